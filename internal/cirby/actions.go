@@ -0,0 +1,49 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// inGitHubActions reports whether cirby runs in a GitHub Actions job
+func inGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// annotate adds an ::error or ::warning annotation for file to the job,
+// shown on the pull request diff. It does nothing outside GitHub Actions.
+func annotate(level, file, message string, opts Options) {
+	if !inGitHubActions() {
+		return
+	}
+	escape := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	property := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	fmt.Fprintf(opts.stdout(), "::%s file=%s,title=cirby::%s\n", level, property.Replace(file), escape.Replace(message))
+}
+
+// writeJobSummary appends Markdown to the job summary page. It does
+// nothing outside GitHub Actions.
+func writeJobSummary(markdown string) error {
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if !inGitHubActions() || path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("writing job summary: %w", err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(markdown + "\n")
+	return err
+}
+
+// diffStat counts the lines added and removed between before and after
+func diffStat(before, after string) (added, removed int) {
+	old, new := splitLines(before), splitLines(after)
+	if before == "" {
+		old = nil
+	}
+	matched := len(lcsMatches(old, new))
+	return len(new) - matched, len(old) - matched
+}
@@ -0,0 +1,182 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// baselineDir keeps the last adopted upstream AGENTS.md and where it came
+// from. It is the common ancestor of the next `cirby adopt` and belongs
+// in version control next to AGENTS.md.
+const baselineDir = ".cirby/baseline"
+
+var (
+	baselineFile   = filepath.Join(baselineDir, "AGENTS.md")
+	baselineSource = filepath.Join(baselineDir, "source")
+)
+
+// Adopt merges an upstream (organization) AGENTS.md into the local one.
+// Changes made upstream since the last adoption are applied with a
+// three-way merge, so local edits survive and only real conflicts are
+// left for the user. Without ref, the previously adopted source is used.
+func Adopt(ref string, opts Options) error {
+	if err := validateOutput(opts.output()); err != nil {
+		return err
+	}
+	agentsPath := opts.output()
+
+	if ref == "" {
+		data, err := os.ReadFile(baselineSource)
+		if err != nil {
+			return fmt.Errorf("no baseline adopted yet; run `cirby adopt <url|file|owner/repo>`")
+		}
+		ref = strings.TrimSpace(string(data))
+	}
+
+	if isNetworkRef(ref) {
+		if err := requireOnline("fetching "+ref, opts); err != nil {
+			return err
+		}
+	}
+	upstream, err := loadTemplate(ref)
+	if err != nil {
+		return err
+	}
+
+	local, err := os.ReadFile(agentsPath)
+	localExists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if hasConflictMarkers(string(local)) {
+		return fmt.Errorf("%s has unresolved conflict markers from a previous adopt; resolve them first", agentsPath)
+	}
+
+	// The stored baseline is only a common ancestor for the same source
+	base, baseErr := os.ReadFile(baselineFile)
+	source, _ := os.ReadFile(baselineSource)
+	hasBase := baseErr == nil && strings.TrimSpace(string(source)) == ref
+
+	var merged []string
+	conflicts := 0
+	switch {
+	case !localExists:
+		merged = splitLines(upstream)
+	case hasBase:
+		merged, conflicts = merge3(splitLines(string(base)), splitLines(string(local)), splitLines(upstream),
+			mergeLabels{Local: agentsPath, Base: "last adopted baseline", Remote: ref})
+	default:
+		// First adoption: no ancestor, so keep everything from both sides
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "No earlier baseline from %s; combining both versions.\n", ref)
+		}
+		merged = mergeUnion(splitLines(string(local)), splitLines(upstream))
+	}
+	if conflicts > 0 && opts.Interactive && !opts.DryRun {
+		merged, conflicts = resolveConflicts(merged, opts)
+	}
+	result := joinLines(merged)
+
+	baselineCurrent := hasBase && string(base) == upstream
+	if localExists && result == string(local) && baselineCurrent {
+		fmt.Fprintf(opts.stdout(), "[ok] %s is up to date with %s\n", agentsPath, ref)
+		return nil
+	}
+
+	if !opts.Force {
+		referenced := map[string]bool{
+			filepath.ToSlash(agentsPath):     true,
+			filepath.ToSlash(baselineFile):   true,
+			filepath.ToSlash(baselineSource): true,
+		}
+		if err := checkGitStatus(referenced, opts); err != nil {
+			return err
+		}
+	}
+
+	added, removed := lineChanges(splitLines(string(local)), merged)
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		fmt.Fprintf(opts.stdout(), "  - Update %s from %s (+%d -%d lines)\n", agentsPath, ref, added, removed)
+		if conflicts > 0 {
+			fmt.Fprintf(opts.stdout(), "  - Leave %d conflicts to resolve\n", conflicts)
+		}
+		fmt.Fprintf(opts.stdout(), "  - Record the adopted version in %s\n", baselineDir)
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	if err := writeFile(agentsPath, []byte(result), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", agentsPath, err)
+	}
+	if err := os.MkdirAll(baselineDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(baselineFile, []byte(upstream), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(baselineSource, []byte(ref+"\n"), 0644); err != nil {
+		return err
+	}
+	entry := historyEntry{Agent: "adopt", AgentsPath: agentsPath, HadAgentsMD: localExists}
+	if err := recordHistory(entry, string(local)); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	if err := stampIntegrity(packageScope{Dir: ".", Output: agentsPath}, lockStamp{Backend: "adopt"}, opts); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(opts.stdout(), "[ok] Adopted %s into %s (+%d -%d lines)\n", ref, agentsPath, added, removed)
+	if conflicts > 0 && opts.Interactive {
+		// The user left these to the agent
+		return resolveWithAgent(agentsPath, conflicts, fmt.Sprintf("%s and the upstream AGENTS.md from %s were both changed since %s was last adopted.", agentsPath, ref, ref), opts)
+	}
+	if conflicts > 0 {
+		return fmt.Errorf("%d conflicts between %s and %s; resolve the %s markers, then commit", conflicts, agentsPath, ref, strings.TrimSpace(conflictStart))
+	}
+	return nil
+}
+
+// lineChanges counts the lines added and removed going from a to b
+func lineChanges(a, b []string) (added, removed int) {
+	common := len(lcsMatches(a, b))
+	return len(b) - common, len(a) - common
+}
+
+// resolveWithAgent has an agent resolve the conflicts left in agentsPath
+func resolveWithAgent(agentsPath string, conflicts int, intro string, opts Options) error {
+	agent, err := selectAgent(opts)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	before := string(content)
+
+	fmt.Fprintf(opts.stdout(), "Resolving %d conflicts in %s with %s...\n", conflicts, agentsPath, agent.Name)
+	prompt := buildConflictPrompt(intro, before, packageScope{Dir: ".", Output: agentsPath})
+	if err := executeAgent(agent, prompt, agentsPath, nil, opts); err != nil {
+		return fmt.Errorf("agent merge failed: %w", err)
+	}
+	content, err = os.ReadFile(agentsPath)
+	if err != nil {
+		return fmt.Errorf("agent did not update %s", agentsPath)
+	}
+	if hasConflictMarkers(string(content)) {
+		return fmt.Errorf("agent left conflict markers in %s; resolve them, then commit", agentsPath)
+	}
+
+	entry := historyEntry{Agent: agent.Name, AgentsPath: agentsPath, HadAgentsMD: true, PromptHash: hashString(prompt), prompt: prompt}
+	if err := recordHistory(entry, before); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	if err := stampIntegrity(packageScope{Dir: ".", Output: agentsPath}, lockStamp{Backend: agent.Name, Model: resolvedModel(agent)}, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Resolved the conflicts in %s\n", agentsPath)
+	return nil
+}
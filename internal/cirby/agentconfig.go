@@ -0,0 +1,190 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// rememberedAgentFile holds the agent chosen at the prompt for this
+// project, so later runs do not ask again
+const rememberedAgentFile = ".cirby/agent"
+
+// promptPlaceholder stands for the merge prompt in overridden arguments
+const promptPlaceholder = "{{prompt}}"
+
+// agentOverride replaces how cirby runs an agent CLI, for when its flags
+// change before cirby catches up, and sets its environment:
+//
+//	agents:
+//	  claude:
+//	    command: /opt/claude/bin/claude
+//	    args: ["-p", "{{prompt}}", "--allowedTools", "Edit,Write,Read"]
+//	    env:
+//	      ANTHROPIC_BASE_URL: https://llm-proxy.example.com
+//	    min_version: 1.0.40                    # warn when the CLI is older
+//	  gemini:
+//	    env:
+//	      GOOGLE_CLOUD_PROJECT: ${GCP_PROJECT}   # expanded from cirby's environment
+type agentOverride struct {
+	Command string
+	Args    []string          // nil keeps the built-in arguments
+	Env     map[string]string // set for the CLI on top of cirby's environment
+
+	MinVersion string // replaces the entry of minVersions
+}
+
+// detectConfig ranks the installed agents for auto-detection, so every
+// machine picks the team's agent rather than the first one found:
+//
+//	detect:
+//	  order: [codex, claude]   # tried first, in this order; the rest follow
+//	  exclude: [cursor]        # never picked unless named on the command line
+//	  versions: fail           # CLIs older than min_version: warn (default), fail or off
+type detectConfig struct {
+	Order    []string
+	Exclude  []string
+	Versions string
+}
+
+// parseAgentOverrides reads the agents: section of .cirby.yaml
+func parseAgentOverrides(v any, path string) (map[string]agentOverride, error) {
+	section, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: agents must map agent names to a command and args", path)
+	}
+	overrides := map[string]agentOverride{}
+	for name, v := range section {
+		agent, ok := findAgent(name)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("%s: agents.%s: unknown agent", path, name)
+		case agent.API != nil || agent.Merge != nil:
+			return nil, fmt.Errorf("%s: agents.%s: only agent CLIs can be overridden", path, name)
+		}
+		fields, _ := v.(map[string]any)
+		o := agentOverride{Command: yamlString(fields["command"]), Args: yamlStrings(fields["args"]), MinVersion: yamlString(fields["min_version"])}
+		if o.MinVersion != "" && parseVersion(o.MinVersion) == nil {
+			return nil, fmt.Errorf("%s: agents.%s.min_version must be a version such as 1.2.0", path, name)
+		}
+		if v, ok := fields["env"]; ok {
+			env, ok := v.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: agents.%s.env must map variable names to values", path, name)
+			}
+			o.Env = map[string]string{}
+			for key, value := range env {
+				o.Env[key] = yamlString(value)
+			}
+		}
+		if o.Args != nil && !strings.Contains(strings.Join(o.Args, " "), promptPlaceholder) {
+			return nil, fmt.Errorf("%s: agents.%s.args must pass the prompt as %s", path, name, promptPlaceholder)
+		}
+		overrides[name] = o
+	}
+	return overrides, nil
+}
+
+func findAgent(name string) (SupportedAgent, bool) {
+	for _, a := range supportedAgents {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return SupportedAgent{}, false
+}
+
+// apply returns a with the command, arguments, environment and minimum
+// version of o
+func (o agentOverride) apply(a SupportedAgent) SupportedAgent {
+	if o.Command != "" {
+		a.Command = o.Command
+	}
+	if len(o.Env) > 0 {
+		a.env = o.Env
+	}
+	if o.MinVersion != "" {
+		a.minVersion = o.MinVersion
+	}
+	if o.Args != nil {
+		// The overridden arguments carry the prompt themselves
+		a.StdinArgs, a.PromptFile = nil, nil
+		args := o.Args
+		a.Args = func(prompt string) []string {
+			out := make([]string, len(args))
+			for i, arg := range args {
+				out[i] = strings.ReplaceAll(arg, promptPlaceholder, prompt)
+			}
+			return out
+		}
+	}
+	return a
+}
+
+// configuredAgents returns the supported agents with the overrides of
+// .cirby.yaml applied, in detection order
+func configuredAgents() ([]SupportedAgent, error) {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	rank := map[string]int{}
+	for i, name := range cfg.Detect.Order {
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+	agents := make([]SupportedAgent, len(supportedAgents))
+	for i, a := range supportedAgents {
+		a.minVersion = minVersions[a.Name]
+		if o, ok := cfg.Agents[a.Name]; ok {
+			a = o.apply(a)
+		}
+		a.skip = slices.Contains(cfg.Detect.Exclude, a.Name)
+		agents[i] = a
+	}
+	sort.SliceStable(agents, func(i, j int) bool {
+		ri, oki := rank[agents[i].Name]
+		rj, okj := rank[agents[j].Name]
+		return oki && (!okj || ri < rj)
+	})
+	return agents, nil
+}
+
+// agentEnv returns the agent's extra environment as KEY=VALUE, with
+// $VAR and ${VAR} in values taken from cirby's own environment
+func agentEnv(a SupportedAgent) []string {
+	keys := make([]string, 0, len(a.env))
+	for key := range a.env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		env = append(env, key+"="+os.ExpandEnv(a.env[key]))
+	}
+	return env
+}
+
+// rememberedAgent returns the name saved in rememberedAgentFile, if any
+func rememberedAgent() string {
+	data, err := os.ReadFile(rememberedAgentFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// rememberAgent saves name as the project's agent
+func rememberAgent(name string) error {
+	if err := os.MkdirAll(filepath.Dir(rememberedAgentFile), 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", filepath.Dir(rememberedAgentFile), err)
+	}
+	if err := os.WriteFile(rememberedAgentFile, []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", rememberedAgentFile, err)
+	}
+	return nil
+}
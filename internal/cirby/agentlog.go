@@ -0,0 +1,145 @@
+package cirby
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the logs: section
+const (
+	defaultLogKeep   = 20
+	defaultLogMaxAge = 30 * 24 * time.Hour
+)
+
+// logsConfig sets how many run logs are kept:
+//
+//	logs:
+//	  keep: 50          # newest logs kept (default 20)
+//	  max_age: 168h     # and none older than this (default 720h)
+//	  enabled: false    # on by default
+type logsConfig struct {
+	Keep     int
+	MaxAge   time.Duration
+	Disabled bool
+}
+
+var runLog struct {
+	sync.Mutex
+	opened bool
+	file   *os.File // nil when disabled or it could not be opened
+	path   string
+}
+
+// agentLog returns the log of this run, opening it and pruning old ones
+// on first use. It returns nil when logging is off.
+func agentLog(opts Options) io.Writer {
+	runLog.Lock()
+	defer runLog.Unlock()
+	if !runLog.opened {
+		runLog.opened = true
+		openAgentLog(opts)
+	}
+	if runLog.file == nil {
+		return nil
+	}
+	return runLog.file
+}
+
+// closeAgentLog closes the log of the run, so the next agent output opens
+// one for the current project root
+func closeAgentLog() {
+	runLog.Lock()
+	defer runLog.Unlock()
+	if runLog.file != nil {
+		runLog.file.Close()
+	}
+	runLog.opened, runLog.file, runLog.path = false, nil, ""
+}
+
+// openAgentLog opens the log in the state directory of projectRoot and
+// prunes old ones
+func openAgentLog(opts Options) {
+	cfg, err := loadProjectConfig()
+	if err != nil || cfg.Logs.Disabled {
+		return
+	}
+	// What agent CLIs printed, one file per cirby run, so a failed
+	// merge in CI leaves something to inspect
+	dir := projectStateDir(projectRoot(), "logs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(opts.stdout(), "[warn] Not logging agent output: %v\n", err)
+		return
+	}
+	// Local state, keep it out of commits
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*\n"), 0644); err != nil {
+		fmt.Fprintf(opts.stdout(), "[warn] Not logging agent output: %v\n", err)
+		return
+	}
+	pruneLogs(dir, cfg.Logs)
+	path := filepath.Join(dir, started.Format("20060102-150405.000000")+".log")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(opts.stdout(), "[warn] Not logging agent output: %v\n", err)
+		return
+	}
+	fmt.Fprintf(f, "cirby %s\n", strings.Join(os.Args[1:], " "))
+	runLog.file, runLog.path = f, path
+}
+
+// pruneLogs removes the logs beyond cfg.Keep and those older than
+// cfg.MaxAge, leaving room for the one about to be written
+func pruneLogs(dir string, cfg logsConfig) {
+	keep, maxAge := cfg.Keep, cfg.MaxAge
+	if keep <= 0 {
+		keep = defaultLogKeep
+	}
+	if maxAge <= 0 {
+		maxAge = defaultLogMaxAge
+	}
+	logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	sort.Strings(logs) // named by start time
+	for i, path := range logs {
+		info, err := os.Stat(path)
+		if len(logs)-i >= keep || err == nil && time.Since(info.ModTime()) > maxAge {
+			os.Remove(path)
+		}
+	}
+}
+
+// teeAgentOutput sends what the CLI prints to the terminal and the run's
+// log, and returns a function to call with the CLI's result
+func teeAgentOutput(stdout, stderr io.Writer, command string, args []string, opts Options) (io.Writer, io.Writer, func(error)) {
+	log := agentLog(opts)
+	if log == nil {
+		return stdout, stderr, func(error) {}
+	}
+	fmt.Fprintf(log, "\n== %s %s %s\n", time.Now().UTC().Format(time.RFC3339), command, strings.Join(logArgs(args), " "))
+	done := func(err error) {
+		if err != nil {
+			fmt.Fprintf(log, "== failed: %v\n", err)
+			fmt.Fprintf(opts.stdout(), "  %s output is in %s\n", command, auditPath(runLog.path))
+		} else {
+			fmt.Fprintln(log, "== done")
+		}
+	}
+	return io.MultiWriter(stdout, log), io.MultiWriter(stderr, log), done
+}
+
+// logArgs shortens the prompt, which is in every argument list that
+// carries it, to keep logs readable
+func logArgs(args []string) []string {
+	out := make([]string, len(args))
+	for i, arg := range args {
+		if len(arg) > 200 {
+			arg = fmt.Sprintf("%s... (%s)", arg[:80], formatBytes(len(arg)))
+		}
+		out[i] = shellQuote(arg)
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package cirby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minVersions are the oldest releases of each agent CLI known to take the
+// arguments cirby passes and answer a prompt without asking anything.
+// .cirby.yaml changes them with agents.NAME.min_version.
+var minVersions = map[string]string{
+	"claude": "1.0.0",  // -p and --allowedTools as non-interactive print mode
+	"gemini": "0.1.0",  // -p
+	"aider":  "0.50.0", // --message with --yes
+}
+
+// versionTimeout bounds `<agent> --version`
+const versionTimeout = 5 * time.Second
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// parseVersion returns the numbers of a version such as 1.0.34 or
+// v0.2.1-beta, nil when s has none
+func parseVersion(s string) []int {
+	m := versionPattern.FindString(s)
+	if m == "" {
+		return nil
+	}
+	var v []int
+	for _, part := range strings.Split(m, ".") {
+		n, _ := strconv.Atoi(part)
+		v = append(v, n)
+	}
+	return v
+}
+
+// olderVersion reports whether version a comes before b
+func olderVersion(a, b []int) bool {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// agentVersion runs `<agent> --version` and returns its output
+func agentVersion(agent SupportedAgent) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, agent.Command, "--version")
+	cmd.Env = append(cmd.Environ(), agentEnv(agent)...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// checkAgentVersion warns, or fails with detect.versions: fail, when the
+// agent CLI is older than its minimum version. Versions that cannot be
+// read are only reported with --verbose.
+func checkAgentVersion(agent SupportedAgent, opts Options) error {
+	if agent.API != nil || agent.Merge != nil || agent.minVersion == "" {
+		return nil
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Detect.Versions == "off" {
+		return nil
+	}
+	out, err := agentVersion(agent)
+	installed := parseVersion(out)
+	if installed == nil {
+		if opts.Verbose {
+			reason := fmt.Sprintf("no version in %q", out)
+			if err != nil {
+				reason = err.Error()
+			}
+			fmt.Fprintf(opts.stdout(), "  [skip] version check of %s (%s --version: %s)\n", agent.Name, agent.Command, reason)
+		}
+		return nil
+	}
+	if !olderVersion(installed, parseVersion(agent.minVersion)) {
+		return nil
+	}
+	msg := fmt.Sprintf("%s %s is older than %s, the oldest version known to merge without prompting; upgrade it, or set agents.%s.min_version in .cirby.yaml",
+		agent.Name, versionPattern.FindString(out), agent.minVersion, agent.Name)
+	if cfg.Detect.Versions == "fail" {
+		return errors.New(msg)
+	}
+	fmt.Fprintf(opts.stdout(), "[warn] %s\n", msg)
+	return nil
+}
@@ -0,0 +1,46 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// aiderConfigFile is aider's per-project settings file
+const aiderConfigFile = ".aider.conf.yml"
+
+// aiderReadFiles returns the instruction files dir's aider config loads
+// through `read:`. Only existing files inside dir are returned: files
+// elsewhere on disk are not part of the project and must not be replaced.
+func aiderReadFiles(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, aiderConfigFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath.Join(dir, aiderConfigFile), err)
+	}
+	settings, _ := doc.(map[string]any)
+
+	var files []string
+	for _, ref := range yamlStrings(settings["read"]) {
+		if ref == "" || filepath.IsAbs(ref) || strings.HasPrefix(ref, "~") {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(ref))
+		if rel, err := filepath.Rel(dir, path); err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
@@ -0,0 +1,321 @@
+package cirby
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultAPITimeout bounds an API merge, including waits for rate limits
+const defaultAPITimeout = 10 * time.Minute
+
+// apiBackend is a model provider's HTTP API, used instead of an agent
+// CLI. The model cannot open files, so the prompt carries their content
+// and the reply is written to the target file by cirby.
+type apiBackend struct {
+	KeyEnv     string // environment variable holding the API key; "" for local servers
+	BaseURLEnv string // optional override of BaseURL
+	BaseURL    string
+	Path       string
+	Model      string
+	ModelEnv   string // optional override of Model
+	Headers    func(key string) map[string]string
+	Body       func(model, prompt string) map[string]any
+	Sampling   map[string]any // added to the body with --reproducible
+	Generate   func(body map[string]any, g generationParams)
+	Reply      func(data []byte) (string, error)
+}
+
+var anthropicAPI = &apiBackend{
+	KeyEnv:     "ANTHROPIC_API_KEY",
+	BaseURLEnv: "ANTHROPIC_BASE_URL",
+	BaseURL:    "https://api.anthropic.com",
+	Path:       "/v1/messages",
+	Model:      "claude-sonnet-4-5",
+	Headers: func(key string) map[string]string {
+		return map[string]string{"x-api-key": key, "anthropic-version": "2023-06-01"}
+	},
+	// Current models reject temperature and top_p together
+	Sampling: map[string]any{"temperature": 0},
+	Generate: func(body map[string]any, g generationParams) {
+		if g.MaxTokens > 0 {
+			body["max_tokens"] = g.MaxTokens
+		}
+		if g.Temperature != nil {
+			body["temperature"] = *g.Temperature
+		}
+		// Thinking counts towards max_tokens, so it gets its budget on top
+		if budget := thinkingBudgets[g.ReasoningEffort]; budget > 0 {
+			body["thinking"] = map[string]any{"type": "enabled", "budget_tokens": budget}
+			body["max_tokens"] = body["max_tokens"].(int) + budget
+		}
+	},
+	Body: func(model, prompt string) map[string]any {
+		return map[string]any{
+			"model":      model,
+			"max_tokens": 16000,
+			"messages":   []map[string]string{{"role": "user", "content": prompt}},
+		}
+	},
+	Reply: func(data []byte) (string, error) {
+		var resp struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return "", err
+		}
+		var text strings.Builder
+		for _, c := range resp.Content {
+			if c.Type == "text" {
+				text.WriteString(c.Text)
+			}
+		}
+		return text.String(), nil
+	},
+}
+
+var openaiAPI = &apiBackend{
+	KeyEnv:     "OPENAI_API_KEY",
+	BaseURLEnv: "OPENAI_BASE_URL",
+	BaseURL:    "https://api.openai.com/v1",
+	Path:       "/chat/completions",
+	Model:      "gpt-5",
+	Headers: func(key string) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + key}
+	},
+	Sampling: map[string]any{"temperature": 0, "top_p": 1, "seed": 0},
+	Generate: func(body map[string]any, g generationParams) {
+		if g.MaxTokens > 0 {
+			body["max_completion_tokens"] = g.MaxTokens
+		}
+		if g.Temperature != nil {
+			body["temperature"] = *g.Temperature
+		}
+		if g.ReasoningEffort != "" {
+			body["reasoning_effort"] = g.ReasoningEffort
+		}
+	},
+	Body: func(model, prompt string) map[string]any {
+		return map[string]any{
+			"model":    model,
+			"messages": []map[string]string{{"role": "user", "content": prompt}},
+		}
+	},
+	Reply: func(data []byte) (string, error) {
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					Content string `json:"content"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", fmt.Errorf("response has no choices")
+		}
+		return resp.Choices[0].Message.Content, nil
+	},
+}
+
+// ollamaAPI is a local Ollama server; it needs no key and, on the
+// default host, no network
+var ollamaAPI = &apiBackend{
+	BaseURLEnv: "OLLAMA_HOST",
+	BaseURL:    "http://127.0.0.1:11434",
+	Path:       "/api/chat",
+	Model:      "llama3.1",
+	ModelEnv:   "OLLAMA_MODEL",
+	Headers:    func(string) map[string]string { return nil },
+	Sampling:   map[string]any{"options": map[string]any{"temperature": 0, "top_p": 1, "seed": 0}},
+	Generate: func(body map[string]any, g generationParams) {
+		options, _ := body["options"].(map[string]any)
+		if options == nil {
+			options = map[string]any{}
+		}
+		if g.MaxTokens > 0 {
+			options["num_predict"] = g.MaxTokens
+		}
+		if g.Temperature != nil {
+			options["temperature"] = *g.Temperature
+		}
+		if len(options) > 0 {
+			body["options"] = options
+		}
+		// Models that think take a level or just true
+		if g.ReasoningEffort != "" {
+			body["think"] = g.ReasoningEffort
+		}
+	},
+	Body: func(model, prompt string) map[string]any {
+		return map[string]any{
+			"model":    model,
+			"stream":   false,
+			"messages": []map[string]string{{"role": "user", "content": prompt}},
+		}
+	},
+	Reply: func(data []byte) (string, error) {
+		var resp struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return "", err
+		}
+		return resp.Message.Content, nil
+	},
+}
+
+func (b *apiBackend) url() string {
+	base := b.BaseURL
+	if env := os.Getenv(b.BaseURLEnv); env != "" {
+		base = env
+	}
+	if !strings.Contains(base, "://") {
+		base = "http://" + base // OLLAMA_HOST is often host:port
+	}
+	return strings.TrimSuffix(base, "/") + b.Path
+}
+
+func (b *apiBackend) model() string {
+	if b.ModelEnv != "" {
+		if env := os.Getenv(b.ModelEnv); env != "" {
+			return env
+		}
+	}
+	return b.Model
+}
+
+// apiPrompt turns an agent prompt into one that needs no file access: the
+// files it refers to are included, and the reply must be the new file
+func apiPrompt(prompt, target string, files []AgentConfig) string {
+	var b strings.Builder
+	b.WriteString(prompt)
+	b.WriteString("\n\nYou cannot read or write files yourself. Their current content follows.\n")
+	if current, err := os.ReadFile(target); err == nil {
+		fmt.Fprintf(&b, "\n--- %s ---\n%s\n", target, strings.TrimRight(stripHeader(string(current)), "\n"))
+	}
+	for _, f := range files {
+		fmt.Fprintf(&b, "\n--- %s ---\n%s\n", f.Path, strings.TrimRight(f.Content, "\n"))
+	}
+	fmt.Fprintf(&b, "\nReply with only the complete new content of %s: no commentary and no surrounding code fence.\n", target)
+	return b.String()
+}
+
+// runAPIBackend sends the prompt to the agent's API and writes the reply
+// to target
+func runAPIBackend(agent SupportedAgent, prompt, target string, files []AgentConfig, opts Options) error {
+	b := agent.API
+	key, _ := apiKey(agent)
+	if key == "" && b.KeyEnv != "" {
+		return fmt.Errorf("%s is not set; run `cirby auth login %s` or export it", b.KeyEnv, agent.Name)
+	}
+	scrub, err := loadScrubber()
+	if err != nil {
+		return err
+	}
+	prompt = apiPrompt(prompt, target, files)
+	if scrub != nil {
+		prompt = scrub.maskPrompt(prompt, opts)
+	}
+	secrets := &secretRedactor{}
+	prompt, err = scrubPrompt(prompt, agent.Name, secrets, opts)
+	if err != nil {
+		return err
+	}
+	model := b.model()
+	if agent.model != "" {
+		model = agent.model
+	}
+	request := b.Body(model, prompt)
+	b.Generate(request, agent.generation)
+	if opts.Reproducible {
+		for k, v := range b.Sampling {
+			nested, ok := v.(map[string]any)
+			current, isMap := request[k].(map[string]any)
+			if !ok || !isMap {
+				request[k] = v
+				continue
+			}
+			for nk, nv := range nested {
+				current[nk] = nv
+			}
+		}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	if err := savePrompt(savedInvocation{Prompt: prompt, Command: []string{http.MethodPost, b.url()}, Body: body}, opts); err != nil {
+		return err
+	}
+
+	client, err := apiHTTPClient(opts)
+	if err != nil {
+		return err
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultAPITimeout
+	}
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, b.url(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range b.Headers(key) {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	}
+	data, err := sendWithRetry(client, agent.Name, newRequest, time.Now().Add(timeout), opts)
+	if err != nil {
+		return err
+	}
+
+	reply, err := b.Reply(data)
+	if err != nil {
+		return fmt.Errorf("parsing %s response: %w", agent.Name, err)
+	}
+	reply = secrets.restore(stripFence(strings.TrimSpace(reply)))
+	if scrub != nil {
+		reply = scrub.unmask(reply)
+	}
+	if reply == "" {
+		return fmt.Errorf("%s returned an empty reply", agent.Name)
+	}
+	return writeMergeResult(target, reply+"\n")
+}
+
+// stripFence removes a code fence around the whole reply
+func stripFence(reply string) string {
+	lines := splitLines(reply)
+	if len(lines) >= 2 && strings.HasPrefix(lines[0], "```") && strings.TrimSpace(lines[len(lines)-1]) == "```" {
+		return strings.TrimSpace(strings.Join(lines[1:len(lines)-1], "\n"))
+	}
+	return reply
+}
+
+// apiError extracts the message of an API error response
+func apiError(data []byte) string {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &resp) == nil && resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,228 @@
+package cirby
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditFile is where every change cirby makes to the project is recorded,
+// one JSON object per line, unless audit.path says otherwise:
+//
+//	audit:
+//	  path: /var/log/cirby/audit.jsonl   # relative paths start from the project root
+//	  enabled: false                     # on by default
+const auditFile = ".cirby/audit.jsonl"
+
+// auditConfig is the audit: section of .cirby.yaml
+type auditConfig struct {
+	Path     string
+	Disabled bool
+}
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time     string   `json:"time"`
+	Op       string   `json:"op"`   // write, restore, delete or symlink
+	Path     string   `json:"path"` // relative to the project root
+	SHA256   string   `json:"sha256,omitempty"`
+	Previous string   `json:"previous_sha256,omitempty"` // of the file that was replaced
+	Target   string   `json:"target,omitempty"`          // symlink target
+	User     string   `json:"user,omitempty"`
+	Args     []string `json:"args"` // of the cirby command
+}
+
+var audit struct {
+	sync.Mutex
+	root     string // project the run changes, see projectRoot
+	resolved bool   // path and err are set
+	path     string // "" when disabled
+	err      error
+}
+
+// setProjectRoot makes dir the project whose audit log and agent logs the
+// following changes go to, as ResolveOptions does with Options.Root before
+// a run. Workspaces and rollouts change directory, but their changes go to
+// the same log.
+func setProjectRoot(dir string) {
+	audit.Lock()
+	audit.root, audit.resolved, audit.path, audit.err = dir, false, "", nil
+	audit.Unlock()
+	closeAgentLog()
+}
+
+// projectRoot is the root set for this run, or else the current directory
+// when the first change is recorded
+func projectRoot() string {
+	audit.Lock()
+	defer audit.Unlock()
+	if audit.root == "" {
+		audit.root, _ = os.Getwd()
+	}
+	return audit.root
+}
+
+// loadAuditConfig reads only the audit: section of the .cirby.yaml in dir;
+// the rest of the project config refers back to the agents, whose merges
+// write through the audit log
+func loadAuditConfig(dir string) (auditConfig, error) {
+	var cfg auditConfig
+	for _, name := range projectConfigFiles {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return cfg, err
+		}
+		parsed, err := parseYAML(data)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		doc, _ := parsed.(map[string]any)
+		if a, ok := doc["audit"].(map[string]any); ok {
+			cfg.Path = yamlString(a["path"])
+			if enabled, set := yamlBool(a["enabled"]); set {
+				cfg.Disabled = !enabled
+			}
+		}
+		break
+	}
+	return cfg, nil
+}
+
+// auditLogPath resolves the log from the .cirby.yaml of projectRoot, once
+// per root
+func auditLogPath() (string, error) {
+	root := projectRoot()
+	audit.Lock()
+	defer audit.Unlock()
+	if audit.resolved {
+		return audit.path, audit.err
+	}
+	audit.resolved = true
+	cfg, err := loadAuditConfig(root)
+	if err != nil {
+		audit.err = err
+		return "", err
+	}
+	if cfg.Disabled {
+		return "", nil
+	}
+	audit.path = filepath.Join(root, auditFile)
+	if filepath.IsAbs(cfg.Path) {
+		audit.path = cfg.Path
+	} else if cfg.Path != "" {
+		audit.path = filepath.Join(root, cfg.Path)
+	}
+	return audit.path, nil
+}
+
+// recordAudit appends a change of path to the audit log. previous is the
+// hash of what path held before, "" if nothing.
+func recordAudit(op, path string, data []byte, previous, target string) error {
+	log, err := auditLogPath()
+	if err != nil || log == "" {
+		return err
+	}
+	entry := auditEntry{Time: time.Now().UTC().Format(time.RFC3339Nano), Op: op, Path: auditPath(path), Previous: previous, Target: target, User: envOr("USER", os.Getenv("USERNAME")), Args: os.Args[1:]}
+	if op == "write" || op == "restore" {
+		entry.SHA256 = hashString(string(data))
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	audit.Lock()
+	defer audit.Unlock()
+	if err := os.MkdirAll(filepath.Dir(log), 0755); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	f, err := os.OpenFile(log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing audit log: %w", err)
+	}
+	return nil
+}
+
+// auditPath is path relative to projectRoot, or absolute outside it
+func auditPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	if rel, err := filepath.Rel(projectRoot(), abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(abs)
+}
+
+// previousHash is the hash of the regular file at path, "" if there is none
+func previousHash(path string) string {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return hashString(string(data))
+}
+
+// writeFile is os.WriteFile for files of the project, recorded in the
+// audit log
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	previous := previousHash(path)
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	return recordAudit("write", path, data, previous, "")
+}
+
+// restoreFile writes back content cirby replaced earlier, as undo does
+func restoreFile(path string, data []byte, perm os.FileMode) error {
+	previous := previousHash(path)
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	return recordAudit("restore", path, data, previous, "")
+}
+
+// removeFile is os.Remove, recorded in the audit log
+func removeFile(path string) error {
+	previous := previousHash(path)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	return recordAudit("delete", path, nil, previous, "")
+}
+
+// removeAll is os.RemoveAll, recorded in the audit log when path existed
+func removeAll(path string) error {
+	if _, err := os.Lstat(path); err != nil {
+		return nil
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return recordAudit("delete", path, nil, "", "")
+}
+
+// symlinkFile is os.Symlink, recorded in the audit log
+func symlinkFile(target, path string) error {
+	if err := os.Symlink(target, path); err != nil {
+		return err
+	}
+	return recordAudit("symlink", path, nil, "", target)
+}
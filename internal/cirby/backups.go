@@ -0,0 +1,213 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The backups are the runs recorded for undo: each keeps AGENTS.md as it
+// was before the run and every file the run replaced with a link.
+
+// backupsConfig sets which recorded runs are kept; without it all are:
+//
+//	backups:
+//	  keep: 50        # newest runs kept
+//	  max_age: 720h   # and none older than this
+type backupsConfig struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+// expired returns the entries, oldest first, that cfg no longer keeps.
+// The newest run is always kept so the last merge can be undone.
+func (cfg backupsConfig) expired(entries []historyEntry) []historyEntry {
+	var old []historyEntry
+	for i, e := range entries[:max(len(entries)-1, 0)] {
+		if cfg.Keep > 0 && len(entries)-i > cfg.Keep || cfg.MaxAge > 0 && time.Since(e.Time) > cfg.MaxAge {
+			old = append(old, e)
+		}
+	}
+	return old
+}
+
+// pruneHistory removes the runs beyond the backups: policy after a new
+// one was recorded
+func pruneHistory() error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	for _, e := range cfg.Backups.expired(entries) {
+		if err := os.RemoveAll(filepath.Join(historyDir(), e.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backups lists the recorded runs and the files each can restore, prunes
+// them by the backups: policy, or restores files from one of them
+func Backups(action string, args []string, opts Options) error {
+	switch action {
+	case "", "list":
+		return listBackups(opts)
+	case "prune":
+		return pruneBackups(opts)
+	case "restore":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: cirby backups restore <id> [path...]")
+		}
+		return restoreBackup(args[0], args[1:], opts)
+	}
+	return fmt.Errorf("unknown backups action: %s (use list, prune or restore)", action)
+}
+
+// backupFiles are the paths a run can restore, AGENTS.md first
+func backupFiles(e historyEntry) []string {
+	var paths []string
+	if e.HadAgentsMD {
+		paths = append(paths, e.AgentsPath)
+	}
+	for _, in := range e.Inputs {
+		if !in.Setting {
+			paths = append(paths, in.Path)
+		}
+	}
+	return paths
+}
+
+func listBackups(opts Options) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(opts.stdout(), "No backups.")
+		return nil
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		fmt.Fprintf(opts.stdout(), "%s  %s  %s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04"), formatBytes(dirSize(filepath.Join(historyDir(), e.ID))))
+		files := backupFiles(e)
+		if len(files) == 0 {
+			fmt.Fprintf(opts.stdout(), "    (nothing to restore; %s was new)\n", e.AgentsPath)
+		}
+		for _, path := range files {
+			fmt.Fprintf(opts.stdout(), "    %s\n", path)
+		}
+	}
+	fmt.Fprintf(opts.stdout(), "\n%d backups in %s\n", len(entries), historyDir())
+	return nil
+}
+
+func pruneBackups(opts Options) error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Backups.Keep == 0 && cfg.Backups.MaxAge == 0 {
+		return fmt.Errorf("no retention policy: set backups.keep or backups.max_age in .cirby.yaml")
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	old := cfg.Backups.expired(entries)
+	if len(old) == 0 {
+		fmt.Fprintln(opts.stdout(), "[ok] Nothing to prune.")
+		return nil
+	}
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		for _, e := range old {
+			fmt.Fprintf(opts.stdout(), "  - Remove backup %s\n", e.ID)
+		}
+		return nil
+	}
+	for _, e := range old {
+		if err := os.RemoveAll(filepath.Join(historyDir(), e.ID)); err != nil {
+			return err
+		}
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  - Removed backup %s\n", e.ID)
+		}
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Removed %d of %d backups\n", len(old), len(entries))
+	return nil
+}
+
+// restoreBackup writes back files as they were before run id, all of them
+// or only paths. Unlike undo it leaves the history alone.
+func restoreBackup(id string, paths []string, opts Options) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	var matched []historyEntry
+	for _, e := range entries {
+		if strings.HasPrefix(e.ID, id) {
+			matched = append(matched, e)
+		}
+	}
+	switch {
+	case len(matched) == 0:
+		return fmt.Errorf("no backup %s (see cirby backups list)", id)
+	case len(matched) > 1:
+		return fmt.Errorf("%s matches %d backups; give more of the id", id, len(matched))
+	}
+	e := matched[0]
+
+	files := backupFiles(e)
+	if len(paths) == 0 {
+		paths = files
+	}
+	for i, path := range paths {
+		paths[i] = filepath.Clean(path)
+		if !slices.Contains(files, paths[i]) {
+			if paths[i] == e.AgentsPath {
+				return fmt.Errorf("%s did not exist before run %s", path, e.ID)
+			}
+			return fmt.Errorf("backup %s has no %s (it has: %s)", e.ID, path, strings.Join(files, ", "))
+		}
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("backup %s has nothing to restore; %s was new", e.ID, e.AgentsPath)
+	}
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		for _, path := range paths {
+			fmt.Fprintf(opts.stdout(), "  - Restore %s from backup %s\n", path, e.ID)
+		}
+		return nil
+	}
+	for _, path := range paths {
+		if path == e.AgentsPath && e.HadAgentsMD {
+			before, err := os.ReadFile(filepath.Join(historyDir(), e.ID, "before.md"))
+			if err != nil {
+				return err
+			}
+			if err := restoreFile(path, before, 0644); err != nil {
+				return err
+			}
+			if err := restampIntegrity(path, opts); err != nil {
+				return err
+			}
+		} else {
+			i := slices.IndexFunc(e.Inputs, func(in historyInput) bool { return in.Path == path })
+			if err := restoreInput(e.Inputs[i]); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Restored %s from backup %s\n", path, e.ID)
+	}
+	return nil
+}
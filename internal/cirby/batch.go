@@ -0,0 +1,142 @@
+package cirby
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Report formats of --report for merges over several targets
+var batchReportFiles = map[string]string{
+	"json":     "cirby-report.json",
+	"markdown": "cirby-report.md",
+}
+
+// Outcomes of one target of a merge
+const (
+	outcomeMerged   = "merged"
+	outcomeWould    = "would merge" // --dry-run
+	outcomeUpToDate = "up-to-date"
+	outcomeDrifted  = "drifted" // nothing to merge, but edited outside cirby
+	outcomeFailed   = "failed"
+)
+
+// targetResult is what a run did to one canonical file
+type targetResult struct {
+	Target  string `json:"target"`
+	Outcome string `json:"outcome"`
+	Linked  int    `json:"linked"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	Drifted bool   `json:"drifted,omitempty"` // edited outside cirby before this run
+	Error   string `json:"error,omitempty"`
+}
+
+// drifted reports whether agentsPath, with content before, was edited
+// since cirby last wrote it
+func drifted(agentsPath, before string) bool {
+	lock, err := loadLock()
+	if err != nil {
+		return false
+	}
+	entry, ok := lock.Agents[filepath.ToSlash(agentsPath)]
+	return ok && before != "" && entry.SHA256 != hashString(before)
+}
+
+// outcome sets the result's outcome from what runScope did
+func (r *targetResult) outcome(err error, before, after string, opts Options) {
+	switch {
+	case err != nil:
+		r.Outcome = outcomeFailed
+		r.Error = err.Error()
+	case r.Linked > 0 || before != after:
+		r.Outcome = outcomeMerged
+		r.Added, r.Removed = diffStat(before, after)
+	case r.Drifted:
+		r.Outcome = outcomeDrifted
+	default:
+		r.Outcome = outcomeUpToDate
+	}
+	if opts.DryRun && r.Outcome == outcomeMerged {
+		r.Outcome = outcomeWould
+	}
+}
+
+// batchTable renders results as a Markdown table, for the terminal and
+// for pasting into an issue
+func batchTable(results []targetResult, style termStyle) string {
+	var b strings.Builder
+	b.WriteString("| Target | Outcome | Files linked | Lines | Notes |\n|--------|---------|-------------:|------:|-------|\n")
+	for _, r := range results {
+		lines := ""
+		if r.Added > 0 || r.Removed > 0 {
+			lines = fmt.Sprintf("+%d %s%d", r.Added, style.glyph("−", "-"), r.Removed)
+		}
+		notes := r.Error
+		if r.Drifted && r.Outcome != outcomeDrifted {
+			notes = strings.TrimPrefix(notes+"; edited outside cirby before this run", "; ")
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %d | %s | %s |\n", r.Target, r.Outcome, r.Linked, lines, strings.ReplaceAll(notes, "|", `\|`))
+	}
+	return b.String()
+}
+
+// batchSummary counts results by outcome, e.g. "2 merged, 1 failed"
+func batchSummary(results []targetResult) string {
+	counts := map[string]int{}
+	var order []string
+	for _, r := range results {
+		if counts[r.Outcome] == 0 {
+			order = append(order, r.Outcome)
+		}
+		counts[r.Outcome]++
+	}
+	parts := make([]string, len(order))
+	for i, outcome := range order {
+		parts[i] = fmt.Sprintf("%d %s", counts[outcome], outcome)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// finishBatch shows the results of command over several targets, writes
+// the --report file, and sends the notification and metrics. It fails when
+// any target failed.
+func finishBatch(command string, results []targetResult, opts Options) error {
+	if len(results) > 1 {
+		fmt.Fprintf(opts.stdout(), "\nSummary (%s):\n\n%s", batchSummary(results), batchTable(results, styleFor(opts.stdout(), opts)))
+	}
+	if opts.Report != "" {
+		format, file, err := parseReport(opts.Report, batchReportFiles)
+		if err != nil {
+			return err
+		}
+		var data []byte
+		if format == "json" {
+			data, err = json.MarshalIndent(results, "", "  ")
+			data = append(data, '\n')
+		} else {
+			data = []byte(fmt.Sprintf("### %s\n\n%s\n\n%s", command, batchSummary(results), batchTable(results, termStyle{})))
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Wrote %s report to %s\n", format, file)
+	}
+	notifyTargets(command, results, opts)
+	recordTargets(command, results, opts)
+	failed := 0
+	for _, r := range results {
+		if r.Outcome == outcomeFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d targets failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// benchDir holds the synthetic sources of cirby bench and each agent's result
+const benchDir = ".cirby/bench"
+
+// benchSources are the files every agent merges in cirby bench: three
+// tools' instructions that overlap and disagree the way real ones do
+var benchSources = []AgentConfig{
+	{Path: "CLAUDE.md", Agent: "Claude Code", Content: `# Project Instructions
+
+## Build
+- Run ` + "`make build`" + ` to compile
+- Run ` + "`make test`" + ` before every commit
+
+## Style
+- Use tabs for indentation
+- Keep functions under 50 lines
+- Wrap errors with context
+`},
+	{Path: "GEMINI.md", Agent: "Gemini CLI", Content: `# Gemini Guidelines
+
+## Testing
+- Run ` + "`make test`" + ` before every commit
+- New features need table-driven tests
+
+## Code Style
+- Indent with tabs
+- Prefer small functions
+`},
+	{Path: ".cursorrules", Agent: "Cursor", Content: `Always wrap returned errors with context.
+Never commit secrets or .env files.
+Document exported functions with a one-line comment.
+`},
+}
+
+// benchResult is one agent's run of the benchmark
+type benchResult struct {
+	agent    string
+	elapsed  time.Duration
+	estimate mergeEstimate
+	score    qualityScore
+}
+
+// Bench runs the same synthetic merge with each of agents, or with every
+// available one, and reports how long each took, its tokens and cost, and
+// how well it merged. The project's own files are left alone.
+func Bench(agents []string, opts Options) error {
+	if len(agents) == 0 {
+		available, err := configuredAgents()
+		if err != nil {
+			return err
+		}
+		for _, a := range available {
+			if a.installed() && checkOffline(a, opts) == nil {
+				agents = append(agents, a.Name)
+			}
+		}
+	}
+
+	var sources []AgentConfig
+	for _, src := range benchSources {
+		src.Path = filepath.Join(benchDir, src.Path)
+		sources = append(sources, src)
+	}
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		fmt.Fprintf(opts.stdout(), "  - Write %d synthetic sources to %s\n", len(sources), benchDir)
+		fmt.Fprintf(opts.stdout(), "  - Merge them with each of: %s\n", strings.Join(agents, ", "))
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+	if err := os.MkdirAll(benchDir, 0755); err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if err := os.WriteFile(src.Path, []byte(src.Content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", src.Path, err)
+		}
+	}
+
+	var results []benchResult
+	for i, name := range agents {
+		agentOpts := opts
+		agentOpts.Agent = name
+		agent, err := selectAgent(agentOpts)
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s: %v\n", name, err)
+			continue
+		}
+		target := packageScope{Dir: ".", Output: filepath.Join(benchDir, agent.Name+".md")}
+		path := target.agentsPath()
+		os.Remove(path)
+		prompt := buildMergePrompt(sources, target, "")
+		est := estimateMerge(agent, prompt, sources)
+		if err := checkMaxCost(est, agent, opts); err != nil {
+			fmt.Fprintf(opts.stdout(), "[skip] %s: %v\n", agent.Name, err)
+			continue
+		}
+
+		fmt.Fprintf(opts.stdout(), "[%d/%d] Merging with %s...\n", i+1, len(agents), agent.Name)
+		start := time.Now()
+		err = executeAgent(agent, prompt, path, sources, agentOpts)
+		elapsed := time.Since(start)
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s: %v\n", agent.Name, err)
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s did not write %s\n", agent.Name, path)
+			continue
+		}
+		// The input is what was sent; the output is what actually came back
+		est = priceEstimate(agent, est.InputTokens, estimateTokens(string(content)))
+		results = append(results, benchResult{agent.Name, elapsed, est, scoreMerge(sources, string(content))})
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("no agent completed the benchmark")
+	}
+
+	fmt.Fprintf(opts.stdout(), "\n%-10s %9s %10s %10s %9s %8s\n", "Agent", "Time", "Tokens in", "Tokens out", "Cost", "Quality")
+	for _, r := range results {
+		cost := "unknown"
+		if r.estimate.Known {
+			cost = formatCost(r.estimate.Cost)
+		}
+		fmt.Fprintf(opts.stdout(), "%-10s %9s %10s %10s %9s %4d/100\n", r.agent, r.elapsed.Round(100*time.Millisecond),
+			"~"+formatCount(r.estimate.InputTokens), "~"+formatCount(r.estimate.OutputTokens), cost, r.score.Score)
+	}
+	fmt.Fprintf(opts.stdout(), "\nTokens are estimated from the prompt and the result. Results are in %s.\n", benchDir)
+	return nil
+}
@@ -0,0 +1,133 @@
+package cirby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mergeCacheVersion is part of every key; bump it when prompts change in a
+// way that makes earlier results unsuitable
+const mergeCacheVersion = "1"
+
+// mergeCacheDir is where merged results are kept, shared by all projects
+func mergeCacheDir() (string, error) {
+	root, err := stateRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "merges"), nil
+}
+
+// mergeCacheKey hashes everything that determines a merge result: the
+// target file, the existing AGENTS.md, the inherited parent, every source
+// path and content, the --template content, the merge pipeline and the
+// settings of the agent that merges, from mergeSettings.
+func mergeCacheKey(scope packageScope, existing string, existed bool, sources []AgentConfig, template string, pipeline []pipelinePass, settings string) string {
+	h := sha256.New()
+	field := func(s string) {
+		fmt.Fprintf(h, "%d:", len(s))
+		io.WriteString(h, s)
+	}
+
+	field(mergeCacheVersion)
+	field(scope.agentsPath())
+	if existed {
+		field("existing")
+		field(existing)
+	} else {
+		field("new")
+	}
+	field(scope.Parent)
+	if scope.Parent != "" {
+		parent, _ := os.ReadFile(scope.Parent)
+		field(string(parent))
+	}
+	for _, cfg := range sources {
+		field(cfg.Path)
+		field(cfg.Content)
+	}
+	field(template)
+	for _, p := range pipeline {
+		field(fmt.Sprintf("%+v", p))
+	}
+	field(settings)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// mergeSettings describes what decides how agent merges, and what the
+// cached result went through afterwards: the agent, its model and
+// generation parameters, the command, arguments and environment it runs
+// with, the scrub rules, and the dedup, condense and quality settings
+func mergeSettings(agent SupportedAgent, project projectConfig, opts Options) string {
+	temperature := "default"
+	if t := agent.generation.Temperature; t != nil {
+		temperature = strconv.FormatFloat(*t, 'g', -1, 64)
+	}
+	var args []string
+	if agent.Args != nil {
+		args = agent.Args(promptPlaceholder)
+	}
+	scrub := make([]string, len(project.Scrub))
+	for i, re := range project.Scrub {
+		scrub[i] = re.String()
+	}
+	return strings.Join([]string{
+		"agent=" + agent.Name,
+		"command=" + agent.Command,
+		fmt.Sprintf("args=%q %q", args, opts.AgentArgs),
+		fmt.Sprintf("env=%q", agentEnv(agent)),
+		fmt.Sprintf("scrub=%q", scrub),
+		"model=" + resolvedModel(agent),
+		"temperature=" + temperature,
+		"max_tokens=" + strconv.Itoa(agent.generation.MaxTokens),
+		"effort=" + agent.generation.ReasoningEffort,
+		"reproducible=" + strconv.FormatBool(opts.Reproducible),
+		fmt.Sprintf("dedup=%t %+v", opts.Dedup || project.Dedup.Enabled, project.Dedup),
+		"max_length=" + opts.MaxLength,
+		"strict=" + strconv.FormatBool(opts.Strict),
+		"min_score=" + strconv.Itoa(project.MinScore),
+	}, "\n")
+}
+
+// loadCachedMerge returns a previous result for key, if any
+func loadCachedMerge(key string) (string, bool) {
+	dir, err := mergeCacheDir()
+	if err != nil {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key+".md"))
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// storeCachedMerge saves result under key
+func storeCachedMerge(key, result string) error {
+	dir, err := mergeCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".merge-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(result); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, key+".md"))
+}
@@ -0,0 +1,30 @@
+package cirby
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestMergeSettings(t *testing.T) {
+	agent, _ := findAgent("claude")
+	base := mergeSettings(agent, projectConfig{}, Options{})
+	tests := []struct {
+		name    string
+		agent   SupportedAgent
+		project projectConfig
+		opts    Options
+	}{
+		{name: "agent arguments", agent: agent, opts: Options{AgentArgs: []string{"--model", "opus"}}},
+		{name: "agent env", agent: agentOverride{Env: map[string]string{"ANTHROPIC_BASE_URL": "https://proxy"}}.apply(agent)},
+		{name: "agent command", agent: agentOverride{Command: "claude-next"}.apply(agent)},
+		{name: "agent args", agent: agentOverride{Args: []string{"--print", promptPlaceholder}}.apply(agent)},
+		{name: "scrub rules", agent: agent, project: projectConfig{Scrub: []*regexp.Regexp{regexp.MustCompile(`acme`)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mergeSettings(tt.agent, tt.project, tt.opts) == base {
+				t.Errorf("settings do not change with the %s", tt.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// On macOS and Windows file names are case-insensitive by default:
+// CLAUDE.md and Claude.md, or AGENTS.md and agents.md, are one file, and
+// a glob for CLAUDE.md returns it under the pattern's spelling. Elsewhere
+// they are two files that collide as soon as the repository is checked
+// out on such a system.
+
+// onDiskName returns path with its last element spelled as it is in the
+// directory, when the file system matched it regardless of case
+func onDiskName(path string) string {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return path
+	}
+	for _, e := range entries {
+		if e.Name() == base {
+			return path
+		}
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), base) {
+			return filepath.Join(dir, e.Name())
+		}
+	}
+	return path
+}
+
+// caseTwins lists the other files in path's directory whose names differ
+// from its own only in case, which a case-sensitive file system allows
+func caseTwins(path string) []string {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil
+	}
+	var twins []string
+	for _, e := range entries {
+		if e.Name() != base && strings.EqualFold(e.Name(), base) {
+			twins = append(twins, filepath.Join(dir, e.Name()))
+		}
+	}
+	return twins
+}
+
+// warnCaseTwins warns about sources and canonical files that only differ
+// from another file in case, once per pair
+func warnCaseTwins(configs []AgentConfig, opts Options) {
+	warned := map[string]bool{}
+	for _, cfg := range configs {
+		for _, twin := range caseTwins(cfg.Path) {
+			key := strings.ToLower(cfg.Path)
+			if warned[key] {
+				continue
+			}
+			warned[key] = true
+			fmt.Fprintf(opts.stdout(), "[warn] %s and %s differ only in case; on macOS and Windows they are one file, so keep only one\n", cfg.Path, twin)
+		}
+	}
+}
+
+// sameFile reports whether a and b are one file under two names. A
+// symlink is not the file it points to.
+func sameFile(a, b string) bool {
+	ia, err := os.Lstat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Lstat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
+
+// dropSameFiles removes configs found twice under names that only differ
+// in case, keeping the canonical file, or else the first
+func dropSameFiles(configs []AgentConfig, opts Options) []AgentConfig {
+	kept := configs[:0]
+	for _, cfg := range configs {
+		dup := -1
+		for i, k := range kept {
+			if k.Path != cfg.Path && sameFile(k.Path, cfg.Path) {
+				dup = i
+				break
+			}
+		}
+		switch {
+		case dup < 0:
+			kept = append(kept, cfg)
+		case cfg.Agent == "AGENTS.md":
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [skip] %s (the same file as %s)\n", kept[dup].Path, cfg.Path)
+			}
+			kept[dup] = cfg
+		default:
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [skip] %s (the same file as %s)\n", cfg.Path, kept[dup].Path)
+			}
+		}
+	}
+	return kept
+}
+
+// errSameFile refuses to replace a file with a link to itself, which would
+// delete it
+func errSameFile(path, target string) error {
+	return fmt.Errorf("%s is %s under another name (the file system ignores case); not replacing it", path, target)
+}
@@ -0,0 +1,92 @@
+package cirby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Cassette modes for --cassette-mode
+const (
+	cassetteAuto   = "auto"   // replay what was recorded, record the rest (default)
+	cassetteRecord = "record" // always run the agent, recording over what is there
+	cassetteReplay = "replay" // never run the agent; fail on anything not recorded
+)
+
+// cassetteKey names a recording: the same backend, model, prompt, sources
+// and starting target give the same key. The generated-by header of the
+// target is left out, its date changes every day.
+func cassetteKey(agent SupportedAgent, prompt, target string, files []AgentConfig) string {
+	h := sha256.New()
+	field := func(s string) {
+		fmt.Fprintf(h, "%d:", len(s))
+		io.WriteString(h, s)
+	}
+
+	field(agent.Name)
+	field(agent.model)
+	field(prompt)
+	field(target)
+	if data, err := os.ReadFile(target); err == nil {
+		field(stripHeader(string(data)))
+	} else {
+		field("new")
+	}
+	for _, f := range files {
+		field(f.Path)
+		field(f.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// runCassette replays the result the agent gave for the same prompt from
+// opts.Cassette, or runs the agent and records it there as
+// <backend>/<key>.prompt.md and <backend>/<key>.md, so tests can exercise
+// the whole merge flow without live agent calls
+func runCassette(agent SupportedAgent, prompt, target string, files []AgentConfig, opts Options) error {
+	key := cassetteKey(agent, prompt, target, files)
+	dir := filepath.Join(opts.Cassette, agent.Name)
+	recording := filepath.Join(dir, key+".md")
+
+	if opts.CassetteMode != cassetteRecord {
+		result, err := os.ReadFile(recording)
+		if err == nil {
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  - Replaying %s\n", recording)
+			}
+			return writeMergeResult(target, string(result))
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		if opts.CassetteMode == cassetteReplay {
+			return fmt.Errorf("no recording of this %s prompt in %s (%s); record one with --cassette-mode record", agent.Name, opts.Cassette, key)
+		}
+	}
+
+	recordOpts := opts
+	recordOpts.Cassette = ""
+	if err := executeAgent(agent, prompt, target, files, recordOpts); err != nil {
+		return err
+	}
+	result, err := os.ReadFile(target)
+	if err != nil {
+		return fmt.Errorf("%s did not write %s", agent.Name, target)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, key+".prompt.md"), []byte(prompt), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(recording, []byte(stripHeader(string(result))), 0644); err != nil {
+		return err
+	}
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  - Recorded %s\n", recording)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package cirby
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCassetteKey(t *testing.T) {
+	files := []AgentConfig{{Path: "CLAUDE.md", Content: "Use tabs.\n"}}
+	base := cassetteKey(SupportedAgent{Name: "claude"}, "merge", "AGENTS.md", files)
+	tests := []struct {
+		name   string
+		agent  SupportedAgent
+		prompt string
+		target string
+		files  []AgentConfig
+		same   bool
+	}{
+		{"same inputs", SupportedAgent{Name: "claude"}, "merge", "AGENTS.md", files, true},
+		{"other backend", SupportedAgent{Name: "gemini"}, "merge", "AGENTS.md", files, false},
+		{"other model", SupportedAgent{Name: "claude", model: "opus"}, "merge", "AGENTS.md", files, false},
+		{"other prompt", SupportedAgent{Name: "claude"}, "merge again", "AGENTS.md", files, false},
+		{"other target", SupportedAgent{Name: "claude"}, "merge", "docs/AGENTS.md", files, false},
+		{"other content", SupportedAgent{Name: "claude"}, "merge", "AGENTS.md", []AgentConfig{{Path: "CLAUDE.md", Content: "Use spaces.\n"}}, false},
+		{"other path", SupportedAgent{Name: "claude"}, "merge", "AGENTS.md", []AgentConfig{{Path: "GEMINI.md", Content: "Use tabs.\n"}}, false},
+		// Fields are length-prefixed, so moving text between them changes the key
+		{"shifted fields", SupportedAgent{Name: "claud"}, "emerge", "AGENTS.md", files, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testProject(t, nil)
+			key := cassetteKey(tt.agent, tt.prompt, tt.target, tt.files)
+			if (key == base) != tt.same {
+				t.Errorf("cassetteKey = %s, base %s; want same = %v", key, base, tt.same)
+			}
+		})
+	}
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	cassette := t.TempDir()
+	files := map[string]string{
+		"CLAUDE.md": "# Claude\n\nUse tabs.\n",
+		"GEMINI.md": "Be brief.\n",
+	}
+	run := func(mode string) (string, error) {
+		var out bytes.Buffer
+		opts := testOptions(mockAgent, &out)
+		opts.Cassette, opts.CassetteMode = cassette, mode
+		if err := Run(opts); err != nil {
+			return out.String(), err
+		}
+		return readAgentsMD(t), nil
+	}
+
+	// Recorded in one project
+	testProject(t, files)
+	recorded, err := run(cassetteAuto)
+	if err != nil {
+		t.Fatalf("recording: %v\n%s", err, recorded)
+	}
+	recordings, _ := filepath.Glob(filepath.Join(cassette, mockAgent, "*.md"))
+	if len(recordings) != 2 {
+		t.Fatalf("recordings = %q, want a result and its prompt", recordings)
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		mode    string
+		fail    bool // the agent fails if it runs
+		wantErr string
+	}{
+		{name: "replayed without running the agent", files: files, mode: cassetteReplay, fail: true},
+		{name: "auto mode replays too", files: files, mode: cassetteAuto, fail: true},
+		{name: "record mode always runs the agent", files: files, mode: cassetteRecord, fail: true, wantErr: "mock failure"},
+		{
+			name:    "new inputs are not recorded",
+			files:   map[string]string{"CLAUDE.md": "# Claude\n\nUse spaces.\n", "GEMINI.md": "Be brief.\n"},
+			mode:    cassetteReplay,
+			wantErr: "no recording of this mock prompt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testProject(t, tt.files)
+			if tt.fail {
+				t.Setenv(mockFailEnv, "the cassette should have been used")
+			}
+			got, err := run(tt.mode)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Run error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: %v\n%s", err, got)
+			}
+			if got != recorded {
+				t.Errorf("replayed AGENTS.md =\n%s\nwant the recorded\n%s", got, recorded)
+			}
+			if !isSymlinkToAgentsMD("CLAUDE.md", "AGENTS.md") {
+				t.Errorf("CLAUDE.md is not linked after a replay")
+			}
+		})
+	}
+}
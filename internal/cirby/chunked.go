@@ -0,0 +1,109 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// batchBudget is the share of the context window a batch of sources may
+// fill. The rest is left for the growing AGENTS.md, which is inlined in
+// every prompt, and for the agent's output.
+const batchBudget = 0.5
+
+// planBatches splits files into batches that each fit the agent's context
+// next to a prompt of overhead tokens, keeping their order. It returns nil
+// when everything fits at once or the context size is unknown.
+func planBatches(agent SupportedAgent, files []AgentConfig, overhead int) ([][]AgentConfig, error) {
+	info, _ := agentModel(agent)
+	if info.ContextTokens == 0 || len(files) < 2 {
+		return nil, nil
+	}
+	total := overhead
+	for _, f := range files {
+		total += estimateTokens(f.Content)
+	}
+	if total <= info.ContextTokens {
+		return nil, nil
+	}
+
+	budget := int(float64(info.ContextTokens)*batchBudget) - overhead
+	if budget <= 0 {
+		return nil, fmt.Errorf("the prompt alone (~%s tokens) leaves no room for sources in %s's ~%s token context window",
+			formatCount(overhead), agent.Name, formatCount(info.ContextTokens))
+	}
+	var batches [][]AgentConfig
+	var batch []AgentConfig
+	size := 0
+	for _, f := range files {
+		tokens := estimateTokens(f.Content)
+		if len(batch) > 0 && size+tokens > budget {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+		batch = append(batch, f)
+		size += tokens
+	}
+	return append(batches, batch), nil
+}
+
+// batchTokens is the estimated size of the sources in batch
+func batchTokens(batch []AgentConfig) int {
+	n := 0
+	for _, f := range batch {
+		n += estimateTokens(f.Content)
+	}
+	return n
+}
+
+// mergeInBatches folds batches of sources into AGENTS.md one at a time:
+// the first batch creates or updates it, and every later one is merged into
+// the result of the previous
+func mergeInBatches(scope packageScope, agent SupportedAgent, batches [][]AgentConfig, agentsMDExists bool, opts Options) (agentMerge, error) {
+	agentsPath := scope.agentsPath()
+	var prompts []string
+	for i, batch := range batches {
+		current, err := os.ReadFile(agentsPath)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			return agentMerge{}, err
+		}
+
+		var prompt string
+		if exists {
+			prompt = buildMergeIntoExistingPrompt(stripHeader(string(current)), batch, scope, opts.template)
+		} else {
+			prompt = buildMergePrompt(batch, scope, opts.template)
+		}
+		est := estimateMerge(agent, prompt, batch)
+		fmt.Fprintf(opts.stdout(), "[%d/%d] Merging %d files (~%s tokens) into %s with %s...\n",
+			i+1, len(batches), len(batch), formatCount(batchTokens(batch)), agentsPath, agent.Name)
+		if est.Known && est.InputTokens > est.Model.ContextTokens {
+			if len(batch) == 1 {
+				fmt.Fprintf(opts.stdout(), "  [warn] %s alone exceeds %s's ~%s token context window\n", batch[0].Path, agent.Name, formatCount(est.Model.ContextTokens))
+			} else {
+				fmt.Fprintf(opts.stdout(), "  [warn] %s has grown past what this batch can fit; the agent may drop content\n", agentsPath)
+			}
+		}
+		if opts.Verbose {
+			for _, f := range batch {
+				fmt.Fprintf(opts.stdout(), "  - %s\n", f.Path)
+			}
+		}
+
+		if err := executeAgent(agent, prompt, agentsPath, batch, opts); err != nil {
+			return agentMerge{}, fmt.Errorf("agent merge failed in batch %d of %d: %w", i+1, len(batches), err)
+		}
+		if _, err := os.Stat(agentsPath); err != nil {
+			return agentMerge{}, fmt.Errorf("agent did not create/update %s in batch %d of %d", agentsPath, i+1, len(batches))
+		}
+		prompts = append(prompts, prompt)
+	}
+
+	if agentsMDExists {
+		fmt.Fprintf(opts.stdout(), "[ok] Updated %s in %d batches\n", agentsPath, len(batches))
+	} else {
+		fmt.Fprintf(opts.stdout(), "[ok] Created %s in %d batches\n", agentsPath, len(batches))
+	}
+	return agentMerge{prompt: strings.Join(prompts, "\n")}, nil
+}
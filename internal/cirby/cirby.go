@@ -2,34 +2,143 @@ package cirby
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 )
 
 // Options holds CLI options
 type Options struct {
-	DryRun  bool
-	Force   bool
-	Verbose bool
-	Agent   string
+	DryRun          bool
+	Force           bool
+	Verbose         bool
+	Recursive       bool
+	Agent           string
+	LinkMode        string
+	Output          string        // canonical file relative to each scope, defaults to AGENTS.md
+	Paths           []string      // directories the run is scoped to, defaults to the current one
+	Org             string        // rollout: owner of the repositories listed by name
+	Repos           string        // rollout: file listing the repositories to merge
+	MaxCost         float64       // abort merges estimated to cost more (USD), 0 = no limit
+	NoCache         bool          // always invoke the agent, even for previously seen inputs
+	FullMerge       bool          // re-merge whole sources instead of only what changed since the last run
+	NoSections      bool          // leave generated AGENTS.md sections alone
+	NoHeader        bool          // do not keep a generated-by comment at the top of AGENTS.md
+	SavePrompt      bool          // write the prompt and agent command to .cirby/last-prompt
+	Cassette        string        // directory agent results are replayed from and recorded to
+	CassetteMode    string        // auto (default), record or replay
+	Reproducible    bool          // deterministic sampling where the backend allows it, and normalized output
+	Interactive     bool          // resolve merge conflicts one by one at the terminal
+	Review          bool          // show the merge result side by side and ask before applying it
+	Edit            bool          // open the merge result in $EDITOR before applying it
+	Timeout         time.Duration // API backends: give up after this long, including rate limit waits
+	FailOnSecrets   bool          // refuse to send prompts containing credentials instead of redacting them
+	Offline         bool          // fail instead of using the network; only ollama on this machine and builtin merge
+	Dedup           bool          // collapse near-duplicate rules after the merge using embeddings
+	Strict          bool          // fail when the merge result scores low or breaks the structure: rules
+	Report          string        // check: also write a junit or codequality report, FORMAT[=FILE]
+	MaxLength       string        // condense AGENTS.md beyond this many tokens (4000) or characters (16000c)
+	Model           string        // model the agent or API backend uses instead of its default
+	Temperature     *float64      // sampling temperature for API backends, overriding generation.temperature
+	MaxTokens       int           // longest reply of API backends, overriding generation.max_tokens
+	ReasoningEffort string        // low, medium or high, overriding generation.reasoning_effort
+	AgentArgs       []string      // passed on to the agent CLI after its own arguments (after --)
+	Choose          bool          // ask which agent to use even if one was remembered for the project
+	Template        string        // team AGENTS.md template the merge follows: URL, file or owner/repo
+	CheckOnly       bool          // upgrade: only report whether a newer release exists
+	Resolved        bool          // config show: the effective value of every option and its origin
+	Flags           []string      // options given on the command line, by long name; ResolveOptions leaves them alone
+	Raw             bool          // preview: print the file without formatting
+	Plain           bool          // ASCII, line-oriented output without color, for screen readers and dumb terminals
+	LineEndings     string        // auto, lf or crlf: line endings AGENTS.md is written with
+	LinkOnly        bool          // link: link sources already merged, and never merge
+	Root            string        // project whose audit log and agent logs the run writes, defaults to the current directory
+
+	Stdout io.Writer // progress and agent output, defaults to os.Stdout
+	Stdin  io.Reader // answers to prompts and agent input, defaults to os.Stdin
+
+	template string          // content of Template, loaded once by Run
+	pipeline []pipelinePass  // passes of .cirby.yaml, loaded once by Run
+	member   bool            // run for one member of cirby.work
+	results  *[]targetResult // where a workspace member's results are collected
+}
+
+func (o Options) output() string {
+	if o.Output == "" {
+		return "AGENTS.md"
+	}
+	return filepath.Clean(o.Output)
+}
+
+// roots are the directories a run scans and merges in
+func (o Options) roots() []string {
+	if len(o.Paths) == 0 {
+		return []string{"."}
+	}
+	var roots []string
+	for _, p := range o.Paths {
+		if p = filepath.Clean(p); !slices.Contains(roots, p) {
+			roots = append(roots, p)
+		}
+	}
+	return roots
+}
+
+func (o Options) stdout() io.Writer {
+	if o.Stdout == nil {
+		return os.Stdout
+	}
+	return o.Stdout
+}
+
+func (o Options) stdin() io.Reader {
+	if o.Stdin == nil {
+		return os.Stdin
+	}
+	return o.Stdin
 }
 
 // AgentConfig represents a discovered agent configuration file
 type AgentConfig struct {
-	Path    string
-	Agent   string
-	Content string
+	Path     string
+	Agent    string
+	Content  string
+	Settings string // for instructions extracted from a settings file: the settings, as the file is never linked
+	Plugin   string // for sources contributed by a scanner plugin: its name; Path is not a file
+}
+
+// quoted reports whether the config is not a file of its own: instructions
+// from settings or a plugin, which are quoted to the agent and never linked
+func (c AgentConfig) quoted() bool {
+	return c.Settings != "" || c.Plugin != ""
 }
 
 // SupportedAgent represents a coding agent that can be used for merging
 type SupportedAgent struct {
-	Name    string
-	Command string
-	Args    func(prompt string) []string
+	Name       string
+	Command    string
+	Args       func(prompt string) []string
+	StdinArgs  []string                                                     // arguments when the prompt is piped over stdin; nil if the CLI cannot read it there
+	PromptFile func(path string) []string                                   // arguments reading the prompt from a file, for CLIs without stdin support
+	ModelFlag  string                                                       // how the CLI is told which model to use
+	EffortArgs func(effort string) []string                                 // how the CLI is told the reasoning effort, if it can be
+	API        *apiBackend                                                  // set for HTTP API backends
+	Merge      func(target string, files []AgentConfig, opts Options) error // set for merges cirby does itself
+	Offline    bool                                                         // works without network access
+
+	model      string            // chosen with --model
+	generation generationParams  // generation: of .cirby.yaml and its flags
+	env        map[string]string // agents.NAME.env of .cirby.yaml
+	skip       bool              // left out of auto-detection by detect.exclude
+
+	minVersion string // oldest CLI version that works, see minVersions
 }
 
 // Agent patterns to scan for
@@ -44,213 +153,882 @@ var agentPatterns = []struct {
 	{"GitHub Copilot", []string{".github/copilot-instructions.md"}},
 	{"Gemini CLI", []string{"GEMINI.md"}},
 	{"Codex", []string{"CODEX.md"}},
+	{"Aider", []string{"CONVENTIONS.md", ".aider/CONVENTIONS.md"}},
 }
 
+// maxConfigSize is the largest file that is still treated as instructions;
+// anything bigger is almost certainly generated or minified
+const maxConfigSize = 1 << 20
+
 // Supported agents for merging
 var supportedAgents = []SupportedAgent{
 	{
-		Name:    "claude",
-		Command: "claude",
-		Args:    func(prompt string) []string { return []string{"-p", prompt, "--allowedTools", "Edit,Write,Read"} },
+		Name:      "claude",
+		Command:   "claude",
+		Args:      func(prompt string) []string { return []string{"-p", prompt, "--allowedTools", "Edit,Write,Read"} },
+		StdinArgs: []string{"-p", "--allowedTools", "Edit,Write,Read"},
+		ModelFlag: "--model",
 	},
 	{
-		Name:    "opencode",
-		Command: "opencode",
-		Args:    func(prompt string) []string { return []string{"-p", prompt} },
+		Name:      "opencode",
+		Command:   "opencode",
+		Args:      func(prompt string) []string { return []string{"-p", prompt} },
+		ModelFlag: "--model",
 	},
 	{
-		Name:    "gemini",
-		Command: "gemini",
-		Args:    func(prompt string) []string { return []string{"-p", prompt} },
+		Name:      "gemini",
+		Command:   "gemini",
+		Args:      func(prompt string) []string { return []string{"-p", prompt} },
+		StdinArgs: []string{}, // a piped prompt runs it non-interactively
+		ModelFlag: "-m",
 	},
 	{
-		Name:    "cursor",
-		Command: "cursor-agent",
-		Args:    func(prompt string) []string { return []string{"chat", prompt} },
+		Name:      "cursor",
+		Command:   "cursor-agent",
+		Args:      func(prompt string) []string { return []string{"chat", prompt} },
+		ModelFlag: "--model",
 	},
 	{
-		Name:    "codex",
-		Command: "codex",
-		Args:    func(prompt string) []string { return []string{prompt} },
+		Name:      "codex",
+		Command:   "codex",
+		Args:      func(prompt string) []string { return []string{prompt} },
+		ModelFlag: "-m",
+		EffortArgs: func(effort string) []string {
+			return []string{"-c", "model_reasoning_effort=" + effort}
+		},
 	},
 	{
-		Name:    "aider",
-		Command: "aider",
-		Args:    func(prompt string) []string { return []string{"--message", prompt, "--yes"} },
+		Name:       "aider",
+		Command:    "aider",
+		Args:       func(prompt string) []string { return []string{"--message", prompt, "--yes"} },
+		PromptFile: func(path string) []string { return []string{"--message-file", path, "--yes"} },
+		ModelFlag:  "--model",
+		EffortArgs: func(effort string) []string { return []string{"--reasoning-effort", effort} },
 	},
+	// API backends are only used when chosen by name
+	{Name: "anthropic", API: anthropicAPI},
+	{Name: "openai", API: openaiAPI},
+	{Name: "ollama", Command: "ollama", API: ollamaAPI, Offline: true},
+	// Only used when chosen by name or with --offline
+	{Name: "builtin", Merge: builtinMerge, Offline: true},
+	// Only used when chosen by name, for tests and demos
+	{Name: mockAgent, Merge: mockMerge, Offline: true},
+}
+
+// installed reports whether the agent can be used: its CLI is on PATH,
+// or its API key is set or stored with `cirby auth login`
+func (a SupportedAgent) installed() bool {
+	switch {
+	case a.Merge != nil:
+		return true
+	case a.API != nil && a.API.KeyEnv == "":
+		// A local server: assume it runs where it is installed or configured
+		_, err := exec.LookPath(a.Command)
+		return err == nil || os.Getenv(a.API.BaseURLEnv) != ""
+	case a.API != nil:
+		key, _ := apiKey(a)
+		return key != ""
+	}
+	_, err := exec.LookPath(a.Command)
+	return err == nil
 }
 
 // Run executes the main cirby logic
-func Run(opts Options) error {
+func Run(opts Options) (err error) {
+	if err := validateLinkMode(opts.LinkMode); err != nil {
+		return err
+	}
+	if err := checkSymlinks(&opts); err != nil {
+		return err
+	}
+	if !opts.member && len(opts.Paths) == 0 && fileExists(workspaceFile) {
+		return runWorkspace(opts)
+	}
+	if err := validateOutput(opts.output()); err != nil {
+		return err
+	}
+	if opts.Report != "" {
+		if _, _, err := parseReport(opts.Report, batchReportFiles); err != nil {
+			return err
+		}
+	}
+	for _, dir := range opts.roots() {
+		if err := validatePath(dir); err != nil {
+			return err
+		}
+	}
+	if opts.CassetteMode != "" && opts.Cassette == "" {
+		return fmt.Errorf("--cassette-mode needs --cassette DIR")
+	}
+
+	var agent *SupportedAgent
+	files := 0
+	start := time.Now()
+	defer func() {
+		if opts.DryRun || agent == nil {
+			return
+		}
+		reportUsage(telemetryEvent{
+			Agent:      agent.Name,
+			Success:    err == nil,
+			DurationMS: time.Since(start).Milliseconds(),
+			Files:      files,
+		}, opts)
+	}()
+
+	if opts.Template != "" {
+		if isNetworkRef(opts.Template) {
+			if err := requireOnline("fetching --template "+opts.Template, opts); err != nil {
+				return err
+			}
+		}
+		if opts.template, err = loadTemplate(opts.Template); err != nil {
+			return err
+		}
+	}
+
+	if opts.MaxLength != "" {
+		if _, err := parseMaxLength(opts.MaxLength); err != nil {
+			return err
+		}
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	opts.pipeline = cfg.Pipeline
+
+	scopes, err := runScopes(opts)
+	if err != nil {
+		return err
+	}
+
 	// Check git status unless --force
 	if !opts.Force {
-		if err := checkGitStatus(opts); err != nil {
+		referenced, err := referencedConfigs(scopes)
+		if err != nil {
+			return err
+		}
+		if err := checkGitStatus(referenced, opts); err != nil {
 			return err
 		}
 	}
 
-	// Scan for config files
-	configs, err := scanConfigs(opts)
+	// With several targets, a failure does not stop the others; they are
+	// all listed at the end
+	batch := len(scopes) > 1 || opts.results != nil
+	var results []targetResult
+	changed := false
+	summary := "### cirby merge\n\n| File | Files linked | Lines |\n|------|-------------:|------:|\n"
+	for _, scope := range scopes {
+		if len(scopes) > 1 || opts.Recursive {
+			fmt.Fprintf(opts.stdout(), "\n== %s ==\n", scope.Dir)
+		}
+		before, _ := os.ReadFile(scope.agentsPath())
+		result := targetResult{Target: scope.agentsPath(), Drifted: drifted(scope.agentsPath(), string(before))}
+		linked, err := runScope(scope, &agent, opts)
+		if err != nil {
+			annotate("error", scope.agentsPath(), err.Error(), opts)
+			if scope.Dir != "." {
+				err = fmt.Errorf("%s: %w", scope.Dir, err)
+			}
+			if !batch {
+				result.outcome(err, "", "", opts)
+				notifyTargets("cirby merge", []targetResult{result}, opts)
+				recordTargets("cirby merge", []targetResult{result}, opts)
+				return err
+			}
+			fmt.Fprintf(opts.stdout(), "[error] %v\n", err)
+		}
+		after, _ := os.ReadFile(scope.agentsPath())
+		result.Linked = linked
+		result.outcome(err, string(before), string(after), opts)
+		results = append(results, result)
+		files += linked
+		changed = changed || linked > 0
+		if linked > 0 {
+			summary += fmt.Sprintf("| `%s` | %d | +%d −%d |\n", scope.agentsPath(), linked, result.Added, result.Removed)
+		}
+	}
+
+	var batchErr error
+	if opts.results != nil {
+		// A workspace member: the workspace reports for all of them
+		*opts.results = append(*opts.results, results...)
+	} else if batch || opts.Report != "" {
+		batchErr = finishBatch("cirby merge", results, opts)
+	} else {
+		notifyTargets("cirby merge", results, opts)
+		recordTargets("cirby merge", results, opts)
+	}
+	if !changed {
+		return batchErr
+	}
+	if opts.DryRun {
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return batchErr
+	}
+	if err := writeJobSummary(summary); err != nil {
+		return err
+	}
+	fmt.Fprintln(opts.stdout(), tr("\nDone!"))
+	return batchErr
+}
+
+// runScope merges and links the config files of a single directory. The
+// merge agent is selected lazily on first use and shared across scopes.
+// It returns how many files were (or, in dry-run mode, would be) linked.
+func runScope(scope packageScope, agent **SupportedAgent, opts Options) (int, error) {
+	agentsPath := scope.agentsPath()
+
+	// Scan for config files, once: plugins among the sources run for
+	// every scan
+	configs, err := scanConfigs(scope.Dir, opts)
 	if err != nil {
-		return fmt.Errorf("scanning configs: %w", err)
+		return 0, fmt.Errorf("scanning configs: %w", err)
+	}
+
+	// Update generated sections first, so copies of the updated AGENTS.md
+	// are refreshed below
+	before, sectionsChanged, err := refreshSections(scope, opts)
+	if err != nil {
+		return 0, err
+	}
+	if sectionsChanged && !opts.DryRun {
+		entry := historyEntry{Agent: "sections", AgentsPath: agentsPath, HadAgentsMD: true}
+		if err := recordHistory(entry, before); err != nil {
+			return 0, fmt.Errorf("recording history: %w", err)
+		}
+		if err := stampIntegrity(scope, lockStamp{Configs: configs}, opts); err != nil {
+			return 0, err
+		}
 	}
 
 	if len(configs) == 0 {
-		fmt.Println("No agent configuration files found.")
-		return nil
+		fmt.Fprintln(opts.stdout(), tr("No agent configuration files found."))
+		return 0, nil
 	}
 
 	// Check if AGENTS.md already exists
 	agentsMDExists := false
 	var agentsMDContent string
-	if content, err := os.ReadFile("AGENTS.md"); err == nil {
+	if content, err := os.ReadFile(agentsPath); err == nil {
 		agentsMDExists = true
 		agentsMDContent = string(content)
 	}
 
-	// Filter out files that are already symlinks to AGENTS.md
-	var toProcess []AgentConfig
+	// Filter out files that are already symlinks to AGENTS.md, and set
+	// aside copies cirby generated earlier so they are refreshed, not merged
+	var toProcess, toRelink []AgentConfig
 	for _, cfg := range configs {
-		if isSymlinkToAgentsMD(cfg.Path) {
+		if isSymlinkToAgentsMD(cfg.Path, agentsPath) {
+			if linkMode(opts) == LinkCopy {
+				toRelink = append(toRelink, cfg)
+				continue
+			}
 			if opts.Verbose {
-				fmt.Printf("  [skip] %s (already symlinked)\n", cfg.Path)
+				fmt.Fprintf(opts.stdout(), tr("  [skip] %s (already symlinked)\n"), cfg.Path)
 			}
 			continue
 		}
-		if cfg.Path == "AGENTS.md" {
+		if cfg.Path == agentsPath {
+			continue
+		}
+		if cfg.quoted() && settingsMerged(cfg, agentsPath) {
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [skip] %s (instructions merged before)\n", cfg.Path)
+			}
+			continue
+		}
+		if isCirbyCopy(cfg.Content) {
+			if isStaleCopy(cfg, agentsPath, opts) {
+				toRelink = append(toRelink, cfg)
+			} else if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [skip] %s (copy is up to date)\n", cfg.Path)
+			}
 			continue
 		}
 		toProcess = append(toProcess, cfg)
 	}
 
+	// Sources merged before only contribute what changed since, and new
+	// ones are added whole; when nothing changed, they just need linking
+	// again
+	plan := planIncremental(scope, toProcess, agentsMDExists, agentsMDContent, opts)
+	if plan != nil && len(plan.Changes) == 0 {
+		toRelink = append(toRelink, toProcess...)
+		toProcess = nil
+	}
+
+	// cirby link only links what AGENTS.md already holds: sources merged
+	// before and unchanged since. The others wait for a merge.
+	pending := 0
+	if opts.LinkOnly && len(toProcess) > 0 {
+		if !agentsMDExists {
+			return 0, fmt.Errorf("%s does not exist yet; run cirby merge first", agentsPath)
+		}
+		lock, err := loadLock()
+		if err != nil {
+			return 0, err
+		}
+		var merged map[string]string
+		if record, ok := lock.Agents[filepath.ToSlash(agentsPath)]; ok {
+			merged = record.Sources
+		}
+		for _, cfg := range toProcess {
+			if hash, ok := merged[filepath.ToSlash(cfg.Path)]; ok && hash == hashString(cfg.Content) {
+				toRelink = append(toRelink, cfg)
+			} else {
+				fmt.Fprintf(opts.stdout(), "[skip] %s has changes not merged into %s; run cirby merge\n", cfg.Path, agentsPath)
+				pending++
+			}
+		}
+		toProcess = nil
+	}
+
+	if len(toProcess) == 0 && len(toRelink) == 0 {
+		if agentsMDExists && linkMode(opts) == LinkSymlink {
+			if err := prepareLinks(agentsPath); err != nil {
+				return 0, err
+			}
+		}
+		// Edits to included files only need recording, so cirby check
+		// passes again
+		included := false
+		if agentsMDExists && !opts.DryRun {
+			lock, err := loadLock()
+			if err != nil {
+				return 0, err
+			}
+			if entry, ok := lock.Agents[filepath.ToSlash(agentsPath)]; ok && len(changedIncludes(entry, agentsPath)) > 0 {
+				if err := stampIntegrity(scope, lockStamp{Configs: configs}, opts); err != nil {
+					return 0, err
+				}
+				fmt.Fprintf(opts.stdout(), "[ok] Recorded changes to files included by %s\n", agentsPath)
+				included = true
+			}
+		}
+		if !sectionsChanged && pending == 0 && !included {
+			fmt.Fprintln(opts.stdout(), tr("[ok] Already in sync. Nothing to do."))
+		}
+		return 0, nil
+	}
+
+	project, err := loadProjectConfig()
+	if err != nil {
+		return 0, err
+	}
 	if len(toProcess) == 0 {
-		fmt.Println("[ok] Already in sync. Nothing to do.")
-		return nil
+		if opts.DryRun {
+			fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+			for _, cfg := range toRelink {
+				fmt.Fprintf(opts.stdout(), "  - Refresh %s: %s -> %s\n", linkMode(opts), cfg.Path, agentsPath)
+			}
+			return len(toRelink), nil
+		}
+		inputs := snapshotInputs(toRelink)
+		if err := linkAll(toRelink, agentsPath, opts); err != nil {
+			return 0, err
+		}
+		entry := historyEntry{AgentsPath: agentsPath, HadAgentsMD: true, Inputs: inputs}
+		if err := recordHistory(entry, agentsMDContent); err != nil {
+			return 0, fmt.Errorf("recording history: %w", err)
+		}
+		if err := stampIntegrity(scope, lockStamp{Inputs: inputs, Configs: configs}, opts); err != nil {
+			return 0, err
+		}
+		if err := runHooks("post_link", project.Hooks.PostLink, hookRun{Scope: scope, Linked: toRelink}, opts); err != nil {
+			return 0, err
+		}
+		return len(toRelink), nil
+	}
+
+	if plan != nil && plan.ThreeWay && plan.Conflicts > 0 && opts.Interactive && !opts.DryRun {
+		resolved, remaining := resolveConflicts(splitLines(plan.Merged), opts)
+		plan.Merged, plan.Conflicts = joinLines(resolved), remaining
+	}
+	clean := plan != nil && plan.ThreeWay && plan.Conflicts == 0
+
+	// If there are non-symlink files, we need to merge them (even if AGENTS.md exists).
+	// An identical earlier merge by the same agent and model is reused
+	// instead of invoking it again, unless a cassette takes its place.
+	// Merges cirby does itself are quick, so they are never cached.
+	cacheKey, cached, hit := "", "", false
+	if !clean && !opts.NoCache && opts.Cassette == "" {
+		if *agent == nil {
+			selected, err := selectAgent(opts)
+			if err != nil {
+				return 0, err
+			}
+			*agent = &selected
+		}
+		if (*agent).Merge == nil {
+			settings := mergeSettings(**agent, project, opts)
+			cacheKey = mergeCacheKey(scope, stripHeader(agentsMDContent), agentsMDExists, toProcess, opts.template, opts.pipeline, settings)
+			cached, hit = loadCachedMerge(cacheKey)
+		}
+	}
+
+	run := hookRun{Scope: scope, Agent: opts.Agent, Sources: toProcess}
+	if *agent != nil {
+		run.Agent = (*agent).Name
+	}
+	if err := runHooks("pre_merge", project.Hooks.PreMerge, run, opts); err != nil {
+		return 0, err
+	}
+
+	var entry historyEntry
+	if clean {
+		// Both sides changed without overlapping: no agent needed
+		if opts.DryRun {
+			fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+			fmt.Fprintf(opts.stdout(), "  - Three-way merge changes from %d files into edited %s (no conflicts)\n", len(plan.Changes), agentsPath)
+			printDryRunLinks(toProcess, toRelink, agentsPath, opts)
+			return len(toProcess) + len(toRelink), nil
+		}
+		if err := writeMergeResult(agentsPath, plan.Merged); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Three-way merged %d files into %s\n", len(plan.Changes), agentsPath)
+		entry.Agent = "merge3"
+		if err := transformMerge(agentsPath, opts); err != nil {
+			return 0, err
+		}
+	} else if hit {
+		if opts.DryRun {
+			fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+			fmt.Fprintf(opts.stdout(), "  - Reuse cached merge of %d files for %s\n", len(toProcess), agentsPath)
+			printDryRunLinks(toProcess, toRelink, agentsPath, opts)
+			return len(toProcess) + len(toRelink), nil
+		}
+		if err := writeMergeResult(agentsPath, cached); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(opts.stdout(), tr("[ok] Reused cached merge for %s\n"), agentsPath)
+		entry.Agent = (*agent).Name
+		if err := transformMerge(agentsPath, opts); err != nil {
+			return 0, err
+		}
+		// The result was checked when it was made, but not against this
+		// project's min_score and structure
+		if err := verifyMerge(agentsPath, agentsMDContent, agentsMDExists, toProcess, opts); err != nil {
+			return 0, err
+		}
+	} else {
+		merged, err := mergeWithAgent(scope, agent, toProcess, toRelink, agentsMDExists, agentsMDContent, plan, opts)
+		if err != nil || opts.DryRun {
+			return merged.linked, err
+		}
+		entry.Agent = (*agent).Name
+		entry.PromptHash = hashString(merged.prompt)
+		entry.prompt = merged.prompt
+		if err := dedupMerge(agentsPath, opts); err != nil {
+			return 0, err
+		}
+		if err := condenseMerge(agentsPath, **agent, opts); err != nil {
+			return 0, err
+		}
+		// Cached as the agent made it, before transform plugins, --edit or
+		// --review change it
+		if cacheKey != "" {
+			if result, err := os.ReadFile(agentsPath); err == nil {
+				if err := storeCachedMerge(cacheKey, string(result)); err != nil && opts.Verbose {
+					fmt.Fprintf(opts.stdout(), "  [skip] caching merge result: %v\n", err)
+				}
+			}
+		}
+		if err := transformMerge(agentsPath, opts); err != nil {
+			return 0, err
+		}
+		if err := verifyMerge(agentsPath, agentsMDContent, agentsMDExists, toProcess, opts); err != nil {
+			return 0, err
+		}
 	}
 
-	// If there are non-symlink files, we need to merge them (even if AGENTS.md exists)
+	if err := orderSections(agentsPath, opts); err != nil {
+		return 0, err
+	}
+	if opts.Edit {
+		if ok, err := editMerge(agentsPath, agentsMDContent, agentsMDExists, opts); err != nil || !ok {
+			return 0, err
+		}
+	}
+	if opts.Review {
+		if ok, err := reviewMerge(agentsPath, agentsMDContent, agentsMDExists, toProcess, opts); err != nil || !ok {
+			return 0, err
+		}
+	}
+	if err := offerSplit(agentsPath, opts); err != nil {
+		return 0, err
+	}
+	if err := normalizeMerge(agentsPath, opts); err != nil {
+		return 0, err
+	}
+	// A new merge result needs its generated sections and header too
+	if _, _, err := refreshSections(scope, opts); err != nil {
+		return 0, err
+	}
+	if err := stampHeader(scope, configs, opts); err != nil {
+		return 0, err
+	}
+	if err := restoreLineEndings(agentsPath, agentsMDContent, opts); err != nil {
+		return 0, err
+	}
+	if *agent != nil {
+		run.Agent = (*agent).Name
+	}
+	if err := runHooks("post_merge", project.Hooks.PostMerge, run, opts); err != nil {
+		rejected, rejectErr := rejectMerge(agentsPath, agentsMDContent, agentsMDExists)
+		if rejectErr != nil {
+			return 0, rejectErr
+		}
+		return 0, fmt.Errorf("%w; %s is unchanged and the rejected result is in %s", err, agentsPath, rejected)
+	}
+
+	// Create symlinks (or copies)
+	linked := append(toProcess, toRelink...)
+	inputs := snapshotInputs(linked)
+	if err := linkAll(linked, agentsPath, opts); err != nil {
+		return 0, err
+	}
+
+	entry.AgentsPath = agentsPath
+	entry.HadAgentsMD = agentsMDExists
+	entry.Inputs = inputs
+	if err := recordHistory(entry, agentsMDContent); err != nil {
+		return 0, fmt.Errorf("recording history: %w", err)
+	}
+	stamp := lockStamp{Backend: entry.Agent, Inputs: inputs, Configs: configs}
+	if *agent != nil && entry.Agent == (*agent).Name {
+		stamp.Model = resolvedModel(**agent)
+	}
+	if err := stampIntegrity(scope, stamp, opts); err != nil {
+		return 0, err
+	}
+	if err := writeSourceMap(agentsPath); err != nil {
+		return 0, fmt.Errorf("writing %s: %w", sourceMapFile, err)
+	}
+	run.Linked = linked
+	if err := runHooks("post_link", project.Hooks.PostLink, run, opts); err != nil {
+		return 0, err
+	}
+
+	return len(linked), nil
+}
+
+// agentMerge is the outcome of mergeWithAgent
+type agentMerge struct {
+	prompt string
+	linked int // files a dry run would link
+}
+
+// mergeWithAgent selects the merge agent if needed, and has it merge
+// toProcess into the scope's AGENTS.md, or only the changes of plan when
+// there is one. In dry-run mode it only prints the planned actions.
+func mergeWithAgent(scope packageScope, agent **SupportedAgent, toProcess, toRelink []AgentConfig, agentsMDExists bool, agentsMDContent string, plan *incrementalPlan, opts Options) (agentMerge, error) {
+	agentsPath := scope.agentsPath()
+
 	// Detect or use specified agent
-	agent, err := selectAgent(opts)
-	if err != nil {
-		return err
+	if *agent == nil {
+		selected, err := selectAgent(opts)
+		if err != nil {
+			return agentMerge{}, err
+		}
+		*agent = &selected
+	}
+	warnReproducible(**agent, opts)
+	if opts.pipeline != nil && plan == nil {
+		return runPipeline(scope, **agent, toProcess, toRelink, opts)
+	}
+
+	// Build the merge prompt
+	var prompt string
+	var estimate mergeEstimate
+	switch {
+	case plan != nil && plan.ThreeWay:
+		prompt = buildConflictPrompt(plan.conflictIntro(agentsPath), plan.Merged, scope)
+		estimate = priceEstimate(**agent, estimateTokens(prompt), estimateTokens(plan.Merged))
+	case plan != nil:
+		prompt = buildIncrementalPrompt(stripHeader(agentsMDContent), plan, scope)
+		estimate = estimateIncremental(**agent, prompt, plan)
+	case agentsMDExists:
+		prompt = buildMergeIntoExistingPrompt(stripHeader(agentsMDContent), toProcess, scope, opts.template)
+		estimate = estimateMerge(**agent, prompt, toProcess)
+	default:
+		prompt = buildMergePrompt(toProcess, scope, opts.template)
+		estimate = estimateMerge(**agent, prompt, toProcess)
+	}
+	var batches [][]AgentConfig
+	if plan == nil {
+		var err error
+		if batches, err = planBatches(**agent, toProcess, estimateTokens(prompt)); err != nil {
+			return agentMerge{}, err
+		}
+		estimate.Batches = len(batches)
 	}
 
 	if opts.DryRun {
-		fmt.Println("\n[Dry Run] Would perform these actions:\n")
-		if agentsMDExists {
-			fmt.Printf("  - Use %s to merge %d new files INTO existing AGENTS.md\n", agent.Name, len(toProcess))
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		if plan != nil && plan.ThreeWay {
+			fmt.Fprintf(opts.stdout(), "  - Use %s to resolve %d conflicts of a three-way merge into edited %s\n", (*agent).Name, plan.Conflicts, agentsPath)
+		} else if plan != nil {
+			fmt.Fprintf(opts.stdout(), "  - Use %s to merge %d changed lines from %d files into %d of %d sections of %s\n",
+				(*agent).Name, plan.changedLines(), len(plan.Changes), len(plan.Sections), plan.Total, agentsPath)
+			plan.describe(opts)
+		} else if agentsMDExists {
+			fmt.Fprintf(opts.stdout(), tr("  - Use %s to merge %d new files INTO existing %s\n"), (*agent).Name, len(toProcess), agentsPath)
 		} else {
-			fmt.Printf("  - Use %s to merge %d files into new AGENTS.md\n", agent.Name, len(toProcess))
+			fmt.Fprintf(opts.stdout(), tr("  - Use %s to merge %d files into new %s\n"), (*agent).Name, len(toProcess), agentsPath)
 		}
-		for _, cfg := range toProcess {
-			fmt.Printf("  - Create symlink: %s -> AGENTS.md\n", cfg.Path)
+		printEstimate(estimate, **agent, opts)
+		for i, batch := range batches {
+			fmt.Fprintf(opts.stdout(), "    batch %d: %d files, ~%s tokens\n", i+1, len(batch), formatCount(batchTokens(batch)))
 		}
-		fmt.Println("\nRun without --dry-run to apply changes.")
-		return nil
+		if scope.Parent != "" {
+			fmt.Fprintf(opts.stdout(), "  - Inherit shared instructions from %s\n", scope.Parent)
+		}
+		printDryRunLinks(toProcess, toRelink, agentsPath, opts)
+		if err := checkMaxCost(estimate, **agent, opts); err != nil {
+			fmt.Fprintf(opts.stdout(), "  [error] %v\n", err)
+		}
+		return agentMerge{prompt: prompt, linked: len(toProcess) + len(toRelink)}, nil
 	}
 
-	// Build the merge prompt
-	var prompt string
-	if agentsMDExists {
-		prompt = buildMergeIntoExistingPrompt(agentsMDContent, toProcess)
-		fmt.Printf("Merging %d new files into existing AGENTS.md with %s...\n", len(toProcess), agent.Name)
+	if plan != nil && plan.ThreeWay {
+		fmt.Fprintf(opts.stdout(), "Resolving %d three-way merge conflicts in %s with %s...\n", plan.Conflicts, agentsPath, (*agent).Name)
+	} else if plan != nil {
+		fmt.Fprintf(opts.stdout(), "Merging %d changed lines into %d of %d sections of %s with %s...\n",
+			plan.changedLines(), len(plan.Sections), plan.Total, agentsPath, (*agent).Name)
+		plan.describe(opts)
+	} else if agentsMDExists {
+		fmt.Fprintf(opts.stdout(), tr("Merging %d new files into existing %s with %s...\n"), len(toProcess), agentsPath, (*agent).Name)
 	} else {
-		prompt = buildMergePrompt(toProcess)
-		fmt.Printf("Merging with %s...\n", agent.Name)
+		fmt.Fprintf(opts.stdout(), tr("Merging with %s...\n"), (*agent).Name)
+	}
+	printEstimate(estimate, **agent, opts)
+	if err := checkMaxCost(estimate, **agent, opts); err != nil {
+		return agentMerge{}, err
+	}
+	if batches != nil {
+		return mergeInBatches(scope, **agent, batches, agentsMDExists, opts)
 	}
 
 	if opts.Verbose {
-		fmt.Printf("Prompt:\n%s\n", prompt)
+		fmt.Fprintf(opts.stdout(), "Prompt:\n%s\n", prompt)
 	}
 
 	// Execute the agent
-	if err := executeAgent(agent, prompt, opts); err != nil {
-		return fmt.Errorf("agent merge failed: %w", err)
+	if err := executeAgent(**agent, prompt, agentsPath, toProcess, opts); err != nil {
+		return agentMerge{}, fmt.Errorf("agent merge failed: %w", err)
 	}
 
 	// Verify AGENTS.md exists
-	if _, err := os.Stat("AGENTS.md"); os.IsNotExist(err) {
-		return fmt.Errorf("agent did not create/update AGENTS.md")
+	result, err := os.ReadFile(agentsPath)
+	if os.IsNotExist(err) {
+		return agentMerge{}, fmt.Errorf("agent did not create/update %s", agentsPath)
+	}
+	if plan != nil && plan.ThreeWay && hasConflictMarkers(string(result)) {
+		return agentMerge{}, fmt.Errorf("agent left conflict markers in %s; resolve them and rerun cirby", agentsPath)
 	}
 
 	if agentsMDExists {
-		fmt.Println("[ok] Updated AGENTS.md")
+		fmt.Fprintf(opts.stdout(), tr("[ok] Updated %s\n"), agentsPath)
 	} else {
-		fmt.Println("[ok] Created AGENTS.md")
+		fmt.Fprintf(opts.stdout(), tr("[ok] Created %s\n"), agentsPath)
 	}
+	return agentMerge{prompt: prompt}, nil
+}
 
-	// Create symlinks
+func printDryRunLinks(toProcess, toRelink []AgentConfig, agentsPath string, opts Options) {
 	for _, cfg := range toProcess {
-		if err := createSymlink(cfg.Path, opts); err != nil {
-			return fmt.Errorf("creating symlink for %s: %w", cfg.Path, err)
+		if cfg.Plugin != "" {
+			fmt.Fprintf(opts.stdout(), "  - Merge %s (from the %s plugin)\n", cfg.Path, cfg.Plugin)
+			continue
 		}
-		fmt.Printf("[ok] Symlinked %s -> AGENTS.md\n", cfg.Path)
+		if cfg.Settings != "" {
+			fmt.Fprintf(opts.stdout(), "  - Keep %s as it is (instructions from its settings)\n", cfg.Path)
+			continue
+		}
+		fmt.Fprintf(opts.stdout(), tr("  - Create %s: %s -> %s\n"), linkMode(opts), cfg.Path, agentsPath)
+	}
+	for _, cfg := range toRelink {
+		fmt.Fprintf(opts.stdout(), "  - Refresh %s: %s -> %s\n", linkMode(opts), cfg.Path, agentsPath)
+	}
+}
+
+// writeMergeResult writes merged content to agentsPath, creating its directory
+func writeMergeResult(agentsPath, content string) error {
+	if err := os.MkdirAll(filepath.Dir(agentsPath), 0755); err != nil {
+		return err
 	}
+	return writeFile(agentsPath, []byte(content), 0644)
+}
 
-	fmt.Println("\nDone!")
+// linkAll points every config at agentsPath after checking that AGENTS.md
+// is ready to be linked to
+func linkAll(configs []AgentConfig, agentsPath string, opts Options) error {
+	if err := prepareLinks(agentsPath); err != nil {
+		return err
+	}
+	for _, cfg := range configs {
+		if cfg.quoted() {
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [skip] %s (not a file to link)\n", cfg.Path)
+			}
+			continue
+		}
+		if err := linkConfig(cfg.Path, agentsPath, opts); err != nil {
+			return fmt.Errorf("linking %s: %w", cfg.Path, err)
+		}
+		printLinked(cfg.Path, agentsPath, opts)
+	}
 	return nil
 }
 
+// selectAgent returns the agent named by opts, or the one installed (or
+// chosen among those installed), set up to use --model and the generation
+// parameters
 func selectAgent(opts Options) (SupportedAgent, error) {
+	agents, err := configuredAgents()
+	if err != nil {
+		return SupportedAgent{}, err
+	}
+	agent, err := pickAgent(agents, opts)
+	if err != nil {
+		return agent, err
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return SupportedAgent{}, err
+	}
+	if agent.generation, err = generationFor(agent, cfg.Generation, opts); err != nil {
+		return SupportedAgent{}, err
+	}
+	if err := checkAgentVersion(agent, opts); err != nil || opts.Model == "" {
+		return agent, err
+	}
+	if agent.ModelFlag == "" && agent.API == nil {
+		return SupportedAgent{}, fmt.Errorf("%s does not use a model; remove --model", agent.Name)
+	}
+	agent.model = opts.Model
+	return agent, nil
+}
+
+func pickAgent(agents []SupportedAgent, opts Options) (SupportedAgent, error) {
 	// If agent specified, find it
 	if opts.Agent != "" {
-		for _, a := range supportedAgents {
+		for _, a := range agents {
 			if a.Name == opts.Agent {
+				// Replaying a cassette runs nothing and calls nothing
+				if opts.Cassette != "" && opts.CassetteMode == cassetteReplay {
+					return a, nil
+				}
+				if err := checkOffline(a, opts); err != nil {
+					return SupportedAgent{}, err
+				}
 				// Check if it's installed
-				if _, err := exec.LookPath(a.Command); err != nil {
+				if a.API != nil && a.API.KeyEnv != "" && !a.installed() {
+					return SupportedAgent{}, fmt.Errorf("%s needs an API key: set %s or run `cirby auth login %s`", a.Name, a.API.KeyEnv, a.Name)
+				}
+				if !a.installed() {
 					return SupportedAgent{}, fmt.Errorf("%s is not installed or not in PATH", a.Name)
 				}
 				return a, nil
 			}
 		}
-		return SupportedAgent{}, fmt.Errorf("unknown agent: %s (supported: claude, opencode, gemini, cursor, codex, aider)", opts.Agent)
+		return SupportedAgent{}, fmt.Errorf("unknown agent: %s (supported: claude, opencode, gemini, cursor, codex, aider, anthropic, openai, ollama, builtin, mock)", opts.Agent)
 	}
 
 	// Auto-detect available agents
 	var available []SupportedAgent
-	for _, a := range supportedAgents {
-		if _, err := exec.LookPath(a.Command); err == nil {
+	for _, a := range agents {
+		if a.skip || a.Name == mockAgent {
+			continue
+		}
+		if opts.Offline {
+			if a.Offline && a.installed() && checkOffline(a, opts) == nil {
+				available = append(available, a)
+			}
+		} else if a.API == nil && a.Merge == nil && a.installed() {
 			available = append(available, a)
 		}
 	}
 
 	if len(available) == 0 {
-		return SupportedAgent{}, fmt.Errorf("no supported agent found. Please install one of: claude, opencode, gemini, cursor, codex, aider")
+		return SupportedAgent{}, fmt.Errorf("no supported agent found. Please install one of: claude, opencode, gemini, cursor, codex, aider (or run `cirby builtin` for a merge without AI)")
 	}
 
 	if len(available) == 1 {
-		fmt.Printf("Using %s to merge config files...\n", available[0].Name)
+		fmt.Fprintf(opts.stdout(), tr("Using %s to merge config files...\n"), available[0].Name)
 		return available[0], nil
 	}
 
-	// Multiple agents available, let user choose
-	fmt.Println("Cirby needs an AI agent to intelligently merge your config files.")
-	fmt.Println("Multiple agents detected on your system:\n")
+	// Multiple agents available: use the one chosen before, if still there
+	if name := rememberedAgent(); name != "" && !opts.Choose {
+		for _, a := range available {
+			if a.Name == name {
+				fmt.Fprintf(opts.stdout(), "Using %s to merge config files (remembered in %s; --choose to pick again)...\n", a.Name, rememberedAgentFile)
+				return a, nil
+			}
+		}
+	}
+
+	// Without a terminal to ask on, take the
+	// first in detection order rather than wait for an answer
+	if !interactive(opts.stdin()) {
+		var names []string
+		for _, a := range available {
+			names = append(names, a.Name)
+		}
+		fmt.Fprintf(opts.stdout(), "Multiple agents detected (%s); stdin is not a terminal, using %s.\n", strings.Join(names, ", "), available[0].Name)
+		fmt.Fprintf(opts.stdout(), "Name the agent to use another one, e.g. `cirby %s`.\n", available[len(available)-1].Name)
+		return available[0], nil
+	}
+
+	// Let the user choose
+	fmt.Fprintln(opts.stdout(), tr("Cirby needs an AI agent to intelligently merge your config files."))
+	fmt.Fprint(opts.stdout(), tr("Multiple agents detected on your system:\n\n"))
 	for i, a := range available {
-		fmt.Printf("  %d) %s\n", i+1, a.Name)
+		fmt.Fprintf(opts.stdout(), "  %d) %s\n", i+1, a.Name)
 	}
-	fmt.Printf("\nWhich agent would you like to use? [1]: ")
+	fmt.Fprint(opts.stdout(), tr("\nWhich agent would you like to use? [1]: "))
 
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(opts.stdin())
 	input, _ := reader.ReadString('\n')
 	input = strings.TrimSpace(input)
 
-	if input == "" {
-		return available[0], nil
-	}
-
+	chosen := available[0]
 	var choice int
-	if _, err := fmt.Sscanf(input, "%d", &choice); err != nil || choice < 1 || choice > len(available) {
-		return available[0], nil
+	if _, err := fmt.Sscanf(input, "%d", &choice); err == nil && choice >= 1 && choice <= len(available) {
+		chosen = available[choice-1]
 	}
 
-	return available[choice-1], nil
+	if opts.DryRun {
+		return chosen, nil
+	}
+	fmt.Fprintf(opts.stdout(), "Use %s for this project from now on? [y/N]: ", chosen.Name)
+	answer, _ := reader.ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "y" || answer == "yes" {
+		if err := rememberAgent(chosen.Name); err != nil {
+			return SupportedAgent{}, err
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Saved in %s; use --choose to pick again\n", rememberedAgentFile)
+	}
+	return chosen, nil
 }
 
-func buildMergePrompt(configs []AgentConfig) string {
-	var files []string
-	for _, cfg := range configs {
-		files = append(files, cfg.Path)
+func buildMergePrompt(configs []AgentConfig, scope packageScope, template string) string {
+	target := scope.agentsPath()
+
+	structure := fmt.Sprintf(`The %s file should follow this structure:
+- Project Overview
+- Build & Test Commands
+- Code Style Guidelines
+- Architecture Notes
+- Any other relevant sections
+`, target)
+	if template != "" {
+		structure = buildTemplateNote(template)
 	}
 
 	return fmt.Sprintf(`Read the following AI agent configuration files in this project:
@@ -258,29 +1036,28 @@ func buildMergePrompt(configs []AgentConfig) string {
 
 These files contain instructions for different AI coding agents. Please:
 1. Analyze the content of each file
-2. Create a unified AGENTS.md file that combines the best instructions from all files
+2. Create a unified %s file that combines the best instructions from all files
 3. Remove duplicate information
 4. Use agent-agnostic language (don't say "Claude should..." or "Gemini should...")
 5. Keep the merged content concise and well-organized
-6. Write the result to AGENTS.md in the current directory
-
-The AGENTS.md file should follow this structure:
-- Project Overview
-- Build & Test Commands
-- Code Style Guidelines
-- Architecture Notes
-- Any other relevant sections
+6. Write the result to %s
 
-Please create the AGENTS.md file now.`, strings.Join(files, "\n"))
+%s
+%sPlease create the %s file now.`, promptFiles(configs), target, target, structure, buildInheritNote(scope), target)
 }
 
-func buildMergeIntoExistingPrompt(existingContent string, configs []AgentConfig) string {
-	var files []string
-	for _, cfg := range configs {
-		files = append(files, cfg.Path)
+func buildMergeIntoExistingPrompt(existingContent string, configs []AgentConfig, scope packageScope, template string) string {
+	target := scope.agentsPath()
+
+	preserve := fmt.Sprintf("Important: Preserve the existing structure and content of %s, only ADD new information that wasn't there before.\n", target)
+	if template != "" {
+		preserve = fmt.Sprintf("Important: Keep all existing content of %s, only ADD new information that wasn't there before, but\nmove it under the template's headings where the current layout differs.\n\n", target) + buildTemplateNote(template)
+	}
+	if strings.Contains(existingContent, "<!-- cirby:section ") {
+		preserve += "\nKeep every block between <!-- cirby:section NAME --> and <!-- /cirby:section NAME --> markers\nexactly as it is, including the markers; cirby maintains those blocks.\n"
 	}
 
-	return fmt.Sprintf(`The project already has an AGENTS.md file with the following content:
+	return fmt.Sprintf(`The project already has an %s file with the following content:
 
 ---
 %s
@@ -291,44 +1068,142 @@ New agent configuration files have been found that need to be merged:
 
 Please:
 1. Read the new configuration files
-2. Analyze what information they contain that is NOT already in AGENTS.md
-3. Merge any new, unique information into AGENTS.md
+2. Analyze what information they contain that is NOT already in %s
+3. Merge any new, unique information into %s
 4. Remove any duplicates
 5. Use agent-agnostic language (don't say "Claude should..." or "Gemini should...")
 6. Keep the content well-organized
-7. Update the AGENTS.md file with the merged content
+7. Update the %s file with the merged content
 
-Important: Preserve the existing structure and content of AGENTS.md, only ADD new information that wasn't there before.
-
-Please update the AGENTS.md file now.`, existingContent, strings.Join(files, "\n"))
+%s
+%sPlease update the %s file now.`, target, existingContent, promptFiles(configs), target, target, target, preserve, buildInheritNote(scope), target)
 }
 
-func executeAgent(agent SupportedAgent, prompt string, opts Options) error {
-	args := agent.Args(prompt)
+// executeAgent runs the agent on prompt, which asks it to write target.
+// API backends are given the content of files (and target) instead of
+// reading them.
+func executeAgent(agent SupportedAgent, prompt, target string, files []AgentConfig, opts Options) error {
+	if len(opts.AgentArgs) > 0 && (agent.Merge != nil || agent.API != nil) {
+		return fmt.Errorf("%s is not an agent CLI; it cannot take the arguments after --", agent.Name)
+	}
+	if opts.Cassette != "" {
+		return runCassette(agent, prompt, target, files, opts)
+	}
+	if agent.Merge != nil {
+		return agent.Merge(target, files, opts)
+	}
+	if agent.API != nil {
+		return runAPIBackend(agent, prompt, target, files, opts)
+	}
+	if err := checkSourceSecrets(files, agent.Name, opts); err != nil {
+		return err
+	}
+	scrub, err := loadScrubber()
+	if err != nil {
+		return err
+	}
+	restore := func() error { return nil }
+	if scrub != nil {
+		// The agent edits target in place, so it gets a masked copy
+		scrub.warnUnmaskable(files, agent.Name, opts)
+		prompt = scrub.maskPrompt(prompt, opts)
+		if restore, err = scrub.maskFile(target); err != nil {
+			return err
+		}
+	}
+	// Credentials are kept out of target as well, and go back into whatever
+	// the agent writes there, from the file or the prompt
+	secrets := &secretRedactor{}
+	unredact, err := secrets.redactFile(target, agent.Name, opts)
+	if err != nil {
+		return errors.Join(err, restore())
+	}
+	unmask := restore
+	restore = func() error { return errors.Join(unredact(), unmask()) }
+	prompt, err = scrubPrompt(prompt, agent.Name, secrets, opts)
+	if err != nil {
+		return errors.Join(err, restore())
+	}
+	input, err := promptInput(agent, prompt)
+	if err != nil {
+		return errors.Join(err, restore())
+	}
+	defer input.Cleanup()
+	args := input.Args
+	if agent.model != "" {
+		args = append(args, agent.ModelFlag, agent.model)
+	}
+	if effort := agent.generation.ReasoningEffort; effort != "" {
+		args = append(args, agent.EffortArgs(effort)...)
+	}
+	args = append(args, opts.AgentArgs...)
 	cmd := exec.Command(agent.Command, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	var logged func(error)
+	cmd.Stdout, cmd.Stderr, logged = teeAgentOutput(opts.stdout(), os.Stderr, agent.Command, args, opts)
+	cmd.Stdin = opts.stdin()
+	if input.Stdin != nil {
+		cmd.Stdin = input.Stdin
+	}
+	if len(agent.env) > 0 {
+		cmd.Env = append(os.Environ(), agentEnv(agent)...)
+	}
 
 	if opts.Verbose {
-		fmt.Printf("Running: %s %s\n", agent.Command, strings.Join(args, " "))
+		fmt.Fprintf(opts.stdout(), "Running: %s %s\n", agent.Command, strings.Join(args, " "))
+		if input.Via != "" {
+			fmt.Fprintf(opts.stdout(), "  (prompt from %s)\n", input.Via)
+		}
+	}
+
+	saved := savedInvocation{Prompt: prompt, Command: append([]string{agent.Command}, args...), Env: agent.env, Stdin: input.Via == "stdin"}
+	if !saved.Stdin {
+		saved.File = input.Via
+	}
+	if err := savePrompt(saved, opts); err != nil {
+		return errors.Join(err, restore())
 	}
 
-	return cmd.Run()
+	previous := previousHash(target)
+	runErr := cmd.Run()
+	logged(runErr)
+	if err := errors.Join(runErr, restore()); err != nil {
+		return err
+	}
+	// The agent CLI wrote target itself
+	if data, err := os.ReadFile(target); err == nil {
+		return recordAudit("write", target, data, previous, "")
+	}
+	return nil
 }
 
-func checkGitStatus(opts Options) error {
+// referencedConfigs lists instruction files that are only known because a
+// tool config points at them, so the git safety check covers them too
+func referencedConfigs(scopes []packageScope) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	for _, scope := range scopes {
+		files, err := aiderReadFiles(scope.Dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			referenced[filepath.ToSlash(f)] = true
+		}
+	}
+	return referenced, nil
+}
+
+func checkGitStatus(referenced map[string]bool, opts Options) error {
 	// Check if we're in a git repo
 	cmd := exec.Command("git", "rev-parse", "--git-dir")
 	if err := cmd.Run(); err != nil {
 		if opts.Verbose {
-			fmt.Println("Not a git repository, skipping git check.")
+			fmt.Fprintln(opts.stdout(), tr("Not a git repository, skipping git check."))
 		}
 		return nil
 	}
 
 	// Check for uncommitted changes in relevant files
-	cmd = exec.Command("git", "status", "--porcelain")
+	cmd = exec.Command("git", append([]string{"status", "--porcelain", "--untracked-files=all", "--"}, opts.roots()...)...)
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("checking git status: %w", err)
@@ -347,7 +1222,7 @@ func checkGitStatus(opts Options) error {
 			continue
 		}
 		file := strings.TrimSpace(line[3:])
-		if isAgentConfigFile(file) {
+		if isAgentConfigFile(file, opts) || referenced[file] {
 			uncommitted = append(uncommitted, file)
 		}
 	}
@@ -368,12 +1243,13 @@ Or use --force to skip this check`,
 	return nil
 }
 
-func isAgentConfigFile(path string) bool {
+func isAgentConfigFile(path string, opts Options) bool {
 	base := filepath.Base(path)
 	agentFiles := []string{
-		"CLAUDE.md", "AGENTS.md", "CODEX.md", "GEMINI.md",
+		"CLAUDE.md", "AGENTS.md", "CODEX.md", "GEMINI.md", "CONVENTIONS.md",
 		".cursorrules", ".windsurfrules",
 		"copilot-instructions.md",
+		filepath.Base(opts.output()),
 	}
 	for _, af := range agentFiles {
 		if base == af {
@@ -386,62 +1262,121 @@ func isAgentConfigFile(path string) bool {
 	return false
 }
 
-func scanConfigs(opts Options) ([]AgentConfig, error) {
+func scanConfigs(dir string, opts Options) ([]AgentConfig, error) {
 	var configs []AgentConfig
+	project, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	if opts.Verbose {
-		fmt.Println("Scanning for agent configuration files...")
+		fmt.Fprintln(opts.stdout(), tr("Scanning for agent configuration files..."))
 	}
 
 	for _, agent := range agentPatterns {
 		for _, pattern := range agent.Patterns {
-			matches, err := filepath.Glob(pattern)
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
 			if err != nil {
 				continue
 			}
 
 			for _, match := range matches {
-				content, err := os.ReadFile(match)
-				if err != nil {
-					if opts.Verbose {
-						fmt.Printf("  [error] %s (error reading: %v)\n", match, err)
-					}
+				match = onDiskName(match)
+				content, ok := readSource(match, project.Scan.maxFileSize(), opts)
+				if !ok {
 					continue
 				}
 
 				if opts.Verbose {
-					fmt.Printf("  [ok] %s (%s)\n", match, agent.Name)
+					fmt.Fprintf(opts.stdout(), "  [ok] %s (%s)\n", match, agent.Name)
 				}
 
 				configs = append(configs, AgentConfig{
 					Path:    match,
 					Agent:   agent.Name,
-					Content: string(content),
+					Content: content,
 				})
 			}
 		}
 	}
 
-	// Also check for AGENTS.md
-	if _, err := os.Stat("AGENTS.md"); err == nil {
+	// Files aider loads through `read:` in its config
+	seen := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		seen[cfg.Path] = true
+	}
+	referenced, err := aiderReadFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range referenced {
+		if seen[path] || strings.EqualFold(filepath.Base(path), "AGENTS.md") || path == filepath.Join(dir, opts.output()) {
+			continue
+		}
+		content, ok := readSource(path, project.Scan.maxFileSize(), opts)
+		if !ok {
+			continue
+		}
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [ok] %s (Aider, read: in %s)\n", path, aiderConfigFile)
+		}
+		seen[path] = true
+		configs = append(configs, AgentConfig{
+			Path:    path,
+			Agent:   "Aider (" + aiderConfigFile + ")",
+			Content: content,
+		})
+	}
+
+	// Instructions kept in JSON and YAML settings
+	configs = append(configs, scanSettings(dir, opts)...)
+
+	// Sources contributed by scanner plugins
+	contributed, err := scanPlugins(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	configs = append(configs, contributed...)
+
+	// Also check for the canonical file. With a custom --output, a plain
+	// AGENTS.md is just another source to merge and link.
+	agentsPath := filepath.Join(dir, opts.output())
+	if _, err := os.Stat(agentsPath); err == nil {
 		if opts.Verbose {
-			fmt.Println("  [ok] AGENTS.md (standard)")
+			fmt.Fprintf(opts.stdout(), tr("  [ok] %s (canonical)\n"), agentsPath)
 		}
 		configs = append(configs, AgentConfig{
-			Path:  "AGENTS.md",
+			Path:  agentsPath,
 			Agent: "AGENTS.md",
 		})
 	}
+	if standard := filepath.Join(dir, "AGENTS.md"); standard != agentsPath && fileExists(standard) {
+		if content, ok := readSource(standard, project.Scan.maxFileSize(), opts); ok {
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [ok] %s (AGENTS.md standard)\n", standard)
+			}
+			configs = append(configs, AgentConfig{
+				Path:    standard,
+				Agent:   "AGENTS.md standard",
+				Content: content,
+			})
+		}
+	}
 
 	// Sort for consistent output
 	sort.Slice(configs, func(i, j int) bool {
 		return configs[i].Path < configs[j].Path
 	})
 
+	// Names that only differ in case are one file on macOS and Windows
+	configs = dropSameFiles(configs, opts)
+	warnCaseTwins(configs, opts)
+
 	return configs, nil
 }
 
-func isSymlinkToAgentsMD(path string) bool {
+// isSymlinkToAgentsMD reports whether path is a symlink resolving to agentsPath
+func isSymlinkToAgentsMD(path, agentsPath string) bool {
 	info, err := os.Lstat(path)
 	if err != nil {
 		return false
@@ -453,28 +1388,76 @@ func isSymlinkToAgentsMD(path string) bool {
 	if err != nil {
 		return false
 	}
-	return target == "AGENTS.md" || filepath.Base(target) == "AGENTS.md"
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	if filepath.Clean(target) == filepath.Clean(agentsPath) {
+		return true
+	}
+	// Fall back to comparing real paths so links through other symlinked
+	// directories, or absolute links, are recognized too
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	want, err := filepath.EvalSymlinks(agentsPath)
+	if err != nil {
+		return false
+	}
+	realAbs, err1 := filepath.Abs(real)
+	wantAbs, err2 := filepath.Abs(want)
+	return err1 == nil && err2 == nil && realAbs == wantAbs
 }
 
-func createSymlink(path string, opts Options) error {
+// validateOutput rejects canonical file names that would collide with a
+// tool-specific config file
+func validateOutput(output string) error {
+	if filepath.IsAbs(output) || strings.HasPrefix(output, "..") {
+		return fmt.Errorf("--output must be a path inside the project: %s", output)
+	}
+	for _, agent := range agentPatterns {
+		for _, pattern := range agent.Patterns {
+			if ok, _ := filepath.Match(pattern, output); ok {
+				return fmt.Errorf("--output %s is the %s config file; choose a different name", output, agent.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validatePath checks that --path is a directory inside the project
+func validatePath(dir string) error {
+	if filepath.IsAbs(dir) || strings.HasPrefix(dir, "..") {
+		return fmt.Errorf("--path must be a directory inside the project: %s", dir)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("--path: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--path %s is not a directory", dir)
+	}
+	return nil
+}
+
+func createSymlink(path, agentsPath string, opts Options) error {
+	// Keep the file when the link cannot replace it
+	if !symlinksAllowed() {
+		return fmt.Errorf("cannot create symlinks\n%s", developerModeHelp)
+	}
+	if sameFile(path, agentsPath) {
+		return errSameFile(path, agentsPath)
+	}
 	// Remove existing file
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+	if err := removeFile(path); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("removing existing file: %w", err)
 	}
 
 	// Calculate relative path to AGENTS.md from the symlink location
-	dir := filepath.Dir(path)
-	var target string
-	if dir == "." {
-		target = "AGENTS.md"
-	} else {
-		relPath, err := filepath.Rel(dir, "AGENTS.md")
-		if err != nil {
-			target = "AGENTS.md"
-		} else {
-			target = relPath
-		}
+	target, err := filepath.Rel(filepath.Dir(path), agentsPath)
+	if err != nil {
+		target = filepath.Base(agentsPath)
 	}
 
-	return os.Symlink(target, path)
+	return symlinkError(symlinkFile(target, path))
 }
@@ -0,0 +1,317 @@
+package cirby
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// canonicalCommandsDir holds one Markdown file per slash command, in the
+// Claude Code format: optional YAML frontmatter, then the prompt with
+// $ARGUMENTS standing for whatever follows the command
+const canonicalCommandsDir = ".cirby/commands"
+
+// slashCommand is a custom slash command in canonical form
+type slashCommand struct {
+	Name        string // path below the commands dir without extension, e.g. git/commit
+	Frontmatter string // YAML between the --- lines, without them
+	Body        string
+	Source      string // file the command was read from
+}
+
+// commandTool is an agent's project commands directory
+type commandTool struct {
+	Tool    string
+	Dir     string
+	BaseDir string // the tool counts as used when this directory exists
+	Ext     string
+	read    func(data []byte) (slashCommand, error)
+	// render is nil when the tool reads canonical files as-is, so its
+	// files can be symlinks
+	render func(cmd slashCommand) []byte
+}
+
+var commandTools = []commandTool{
+	{Tool: "Claude Code", Dir: ".claude/commands", BaseDir: ".claude", Ext: ".md", read: readMarkdownCommand},
+	{Tool: "Gemini CLI", Dir: ".gemini/commands", BaseDir: ".gemini", Ext: ".toml", read: readGeminiCommand, render: renderGeminiCommand},
+	{Tool: "Cursor", Dir: ".cursor/commands", BaseDir: ".cursor", Ext: ".md", read: readCursorCommand, render: renderCursorCommand},
+}
+
+// SyncCommands consolidates the custom slash commands of all agents into
+// canonicalCommandsDir and regenerates each agent's commands from it
+func SyncCommands(opts Options) error {
+	canonical, err := readCommandDir(canonicalCommandsDir, ".md", readMarkdownCommand)
+	if err != nil {
+		return err
+	}
+	commands := map[string]slashCommand{}
+	for _, cmd := range canonical {
+		commands[cmd.Name] = cmd
+	}
+
+	// Import commands that only exist in a tool directory
+	var imported []string
+	found := len(canonical) > 0
+	for _, tool := range commandTools {
+		toolCommands, err := readCommandDir(tool.Dir, tool.Ext, tool.read)
+		if err != nil {
+			return err
+		}
+		for _, cmd := range toolCommands {
+			found = true
+			existing, ok := commands[cmd.Name]
+			if !ok {
+				commands[cmd.Name] = cmd
+				imported = append(imported, cmd.Name)
+				continue
+			}
+			if strings.TrimSpace(existing.Body) != strings.TrimSpace(cmd.Body) {
+				fmt.Fprintf(opts.stdout(), "[warn] /%s differs between %s and %s; keeping %s\n",
+					cmd.Name, existing.Source, cmd.Source, existing.Source)
+			}
+		}
+	}
+
+	if !found {
+		fmt.Fprintln(opts.stdout(), "No custom slash commands found.")
+		return nil
+	}
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Plan the canonical files, then every tool's adapters
+	var writes []plannedWrite
+	var links []string
+	for _, name := range imported {
+		path := canonicalCommandPath(name)
+		writes = append(writes, plannedWrite{Path: path, Content: renderMarkdownCommand(commands[name])})
+	}
+	for _, tool := range commandTools {
+		if !dirExists(tool.BaseDir) {
+			continue
+		}
+		for _, name := range names {
+			path := filepath.Join(tool.Dir, filepath.FromSlash(name)+tool.Ext)
+			if tool.render == nil && linkMode(opts) == LinkSymlink {
+				if !isSymlinkToAgentsMD(path, canonicalCommandPath(name)) {
+					links = append(links, path)
+				}
+				continue
+			}
+
+			var content []byte
+			if tool.render == nil {
+				content = renderMarkdownCommand(commands[name])
+			} else {
+				content = tool.render(commands[name])
+			}
+			if current, err := os.ReadFile(path); err == nil && string(current) == string(content) {
+				if opts.Verbose {
+					fmt.Fprintf(opts.stdout(), "  [skip] %s (up to date)\n", path)
+				}
+				continue
+			}
+			writes = append(writes, plannedWrite{Path: path, Content: content})
+		}
+	}
+
+	if len(writes) == 0 && len(links) == 0 {
+		fmt.Fprintf(opts.stdout(), "[ok] Slash commands already in sync (%d commands).\n", len(commands))
+		return nil
+	}
+
+	if !opts.Force {
+		referenced := map[string]bool{}
+		for _, w := range writes {
+			referenced[filepath.ToSlash(w.Path)] = true
+		}
+		for _, path := range links {
+			referenced[filepath.ToSlash(path)] = true
+		}
+		if err := checkGitStatus(referenced, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		for _, w := range writes {
+			fmt.Fprintf(opts.stdout(), "  - Write %s\n", w.Path)
+		}
+		for _, path := range links {
+			fmt.Fprintf(opts.stdout(), "  - Create symlink: %s -> %s\n", path, canonicalCommandPath(commandName(path)))
+		}
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	for _, w := range writes {
+		if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(w.Path, w.Content, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", w.Path, err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Wrote %s\n", w.Path)
+	}
+	for _, path := range links {
+		target := canonicalCommandPath(commandName(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := createSymlink(path, target, opts); err != nil {
+			return fmt.Errorf("linking %s: %w", path, err)
+		}
+		fmt.Fprintf(opts.stdout(), tr("[ok] Symlinked %s -> %s\n"), path, target)
+	}
+
+	fmt.Fprintf(opts.stdout(), "\nDone! %d slash commands in sync.\n", len(commands))
+	return nil
+}
+
+func canonicalCommandPath(name string) string {
+	return filepath.Join(canonicalCommandsDir, filepath.FromSlash(name)+".md")
+}
+
+// commandName returns the command name of a file in a commands directory
+func commandName(path string) string {
+	for _, tool := range commandTools {
+		if rel, err := filepath.Rel(tool.Dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// readCommandDir reads every command below dir, skipping links into the
+// canonical directory
+func readCommandDir(dir, ext string, read func([]byte) (slashCommand, error)) ([]slashCommand, error) {
+	var commands []slashCommand
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ext {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		name := filepath.ToSlash(strings.TrimSuffix(rel, ext))
+		if dir != canonicalCommandsDir && isSymlinkToAgentsMD(path, canonicalCommandPath(name)) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		cmd, err := read(data)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		cmd.Name = name
+		cmd.Source = path
+		commands = append(commands, cmd)
+		return nil
+	})
+	return commands, err
+}
+
+func readMarkdownCommand(data []byte) (slashCommand, error) {
+	front, body := splitFrontmatter(string(data))
+	return slashCommand{Frontmatter: front, Body: body}, nil
+}
+
+// Cursor commands are plain Markdown without frontmatter
+func readCursorCommand(data []byte) (slashCommand, error) {
+	return slashCommand{Body: strings.TrimLeft(string(data), "\n")}, nil
+}
+
+// Gemini commands are TOML with a description and a prompt using {{args}}
+func readGeminiCommand(data []byte) (slashCommand, error) {
+	doc, err := parseTOML(data)
+	if err != nil {
+		return slashCommand{}, err
+	}
+	prompt, _ := doc["prompt"].(string)
+	if prompt == "" {
+		return slashCommand{}, fmt.Errorf("missing prompt")
+	}
+	var cmd slashCommand
+	if description, _ := doc["description"].(string); description != "" {
+		cmd.Frontmatter = "description: " + strconv.Quote(description)
+	}
+	cmd.Body = strings.ReplaceAll(prompt, "{{args}}", "$ARGUMENTS")
+	return cmd, nil
+}
+
+func renderMarkdownCommand(cmd slashCommand) []byte {
+	body := ensureTrailingNewline(cmd.Body)
+	if cmd.Frontmatter == "" {
+		return []byte(body)
+	}
+	return []byte("---\n" + cmd.Frontmatter + "\n---\n\n" + body)
+}
+
+func renderCursorCommand(cmd slashCommand) []byte {
+	return []byte(ensureTrailingNewline(cmd.Body))
+}
+
+func renderGeminiCommand(cmd slashCommand) []byte {
+	var b strings.Builder
+	if description := commandDescription(cmd); description != "" {
+		fmt.Fprintf(&b, "description = %s\n", formatTOMLString(description))
+	}
+	prompt := strings.ReplaceAll(ensureTrailingNewline(cmd.Body), "$ARGUMENTS", "{{args}}")
+	fmt.Fprintf(&b, "prompt = %s\n", formatTOMLString(prompt))
+	return []byte(b.String())
+}
+
+// commandDescription reads the description from a command's frontmatter
+func commandDescription(cmd slashCommand) string {
+	if cmd.Frontmatter == "" {
+		return ""
+	}
+	front, err := parseYAML([]byte(cmd.Frontmatter))
+	if err != nil {
+		return ""
+	}
+	m, _ := front.(map[string]any)
+	return yamlString(m["description"])
+}
+
+// splitFrontmatter separates a leading --- delimited YAML block from the
+// rest of a Markdown document
+func splitFrontmatter(content string) (front, body string) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(content, "---\n") {
+		return "", content
+	}
+	rest := content[len("---\n"):]
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return "", content
+	}
+	after := rest[end+len("\n---"):]
+	if after != "" && after[0] != '\n' {
+		return "", content
+	}
+	return rest[:end], strings.TrimLeft(after, "\n")
+}
+
+func ensureTrailingNewline(s string) string {
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
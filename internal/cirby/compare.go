@@ -0,0 +1,117 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// compareDir holds the candidates of cirby compare
+const compareDir = ".cirby/compare"
+
+// Compare runs the same merge with each of agents, writing every candidate
+// to .cirby/compare/<agent>.md, and shows how they differ and how they
+// score. AGENTS.md and the sources are left alone.
+func Compare(agents []string, opts Options) error {
+	if len(agents) < 2 {
+		return fmt.Errorf("usage: cirby compare <agent> <agent>...")
+	}
+	if opts.Template != "" {
+		if isNetworkRef(opts.Template) {
+			if err := requireOnline("fetching --template "+opts.Template, opts); err != nil {
+				return err
+			}
+		}
+		var err error
+		if opts.template, err = loadTemplate(opts.Template); err != nil {
+			return err
+		}
+	}
+
+	scope := packageScope{Dir: ".", Output: opts.output()}
+	agentsPath := scope.agentsPath()
+	configs, err := scanConfigs(scope.Dir, opts)
+	if err != nil {
+		return fmt.Errorf("scanning configs: %w", err)
+	}
+	var sources []AgentConfig
+	for _, cfg := range configs {
+		if cfg.Path != agentsPath && !isSymlinkToAgentsMD(cfg.Path, agentsPath) && !isCirbyCopy(cfg.Content) {
+			sources = append(sources, cfg)
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("nothing to merge: every config file already points at %s", agentsPath)
+	}
+	existing, err := os.ReadFile(agentsPath)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(compareDir, 0755); err != nil {
+		return err
+	}
+	type candidate struct {
+		agent, path string
+		content     string
+		score       qualityScore
+	}
+	var candidates []candidate
+	for i, name := range agents {
+		agentOpts := opts
+		agentOpts.Agent = name
+		agent, err := selectAgent(agentOpts)
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s: %v\n", name, err)
+			continue
+		}
+
+		// Each candidate starts from the same AGENTS.md
+		target := packageScope{Dir: scope.Dir, Output: filepath.Join(compareDir, agent.Name+".md"), Parent: scope.Parent}
+		path := target.agentsPath()
+		os.Remove(path)
+		var prompt string
+		if existed {
+			if err := os.WriteFile(path, existing, 0644); err != nil {
+				return err
+			}
+			prompt = buildMergeIntoExistingPrompt(string(existing), sources, target, opts.template)
+		} else {
+			prompt = buildMergePrompt(sources, target, opts.template)
+		}
+
+		fmt.Fprintf(opts.stdout(), "[%d/%d] Merging %d files with %s into %s...\n", i+1, len(agents), len(sources), agent.Name, path)
+		if err := executeAgent(agent, prompt, path, sources, opts); err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s: %v\n", agent.Name, err)
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s did not write %s\n", agent.Name, path)
+			continue
+		}
+		candidates = append(candidates, candidate{agent.Name, path, string(content), scoreMerge(sources, string(content))})
+	}
+	if len(candidates) < 2 {
+		return fmt.Errorf("need at least two merge results to compare, got %d", len(candidates))
+	}
+
+	style := styleFor(opts.stdout(), opts)
+	first := candidates[0]
+	for _, c := range candidates[1:] {
+		fmt.Fprintln(opts.stdout())
+		fmt.Fprint(opts.stdout(), sideBySide(first.path, c.path, splitLines(first.content), splitLines(c.content), terminalWidth(), style))
+	}
+
+	fmt.Fprintln(opts.stdout(), "\nQuality:")
+	best := first
+	for _, c := range candidates {
+		fmt.Fprintf(opts.stdout(), "  %-10s %3d/100  %s\n", c.agent, c.score.Score, c.score)
+		if c.score.Score > best.score.Score {
+			best = c
+		}
+	}
+	fmt.Fprintf(opts.stdout(), "\nCandidates are in %s. To merge with the best scoring agent, run: cirby %s\n", compareDir, best.agent)
+	return nil
+}
@@ -0,0 +1,174 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxLength is a parsed --max-length: a number of tokens or characters
+type maxLength struct {
+	N     int
+	Chars bool
+}
+
+// parseMaxLength reads --max-length: 4000 or 4k for tokens, 16000c or
+// 16kc for characters
+func parseMaxLength(s string) (maxLength, error) {
+	var l maxLength
+	v := strings.ToLower(strings.TrimSpace(s))
+	if strings.HasSuffix(v, "c") {
+		l.Chars, v = true, strings.TrimSuffix(v, "c")
+	}
+	mult := 1
+	if strings.HasSuffix(v, "k") {
+		mult, v = 1000, strings.TrimSuffix(v, "k")
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return l, fmt.Errorf("invalid --max-length %q: use a number of tokens (4000, 4k) or characters (16000c, 16kc)", s)
+	}
+	l.N = n * mult
+	return l, nil
+}
+
+// of measures content in the unit of l
+func (l maxLength) of(content string) int {
+	if l.Chars {
+		return len([]rune(content))
+	}
+	return estimateTokens(content)
+}
+
+// format shows n in the unit of l
+func (l maxLength) format(n int) string {
+	if l.Chars {
+		return formatCount(n) + " characters"
+	}
+	return "~" + formatCount(n) + " tokens"
+}
+
+// condenseMerge shortens agentsPath when it is longer than --max-length:
+// the merge agent condenses it, and what is still too long is cut down
+// without a model (see condenseHeuristic). Merges without an agent only
+// get the heuristic pass.
+func condenseMerge(agentsPath string, agent SupportedAgent, opts Options) error {
+	if opts.MaxLength == "" {
+		return nil
+	}
+	limit, err := parseMaxLength(opts.MaxLength)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	size := limit.of(string(data))
+	if size <= limit.N {
+		return nil
+	}
+
+	if agent.Merge == nil {
+		fmt.Fprintf(opts.stdout(), "Condensing %s (%s, limit %s) with %s...\n", agentsPath, limit.format(size), limit.format(limit.N), agent.Name)
+		if err := executeAgent(agent, buildCondensePrompt(agentsPath, limit), agentsPath, nil, opts); err != nil {
+			return fmt.Errorf("condensing %s: %w", agentsPath, err)
+		}
+		if data, err = os.ReadFile(agentsPath); err != nil {
+			return err
+		}
+	}
+
+	content := string(data)
+	if limit.of(content) > limit.N {
+		var dropped int
+		content, dropped = condenseHeuristic(content, limit)
+		if err := writeFile(agentsPath, []byte(content), 0644); err != nil {
+			return err
+		}
+		if dropped > 0 {
+			fmt.Fprintf(opts.stdout(), "  - Dropped %d paragraphs, code blocks and list items to fit\n", dropped)
+		}
+	}
+	if after := limit.of(content); after > limit.N {
+		fmt.Fprintf(opts.stdout(), "[warn] %s is still %s, over the limit of %s\n", agentsPath, limit.format(after), limit.format(limit.N))
+		return nil
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Condensed %s from %s to %s\n", agentsPath, limit.format(size), limit.format(limit.of(content)))
+	return nil
+}
+
+func buildCondensePrompt(agentsPath string, limit maxLength) string {
+	return fmt.Sprintf(`%[1]s is too long for some coding agents to use. Condense it in place to at most %[2]s.
+
+- Keep every instruction that changes how to work in this project: commands, conventions, constraints, warnings.
+- Drop repetition, explanations of why, filler and examples that restate a rule.
+- Merge related rules and prefer short list items over prose.
+- Keep the headings and their order.
+- Keep every block between <!-- cirby:section NAME --> and <!-- /cirby:section NAME --> markers exactly as it is, including the markers.
+
+Update the %[1]s file now.`, agentsPath, limit.format(limit.N))
+}
+
+// condenseHeuristic cuts content down to limit without a model: first
+// prose paragraphs, then code blocks, then list items, always from the end
+// of the longest section. Headings and generated sections stay. It returns
+// the result and how many blocks and items it dropped.
+func condenseHeuristic(content string, limit maxLength) (string, int) {
+	doc := parseDoc(splitLines(content))
+	dropped := 0
+	isGenerated := func(b docBlock) bool {
+		return strings.HasPrefix(strings.TrimSpace(b.Lines[0]), "<!-- cirby:section ")
+	}
+	isCode := func(b docBlock) bool {
+		t := strings.TrimSpace(b.Lines[0])
+		return strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~")
+	}
+	passes := []func(b docBlock) bool{
+		func(b docBlock) bool { return !b.List && !isCode(b) && !isGenerated(b) },
+		func(b docBlock) bool { return isCode(b) },
+		func(b docBlock) bool { return b.List },
+	}
+
+	for _, droppable := range passes {
+		for limit.of(renderDoc(doc)) > limit.N {
+			// The longest section with something left to drop
+			best, bestSize := -1, 0
+			for i, s := range doc {
+				for _, b := range s.Blocks {
+					if droppable(b) {
+						if size := limit.of(renderDoc([]docSection{s})); size > bestSize {
+							best, bestSize = i, size
+						}
+						break
+					}
+				}
+			}
+			if best < 0 {
+				break
+			}
+			s := &doc[best]
+			for j := len(s.Blocks) - 1; j >= 0; j-- {
+				b := s.Blocks[j]
+				if !droppable(b) {
+					continue
+				}
+				if items := listItems(b.Lines); b.List && len(items) > 1 {
+					// Drop the last item, not the whole list
+					kept := items[:len(items)-1]
+					var lines []string
+					for _, item := range kept {
+						lines = append(lines, item...)
+					}
+					s.Blocks[j].Lines = lines
+				} else {
+					s.Blocks = append(s.Blocks[:j:j], s.Blocks[j+1:]...)
+				}
+				dropped++
+				break
+			}
+		}
+	}
+	return renderDoc(doc), dropped
+}
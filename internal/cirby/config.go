@@ -0,0 +1,300 @@
+package cirby
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// projectConfigFiles are the names cirby reads its project settings from
+var projectConfigFiles = []string{".cirby.yaml", ".cirby.yml"}
+
+// projectConfig is the content of .cirby.yaml
+type projectConfig struct {
+	Path       string // file it was read from, "" when there is none
+	Remote     *remoteConfig
+	HandEdits  string // check.hand_edits: "fail" (default) or "warn"
+	API        apiConfig
+	Scrub      []*regexp.Regexp // scrub.patterns and scrub.keywords, masked before content reaches an agent
+	Dedup      dedupConfig
+	Pipeline   []pipelinePass // passes that replace the single merge prompt
+	MinScore   int            // quality.min_score: the score --strict requires
+	Structure  structureConfig
+	Lint       []lintRule
+	TOC        tocConfig
+	Split      splitConfig
+	Agents     map[string]agentOverride // how agent CLIs are run, by agent name
+	Detect     detectConfig
+	Plugins    []scannerPlugin
+	Wasm       []wasmPlugin // plugins: with a wasm module, run in process
+	Hooks      hooksConfig
+	Notify     notifyConfig
+	Metrics    metricsConfig
+	Generation generationParams
+	Logs       logsConfig
+	Scan       scanConfig
+	Backups    backupsConfig
+}
+
+// apiConfig holds network settings for the API backends, for use behind
+// corporate proxies and TLS-intercepting gateways:
+//
+//	api:
+//	  proxy: http://proxy.example.com:8080
+//	  ca_bundle: certs/corp-root.pem
+//	  client_cert: ~/.certs/me.pem
+//	  client_key: ~/.certs/me-key.pem
+type apiConfig struct {
+	Proxy      string // overrides HTTPS_PROXY; NO_PROXY still applies
+	CABundle   string // PEM file trusted in addition to the system roots
+	ClientCert string // PEM certificate for mutual TLS
+	ClientKey  string
+}
+
+// dedupConfig chooses how near-duplicate rules are found after a merge:
+//
+//	dedup:
+//	  enabled: true              # always, not only with --dedup
+//	  model: nomic-embed-text    # Ollama embedding model
+//	  command: ./embed.py        # or a program: JSON strings in, JSON vectors out
+//	  threshold: 0.92            # cosine similarity that counts as a duplicate
+type dedupConfig struct {
+	Enabled   bool
+	Model     string
+	Command   string
+	Threshold float64
+}
+
+// remoteConfig points at shared AGENTS.md fragments maintained elsewhere:
+//
+//	remote:
+//	  url: https://github.com/my-org/agent-guidelines.git
+//	  ref: main
+//	  paths: [security.md, style.md]
+type remoteConfig struct {
+	URL   string
+	Ref   string   // git branch or tag; default branch when empty
+	Paths []string // files in the repository, or below the URL for HTTPS
+	Git   bool     // fetch with git even if the URL does not look like a repository
+}
+
+func loadProjectConfig() (projectConfig, error) {
+	for _, path := range projectConfigFiles {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return projectConfig{}, err
+		}
+		parsed, err := parseYAML(data)
+		if err != nil {
+			return projectConfig{}, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		doc, _ := parsed.(map[string]any)
+		cfg := projectConfig{Path: path}
+		if remote, ok := doc["remote"].(map[string]any); ok {
+			cfg.Remote = &remoteConfig{
+				URL:   yamlString(remote["url"]),
+				Ref:   yamlString(remote["ref"]),
+				Paths: yamlStrings(remote["paths"]),
+			}
+			cfg.Remote.Git, _ = yamlBool(remote["git"])
+			if cfg.Remote.URL == "" {
+				return projectConfig{}, fmt.Errorf("%s: remote.url is required", path)
+			}
+		}
+		if check, ok := doc["check"].(map[string]any); ok {
+			cfg.HandEdits = yamlString(check["hand_edits"])
+			if cfg.HandEdits != "" && cfg.HandEdits != "fail" && cfg.HandEdits != "warn" {
+				return projectConfig{}, fmt.Errorf("%s: check.hand_edits must be fail or warn", path)
+			}
+		}
+		if api, ok := doc["api"].(map[string]any); ok {
+			cfg.API = apiConfig{
+				Proxy:      yamlString(api["proxy"]),
+				CABundle:   yamlString(api["ca_bundle"]),
+				ClientCert: yamlString(api["client_cert"]),
+				ClientKey:  yamlString(api["client_key"]),
+			}
+			if (cfg.API.ClientCert == "") != (cfg.API.ClientKey == "") {
+				return projectConfig{}, fmt.Errorf("%s: api.client_cert and api.client_key must be set together", path)
+			}
+		}
+		if scrub, ok := doc["scrub"].(map[string]any); ok {
+			for _, pattern := range yamlStrings(scrub["patterns"]) {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return projectConfig{}, fmt.Errorf("%s: scrub.patterns: %w", path, err)
+				}
+				cfg.Scrub = append(cfg.Scrub, re)
+			}
+			for _, keyword := range yamlStrings(scrub["keywords"]) {
+				cfg.Scrub = append(cfg.Scrub, regexp.MustCompile(`(?i)\b`+regexp.QuoteMeta(keyword)+`\b`))
+			}
+		}
+		if dedup, ok := doc["dedup"].(map[string]any); ok {
+			cfg.Dedup.Enabled, _ = yamlBool(dedup["enabled"])
+			cfg.Dedup.Model = yamlString(dedup["model"])
+			cfg.Dedup.Command = yamlString(dedup["command"])
+			if t := yamlString(dedup["threshold"]); t != "" {
+				threshold, err := strconv.ParseFloat(t, 64)
+				if err != nil || threshold <= 0 || threshold > 1 {
+					return projectConfig{}, fmt.Errorf("%s: dedup.threshold must be a number between 0 and 1", path)
+				}
+				cfg.Dedup.Threshold = threshold
+			}
+		}
+		if quality, ok := doc["quality"].(map[string]any); ok {
+			if v := yamlString(quality["min_score"]); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > 100 {
+					return projectConfig{}, fmt.Errorf("%s: quality.min_score must be a number between 1 and 100", path)
+				}
+				cfg.MinScore = n
+			}
+		}
+		if structure, ok := doc["structure"].(map[string]any); ok {
+			cfg.Structure.Required = yamlStrings(structure["required"])
+			cfg.Structure.Outline = yamlStrings(structure["outline"])
+			cfg.Structure.NoToolNames, _ = yamlBool(structure["no_tool_names"])
+			cfg.Structure.Unknown = yamlString(structure["unknown"])
+			if u := cfg.Structure.Unknown; u != "" && u != "start" && u != "end" && !matchesTitle(u, headingsOf(cfg.Structure.Outline)) {
+				return projectConfig{}, fmt.Errorf("%s: structure.unknown must be start, end or a section of structure.outline", path)
+			}
+			if v := yamlString(structure["max_tokens"]); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					return projectConfig{}, fmt.Errorf("%s: structure.max_tokens must be a positive number", path)
+				}
+				cfg.Structure.MaxTokens = n
+			}
+		}
+		if v, ok := doc["lint"]; ok {
+			if cfg.Lint, err = parseLintRules(v, path); err != nil {
+				return projectConfig{}, err
+			}
+		}
+		if toc, ok := doc["toc"].(map[string]any); ok {
+			cfg.TOC.Enabled, _ = yamlBool(toc["enabled"])
+			for key, n := range map[string]*int{"depth": &cfg.TOC.Depth, "min_sections": &cfg.TOC.MinSections} {
+				if v := yamlString(toc[key]); v != "" {
+					var err error
+					if *n, err = strconv.Atoi(v); err != nil || *n < 0 {
+						return projectConfig{}, fmt.Errorf("%s: toc.%s must be a positive number", path, key)
+					}
+				}
+			}
+		}
+		if split, ok := doc["split"].(map[string]any); ok {
+			if v := yamlString(split["threshold"]); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					return projectConfig{}, fmt.Errorf("%s: split.threshold must be a positive number", path)
+				}
+				cfg.Split.Threshold = n
+			}
+			cfg.Split.Dir = yamlString(split["dir"])
+			cfg.Split.Keep = yamlStrings(split["keep"])
+		}
+		if v, ok := doc["agents"]; ok {
+			if cfg.Agents, err = parseAgentOverrides(v, path); err != nil {
+				return projectConfig{}, err
+			}
+		}
+		if hooks, ok := doc["hooks"].(map[string]any); ok {
+			cfg.Hooks = hooksConfig{PreMerge: yamlStrings(hooks["pre_merge"]), PostMerge: yamlStrings(hooks["post_merge"]), PostLink: yamlStrings(hooks["post_link"])}
+			for _, key := range sortedKeys(hooks) {
+				if key != "pre_merge" && key != "post_merge" && key != "post_link" {
+					return projectConfig{}, fmt.Errorf("%s: hooks.%s: unknown hook (pre_merge, post_merge, post_link)", path, key)
+				}
+			}
+		}
+		if notify, ok := doc["notify"].(map[string]any); ok {
+			cfg.Notify = notifyConfig{URL: yamlString(notify["url"]), Format: yamlString(notify["format"]), On: yamlString(notify["on"])}
+			switch {
+			case cfg.Notify.URL == "":
+				return projectConfig{}, fmt.Errorf("%s: notify.url is required", path)
+			case cfg.Notify.Format != "" && cfg.Notify.Format != "json" && cfg.Notify.Format != "slack":
+				return projectConfig{}, fmt.Errorf("%s: notify.format must be json or slack", path)
+			case cfg.Notify.On != "" && cfg.Notify.On != "changes" && cfg.Notify.On != "failures" && cfg.Notify.On != "always":
+				return projectConfig{}, fmt.Errorf("%s: notify.on must be changes, failures or always", path)
+			}
+		}
+		if metrics, ok := doc["metrics"].(map[string]any); ok {
+			cfg.Metrics = metricsConfig{File: yamlString(metrics["file"]), StatsD: yamlString(metrics["statsd"])}
+			if addr := cfg.Metrics.StatsD; addr != "" {
+				if _, _, err := net.SplitHostPort(addr); err != nil {
+					return projectConfig{}, fmt.Errorf("%s: metrics.statsd must be host:port", path)
+				}
+			}
+		}
+		if v, ok := doc["plugins"]; ok {
+			if cfg.Plugins, cfg.Wasm, err = parsePlugins(v, path); err != nil {
+				return projectConfig{}, err
+			}
+		}
+		if detect, ok := doc["detect"].(map[string]any); ok {
+			cfg.Detect = detectConfig{Order: yamlStrings(detect["order"]), Exclude: yamlStrings(detect["exclude"]), Versions: yamlString(detect["versions"])}
+			if v := cfg.Detect.Versions; v != "" && v != "warn" && v != "fail" && v != "off" {
+				return projectConfig{}, fmt.Errorf("%s: detect.versions must be warn, fail or off", path)
+			}
+			for key, names := range map[string][]string{"order": cfg.Detect.Order, "exclude": cfg.Detect.Exclude} {
+				for _, name := range names {
+					if _, ok := findAgent(name); !ok {
+						return projectConfig{}, fmt.Errorf("%s: detect.%s: unknown agent %s", path, key, name)
+					}
+				}
+			}
+		}
+		if logs, ok := doc["logs"].(map[string]any); ok {
+			if enabled, set := yamlBool(logs["enabled"]); set {
+				cfg.Logs.Disabled = !enabled
+			}
+			if v := yamlString(logs["keep"]); v != "" {
+				if cfg.Logs.Keep, err = strconv.Atoi(v); err != nil || cfg.Logs.Keep <= 0 {
+					return projectConfig{}, fmt.Errorf("%s: logs.keep must be a positive number", path)
+				}
+			}
+			if v := yamlString(logs["max_age"]); v != "" {
+				if cfg.Logs.MaxAge, err = time.ParseDuration(v); err != nil || cfg.Logs.MaxAge <= 0 {
+					return projectConfig{}, fmt.Errorf("%s: logs.max_age must be a duration such as 168h", path)
+				}
+			}
+		}
+		if backups, ok := doc["backups"].(map[string]any); ok {
+			if v := yamlString(backups["keep"]); v != "" {
+				if cfg.Backups.Keep, err = strconv.Atoi(v); err != nil || cfg.Backups.Keep <= 0 {
+					return projectConfig{}, fmt.Errorf("%s: backups.keep must be a positive number", path)
+				}
+			}
+			if v := yamlString(backups["max_age"]); v != "" {
+				if cfg.Backups.MaxAge, err = time.ParseDuration(v); err != nil || cfg.Backups.MaxAge <= 0 {
+					return projectConfig{}, fmt.Errorf("%s: backups.max_age must be a duration such as 720h", path)
+				}
+			}
+		}
+		if scan, ok := doc["scan"].(map[string]any); ok {
+			if v := yamlString(scan["max_file_size"]); v != "" {
+				if cfg.Scan.MaxFileSize, err = parseSize(v); err != nil {
+					return projectConfig{}, fmt.Errorf("%s: scan.max_file_size must be a size such as 256KiB", path)
+				}
+			}
+		}
+		if generation, ok := doc["generation"].(map[string]any); ok {
+			if cfg.Generation, err = parseGeneration(generation, path); err != nil {
+				return projectConfig{}, err
+			}
+		}
+		if v, ok := doc["pipeline"]; ok {
+			if cfg.Pipeline, err = parsePipeline(v, path); err != nil {
+				return projectConfig{}, err
+			}
+		}
+		return cfg, nil
+	}
+	return projectConfig{}, nil
+}
@@ -0,0 +1,165 @@
+package cirby
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// mergeConflict is one conflict of a merge3 result
+type mergeConflict struct {
+	Start, End          int // line range of the markers in the result, End exclusive
+	Heading             string
+	Labels              mergeLabels
+	Local, Base, Remote []string
+}
+
+// parseConflicts finds the conflicts merge3 marked in lines
+func parseConflicts(lines []string) []mergeConflict {
+	var conflicts []mergeConflict
+	heading := ""
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], conflictStart) {
+			var isHeading bool
+			isHeading, inFence = markdownHeading(lines[i], inFence)
+			if isHeading {
+				heading = strings.TrimSpace(lines[i])
+			}
+			continue
+		}
+
+		c := mergeConflict{Start: i, Heading: heading}
+		c.Labels.Local = strings.TrimPrefix(lines[i], conflictStart)
+		side := &c.Local
+		j := i + 1
+		for ; j < len(lines); j++ {
+			line := lines[j]
+			switch {
+			case strings.HasPrefix(line, conflictBase):
+				c.Labels.Base = strings.TrimPrefix(line, conflictBase)
+				side = &c.Base
+			case line == conflictMiddle:
+				side = &c.Remote
+			case strings.HasPrefix(line, conflictEnd):
+				c.Labels.Remote = strings.TrimPrefix(line, conflictEnd)
+				side = nil
+			default:
+				*side = append(*side, line)
+			}
+			if side == nil {
+				break
+			}
+		}
+		if j == len(lines) {
+			return conflicts // unterminated, leave it alone
+		}
+		c.End = j + 1
+		conflicts = append(conflicts, c)
+		i = j
+	}
+	return conflicts
+}
+
+// resolveConflicts walks through the conflicts in lines at the terminal,
+// letting the user keep either side, both, or their own text. Conflicts
+// the user defers stay marked, for the agent to resolve. It returns the
+// new lines and the number of conflicts left.
+func resolveConflicts(lines []string, opts Options) ([]string, int) {
+	conflicts := parseConflicts(lines)
+	if len(conflicts) == 0 {
+		return lines, 0
+	}
+	reader := bufio.NewReader(opts.stdin())
+	out := opts.stdout()
+
+	var result []string
+	last, deferred := 0, 0
+	for n, c := range conflicts {
+		result = append(result, lines[last:c.Start]...)
+		last = c.End
+
+		fmt.Fprintf(out, "\nConflict %d of %d", n+1, len(conflicts))
+		if c.Heading != "" {
+			fmt.Fprintf(out, " (under %q)", c.Heading)
+		}
+		fmt.Fprintln(out, ":")
+		printConflictSide(out, c.Labels.Local, c.Local)
+		if c.Labels.Base != "" {
+			printConflictSide(out, c.Labels.Base, c.Base)
+		}
+		printConflictSide(out, c.Labels.Remote, c.Remote)
+
+		switch askConflictChoice(reader, c, opts) {
+		case "l":
+			result = append(result, c.Local...)
+		case "r":
+			result = append(result, c.Remote...)
+		case "b":
+			result = append(result, c.Local...)
+			for _, line := range c.Remote {
+				if strings.TrimSpace(line) == "" || !slices.Contains(c.Local, line) {
+					result = append(result, line)
+				}
+			}
+		case "e":
+			fmt.Fprintln(out, "Enter the replacement text, then a line with only \".\":")
+			result = append(result, readUntilDot(reader)...)
+		default:
+			result = append(result, lines[c.Start:c.End]...)
+			deferred++
+		}
+	}
+	result = append(result, lines[last:]...)
+	return result, deferred
+}
+
+func printConflictSide(out io.Writer, label string, lines []string) {
+	fmt.Fprintf(out, "  %s:\n", label)
+	if len(lines) == 0 {
+		fmt.Fprintln(out, "    (nothing)")
+	}
+	for _, line := range lines {
+		fmt.Fprintf(out, "    | %s\n", line)
+	}
+}
+
+func askConflictChoice(reader *bufio.Reader, c mergeConflict, opts Options) string {
+	for {
+		fmt.Fprintf(opts.stdout(), "[l] keep %s  [r] take %s  [b] both  [e] edit  [a] leave to the agent (default): ",
+			c.Labels.Local, c.Labels.Remote)
+		input, err := reader.ReadString('\n')
+		switch choice := strings.ToLower(strings.TrimSpace(input)); choice {
+		case "l", "r", "b", "e":
+			return choice
+		case "", "a":
+			return "a"
+		default:
+			if err != nil {
+				return "a" // input ended: leave the rest to the agent
+			}
+			fmt.Fprintf(opts.stdout(), "Unknown choice %q\n", choice)
+		}
+	}
+}
+
+// readUntilDot reads lines up to a line containing only "."
+func readUntilDot(reader *bufio.Reader) []string {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." {
+			return lines
+		}
+		if err != nil {
+			if line != "" {
+				lines = append(lines, line)
+			}
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
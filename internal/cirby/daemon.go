@@ -0,0 +1,169 @@
+package cirby
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// daemonSocket is where cirby daemon listens. Unix sockets also work on
+// Windows 10 and later, so there is no separate named pipe.
+const daemonSocket = ".cirby/daemon.sock"
+
+// daemonPoll is how often the daemon looks for changed config files
+const daemonPoll = 2 * time.Second
+
+// daemonState is what the daemon knows about the repository, kept current
+// so queries are answered without scanning
+type daemonState struct {
+	InSync    bool           `json:"in_sync"`
+	Files     []configStatus `json:"files"`
+	CheckOK   bool           `json:"check_ok"`
+	Check     string         `json:"check"`
+	UpdatedAt time.Time      `json:"updated_at"`
+
+	fingerprint string
+}
+
+type daemon struct {
+	opts  Options
+	mu    sync.Mutex // guards state
+	state daemonState
+	merge sync.Mutex // one merge at a time
+}
+
+// Daemon watches the repository and answers JSON-RPC requests (status,
+// check and the methods of cirby rpc), one per line, on .cirby/daemon.sock
+// until interrupted
+func Daemon(opts Options) error {
+	if err := os.MkdirAll(".cirby", 0755); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", daemonSocket); err == nil {
+		conn.Close()
+		return fmt.Errorf("a cirby daemon is already listening on %s", daemonSocket)
+	}
+	os.Remove(daemonSocket) // left behind by a daemon that did not exit cleanly
+	ln, err := net.Listen("unix", daemonSocket)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", daemonSocket, err)
+	}
+	defer os.Remove(daemonSocket)
+
+	d := &daemon{opts: opts}
+	if err := d.refresh(); err != nil {
+		ln.Close()
+		return err
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] cirby daemon listening on %s (Ctrl-C to stop)\n", daemonSocket)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		ln.Close()
+	}()
+	go d.watch()
+
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			fmt.Fprintln(opts.stdout(), "\nStopped.")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := serveRPC(conn, conn, d.handle); err != nil && d.opts.Verbose {
+				fmt.Fprintf(d.opts.stdout(), "  [error] connection: %v\n", err)
+			}
+		}()
+	}
+}
+
+// watch refreshes the state whenever config files change
+func (d *daemon) watch() {
+	for range time.Tick(daemonPoll) {
+		if err := d.refresh(); err != nil && d.opts.Verbose {
+			fmt.Fprintf(d.opts.stdout(), "  [error] refreshing: %v\n", err)
+		}
+	}
+}
+
+// refresh rescans the repository and, if anything changed, recomputes the
+// sync status and the integrity check
+func (d *daemon) refresh() error {
+	statuses, err := inspectConfigs(d.opts)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	json.NewEncoder(h).Encode(statuses)
+	lock, _ := os.ReadFile(lockFile)
+	h.Write(lock)
+	for _, st := range statuses {
+		data, _ := os.ReadFile(st.Path)
+		h.Write(data)
+	}
+	fingerprint := hex.EncodeToString(h.Sum(nil))
+
+	d.mu.Lock()
+	unchanged := fingerprint == d.state.fingerprint
+	d.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	state := daemonState{InSync: true, Files: statuses, UpdatedAt: time.Now().UTC(), fingerprint: fingerprint}
+	for _, st := range statuses {
+		state.InSync = state.InSync && st.inSync()
+	}
+	var out bytes.Buffer
+	checkOpts := d.opts
+	checkOpts.Stdout = &out
+	err = Check(checkOpts)
+	state.CheckOK = err == nil
+	state.Check = out.String()
+	if err != nil {
+		state.Check += err.Error() + "\n"
+	}
+
+	d.mu.Lock()
+	d.state = state
+	d.mu.Unlock()
+	if d.opts.Verbose {
+		fmt.Fprintf(d.opts.stdout(), "  - %s: in sync %t, check ok %t\n", state.UpdatedAt.Format(time.TimeOnly), state.InSync, state.CheckOK)
+	}
+	return nil
+}
+
+// handle answers status and check from the watched state, and everything
+// else like cirby rpc
+func (d *daemon) handle(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "status":
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.state, nil
+	case "check":
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return map[string]any{"ok": d.state.CheckOK, "output": d.state.Check}, nil
+	case "merge":
+		d.merge.Lock()
+		defer d.merge.Unlock()
+		defer d.refresh()
+	}
+	return editorHandler(d.opts)(method, params)
+}
@@ -0,0 +1,244 @@
+package cirby
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultDedupThreshold is the cosine similarity above which two rules
+// count as the same instruction
+const defaultDedupThreshold = 0.92
+
+// embedder turns texts into vectors whose cosine similarity reflects how
+// alike the texts are in meaning
+type embedder interface {
+	embed(texts []string) ([][]float64, error)
+}
+
+// ollamaEmbedder uses the embedding endpoint of a local Ollama server
+type ollamaEmbedder struct {
+	Model string
+}
+
+func (e ollamaEmbedder) embed(texts []string) ([][]float64, error) {
+	body, err := json.Marshal(map[string]any{"model": e.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	u := strings.TrimSuffix(ollamaAPI.url(), ollamaAPI.Path) + "/api/embed"
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ollama embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Embeddings [][]float64 `json:"embeddings"`
+		Error      string      `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("ollama embeddings: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ollama embeddings (%s): %s", resp.Status, out.Error)
+	}
+	return out.Embeddings, nil
+}
+
+// commandEmbedder runs a user-supplied program that reads a JSON array of
+// strings on stdin and writes a JSON array of vectors to stdout
+type commandEmbedder struct {
+	Command string
+}
+
+func (e commandEmbedder) embed(texts []string) ([][]float64, error) {
+	input, err := json.Marshal(texts)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("sh", "-c", e.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("embedder %q: %w", e.Command, err)
+	}
+	var vectors [][]float64
+	if err := json.Unmarshal(out, &vectors); err != nil {
+		return nil, fmt.Errorf("embedder %q: expected a JSON array of vectors: %w", e.Command, err)
+	}
+	return vectors, nil
+}
+
+// dedupRule is one instruction in AGENTS.md that may be a duplicate: a
+// list item or a one-line paragraph
+type dedupRule struct {
+	Line int
+	Text string
+}
+
+// dedupRules finds the rules of a Markdown document, skipping headings,
+// code, tables and generated sections
+func dedupRules(lines []string) []dedupRule {
+	var rules []dedupRule
+	inFence, inSection := false, false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			inFence = !inFence
+			continue
+		case strings.HasPrefix(trimmed, "<!-- cirby:section "):
+			inSection = true
+			continue
+		case strings.HasPrefix(trimmed, "<!-- /cirby:section "):
+			inSection = false
+			continue
+		}
+		if inFence || inSection || trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "|") {
+			continue
+		}
+		item := listItemText(trimmed)
+		if item == "" {
+			// A paragraph line only counts when it is the whole paragraph
+			prevBlank := i == 0 || strings.TrimSpace(lines[i-1]) == ""
+			nextBlank := i == len(lines)-1 || strings.TrimSpace(lines[i+1]) == ""
+			if !prevBlank || !nextBlank {
+				continue
+			}
+			item = trimmed
+		}
+		if len(strings.Fields(item)) >= 3 {
+			rules = append(rules, dedupRule{Line: i, Text: item})
+		}
+	}
+	return rules
+}
+
+// listItemText returns the text of a Markdown list item, or ""
+func listItemText(line string) string {
+	for _, marker := range []string{"- ", "* ", "+ "} {
+		if rest, ok := strings.CutPrefix(line, marker); ok {
+			return strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(rest, "[ ] "), "[x] "))
+		}
+	}
+	if n := strings.IndexAny(line, ".)"); n > 0 && n <= 3 && strings.Trim(line[:n], "0123456789") == "" && strings.HasPrefix(line[n+1:], " ") {
+		return strings.TrimSpace(line[n+1:])
+	}
+	return ""
+}
+
+// cosine is the cosine similarity of two vectors
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range min(len(a), len(b)) {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// dedupMerge removes rules from the merged file at agentsPath that mean
+// the same as an earlier rule, as judged by the configured embedder. It
+// runs with --dedup or dedup.enabled in .cirby.yaml.
+func dedupMerge(agentsPath string, opts Options) error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if !opts.Dedup && !cfg.Dedup.Enabled {
+		return nil
+	}
+	emb, err := newEmbedder(cfg.Dedup, opts)
+	if err != nil {
+		return err
+	}
+	threshold := cfg.Dedup.Threshold
+	if threshold <= 0 {
+		threshold = defaultDedupThreshold
+	}
+
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	lines := splitLines(string(data))
+	rules := dedupRules(lines)
+	if len(rules) < 2 {
+		return nil
+	}
+	texts := make([]string, len(rules))
+	for i, r := range rules {
+		texts[i] = r.Text
+	}
+	vectors, err := emb.embed(texts)
+	if err != nil {
+		return fmt.Errorf("deduplicating %s: %w", agentsPath, err)
+	}
+	if len(vectors) != len(rules) {
+		return fmt.Errorf("deduplicating %s: embedder returned %d vectors for %d rules", agentsPath, len(vectors), len(rules))
+	}
+
+	drop := map[int]bool{}
+	for j := range rules {
+		for i := range j {
+			if drop[rules[i].Line] {
+				continue
+			}
+			if sim := cosine(vectors[i], vectors[j]); sim >= threshold {
+				drop[rules[j].Line] = true
+				if opts.Verbose {
+					fmt.Fprintf(opts.stdout(), "  - Duplicate (%.2f): %q repeats %q\n", sim, fitColumn(rules[j].Text, 60), fitColumn(rules[i].Text, 60))
+				}
+				break
+			}
+		}
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+
+	var kept []string
+	for i, line := range lines {
+		if drop[i] {
+			continue
+		}
+		// Do not leave two blank lines where a paragraph was dropped
+		if i > 0 && drop[i-1] && strings.TrimSpace(line) == "" && len(kept) > 0 && strings.TrimSpace(kept[len(kept)-1]) == "" {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if err := writeMergeResult(agentsPath, joinLines(kept)); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Collapsed %d near-duplicate rules in %s\n", len(drop), agentsPath)
+	return nil
+}
+
+// newEmbedder returns the embedder of the dedup: settings; Ollama with
+// nomic-embed-text unless a command is configured
+func newEmbedder(cfg dedupConfig, opts Options) (embedder, error) {
+	if cfg.Command != "" {
+		return commandEmbedder{Command: cfg.Command}, nil
+	}
+	if opts.Offline && !isLoopbackURL(ollamaAPI.url()) {
+		return nil, fmt.Errorf("--offline: the ollama embedder points at %s, which is not this machine", ollamaAPI.url())
+	}
+	model := cfg.Model
+	if model == "" {
+		model = "nomic-embed-text"
+	}
+	return ollamaEmbedder{Model: model}, nil
+}
@@ -0,0 +1,301 @@
+package cirby
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// diffContext is how many unchanged lines are shown around each change
+const diffContext = 3
+
+// diffRow is one row of a side-by-side diff
+type diffRow struct {
+	left, right string
+	hasL, hasR  bool
+	changed     bool
+}
+
+// diffRows pairs up the lines of old and new: unchanged lines side by
+// side, and removed lines next to the lines that replaced them
+func diffRows(old, new []string) []diffRow {
+	var rows []diffRow
+	i, j := 0, 0
+	for _, m := range append(lcsMatches(old, new), [2]int{len(old), len(new)}) {
+		removed, added := old[i:m[0]], new[j:m[1]]
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			row := diffRow{changed: true}
+			if k < len(removed) {
+				row.left, row.hasL = removed[k], true
+			}
+			if k < len(added) {
+				row.right, row.hasR = added[k], true
+			}
+			rows = append(rows, row)
+		}
+		if m[0] < len(old) {
+			rows = append(rows, diffRow{left: old[m[0]], right: new[m[1]], hasL: true, hasR: true})
+		}
+		i, j = m[0]+1, m[1]+1
+	}
+	return rows
+}
+
+// sideBySide renders old and new next to each other, changed lines in
+// color, with long unchanged stretches collapsed. Plain output lists the
+// changes one line after another instead.
+func sideBySide(oldLabel, newLabel string, old, new []string, width int, style termStyle) string {
+	if style.plain {
+		return unifiedDiff(oldLabel, newLabel, old, new)
+	}
+	color := style.color
+	col := max((width-3)/2, 20)
+	var b strings.Builder
+	write := func(left, right, leftStyle, rightStyle string) {
+		l := fitColumn(left, col)
+		b.WriteString(paint(l, leftStyle, color) + strings.Repeat(" ", col-utf8.RuneCountInString(l)))
+		b.WriteString(paint(" │ ", ansiDim, color))
+		b.WriteString(paint(fitColumn(right, col), rightStyle, color) + "\n")
+	}
+	write(oldLabel, newLabel, ansiBold, ansiBold)
+	b.WriteString(paint(strings.Repeat("─", col)+"─┼─"+strings.Repeat("─", col), ansiDim, color) + "\n")
+
+	rows := diffRows(old, new)
+	show := make([]bool, len(rows))
+	changes := 0
+	for n, row := range rows {
+		if row.changed {
+			changes++
+			for k := max(n-diffContext, 0); k < min(n+diffContext+1, len(rows)); k++ {
+				show[k] = true
+			}
+		}
+	}
+	if changes == 0 {
+		b.WriteString("(no changes)\n")
+		return b.String()
+	}
+
+	for n := 0; n < len(rows); n++ {
+		row := rows[n]
+		switch {
+		case !show[n] && n+1 < len(rows) && !show[n+1]:
+			skipped := 0
+			for ; n < len(rows) && !show[n]; n++ {
+				skipped++
+			}
+			n--
+			write(fmt.Sprintf("  ⋯ %d unchanged lines", skipped), "", ansiDim, "")
+		case row.changed:
+			left, right := "", ""
+			if row.hasL {
+				left = "- " + row.left
+			}
+			if row.hasR {
+				right = "+ " + row.right
+			}
+			write(left, right, ansiRed, ansiGreen)
+		default:
+			write("  "+row.left, "  "+row.right, "", "")
+		}
+	}
+	return b.String()
+}
+
+// unifiedDiff is sideBySide for plain output: the changed lines with
+// some context, each on a line of its own
+func unifiedDiff(oldLabel, newLabel string, old, new []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldLabel, newLabel)
+	rows := diffRows(old, new)
+	show := make([]bool, len(rows))
+	changes := 0
+	for n, row := range rows {
+		if row.changed {
+			changes++
+			for k := max(n-diffContext, 0); k < min(n+diffContext+1, len(rows)); k++ {
+				show[k] = true
+			}
+		}
+	}
+	if changes == 0 {
+		b.WriteString("(no changes)\n")
+		return b.String()
+	}
+	for n := 0; n < len(rows); n++ {
+		row := rows[n]
+		switch {
+		case !show[n]:
+			skipped := 0
+			for ; n < len(rows) && !show[n]; n++ {
+				skipped++
+			}
+			n--
+			fmt.Fprintf(&b, "(%d unchanged lines)\n", skipped)
+		case row.changed:
+			if row.hasL {
+				b.WriteString("- " + row.left + "\n")
+			}
+			if row.hasR {
+				b.WriteString("+ " + row.right + "\n")
+			}
+		default:
+			b.WriteString("  " + row.left + "\n")
+		}
+	}
+	return b.String()
+}
+
+// fitColumn shortens s to width columns
+func fitColumn(s string, width int) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+// coverageReport shows, for every source, how many of its lines made it
+// into merged, and which did not. Agents reword instructions, so a
+// missing line is a hint to check, not proof of loss.
+func coverageReport(sources []AgentConfig, merged string, style termStyle, verbose bool) string {
+	color := style.color
+	haystack := normalizeForCoverage(merged)
+	var b strings.Builder
+	for _, src := range sources {
+		var total int
+		var missing []string
+		for _, line := range splitLines(src.Content) {
+			norm := normalizeForCoverage(line)
+			if len(norm) < 4 {
+				continue // blank lines, rules and bare punctuation
+			}
+			total++
+			if !strings.Contains(haystack, norm) {
+				missing = append(missing, strings.TrimSpace(line))
+			}
+		}
+		if total == 0 {
+			continue
+		}
+		covered := total - len(missing)
+		shade := ansiGreen
+		if len(missing) > 0 {
+			shade = ansiYellow
+		}
+		fmt.Fprintf(&b, "%s %s: %d/%d lines carried over verbatim\n",
+			paint(fmt.Sprintf("%3d%%", covered*100/total), shade, color), src.Path, covered, total)
+
+		limit := 5
+		if verbose {
+			limit = len(missing)
+		}
+		for n, line := range missing {
+			if n == limit {
+				fmt.Fprintf(&b, "       ... %d more (use --verbose to list all)\n", len(missing)-limit)
+				break
+			}
+			if !style.plain {
+				line = fitColumn(line, 70)
+			}
+			fmt.Fprintf(&b, "       %s\n", paint("not found: "+line, ansiDim, color))
+		}
+	}
+	return b.String()
+}
+
+// normalizeForCoverage reduces a line to its words, dropping Markdown
+// list and heading markers, case and repeated whitespace
+func normalizeForCoverage(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "#>*-+ ")
+		line = strings.ToLower(strings.Join(strings.Fields(line), " "))
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Diff shows a recorded run side by side, the AGENTS.md before and after
+// it, and how much of each source file the result covers. Without id it
+// shows the latest run.
+func Diff(id string, opts Options) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no recorded runs in %s", historyDir())
+	}
+	entry := entries[len(entries)-1]
+	if id != "" {
+		found := false
+		for _, e := range entries {
+			if e.ID == id {
+				entry, found = e, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no recorded run %s; see `cirby history`", id)
+		}
+	}
+
+	dir := filepath.Join(historyDir(), entry.ID)
+	after, err := os.ReadFile(filepath.Join(dir, "after.md"))
+	if err != nil {
+		return err
+	}
+	var before []byte
+	if entry.HadAgentsMD {
+		if before, err = os.ReadFile(filepath.Join(dir, "before.md")); err != nil {
+			return err
+		}
+	}
+
+	var sources []AgentConfig
+	for _, in := range entry.Inputs {
+		if in.Content != "" {
+			sources = append(sources, AgentConfig{Path: in.Path, Content: in.Content})
+		}
+	}
+	printReview(entry.AgentsPath, string(before), string(after), sources, opts)
+	return nil
+}
+
+// printReview prints the side-by-side diff and source coverage of a merge
+func printReview(agentsPath, before, after string, sources []AgentConfig, opts Options) {
+	style := styleFor(opts.stdout(), opts)
+	fmt.Fprint(opts.stdout(), sideBySide(agentsPath+" (before)", agentsPath+" (after)",
+		splitLines(before), splitLines(after), terminalWidth(), style))
+	if report := coverageReport(sources, after, style, opts.Verbose); report != "" {
+		fmt.Fprintf(opts.stdout(), "\nSource coverage:\n%s", report)
+	}
+}
+
+// reviewMerge shows a merge result that was just written and asks
+// whether to keep it. When declined, agentsPath is restored.
+func reviewMerge(agentsPath, before string, existed bool, sources []AgentConfig, opts Options) (bool, error) {
+	after, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintln(opts.stdout())
+	printReview(agentsPath, before, string(after), sources, opts)
+
+	fmt.Fprintf(opts.stdout(), "\nApply these changes to %s and link the files? [y/N]: ", agentsPath)
+	input, _ := bufio.NewReader(opts.stdin()).ReadString('\n')
+	if answer := strings.ToLower(strings.TrimSpace(input)); answer == "y" || answer == "yes" {
+		return true, nil
+	}
+
+	if err := restoreAgentsMD(agentsPath, before, existed); err != nil {
+		return false, err
+	}
+	fmt.Fprintf(opts.stdout(), "[skip] Discarded the merge; %s is unchanged\n", agentsPath)
+	return false, nil
+}
@@ -0,0 +1,89 @@
+package cirby
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// editor returns the user's editor command: $VISUAL, $EDITOR, or vi
+func editor() []string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if cmd := strings.Fields(os.Getenv(env)); len(cmd) > 0 {
+			return cmd
+		}
+	}
+	return []string{"vi"}
+}
+
+// editMerge opens the merge result that was just written to agentsPath in
+// the user's editor, like `git commit` does with a message. agentsPath
+// keeps its old content until the edited candidate is saved and
+// confirmed; an empty candidate or a failing editor aborts the merge.
+func editMerge(agentsPath, before string, existed bool, opts Options) (bool, error) {
+	candidate, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return false, err
+	}
+	if err := restoreAgentsMD(agentsPath, before, existed); err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp("", "cirby-"+strings.TrimSuffix(filepath.Base(agentsPath), ".md")+"-*.md")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(candidate); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+
+	cmd := editor()
+	fmt.Fprintf(opts.stdout(), "Waiting for %s to close %s...\n", cmd[0], tmp.Name())
+	run := exec.Command(cmd[0], append(cmd[1:], tmp.Name())...)
+	run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := run.Run(); err != nil {
+		return false, fmt.Errorf("editor %s failed, merge aborted: %w", cmd[0], err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(string(edited)) == "" {
+		fmt.Fprintf(opts.stdout(), "[skip] Aborting the merge due to an empty %s\n", agentsPath)
+		return false, nil
+	}
+
+	fmt.Fprintf(opts.stdout(), "Apply the edited %s and link the files? [Y/n]: ", agentsPath)
+	input, _ := bufio.NewReader(opts.stdin()).ReadString('\n')
+	if answer := strings.ToLower(strings.TrimSpace(input)); answer != "" && answer != "y" && answer != "yes" {
+		fmt.Fprintf(opts.stdout(), "[skip] Discarded the merge; %s is unchanged\n", agentsPath)
+		return false, nil
+	}
+	if err := writeMergeResult(agentsPath, string(edited)); err != nil {
+		return false, fmt.Errorf("writing %s: %w", agentsPath, err)
+	}
+	return true, nil
+}
+
+// restoreAgentsMD puts agentsPath back the way it was before a merge
+func restoreAgentsMD(agentsPath, before string, existed bool) error {
+	var err error
+	if existed {
+		err = restoreFile(agentsPath, []byte(before), 0644)
+	} else {
+		err = removeFile(agentsPath)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("restoring %s: %w", agentsPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package cirby
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// editorParams are the parameters of the editor RPC methods: the merge
+// options of the MCP tools, plus what preview renders
+type editorParams struct {
+	mcpArgs
+	Path  string `json:"path"`  // preview: file to render, default AGENTS.md
+	Width int    `json:"width"` // preview: wrap width, default 80
+	Color bool   `json:"color"` // preview: ANSI styling
+}
+
+// options applies the parameters of a call over the defaults of the
+// command line
+func (p editorParams) options(base Options) Options {
+	opts := p.mcpArgs.options()
+	opts.Recursive = opts.Recursive || base.Recursive
+	opts.Offline = base.Offline
+	if opts.Output == "" {
+		opts.Output = base.Output
+	}
+	return opts
+}
+
+// ServeRPC runs cirby as a long-running JSON-RPC 2.0 server on stdin and
+// stdout, one message per line, for editor plugins. Methods: scan, check,
+// merge, preview and ping.
+func ServeRPC(opts Options) error {
+	return serveRPC(os.Stdin, os.Stdout, editorHandler(opts))
+}
+
+// editorHandler answers the editor RPC methods, with base for the options
+// a call does not set
+func editorHandler(base Options) rpcHandler {
+	return func(method string, params json.RawMessage) (any, error) {
+		var p editorParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, &rpcError{rpcInvalidParams, err.Error()}
+			}
+		}
+		opts := p.options(base)
+		var out bytes.Buffer
+		opts.Stdout = &out
+
+		switch method {
+		case "ping":
+			return map[string]any{"version": Version}, nil
+		case "scan":
+			statuses, err := inspectConfigs(opts)
+			if err != nil {
+				return nil, err
+			}
+			inSync := true
+			for _, st := range statuses {
+				inSync = inSync && st.inSync()
+			}
+			if statuses == nil {
+				statuses = []configStatus{}
+			}
+			return map[string]any{"in_sync": inSync, "files": statuses}, nil
+		case "check":
+			err := Check(opts)
+			if err != nil {
+				out.WriteString(err.Error() + "\n")
+			}
+			return map[string]any{"ok": err == nil, "output": out.String()}, nil
+		case "merge":
+			if err := validateLinkMode(p.LinkMode); err != nil {
+				return nil, &rpcError{rpcInvalidParams, err.Error()}
+			}
+			if err := Run(opts); err != nil {
+				return nil, &rpcError{rpcInternalError, strings.TrimSpace(out.String() + "\n" + err.Error())}
+			}
+			return map[string]any{"output": out.String()}, nil
+		case "preview":
+			path := p.Path
+			if path == "" {
+				path = opts.output()
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, &rpcError{rpcInvalidParams, err.Error()}
+			}
+			width := p.Width
+			if width <= 0 {
+				width = 80
+			}
+			return map[string]any{"path": path, "content": string(data), "rendered": renderMarkdown(string(data), width, termStyle{color: p.Color})}, nil
+		}
+		return nil, &rpcError{rpcMethodNotFound, "method not found: " + method}
+	}
+}
@@ -0,0 +1,205 @@
+package cirby
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// modelInfo is what we assume about the model behind an agent when
+// estimating cost. Prices are USD per million tokens.
+type modelInfo struct {
+	Model         string
+	InputPrice    float64
+	OutputPrice   float64
+	ContextTokens int
+}
+
+// Default models of each agent CLI. Agents missing here (cursor, opencode,
+// aider) run whatever model the user configured, so their cost is unknown.
+var agentModels = map[string]modelInfo{
+	"claude": {Model: "claude-sonnet", InputPrice: 3, OutputPrice: 15, ContextTokens: 200_000},
+	"gemini": {Model: "gemini-2.5-pro", InputPrice: 1.25, OutputPrice: 10, ContextTokens: 1_000_000},
+	"codex":  {Model: "gpt-5", InputPrice: 1.25, OutputPrice: 10, ContextTokens: 400_000},
+
+	"anthropic": {Model: "claude-sonnet", InputPrice: 3, OutputPrice: 15, ContextTokens: 200_000},
+	"openai":    {Model: "gpt-5", InputPrice: 1.25, OutputPrice: 10, ContextTokens: 400_000},
+
+	// Local merges cost nothing
+	"ollama":  {Model: "a local model", ContextTokens: 128_000},
+	"builtin": {Model: "no model", ContextTokens: 1 << 40}, // so --max-cost allows it
+	"mock":    {Model: "no model", ContextTokens: 1 << 40},
+}
+
+// knownModels are the models --model may choose, matched by part of their
+// name, most specific first
+var knownModels = []struct {
+	Match string
+	Info  modelInfo
+}{
+	{"opus", modelInfo{InputPrice: 15, OutputPrice: 75, ContextTokens: 200_000}},
+	{"haiku", modelInfo{InputPrice: 1, OutputPrice: 5, ContextTokens: 200_000}},
+	{"sonnet", modelInfo{InputPrice: 3, OutputPrice: 15, ContextTokens: 200_000}},
+	{"gemini-2.5-flash", modelInfo{InputPrice: 0.3, OutputPrice: 2.5, ContextTokens: 1_000_000}},
+	{"gemini-2.5-pro", modelInfo{InputPrice: 1.25, OutputPrice: 10, ContextTokens: 1_000_000}},
+	{"gpt-5-nano", modelInfo{InputPrice: 0.05, OutputPrice: 0.4, ContextTokens: 400_000}},
+	{"gpt-5-mini", modelInfo{InputPrice: 0.25, OutputPrice: 2, ContextTokens: 400_000}},
+	{"gpt-5", modelInfo{InputPrice: 1.25, OutputPrice: 10, ContextTokens: 400_000}},
+}
+
+// agentModel is what is known about the model agent runs: its default, or
+// the one chosen with --model. priced is false when the cost is unknown;
+// the context size then falls back to the agent's default.
+func agentModel(agent SupportedAgent) (info modelInfo, priced bool) {
+	info, priced = agentModels[agent.Name]
+	if agent.model == "" {
+		return info, priced
+	}
+	if priced && info.InputPrice == 0 && info.OutputPrice == 0 {
+		// Local models cost nothing, whichever is chosen
+		info.Model = agent.model
+		return info, true
+	}
+	for _, m := range knownModels {
+		if strings.Contains(strings.ToLower(agent.model), m.Match) {
+			m.Info.Model = agent.model
+			return m.Info, true
+		}
+	}
+	return modelInfo{Model: agent.model, ContextTokens: info.ContextTokens}, false
+}
+
+// resolvedModel names the model agent runs: the one chosen with --model,
+// the configured model of an API backend, or the default of its CLI as
+// far as it is known. It is "" for cirby's own merges and CLIs that run
+// whatever model the user set up.
+func resolvedModel(agent SupportedAgent) string {
+	switch {
+	case agent.model != "":
+		return agent.model
+	case agent.API != nil:
+		return agent.API.model()
+	case agent.Merge != nil:
+		return ""
+	}
+	return agentModels[agent.Name].Model
+}
+
+// mergeEstimate is the expected size and cost of one merge
+type mergeEstimate struct {
+	InputTokens  int
+	OutputTokens int
+	Cost         float64 // only meaningful when Known is true
+	Known        bool
+	Model        modelInfo
+	Batches      int // prompts the merge is split into when it does not fit one
+}
+
+// estimateTokens approximates a token count at four bytes per token for
+// ASCII text and one token per character otherwise
+func estimateTokens(s string) int {
+	ascii := 0
+	other := 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
+
+// estimateMerge approximates the tokens an agent reads and writes: the
+// prompt plus every source file it has to open, and at most the combined
+// size of the sources back as output
+func estimateMerge(agent SupportedAgent, prompt string, configs []AgentConfig) mergeEstimate {
+	sources := 0
+	for _, cfg := range configs {
+		sources += estimateTokens(cfg.Content)
+	}
+
+	return priceEstimate(agent, estimateTokens(prompt)+sources, sources)
+}
+
+// estimateIncremental approximates an incremental merge, whose prompt
+// carries everything the agent needs and which rewrites only the
+// affected sections
+func estimateIncremental(agent SupportedAgent, prompt string, plan *incrementalPlan) mergeEstimate {
+	return priceEstimate(agent, estimateTokens(prompt), estimateTokens(plan.sectionText())+plan.changedLines()*10)
+}
+
+func priceEstimate(agent SupportedAgent, input, output int) mergeEstimate {
+	est := mergeEstimate{InputTokens: input, OutputTokens: output}
+	if info, ok := agentModel(agent); ok {
+		est.Known = true
+		est.Model = info
+		est.Cost = float64(est.InputTokens)*info.InputPrice/1e6 + float64(est.OutputTokens)*info.OutputPrice/1e6
+	}
+	return est
+}
+
+// printEstimate shows the estimate and warns when the input may not fit
+func printEstimate(est mergeEstimate, agent SupportedAgent, opts Options) {
+	if agent.Merge != nil {
+		return // no model, no tokens
+	}
+	cost := "cost unknown"
+	if est.Known {
+		cost = fmt.Sprintf("~%s with %s", formatCost(est.Cost), est.Model.Model)
+	}
+	fmt.Fprintf(opts.stdout(), "  - Estimated tokens: ~%s in, up to ~%s out (%s)\n",
+		formatCount(est.InputTokens), formatCount(est.OutputTokens), cost)
+
+	if est.Batches > 1 {
+		fmt.Fprintf(opts.stdout(), "  - Too large for %s's ~%s token context window: merging in %d batches\n",
+			agent.Name, formatCount(est.Model.ContextTokens), est.Batches)
+		return
+	}
+	if est.Known && est.InputTokens > est.Model.ContextTokens {
+		fmt.Fprintf(opts.stdout(), "  [warn] input exceeds %s's ~%s token context window\n",
+			agent.Name, formatCount(est.Model.ContextTokens))
+	}
+}
+
+// checkMaxCost enforces --max-cost
+func checkMaxCost(est mergeEstimate, agent SupportedAgent, opts Options) error {
+	if opts.MaxCost <= 0 {
+		return nil
+	}
+	if !est.Known {
+		return fmt.Errorf("cannot estimate the cost of merging with %s; remove --max-cost or choose claude, gemini or codex", agent.Name)
+	}
+	if est.Cost > opts.MaxCost {
+		return fmt.Errorf("estimated cost ~%s exceeds --max-cost %s", formatCost(est.Cost), formatCost(opts.MaxCost))
+	}
+	return nil
+}
+
+// formatCost renders a USD amount, keeping fractions of a cent visible
+func formatCost(usd float64) string {
+	if usd > 0 && usd < 0.01 {
+		return fmt.Sprintf("$%.4f", usd)
+	}
+	return fmt.Sprintf("$%.2f", usd)
+}
+
+// formatCount renders n with thousands separators
+func formatCount(n int) string {
+	s := fmt.Sprint(n)
+	if len(s) <= 3 {
+		return s
+	}
+	var b strings.Builder
+	pre := len(s) % 3
+	if pre > 0 {
+		b.WriteString(s[:pre])
+	}
+	for i := pre; i < len(s); i += 3 {
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(s[i : i+3])
+	}
+	return b.String()
+}
@@ -0,0 +1,195 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// provenanceMatch is the share of shingles a rule must share with a source
+// rule to be attributed to it; agents reword, so it is lower than
+// nearDuplicate
+const provenanceMatch = 0.5
+
+// provenanceSource is a file whose rules went into AGENTS.md
+type provenanceSource struct {
+	Path   string
+	SHA256 string
+	units  []map[string]bool
+	exact  map[string]bool
+}
+
+// sectionProvenance says where the rules of one AGENTS.md section came from
+type sectionProvenance struct {
+	Heading string         `json:"heading"`
+	SHA256  string         `json:"sha256"`
+	Rules   int            `json:"rules"`
+	Sources map[string]int `json:"sources"`       // rules per source path
+	New     int            `json:"new,omitempty"` // rules found in no source
+
+	rules, origins []string
+}
+
+// explainSections attributes every rule of content to one of sources,
+// section by section
+func explainSections(content string, sources []provenanceSource) []sectionProvenance {
+	var out []sectionProvenance
+	for _, section := range parseDoc(splitLines(content)) {
+		p := sectionProvenance{Heading: section.Heading, SHA256: hashString(renderDoc([]docSection{section})), Sources: map[string]int{}}
+		if p.Heading == "" {
+			p.Heading = "(preamble)"
+		}
+		for _, b := range section.Blocks {
+			for _, unit := range blockUnits(b) {
+				origin := attribute(unit, sources)
+				if origin == "" {
+					p.New++
+				} else {
+					p.Sources[origin]++
+				}
+				p.rules = append(p.rules, unit)
+				p.origins = append(p.origins, origin)
+			}
+		}
+		if p.Rules = len(p.rules); p.Rules > 0 {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Explain shows, for every section of AGENTS.md (or path), which source
+// files its rules came from. Sources are the files of every recorded run
+// for it, at the state they were merged in, and the AGENTS.md that existed
+// before the first run. Rules that match no source were written by the
+// agent or by hand since.
+func Explain(path string, opts Options) error {
+	if path == "" {
+		path = opts.output()
+	}
+	path = filepath.Clean(path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sources, err := provenanceSources(path)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no recorded merges for %s; run cirby first", path)
+	}
+
+	fmt.Fprintf(opts.stdout(), "%s, merged from %d sources:\n", path, len(sources))
+	total := map[string]int{}
+	for _, section := range explainSections(string(content), sources) {
+		fmt.Fprintf(opts.stdout(), "\n%s\n", section.Heading)
+		counts := map[string]int{"": section.New}
+		for origin, n := range section.Sources {
+			counts[origin] = n
+		}
+		for _, origin := range byCount(counts) {
+			if counts[origin] > 0 {
+				total[origin] += counts[origin]
+				fmt.Fprintf(opts.stdout(), "  %3d of %-3d %s\n", counts[origin], section.Rules, describeOrigin(origin))
+			}
+		}
+		if opts.Verbose {
+			for i, rule := range section.rules {
+				fmt.Fprintf(opts.stdout(), "      %-24s %s\n", fitColumn(describeOrigin(section.origins[i]), 24), fitColumn(strings.TrimSpace(strings.SplitN(rule, "\n", 2)[0]), 60))
+			}
+		}
+	}
+
+	fmt.Fprintln(opts.stdout(), "\nOverall:")
+	for _, origin := range byCount(total) {
+		fmt.Fprintf(opts.stdout(), "  %3d  %s\n", total[origin], describeOrigin(origin))
+	}
+	return nil
+}
+
+// provenanceSources collects the sources of every recorded run for
+// agentsPath, the latest content of each path winning
+func provenanceSources(agentsPath string) ([]provenanceSource, error) {
+	entries, err := loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	contents := map[string]string{}
+	first := true
+	for _, e := range entries {
+		if filepath.Clean(e.AgentsPath) != agentsPath {
+			continue
+		}
+		if first && e.HadAgentsMD {
+			if before, err := os.ReadFile(filepath.Join(historyDir(), e.ID, "before.md")); err == nil {
+				contents[agentsPath+" (before cirby)"] = string(before)
+			}
+		}
+		first = false
+		for _, in := range e.Inputs {
+			if in.Content != "" {
+				contents[in.Path] = in.Content
+			}
+		}
+	}
+
+	var sources []provenanceSource
+	for path, content := range contents {
+		src := provenanceSource{Path: path, SHA256: hashString(content), exact: map[string]bool{}}
+		for _, s := range parseDoc(splitLines(content)) {
+			for _, b := range s.Blocks {
+				for _, unit := range blockUnits(b) {
+					norm := dedupWords(unit)
+					src.exact[norm] = true
+					src.units = append(src.units, shingles(norm))
+				}
+			}
+		}
+		sources = append(sources, src)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Path < sources[j].Path })
+	return sources, nil
+}
+
+// attribute returns the path of the source rule is most similar to, or ""
+func attribute(rule string, sources []provenanceSource) string {
+	norm := dedupWords(rule)
+	sh := shingles(norm)
+	best, bestScore := "", provenanceMatch
+	for _, src := range sources {
+		if src.exact[norm] {
+			return src.Path
+		}
+		for _, other := range src.units {
+			if score := jaccard(sh, other); score >= bestScore && (score > bestScore || best == "") {
+				best, bestScore = src.Path, score
+			}
+		}
+	}
+	return best
+}
+
+func describeOrigin(origin string) string {
+	if origin == "" {
+		return "new (in no source)"
+	}
+	return origin
+}
+
+// byCount orders the keys of counts by count, then name
+func byCount(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,41 @@
+package cirby
+
+import (
+	"os"
+)
+
+// Files cirby rewrites are written in place, so they keep their mode,
+// owner and extended attributes. Files it creates, as copies or split
+// topics, or writes back after replacing them with a link, get a mode
+// chosen here instead of a fixed 0644.
+
+// regularPerm returns the permission bits of path if it is a regular file
+func regularPerm(path string) (os.FileMode, bool) {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Mode().Perm(), true
+}
+
+// copyMode is the mode for a file materialized at path from like: the one
+// path already has, or else that of like without executable bits, since
+// instructions are never programs even when AGENTS.md was marked as one
+func copyMode(path, like string) os.FileMode {
+	if perm, ok := regularPerm(path); ok {
+		return perm
+	}
+	if perm, ok := regularPerm(like); ok {
+		return perm &^ 0111
+	}
+	return 0644
+}
+
+// restoreMode gives a file written back by undo the mode it had when it
+// was recorded; files recorded before modes were kept stay as created
+func restoreMode(path string, mode os.FileMode) error {
+	if mode == 0 {
+		return nil
+	}
+	return os.Chmod(path, mode)
+}
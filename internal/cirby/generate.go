@@ -0,0 +1,328 @@
+package cirby
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// projectFacts is what cirby generate finds out about a repository before
+// asking an agent to describe it
+type projectFacts struct {
+	Name     string
+	Kinds    []string // "Go module github.com/x/y (go.mod)", ...
+	Commands []string // build, test and lint commands
+	CI       []string // commands CI workflows run
+	Layout   []string // top-level files and directories
+	README   string   // start of the README
+}
+
+// readmeLines is how much of the README goes into the prompt
+const readmeLines = 40
+
+// makeTarget matches a Makefile rule
+var makeTarget = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.-]*):([^=]|$)`)
+
+// inspectProject collects the facts of the repository in dir
+func inspectProject(dir string) projectFacts {
+	var f projectFacts
+	if abs, err := filepath.Abs(dir); err == nil {
+		f.Name = filepath.Base(abs)
+	}
+	exists := func(name string) bool { return fileExists(filepath.Join(dir, name)) }
+
+	if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		module := "Go module"
+		if m := regexp.MustCompile(`(?m)^module\s+(\S+)`).FindSubmatch(data); m != nil {
+			module += " " + string(m[1])
+		}
+		f.Kinds = append(f.Kinds, module+" (go.mod)")
+		f.Commands = append(f.Commands, "go build ./...", "go test ./...", "go vet ./...")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "package.json")); err == nil {
+		var pkg struct {
+			Name    string         `json:"name"`
+			Scripts map[string]any `json:"scripts"`
+		}
+		json.Unmarshal(data, &pkg)
+		f.Kinds = append(f.Kinds, strings.TrimSpace("Node.js package "+pkg.Name)+" (package.json)")
+		runner := "npm run"
+		switch {
+		case exists("pnpm-lock.yaml"):
+			runner = "pnpm"
+		case exists("yarn.lock"):
+			runner = "yarn"
+		case exists("bun.lockb"), exists("bun.lock"):
+			runner = "bun run"
+		}
+		for _, script := range sortedKeys(pkg.Scripts) {
+			f.Commands = append(f.Commands, fmt.Sprintf("%s %s  # %v", runner, script, pkg.Scripts[script]))
+		}
+	}
+	if exists("Cargo.toml") {
+		f.Kinds = append(f.Kinds, "Rust crate (Cargo.toml)")
+		f.Commands = append(f.Commands, "cargo build", "cargo test", "cargo clippy")
+	}
+	for _, name := range []string{"pyproject.toml", "setup.py", "requirements.txt"} {
+		if exists(name) {
+			f.Kinds = append(f.Kinds, "Python project ("+name+")")
+			if exists("tests") || exists("pytest.ini") {
+				f.Commands = append(f.Commands, "pytest")
+			}
+			break
+		}
+	}
+	if exists("Gemfile") {
+		f.Kinds = append(f.Kinds, "Ruby project (Gemfile)")
+		if exists("Rakefile") {
+			f.Commands = append(f.Commands, "bundle exec rake")
+		}
+	}
+	for _, name := range []string{"pom.xml", "build.gradle", "build.gradle.kts"} {
+		if exists(name) {
+			f.Kinds = append(f.Kinds, "JVM project ("+name+")")
+		}
+	}
+	if file, err := os.Open(filepath.Join(dir, "Makefile")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if m := makeTarget.FindStringSubmatch(scanner.Text()); m != nil && !strings.HasPrefix(m[1], ".") {
+				f.Commands = append(f.Commands, "make "+m[1])
+			}
+		}
+		file.Close()
+	}
+
+	workflows, _ := filepath.Glob(filepath.Join(dir, ".github", "workflows", "*.y*ml"))
+	seen := map[string]bool{}
+	for _, path := range workflows {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, line := range splitLines(string(data)) {
+			cmd, ok := strings.CutPrefix(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "- ")), "run:")
+			if cmd = strings.TrimSpace(cmd); ok && cmd != "" && cmd != "|" && cmd != ">" && !seen[cmd] {
+				seen[cmd] = true
+				f.CI = append(f.CI, cmd)
+			}
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") || name == "AGENTS.md" || name == "node_modules" || name == "vendor" || name == "target" {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		f.Layout = append(f.Layout, name)
+	}
+
+	for _, name := range []string{"README.md", "README", "README.rst", "readme.md"} {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err == nil {
+			lines := splitLines(string(data))
+			if len(lines) > readmeLines {
+				lines = lines[:readmeLines]
+			}
+			f.README = strings.TrimSpace(joinLines(lines))
+			break
+		}
+	}
+	return f
+}
+
+func (f projectFacts) String() string {
+	var b strings.Builder
+	list := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s:\n", title)
+		for _, item := range items {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+		b.WriteString("\n")
+	}
+	list("Project type", f.Kinds)
+	list("Build, test and lint commands", f.Commands)
+	list("Commands run in CI", f.CI)
+	list("Top-level files and directories", f.Layout)
+	if f.README != "" {
+		fmt.Fprintf(&b, "Start of the README:\n\n---\n%s\n---\n", f.README)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// commandList renders the build, test and CI commands as a Markdown list
+func (f projectFacts) commandList() string {
+	var b strings.Builder
+	seen := map[string]bool{}
+	for _, cmd := range append(append([]string(nil), f.Commands...), f.CI...) {
+		if cmd, _, _ = strings.Cut(cmd, "  # "); !seen[cmd] {
+			seen[cmd] = true
+			fmt.Fprintf(&b, "- `%s`\n", cmd)
+		}
+	}
+	return b.String()
+}
+
+func buildGeneratePrompt(facts projectFacts, target, template string) string {
+	structure := fmt.Sprintf(`The %s file should follow this structure:
+- Project Overview
+- Build & Test Commands
+- Code Style Guidelines
+- Architecture Notes
+`, target)
+	if template != "" {
+		structure = buildTemplateNote(template)
+	}
+	return fmt.Sprintf(`This project has no instructions for AI coding agents yet. Draft a first %[1]s for it.
+
+Here is what cirby found in the repository:
+
+%[2]s
+
+Please:
+1. Inspect the repository further where these facts are not enough: build files, tests, main packages
+2. Describe only what is true of this project; leave out sections you cannot fill
+3. List the exact commands to build, test and lint
+4. Point out conventions the code follows and where the main parts live
+5. Use agent-agnostic language (don't say "Claude should..." or "Gemini should...")
+6. Keep it concise
+7. Write the result to %[1]s
+
+%[3]s
+Please create the %[1]s file now.`, target, facts, structure)
+}
+
+// draftAgentsMD writes a first AGENTS.md from facts alone, for merges
+// without a model
+func draftAgentsMD(facts projectFacts) string {
+	var b strings.Builder
+	b.WriteString("# AGENTS.md\n\n## Project Overview\n\n")
+	overview := ""
+	for _, s := range parseDoc(splitLines(facts.README)) {
+		for _, block := range s.Blocks {
+			if !block.List && !strings.HasPrefix(strings.TrimSpace(block.Lines[0]), "```") && !strings.HasPrefix(strings.TrimSpace(block.Lines[0]), "<") {
+				overview = strings.Join(block.Lines, "\n")
+				break
+			}
+		}
+		if overview != "" {
+			break
+		}
+	}
+	if overview == "" {
+		overview = facts.Name
+		if len(facts.Kinds) > 0 {
+			overview += ": " + strings.Join(facts.Kinds, ", ")
+		}
+		overview += "."
+	}
+	b.WriteString(overview + "\n")
+
+	if commands := facts.commandList(); commands != "" {
+		b.WriteString("\n## Build & Test Commands\n\n" + commands)
+	}
+	if len(facts.Layout) > 0 {
+		b.WriteString("\n## Architecture Notes\n\n")
+		for _, entry := range facts.Layout {
+			if strings.HasSuffix(entry, "/") {
+				fmt.Fprintf(&b, "- `%s`\n", entry)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Generate drafts a first AGENTS.md from the repository itself, for
+// projects without any agent configuration to merge
+func Generate(opts Options) error {
+	if opts.Template != "" {
+		if isNetworkRef(opts.Template) {
+			if err := requireOnline("fetching --template "+opts.Template, opts); err != nil {
+				return err
+			}
+		}
+		var err error
+		if opts.template, err = loadTemplate(opts.Template); err != nil {
+			return err
+		}
+	}
+	roots := opts.roots()
+	if len(roots) > 1 {
+		return fmt.Errorf("cirby generate drafts one AGENTS.md at a time; give a single --path")
+	}
+	if err := validatePath(roots[0]); err != nil {
+		return err
+	}
+	scope := packageScope{Dir: roots[0], Output: opts.output()}
+	agentsPath := scope.agentsPath()
+	if fileExists(agentsPath) && !opts.Force {
+		return fmt.Errorf("%s already exists; use --force to replace it with a new draft", agentsPath)
+	}
+	configs, err := scanConfigs(scope.Dir, opts)
+	if err != nil {
+		return fmt.Errorf("scanning configs: %w", err)
+	}
+	var sources []string
+	for _, cfg := range configs {
+		if cfg.Path != agentsPath {
+			sources = append(sources, cfg.Path)
+		}
+	}
+	if len(sources) > 0 && !opts.Force {
+		return fmt.Errorf("found agent configs to merge (%s); run cirby to merge them, or use --force to draft from the code anyway", strings.Join(sources, ", "))
+	}
+
+	facts := inspectProject(scope.Dir)
+	agent, err := selectAgent(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "Found:\n%s\n\n", facts)
+	}
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		fmt.Fprintf(opts.stdout(), "  - Use %s to draft %s from %d commands and %d top-level entries\n", agent.Name, agentsPath, len(facts.Commands)+len(facts.CI), len(facts.Layout))
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	before, err := os.ReadFile(agentsPath)
+	existed := err == nil
+	fmt.Fprintf(opts.stdout(), "Drafting %s with %s...\n", agentsPath, agent.Name)
+	if agent.Merge != nil {
+		err = writeMergeResult(agentsPath, draftAgentsMD(facts))
+	} else {
+		removeFile(agentsPath)
+		err = executeAgent(agent, buildGeneratePrompt(facts, agentsPath, opts.template), agentsPath, nil, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("drafting %s: %w", agentsPath, err)
+	}
+	if !fileExists(agentsPath) {
+		if existed {
+			restoreAgentsMD(agentsPath, string(before), existed)
+		}
+		return fmt.Errorf("%s did not write %s", agent.Name, agentsPath)
+	}
+
+	entry := historyEntry{Agent: "generate", AgentsPath: agentsPath, HadAgentsMD: existed}
+	if err := recordHistory(entry, string(before)); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	if err := stampIntegrity(scope, lockStamp{Backend: agent.Name, Model: resolvedModel(agent)}, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Drafted %s; review it, then commit it as the project's agent instructions\n", agentsPath)
+	return nil
+}
@@ -0,0 +1,98 @@
+package cirby
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// generationParams tune how the merging model writes, trading verbosity
+// against faithfulness to the sources:
+//
+//	generation:
+//	  temperature: 0.2
+//	  max_tokens: 8000
+//	  reasoning_effort: low   # low, medium or high
+//
+// --temperature, --max-tokens and --reasoning-effort override them.
+type generationParams struct {
+	Temperature     *float64
+	MaxTokens       int
+	ReasoningEffort string
+}
+
+// thinkingBudgets are the Anthropic thinking budgets, in tokens, for each
+// reasoning effort
+var thinkingBudgets = map[string]int{"low": 2048, "medium": 8192, "high": 24576}
+
+// validEffort reports whether effort is a reasoning effort cirby maps
+func validEffort(effort string) bool {
+	_, ok := thinkingBudgets[effort]
+	return ok
+}
+
+// parseGeneration reads the generation: section of .cirby.yaml
+func parseGeneration(section map[string]any, path string) (generationParams, error) {
+	var g generationParams
+	if v := yamlString(section["temperature"]); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 2 {
+			return g, fmt.Errorf("%s: generation.temperature must be a number between 0 and 2", path)
+		}
+		g.Temperature = &t
+	}
+	if v := yamlString(section["max_tokens"]); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return g, fmt.Errorf("%s: generation.max_tokens must be a positive number", path)
+		}
+		g.MaxTokens = n
+	}
+	g.ReasoningEffort = yamlString(section["reasoning_effort"])
+	if g.ReasoningEffort != "" && !validEffort(g.ReasoningEffort) {
+		return g, fmt.Errorf("%s: generation.reasoning_effort must be low, medium or high", path)
+	}
+	return g, nil
+}
+
+// generationFor combines the generation: section of .cirby.yaml with the
+// flags for agent. Flags the agent cannot honor are errors; settings from
+// the file it cannot honor are dropped, so one file serves every agent.
+func generationFor(agent SupportedAgent, cfg generationParams, opts Options) (generationParams, error) {
+	g := cfg
+	if opts.Temperature != nil {
+		g.Temperature = opts.Temperature
+	}
+	if opts.MaxTokens > 0 {
+		g.MaxTokens = opts.MaxTokens
+	}
+	if opts.ReasoningEffort != "" {
+		g.ReasoningEffort = opts.ReasoningEffort
+	}
+	if agent.API == nil {
+		switch {
+		case opts.Temperature != nil:
+			return g, fmt.Errorf("%s does not take a temperature; remove --temperature", agent.Name)
+		case opts.MaxTokens > 0:
+			return g, fmt.Errorf("%s does not take a token limit; remove --max-tokens", agent.Name)
+		case opts.ReasoningEffort != "" && agent.EffortArgs == nil:
+			return g, fmt.Errorf("%s does not take a reasoning effort; remove --reasoning-effort", agent.Name)
+		}
+		g.Temperature, g.MaxTokens = nil, 0
+		if agent.EffortArgs == nil {
+			g.ReasoningEffort = ""
+		}
+		return g, nil
+	}
+	if opts.Reproducible && opts.Temperature != nil {
+		return g, fmt.Errorf("--reproducible sets the temperature; remove --temperature")
+	}
+	if agent.API == anthropicAPI && g.ReasoningEffort != "" {
+		switch {
+		case opts.Reproducible:
+			return g, fmt.Errorf("anthropic cannot use a reasoning effort with --reproducible, which sets the temperature")
+		case g.Temperature != nil && *g.Temperature != 1:
+			return g, fmt.Errorf("anthropic only allows a temperature of 1 with a reasoning effort")
+		}
+	}
+	return g, nil
+}
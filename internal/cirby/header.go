@@ -0,0 +1,98 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// headerPrefix starts the one comment line cirby keeps at the top of
+// AGENTS.md to say where it came from:
+//
+//	<!-- generated with cirby v0.2.0 from: CLAUDE.md, .cursorrules @ 2026-10-15 -->
+const headerPrefix = "<!-- generated with cirby "
+
+// isHeader reports whether line is a generated-by header
+func isHeader(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), headerPrefix)
+}
+
+// stripHeader removes the generated-by header from content, wherever an
+// agent may have moved it, so agents never see or copy it
+func stripHeader(content string) string {
+	if !strings.Contains(content, headerPrefix) {
+		return content
+	}
+	var kept []string
+	for _, line := range splitLines(content) {
+		if !isHeader(line) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.TrimLeft(joinLines(kept), "\n")
+}
+
+// renderHeader is the header for a merge of sources, without a date when
+// date is zero
+func renderHeader(sources []string, date time.Time) string {
+	from := ""
+	if len(sources) > 0 {
+		from = " from: " + strings.Join(sources, ", ")
+	}
+	if date.IsZero() {
+		return fmt.Sprintf("%sv%s%s -->", headerPrefix, Version, from)
+	}
+	return fmt.Sprintf("%sv%s%s @ %s -->", headerPrefix, Version, from, date.Format("2006-01-02"))
+}
+
+// stampHeader puts a single up-to-date header at the top of the scope's
+// AGENTS.md, listing every source now merged into it. A header that only
+// differs in its date is left alone, so unchanged runs do not rewrite it;
+// --reproducible leaves the date out. configs are the sources the run
+// scanned.
+func stampHeader(scope packageScope, configs []AgentConfig, opts Options) error {
+	if opts.NoHeader {
+		return nil
+	}
+	agentsPath := scope.agentsPath()
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	hashes := sourceHashes(scope, configs, nil)
+	sources := make([]string, 0, len(hashes))
+	for path := range hashes {
+		sources = append(sources, path)
+	}
+	sort.Strings(sources)
+
+	content := string(data)
+	date := time.Now()
+	if opts.Reproducible {
+		date = time.Time{} // the same inputs make the same file on any day
+	}
+	header := renderHeader(sources, date)
+	if lines := splitLines(content); len(lines) > 0 && isHeader(lines[0]) && !strings.Contains(joinLines(lines[1:]), headerPrefix) {
+		if lines[0] == header || !opts.Reproducible && sameHeader(lines[0], header) {
+			return nil
+		}
+	}
+	body := stripHeader(content)
+	if body == "" {
+		return writeFile(agentsPath, []byte(header+"\n"), 0644)
+	}
+	return writeFile(agentsPath, []byte(header+"\n"+body), 0644)
+}
+
+// sameHeader compares two headers without their dates
+func sameHeader(a, b string) bool {
+	undated := func(h string) string {
+		if i := strings.LastIndex(h, " @ "); i >= 0 {
+			return h[:i]
+		}
+		return strings.TrimSuffix(h, " -->")
+	}
+	return undated(strings.TrimSpace(a)) == undated(b)
+}
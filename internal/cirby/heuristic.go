@@ -0,0 +1,323 @@
+package cirby
+
+import (
+	"strings"
+	"unicode"
+)
+
+// nearDuplicate is the share of shared word shingles above which two
+// paragraphs or list items count as the same text
+const nearDuplicate = 0.8
+
+// docSection is a heading and the blocks below it, up to the next heading.
+// The preamble before the first heading has no heading.
+type docSection struct {
+	Heading string
+	Level   int
+	Blocks  []docBlock
+}
+
+// docBlock is a paragraph, list, code block or generated section
+type docBlock struct {
+	Lines []string
+	List  bool
+}
+
+// parseDoc splits Markdown into sections and blocks. Code fences and
+// generated <!-- cirby:section --> blocks stay whole.
+func parseDoc(lines []string) []docSection {
+	sections := []docSection{{}}
+	var block []string
+	flush := func() {
+		if len(block) > 0 {
+			cur := &sections[len(sections)-1]
+			cur.Blocks = append(cur.Blocks, docBlock{Lines: block, List: listItemText(strings.TrimSpace(block[0])) != ""})
+		}
+		block = nil
+	}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") || strings.HasPrefix(trimmed, "<!-- cirby:section "):
+			// Keep everything up to the closing line together
+			closing := trimmed[:3]
+			if strings.HasPrefix(trimmed, "<!--") {
+				closing = "<!-- /cirby:section "
+			}
+			flush()
+			block = append(block, line)
+			for i++; i < len(lines); i++ {
+				block = append(block, lines[i])
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), closing) {
+					break
+				}
+			}
+			flush()
+		case trimmed == "":
+			flush()
+		default:
+			if heading, _ := markdownHeading(line, false); heading {
+				flush()
+				sections = append(sections, docSection{Heading: trimmed, Level: len(trimmed) - len(strings.TrimLeft(trimmed, "#"))})
+				continue
+			}
+			block = append(block, line)
+		}
+	}
+	flush()
+	if len(sections[0].Blocks) == 0 {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+// renderDoc turns sections back into Markdown, with one blank line
+// between blocks
+func renderDoc(sections []docSection) string {
+	var parts []string
+	for _, s := range sections {
+		if s.Heading != "" {
+			parts = append(parts, s.Heading)
+		}
+		for _, b := range s.Blocks {
+			parts = append(parts, strings.Join(b.Lines, "\n"))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, "\n\n") + "\n"
+}
+
+// heuristicMerge merges sources into doc without a model: sections with
+// the same heading are combined, the title of each source is folded into
+// the document's title, and paragraphs and list items that already exist,
+// exactly or nearly, are dropped. It also returns how many were dropped.
+func heuristicMerge(doc []docSection, source []docSection) ([]docSection, int) {
+	seen := newShingleIndex(doc)
+	for _, s := range source {
+		blocks := seen.filter(s.Blocks)
+		target := findSection(doc, s)
+		if target < 0 {
+			if len(blocks) > 0 {
+				doc = append(doc, docSection{Heading: s.Heading, Level: s.Level, Blocks: blocks})
+			}
+			continue
+		}
+		for _, b := range blocks {
+			cur := &doc[target]
+			if n := len(cur.Blocks); n > 0 && b.List && cur.Blocks[n-1].List {
+				// Continue the list instead of starting a second one
+				last := &cur.Blocks[n-1]
+				last.Lines = append(append([]string(nil), last.Lines...), b.Lines...)
+				continue
+			}
+			cur.Blocks = append(cur.Blocks, b)
+		}
+	}
+	return doc, seen.dropped
+}
+
+// findSection returns the section of doc that s belongs in, or -1. A
+// source's preamble and title go below the document's title.
+func findSection(doc []docSection, s docSection) int {
+	if s.Heading == "" || s.Level == 1 {
+		for i, d := range doc {
+			if d.Heading == "" || d.Level == 1 {
+				return i
+			}
+			break
+		}
+		if s.Heading == "" {
+			return -1
+		}
+	}
+	title := normalizeTitle(s.Heading)
+	match := -1
+	for i, d := range doc {
+		if d.Heading == "" {
+			continue
+		}
+		other := normalizeTitle(d.Heading)
+		if other == title {
+			return i
+		}
+		// "Style" goes with "Code Style", "Build" with "Build & Test"
+		if match < 0 && title != "" && other != "" && (wordSubset(title, other) || wordSubset(other, title)) {
+			match = i
+		}
+	}
+	return match
+}
+
+// wordSubset reports whether every word of a is in b
+func wordSubset(a, b string) bool {
+	words := map[string]bool{}
+	for _, w := range strings.Fields(b) {
+		words[w] = true
+	}
+	for _, w := range strings.Fields(a) {
+		if !words[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeTitle compares headings regardless of case, punctuation and
+// numbering
+func normalizeTitle(heading string) string {
+	var words []string
+	for _, w := range strings.Fields(headingTitle(heading)) {
+		w = strings.Trim(w, ".:&-–—()[]`*_")
+		if w == "" || w == "and" || strings.Trim(w, "0123456789") == "" {
+			continue
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " ")
+}
+
+// shingleIndex holds the word shingles of every paragraph and list item
+// merged so far
+type shingleIndex struct {
+	texts   []map[string]bool
+	exact   map[string]bool
+	dropped int
+}
+
+func newShingleIndex(doc []docSection) *shingleIndex {
+	idx := &shingleIndex{exact: map[string]bool{}}
+	for _, s := range doc {
+		for _, b := range s.Blocks {
+			for _, unit := range blockUnits(b) {
+				idx.add(unit)
+			}
+		}
+	}
+	return idx
+}
+
+func (idx *shingleIndex) add(text string) {
+	norm := dedupWords(text)
+	idx.exact[norm] = true
+	idx.texts = append(idx.texts, shingles(norm))
+}
+
+// contains reports whether text, or something nearly the same, was added
+func (idx *shingleIndex) contains(text string) bool {
+	norm := dedupWords(text)
+	if idx.exact[norm] {
+		return true
+	}
+	sh := shingles(norm)
+	for _, other := range idx.texts {
+		if jaccard(sh, other) >= nearDuplicate {
+			return true
+		}
+	}
+	return false
+}
+
+// filter drops the blocks, and the list items, that were seen before and
+// records the rest
+func (idx *shingleIndex) filter(blocks []docBlock) []docBlock {
+	var out []docBlock
+	for _, b := range blocks {
+		if !b.List {
+			text := strings.Join(b.Lines, "\n")
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if idx.contains(text) {
+				idx.dropped++
+				continue
+			}
+			idx.add(text)
+			out = append(out, b)
+			continue
+		}
+		var kept []string
+		for _, item := range listItems(b.Lines) {
+			text := strings.Join(item, "\n")
+			if idx.contains(text) {
+				idx.dropped++
+				continue
+			}
+			idx.add(text)
+			kept = append(kept, item...)
+		}
+		if len(kept) > 0 {
+			out = append(out, docBlock{Lines: kept, List: true})
+		}
+	}
+	return out
+}
+
+// blockUnits are the texts of a block compared for duplicates: each item
+// of a list, or the whole block
+func blockUnits(b docBlock) []string {
+	if !b.List {
+		return []string{strings.Join(b.Lines, "\n")}
+	}
+	var units []string
+	for _, item := range listItems(b.Lines) {
+		units = append(units, strings.Join(item, "\n"))
+	}
+	return units
+}
+
+// listItems splits list lines into items; indented lines continue the
+// item above
+func listItems(lines []string) [][]string {
+	var items [][]string
+	for _, line := range lines {
+		isItem := line == strings.TrimLeft(line, " \t") && listItemText(strings.TrimSpace(line)) != ""
+		if isItem || len(items) == 0 {
+			items = append(items, []string{line})
+			continue
+		}
+		items[len(items)-1] = append(items[len(items)-1], line)
+	}
+	return items
+}
+
+// dedupWords reduces text to its lower-case words, so that punctuation,
+// Markdown markup and list markers do not matter
+func dedupWords(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// shingles returns the overlapping word triples of normalized text, or its
+// words when it is shorter
+func shingles(norm string) map[string]bool {
+	words := strings.Fields(norm)
+	set := map[string]bool{}
+	if len(words) < 3 {
+		for _, w := range words {
+			set[w] = true
+		}
+		return set
+	}
+	for i := 0; i+3 <= len(words); i++ {
+		set[strings.Join(words[i:i+3], " ")] = true
+	}
+	return set
+}
+
+// jaccard is the share of shingles two sets have in common
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for s := range a {
+		if b[s] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,205 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// packageScope is a directory that gets its own AGENTS.md. Nested scopes
+// inherit the instructions of the nearest ancestor AGENTS.md.
+type packageScope struct {
+	Dir    string // directory relative to the project root
+	Output string // canonical file name relative to Dir
+	Parent string // AGENTS.md this scope inherits from, empty for the root
+}
+
+func (s packageScope) agentsPath() string {
+	output := s.Output
+	if output == "" {
+		output = "AGENTS.md"
+	}
+	return filepath.Join(s.Dir, output)
+}
+
+// Directories never worth descending into when looking for packages:
+// dependencies, build output and VCS metadata
+var skipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"dist":         true,
+}
+
+// scanWorkers bounds how many directories are read concurrently
+var scanWorkers = 4 * runtime.NumCPU()
+
+// runScopes returns the directories a run operates on: just the project
+// root (or each --path), or every package below them as well in recursive
+// mode. Scopes still inherit from an AGENTS.md above them.
+func runScopes(opts Options) ([]packageScope, error) {
+	if !opts.Recursive {
+		return resolveScopes(opts.roots(), opts.output()), nil
+	}
+	var dirs []string
+	for _, root := range opts.roots() {
+		found, err := findConfigDirs(root, opts)
+		if err != nil {
+			return nil, fmt.Errorf("scanning packages: %w", err)
+		}
+		for _, dir := range found {
+			if !slices.Contains(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return resolveScopes(dirs, opts.output()), nil
+}
+
+// findConfigDirs walks root and returns every directory that contains agent
+// config files. The root itself is always included and comes first; the
+// rest are sorted. Directories are read in parallel by up to scanWorkers
+// goroutines, and symlinked directories are not followed.
+func findConfigDirs(root string, opts Options) ([]string, error) {
+	var (
+		mu       sync.Mutex
+		found    []string
+		firstErr error
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, scanWorkers)
+	)
+
+	var visit func(dir string)
+	visit = func(dir string) {
+		defer wg.Done()
+
+		sem <- struct{}{}
+		entries, err := os.ReadDir(dir)
+		hasConfigs := err == nil && dir != root && mayHaveConfigs(entries) && hasAgentConfigs(dir)
+		<-sem
+
+		mu.Lock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if hasConfigs {
+			found = append(found, dir)
+		}
+		mu.Unlock()
+
+		for _, e := range entries {
+			name := e.Name()
+			if !e.IsDir() || strings.HasPrefix(name, ".") || skipDirs[name] {
+				continue
+			}
+			wg.Add(1)
+			go visit(filepath.Join(dir, name))
+		}
+	}
+
+	wg.Add(1)
+	visit(root)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	sort.Strings(found)
+	if opts.Verbose {
+		for _, dir := range found {
+			fmt.Fprintf(opts.stdout(), "  [ok] %s (package)\n", dir)
+		}
+	}
+	return append([]string{root}, found...), nil
+}
+
+// mayHaveConfigs cheaply filters directories by their entry names before
+// hasAgentConfigs globs for the actual patterns
+func mayHaveConfigs(entries []os.DirEntry) bool {
+	for _, e := range entries {
+		name := e.Name()
+		if name == aiderConfigFile {
+			return true
+		}
+		for _, agent := range agentPatterns {
+			for _, pattern := range agent.Patterns {
+				first, _, _ := strings.Cut(pattern, "/")
+				if ok, _ := filepath.Match(first, name); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// hasAgentConfigs reports whether dir holds any config file other than AGENTS.md
+func hasAgentConfigs(dir string) bool {
+	for _, agent := range agentPatterns {
+		for _, pattern := range agent.Patterns {
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err == nil && len(matches) > 0 {
+				return true
+			}
+		}
+	}
+	files, err := aiderReadFiles(dir)
+	return err == nil && len(files) > 0
+}
+
+// resolveScopes pairs every directory with the AGENTS.md it inherits from.
+// dirs must be sorted so that ancestors come before their descendants.
+func resolveScopes(dirs []string, output string) []packageScope {
+	known := make(map[string]bool, len(dirs))
+	scopes := make([]packageScope, 0, len(dirs))
+
+	for _, dir := range dirs {
+		scope := packageScope{Dir: dir, Output: output}
+		for parent := filepath.Dir(dir); dir != "." && parent != dir; parent = filepath.Dir(parent) {
+			if known[parent] || fileExists(filepath.Join(parent, output)) {
+				scope.Parent = filepath.Join(parent, output)
+				break
+			}
+			if parent == "." {
+				break
+			}
+		}
+		known[dir] = hasAgentConfigs(dir) || fileExists(scope.agentsPath())
+		scopes = append(scopes, scope)
+	}
+
+	return scopes
+}
+
+// buildInheritNote explains the inheritance contract to the merge agent.
+// It returns an empty string for scopes without a parent.
+func buildInheritNote(scope packageScope) string {
+	if scope.Parent == "" {
+		return ""
+	}
+	link, err := filepath.Rel(scope.Dir, scope.Parent)
+	if err != nil {
+		link = scope.Parent
+	}
+	link = filepath.ToSlash(link)
+
+	return fmt.Sprintf(`This directory is a package inside a larger project. Project-wide instructions
+live in %s and are inherited by this package. Therefore:
+- Only include instructions that are specific to this package
+- Do not repeat anything already covered by %s
+- Start the file with a short note that it inherits from the root instructions,
+  linking to them as [%s](%s)
+
+`, scope.Parent, scope.Parent, link, link)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,272 @@
+package cirby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// historyEntry records a single run so it can be inspected and undone.
+// Each entry lives in <history dir>/<ID>/ next to the AGENTS.md snapshots
+// before.md (only when AGENTS.md already existed) and after.md.
+type historyEntry struct {
+	ID          string         `json:"id"`
+	Time        time.Time      `json:"time"`
+	Agent       string         `json:"agent,omitempty"`
+	PromptHash  string         `json:"prompt_sha256,omitempty"`
+	AgentsPath  string         `json:"agents_md"`
+	HadAgentsMD bool           `json:"had_agents_md"`
+	Inputs      []historyInput `json:"inputs"`
+
+	prompt string // kept as prompt.md for cirby replay
+}
+
+// historyInput is the state of a file before cirby linked it
+type historyInput struct {
+	Path    string      `json:"path"`
+	SHA256  string      `json:"sha256"`
+	Symlink string      `json:"symlink,omitempty"` // link target if the file was a symlink
+	Content string      `json:"content,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`     // permission bits of a regular file
+	Setting bool        `json:"settings,omitempty"` // instructions from a settings file or plugin, which undo leaves alone
+}
+
+// snapshotInputs captures the on-disk state of configs before they are linked
+func snapshotInputs(configs []AgentConfig) []historyInput {
+	inputs := make([]historyInput, 0, len(configs))
+	for _, cfg := range configs {
+		input := historyInput{Path: cfg.Path, SHA256: hashString(cfg.Content), Setting: cfg.quoted()}
+		if target, err := os.Readlink(cfg.Path); err == nil {
+			input.Symlink = target
+		} else {
+			input.Content = cfg.Content
+			input.Mode, _ = regularPerm(cfg.Path)
+			// As it was on disk, line endings and all
+			if data, err := os.ReadFile(cfg.Path); err == nil && !cfg.quoted() {
+				input.Content = string(data)
+			}
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+// recordHistory stores a finished run in the history directory
+func recordHistory(entry historyEntry, before string) error {
+	after, err := os.ReadFile(entry.AgentsPath)
+	if err != nil {
+		return err
+	}
+
+	entry.Time = time.Now().UTC()
+	entry.ID = entry.Time.Format("20060102-150405.000000")
+	dir := filepath.Join(historyDir(), entry.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// History is local state, keep it out of commits
+	if err := os.WriteFile(filepath.Join(historyDir(), ".gitignore"), []byte("*\n"), 0644); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "run.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if entry.HadAgentsMD {
+		if err := os.WriteFile(filepath.Join(dir, "before.md"), []byte(before), 0644); err != nil {
+			return err
+		}
+	}
+	if entry.prompt != "" {
+		if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(entry.prompt), 0644); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "after.md"), after, 0644); err != nil {
+		return err
+	}
+	return pruneHistory()
+}
+
+// loadHistory returns all recorded runs, oldest first
+func loadHistory() ([]historyEntry, error) {
+	dirs, err := os.ReadDir(historyDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []historyEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(historyDir(), d.Name(), "run.json"))
+		if err != nil {
+			return nil, fmt.Errorf("reading history entry %s: %w", d.Name(), err)
+		}
+		var entry historyEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("parsing history entry %s: %w", d.Name(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
+
+// History prints the recorded runs, newest first
+func History(opts Options) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(opts.stdout(), "No recorded runs.")
+		return nil
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		agent := e.Agent
+		if agent == "" {
+			agent = "relink"
+		}
+		fmt.Fprintf(opts.stdout(), "%s  %-8s  %s  (%d files)\n", e.ID, agent, e.AgentsPath, len(e.Inputs))
+		if opts.Verbose {
+			for _, in := range e.Inputs {
+				fmt.Fprintf(opts.stdout(), "    %s  %s\n", in.SHA256[:12], in.Path)
+			}
+			if e.PromptHash != "" {
+				fmt.Fprintf(opts.stdout(), "    prompt sha256 %s\n", e.PromptHash)
+			}
+			fmt.Fprintf(opts.stdout(), "    snapshot: %s\n", filepath.Join(historyDir(), e.ID, "after.md"))
+		}
+	}
+	return nil
+}
+
+// Undo reverts the most recent steps runs, newest first: linked files get
+// their original content back and AGENTS.md returns to its earlier state.
+func Undo(steps int, opts Options) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("nothing to undo: no recorded runs in %s", historyDir())
+	}
+	if steps < 1 || steps > len(entries) {
+		return fmt.Errorf("can only undo 1 to %d runs", len(entries))
+	}
+
+	for i := len(entries) - 1; i >= len(entries)-steps; i-- {
+		// A dry run leaves AGENTS.md untouched, so only the newest run can
+		// be compared against the file on disk
+		latest := i == len(entries)-1
+		if err := undoEntry(entries[i], latest || !opts.DryRun, opts); err != nil {
+			return fmt.Errorf("undoing run %s: %w", entries[i].ID, err)
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+	}
+	return nil
+}
+
+func undoEntry(e historyEntry, checkModified bool, opts Options) error {
+	dir := filepath.Join(historyDir(), e.ID)
+
+	// Refuse to drop edits made to AGENTS.md after the run
+	after, err := os.ReadFile(filepath.Join(dir, "after.md"))
+	if err != nil {
+		return err
+	}
+	current, err := os.ReadFile(e.AgentsPath)
+	if checkModified && err == nil && string(current) != string(after) && !opts.Force {
+		return fmt.Errorf("%s was modified after this run; use --force to discard those changes", e.AgentsPath)
+	}
+
+	if opts.DryRun {
+		fmt.Fprintf(opts.stdout(), "[Dry Run] Would undo run %s:\n", e.ID)
+		for _, in := range e.Inputs {
+			if !in.Setting {
+				fmt.Fprintf(opts.stdout(), "  - Restore %s\n", in.Path)
+			}
+		}
+		if e.HadAgentsMD {
+			fmt.Fprintf(opts.stdout(), "  - Restore previous %s\n", e.AgentsPath)
+		} else {
+			fmt.Fprintf(opts.stdout(), "  - Remove %s\n", e.AgentsPath)
+		}
+		return nil
+	}
+
+	for _, in := range e.Inputs {
+		if in.Setting {
+			continue
+		}
+		if err := restoreInput(in); err != nil {
+			return err
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Restored %s\n", in.Path)
+	}
+
+	if e.HadAgentsMD {
+		before, err := os.ReadFile(filepath.Join(dir, "before.md"))
+		if err != nil {
+			return err
+		}
+		if err := restoreFile(e.AgentsPath, before, 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Restored previous %s\n", e.AgentsPath)
+	} else {
+		if err := removeFile(e.AgentsPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Removed %s\n", e.AgentsPath)
+	}
+
+	if err := restampIntegrity(e.AgentsPath, opts); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// restoreInput puts a file back the way it was before a run linked it
+func restoreInput(in historyInput) error {
+	if err := removeFile(in.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var err error
+	if in.Symlink != "" {
+		err = symlinkFile(in.Symlink, in.Path)
+	} else if err = restoreFile(in.Path, []byte(in.Content), 0644); err == nil {
+		err = restoreMode(in.Path, in.Mode)
+	}
+	if err != nil {
+		return fmt.Errorf("restoring %s: %w", in.Path, err)
+	}
+	return nil
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,207 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// automationHook is a command an agent runs on its own at some event
+type automationHook struct {
+	Tool    string
+	When    string
+	Command string
+	Source  string
+}
+
+// hookEvents describes agent hook events in plain words
+var hookEvents = map[string]string{
+	// Claude Code and Gemini CLI
+	"PreToolUse":       "before a tool runs",
+	"PostToolUse":      "after a tool runs",
+	"UserPromptSubmit": "when a prompt is submitted",
+	"Notification":     "on notifications",
+	"Stop":             "when the agent finishes responding",
+	"SubagentStop":     "when a subagent finishes",
+	"PreCompact":       "before the context is compacted",
+	"SessionStart":     "when a session starts",
+	"SessionEnd":       "when a session ends",
+	"BeforeTool":       "before a tool runs",
+	"AfterTool":        "after a tool runs",
+	"BeforeAgent":      "before the agent starts a turn",
+	"AfterAgent":       "after the agent finishes a turn",
+	// Cursor
+	"beforeShellExecution": "before a shell command runs",
+	"beforeMCPExecution":   "before an MCP tool runs",
+	"beforeReadFile":       "before a file is read",
+	"afterFileEdit":        "after a file is edited",
+	"beforeSubmitPrompt":   "when a prompt is submitted",
+	"stop":                 "when the agent finishes",
+}
+
+// findHooks collects the automation configured for all agents in dir
+func findHooks(dir string) ([]automationHook, error) {
+	var hooks []automationHook
+	for _, src := range []struct {
+		tool, path string
+	}{
+		{"Claude Code", ".claude/settings.json"},
+		{"Gemini CLI", ".gemini/settings.json"},
+	} {
+		found, err := settingsHooks(src.tool, filepath.Join(dir, src.path))
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, found...)
+	}
+
+	found, err := cursorHooks(filepath.Join(dir, ".cursor/hooks.json"))
+	if err != nil {
+		return nil, err
+	}
+	hooks = append(hooks, found...)
+
+	found, err = codexHooks(filepath.Join(dir, ".codex/config.toml"))
+	if err != nil {
+		return nil, err
+	}
+	hooks = append(hooks, found...)
+
+	found, err = aiderHooks(filepath.Join(dir, aiderConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	return append(hooks, found...), nil
+}
+
+// settingsHooks reads the hooks of a Claude Code style settings file:
+// event -> [{matcher, hooks: [{type: command, command}]}]
+func settingsHooks(tool, path string) ([]automationHook, error) {
+	doc, err := readJSONObject(path)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	events := jsonObject(doc["hooks"])
+	var hooks []automationHook
+	for _, event := range sortedKeys(events) {
+		groups, _ := events[event].([]any)
+		for _, g := range groups {
+			group := jsonObject(g)
+			when := describeHookEvent(event)
+			if matcher := yamlString(group["matcher"]); matcher != "" && matcher != "*" {
+				when += fmt.Sprintf(" (`%s`)", matcher)
+			}
+			entries, _ := group["hooks"].([]any)
+			for _, e := range entries {
+				if command := yamlString(jsonObject(e)["command"]); command != "" {
+					hooks = append(hooks, automationHook{Tool: tool, When: when, Command: command, Source: path})
+				}
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// cursorHooks reads .cursor/hooks.json: {hooks: {event: [{command}]}}
+func cursorHooks(path string) ([]automationHook, error) {
+	doc, err := readJSONObject(path)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	events := jsonObject(doc["hooks"])
+	var hooks []automationHook
+	for _, event := range sortedKeys(events) {
+		entries, _ := events[event].([]any)
+		for _, e := range entries {
+			if command := yamlString(jsonObject(e)["command"]); command != "" {
+				hooks = append(hooks, automationHook{Tool: "Cursor", When: describeHookEvent(event), Command: command, Source: path})
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// codexHooks reads the notify program of .codex/config.toml
+func codexHooks(path string) ([]automationHook, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseTOML(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	notify := yamlStrings(doc["notify"])
+	if len(notify) == 0 {
+		return nil, nil
+	}
+	return []automationHook{{Tool: "Codex", When: "when a turn completes", Command: strings.Join(notify, " "), Source: path}}, nil
+}
+
+// aiderHooks reads the lint and test commands Aider runs after edits
+func aiderHooks(path string) ([]automationHook, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	conf, _ := parsed.(map[string]any)
+
+	var hooks []automationHook
+	for _, cmd := range []struct{ key, auto, when string }{
+		{"lint-cmd", "auto-lint", "after editing files (lint)"},
+		{"test-cmd", "auto-test", "after editing files (tests)"},
+	} {
+		// Aider lints automatically unless told not to, but only tests on request
+		enabled, set := yamlBool(conf[cmd.auto])
+		if !set {
+			enabled = cmd.auto == "auto-lint"
+		}
+		if !enabled {
+			continue
+		}
+		for _, command := range yamlStrings(conf[cmd.key]) {
+			hooks = append(hooks, automationHook{Tool: "Aider", When: cmd.when, Command: command, Source: path})
+		}
+	}
+	return hooks, nil
+}
+
+func describeHookEvent(event string) string {
+	if when, ok := hookEvents[event]; ok {
+		return when
+	}
+	return "on " + event
+}
+
+// renderHooksSection tells every agent what runs automatically, so effects
+// such as reformatted files or test output are not a surprise
+func renderHooksSection(scope packageScope) (string, error) {
+	hooks, err := findHooks(scope.Dir)
+	if err != nil || len(hooks) == 0 {
+		return "", err
+	}
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].Tool < hooks[j].Tool })
+
+	var b strings.Builder
+	b.WriteString("These commands run automatically while agents work in this project. Expect\ntheir effects (such as reformatted files or test output) after the listed events.\n\n")
+	for _, h := range hooks {
+		rel, err := filepath.Rel(filepath.Dir(scope.agentsPath()), h.Source)
+		if err != nil {
+			rel = h.Source
+		}
+		fmt.Fprintf(&b, "- **%s**, %s: `%s` (%s)\n", h.Tool, h.When, h.Command, filepath.ToSlash(rel))
+	}
+	return b.String(), nil
+}
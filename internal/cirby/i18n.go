@@ -0,0 +1,103 @@
+package cirby
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// catalog translates user-facing messages, keyed by language and then by
+// the English format string, which is also what is shown when a message
+// has no translation. Translations keep the [ok]/[skip]/... markers and
+// may reorder arguments with %[n]s.
+//
+// It covers the merge flow only: scanning, agent selection, the dry-run
+// summary, merging and linking, and the "Error:" prefix. Help, the other
+// commands and error messages themselves are English.
+var catalog = map[string]map[string]string{
+	"zh": {
+		"Scanning for agent configuration files...":                         "正在扫描智能体配置文件...",
+		"No agent configuration files found.":                               "未找到智能体配置文件。",
+		"  [ok] %s (canonical)\n":                                           "  [ok] %s（规范文件）\n",
+		"  [skip] %s (already symlinked)\n":                                 "  [skip] %s（已是符号链接）\n",
+		"[ok] Already in sync. Nothing to do.":                              "[ok] 已同步，无需操作。",
+		"\n[Dry Run] Would perform these actions:\n\n":                      "\n[Dry Run] 将执行以下操作：\n\n",
+		"  - Use %s to merge %d files into new %s\n":                        "  - 使用 %[1]s 将 %[2]d 个文件合并为新的 %[3]s\n",
+		"  - Use %s to merge %d new files INTO existing %s\n":               "  - 使用 %[1]s 将 %[2]d 个新文件合并到现有的 %[3]s\n",
+		"  - Create %s: %s -> %s\n":                                         "  - 创建 %s：%s -> %s\n",
+		"\nRun without --dry-run to apply changes.":                         "\n去掉 --dry-run 重新运行以应用更改。",
+		"Using %s to merge config files...\n":                               "使用 %s 合并配置文件...\n",
+		"Cirby needs an AI agent to intelligently merge your config files.": "Cirby 需要一个 AI 智能体来合并你的配置文件。",
+		"Multiple agents detected on your system:\n\n":                      "检测到多个智能体：\n\n",
+		"\nWhich agent would you like to use? [1]: ":                        "\n要使用哪个智能体？[1]: ",
+		"Not a git repository, skipping git check.":                         "不是 git 仓库，跳过 git 检查。",
+		"Merging with %s...\n":                                              "正在使用 %s 合并...\n",
+		"Merging %d new files into existing %s with %s...\n":                "正在使用 %[3]s 将 %[1]d 个新文件合并到现有的 %[2]s...\n",
+		"[ok] Reused cached merge for %s\n":                                 "[ok] 复用了 %s 的缓存合并结果\n",
+		"[ok] Created %s\n":                                                 "[ok] 已创建 %s\n",
+		"[ok] Updated %s\n":                                                 "[ok] 已更新 %s\n",
+		"[ok] Symlinked %s -> %s\n":                                         "[ok] 已创建符号链接 %s -> %s\n",
+		"[ok] Copied %s -> %s\n":                                            "[ok] 已复制 %s -> %s\n",
+		"\nDone!":                                                           "\n完成！",
+		"Error: %v\n":                                                       "错误：%v\n",
+	},
+	"ja": {
+		"Scanning for agent configuration files...":                         "エージェント設定ファイルを検索しています...",
+		"No agent configuration files found.":                               "エージェント設定ファイルが見つかりません。",
+		"  [ok] %s (canonical)\n":                                           "  [ok] %s（正規ファイル）\n",
+		"  [skip] %s (already symlinked)\n":                                 "  [skip] %s（シンボリックリンク済み）\n",
+		"[ok] Already in sync. Nothing to do.":                              "[ok] 同期済みです。何もすることはありません。",
+		"\n[Dry Run] Would perform these actions:\n\n":                      "\n[Dry Run] 次の操作を実行します:\n\n",
+		"  - Use %s to merge %d files into new %s\n":                        "  - %[1]s で %[2]d 個のファイルを新しい %[3]s にマージ\n",
+		"  - Use %s to merge %d new files INTO existing %s\n":               "  - %[1]s で %[2]d 個の新しいファイルを既存の %[3]s にマージ\n",
+		"  - Create %s: %s -> %s\n":                                         "  - %s を作成: %s -> %s\n",
+		"\nRun without --dry-run to apply changes.":                         "\n変更を適用するには --dry-run を付けずに実行してください。",
+		"Using %s to merge config files...\n":                               "%s で設定ファイルをマージします...\n",
+		"Cirby needs an AI agent to intelligently merge your config files.": "Cirby は設定ファイルのマージに AI エージェントを使います。",
+		"Multiple agents detected on your system:\n\n":                      "複数のエージェントが見つかりました:\n\n",
+		"\nWhich agent would you like to use? [1]: ":                        "\nどのエージェントを使いますか？ [1]: ",
+		"Not a git repository, skipping git check.":                         "git リポジトリではないため、git のチェックを省略します。",
+		"Merging with %s...\n":                                              "%s でマージしています...\n",
+		"Merging %d new files into existing %s with %s...\n":                "%[3]s で %[1]d 個の新しいファイルを既存の %[2]s にマージしています...\n",
+		"[ok] Reused cached merge for %s\n":                                 "[ok] %s のキャッシュ済みのマージ結果を再利用しました\n",
+		"[ok] Created %s\n":                                                 "[ok] %s を作成しました\n",
+		"[ok] Updated %s\n":                                                 "[ok] %s を更新しました\n",
+		"[ok] Symlinked %s -> %s\n":                                         "[ok] シンボリックリンクを作成しました %s -> %s\n",
+		"[ok] Copied %s -> %s\n":                                            "[ok] コピーしました %s -> %s\n",
+		"\nDone!":                                                           "\n完了しました！",
+		"Error: %v\n":                                                       "エラー: %v\n",
+	},
+}
+
+// language is the catalog used for this run, from CIRBY_LANG or the usual
+// locale variables; "" for English
+var language = sync.OnceValue(func() string {
+	for _, env := range []string{"CIRBY_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		// zh_CN.UTF-8, ja-JP, en
+		lang, _, _ := strings.Cut(strings.ToLower(value), ".")
+		lang, _, _ = strings.Cut(lang, "_")
+		lang, _, _ = strings.Cut(lang, "-")
+		if _, ok := catalog[lang]; ok {
+			return lang
+		}
+		return ""
+	}
+	return ""
+})
+
+// tr returns the translation of a message for the user's language
+func tr(message string) string {
+	if translated, ok := catalog[language()][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Translate is tr for the cirby command, for the messages it prints itself
+func Translate(message string) string {
+	return tr(message)
+}
@@ -0,0 +1,41 @@
+package cirby
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// formatVerb matches the fmt verbs of a message, after argument indexes
+// such as %[2]s are dropped
+var (
+	formatVerb    = regexp.MustCompile(`%[a-z]`)
+	argumentIndex = regexp.MustCompile(`%\[\d+\]`)
+)
+
+func TestCatalog(t *testing.T) {
+	for lang, messages := range catalog {
+		for _, other := range catalog {
+			for message := range other {
+				if _, ok := messages[message]; !ok {
+					t.Errorf("%s has no translation of %q", lang, message)
+				}
+			}
+		}
+		for message, translated := range messages {
+			want := formatVerb.FindAllString(message, -1)
+			got := formatVerb.FindAllString(argumentIndex.ReplaceAllString(translated, "%"), -1)
+			slices.Sort(want)
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s translation of %q has verbs %q, want %q", lang, message, got, want)
+			}
+			for _, marker := range []string{"[ok]", "[skip]", "[warn]", "[error]", "[Dry Run]"} {
+				if strings.Contains(message, marker) != strings.Contains(translated, marker) {
+					t.Errorf("%s translation of %q does not keep %s", lang, message, marker)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// canonicalIgnoreFile holds the exclusion list shared by all agents, in
+// .gitignore syntax
+const canonicalIgnoreFile = ".cirby/ignore"
+
+// ignoreHeader marks tool ignore files generated from canonicalIgnoreFile
+const ignoreHeader = "# Generated by cirby from " + canonicalIgnoreFile + "; edit that file and run `cirby sync-ignore`."
+
+// ignoreTool is an agent's ignore file. The file is generated when it
+// already exists or when any of the agent's marker paths does.
+type ignoreTool struct {
+	Tool    string
+	Path    string
+	Markers []string
+}
+
+var ignoreTools = []ignoreTool{
+	{"Aider", ".aiderignore", []string{aiderConfigFile, "CONVENTIONS.md"}},
+	{"Cursor", ".cursorignore", []string{".cursor", ".cursorrules"}},
+	{"Windsurf", ".codeiumignore", []string{".windsurf", ".windsurfrules"}},
+	{"Gemini CLI", ".geminiignore", []string{".gemini", "GEMINI.md"}},
+}
+
+// SyncIgnore merges the agents' ignore files into canonicalIgnoreFile and
+// regenerates each of them from it. The files are written rather than
+// symlinked so each can carry its own header.
+func SyncIgnore(opts Options) error {
+	canonical, err := readLines(canonicalIgnoreFile)
+	if err != nil {
+		return err
+	}
+	found := canonical != nil
+	known := map[string]bool{}
+	for _, line := range canonical {
+		known[strings.TrimSpace(line)] = true
+	}
+
+	// Patterns from hand-written ignore files are appended to the canonical
+	// list; generated files only contribute a warning if edited since
+	merged := append([]string(nil), canonical...)
+	for _, tool := range ignoreTools {
+		lines, err := readLines(tool.Path)
+		if err != nil {
+			return err
+		}
+		if lines == nil {
+			continue
+		}
+		found = true
+		generated := len(lines) > 0 && lines[0] == ignoreHeader
+
+		var added []string
+		for _, line := range lines {
+			pattern := strings.TrimSpace(line)
+			if pattern == "" || strings.HasPrefix(pattern, "#") || known[pattern] {
+				continue
+			}
+			added = append(added, pattern)
+			if !generated {
+				known[pattern] = true
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		if generated {
+			fmt.Fprintf(opts.stdout(), "[warn] %s was edited after it was generated; %s is replaced (add it to %s instead)\n",
+				tool.Path, strings.Join(added, ", "), canonicalIgnoreFile)
+			continue
+		}
+		if len(merged) > 0 && strings.TrimSpace(merged[len(merged)-1]) != "" {
+			merged = append(merged, "")
+		}
+		merged = append(merged, "# from "+tool.Path)
+		merged = append(merged, added...)
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [ok] %d patterns from %s\n", len(added), tool.Path)
+		}
+	}
+
+	if !found {
+		fmt.Fprintln(opts.stdout(), "No AI ignore files found.")
+		return nil
+	}
+
+	body := strings.Join(merged, "\n") + "\n"
+	writes := []plannedWrite{{Path: canonicalIgnoreFile, Content: []byte(body)}}
+	for _, tool := range ignoreTools {
+		if usesIgnoreTool(tool) {
+			writes = append(writes, plannedWrite{Path: tool.Path, Content: []byte(ignoreHeader + "\n\n" + body)})
+		}
+	}
+
+	var changed []plannedWrite
+	for _, w := range writes {
+		if current, err := os.ReadFile(w.Path); err == nil && string(current) == string(w.Content) {
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [skip] %s (up to date)\n", w.Path)
+			}
+			continue
+		}
+		changed = append(changed, w)
+	}
+	if len(changed) == 0 {
+		fmt.Fprintln(opts.stdout(), "[ok] Ignore files already in sync.")
+		return nil
+	}
+
+	if !opts.Force {
+		referenced := map[string]bool{}
+		for _, w := range changed {
+			referenced[w.Path] = true
+		}
+		if err := checkGitStatus(referenced, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		for _, w := range changed {
+			fmt.Fprintf(opts.stdout(), "  - Write %s\n", w.Path)
+		}
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	for _, w := range changed {
+		if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(w.Path, w.Content, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", w.Path, err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Wrote %s\n", w.Path)
+	}
+	fmt.Fprintln(opts.stdout(), "\nDone! Ignore files in sync.")
+	return nil
+}
+
+func usesIgnoreTool(tool ignoreTool) bool {
+	if _, err := os.Lstat(tool.Path); err == nil {
+		return true
+	}
+	for _, marker := range tool.Markers {
+		if _, err := os.Lstat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readLines returns the lines of a text file without the final newline, or
+// nil if the file does not exist
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimRight(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	if text == "" {
+		return []string{}, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
@@ -0,0 +1,94 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// includePattern matches a whole-line include directive such as
+// <!-- cirby:include docs/testing.md -->
+var includePattern = regexp.MustCompile(`^\s*<!--\s*cirby:include\s+(\S+)\s*-->\s*$`)
+
+// expandIncludes returns the content of path with every include directive
+// replaced by the (recursively expanded) content of the referenced file.
+// Include paths are relative to the file containing the directive.
+func expandIncludes(path string) (string, error) {
+	return expandFile(path, nil)
+}
+
+func expandFile(path string, stack []string) (string, error) {
+	for _, seen := range stack {
+		if seen == path {
+			return "", fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), path)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if len(stack) > 0 {
+			return "", fmt.Errorf("%s includes missing file %s", stack[len(stack)-1], path)
+		}
+		return "", err
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	var out strings.Builder
+	for _, line := range lines {
+		m := includePattern.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+		if m == nil {
+			out.WriteString(line)
+			continue
+		}
+		included, err := expandFile(filepath.Join(filepath.Dir(path), filepath.FromSlash(m[1])), append(stack, path))
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(included)
+		if !strings.HasSuffix(included, "\n") {
+			out.WriteString("\n")
+		}
+	}
+
+	return out.String(), nil
+}
+
+// validateIncludes checks that every include directive in path resolves
+func validateIncludes(path string) error {
+	_, err := expandIncludes(path)
+	return err
+}
+
+// includedFiles returns the sha256 of every file the include directives
+// of path pull in, directly or through other included files, by path
+// relative to the project root. Missing files are left out.
+func includedFiles(path string) map[string]string {
+	files := map[string]string{}
+	var walk func(path string)
+	walk = func(path string) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			m := includePattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+			if m == nil {
+				continue
+			}
+			included := filepath.Join(filepath.Dir(path), filepath.FromSlash(m[1]))
+			if _, seen := files[filepath.ToSlash(included)]; seen {
+				continue
+			}
+			data, err := os.ReadFile(included)
+			if err != nil {
+				continue
+			}
+			files[filepath.ToSlash(included)] = hashString(string(data))
+			walk(included)
+		}
+	}
+	walk(path)
+	return files
+}
@@ -0,0 +1,440 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// sourceChange is what changed in one source file since cirby last merged it
+type sourceChange struct {
+	Path  string
+	New   bool // not merged before, so every line is added
+	Hunks []changeHunk
+}
+
+// changeHunk is a run of consecutive changed lines
+type changeHunk struct {
+	Heading string // nearest heading above the change, "" at the top of the file
+	Removed []string
+	Added   []string
+}
+
+// markdownSection is a level-2 section of AGENTS.md, or the preamble
+// before the first one
+type markdownSection struct {
+	Heading string // heading line, "" for the preamble
+	Content string // including the heading line
+}
+
+// incrementalPlan merges only the changed lines of sources cirby merged
+// before, into the AGENTS.md sections they belong to
+type incrementalPlan struct {
+	Changes  []sourceChange
+	Sections []markdownSection // sections of AGENTS.md the changes touch
+	Outline  []string          // every heading of AGENTS.md
+	Total    int               // number of sections in AGENTS.md
+
+	// When AGENTS.md was edited too, the changes are instead merged three
+	// ways against the AGENTS.md of the last merge, their common ancestor
+	ThreeWay  bool
+	Merged    string // result of the three-way merge, with conflict markers
+	Conflicts int
+}
+
+// mergeRecord is what cirby knows about the last merge into a scope
+type mergeRecord struct {
+	lock     *agentsLock
+	history  []historyEntry
+	current  string // AGENTS.md as it is now
+	recorded string // AGENTS.md as cirby last wrote it, "" if unknown
+}
+
+// planIncremental compares each source with the state it had when cirby
+// last merged it; sources new since then are added whole. It returns nil
+// when a full merge is needed: for a missing record, a source whose last
+// merged state is unknown, --full, a template or a merge pipeline.
+func planIncremental(scope packageScope, sources []AgentConfig, agentsMDExists bool, agentsMD string, opts Options) *incrementalPlan {
+	if opts.FullMerge || opts.template != "" || opts.pipeline != nil || !agentsMDExists {
+		return nil
+	}
+	agentsPath := scope.agentsPath()
+	lock, err := loadLock()
+	if err != nil {
+		return nil
+	}
+	record, ok := lock.Agents[filepath.ToSlash(agentsPath)]
+	if !ok {
+		return nil
+	}
+	history, err := loadHistory()
+	if err != nil {
+		return nil
+	}
+	last := mergeRecord{lock: record, history: history, current: agentsMD}
+	last.recorded = recordedAgentsMD(agentsPath, last)
+	edited := last.recorded != "" && last.recorded != agentsMD
+
+	plan := &incrementalPlan{ThreeWay: edited}
+	var changed []AgentConfig
+	for _, cfg := range sources {
+		baseline, fromRecorded, ok := sourceBaseline(cfg, last)
+		_, known := record.Sources[filepath.ToSlash(cfg.Path)]
+		if !ok && known {
+			return nil
+		}
+		if hunks := changeHunks(splitLines(baseline), splitLines(stripHeader(cfg.Content))); len(hunks) > 0 {
+			plan.Changes = append(plan.Changes, sourceChange{Path: cfg.Path, New: !known, Hunks: hunks})
+			changed = append(changed, cfg)
+			plan.ThreeWay = plan.ThreeWay && fromRecorded
+		}
+	}
+
+	if plan.ThreeWay && len(changed) > 0 {
+		// Without headers, which stampHeader puts back after the merge
+		merged := splitLines(stripHeader(agentsMD))
+		for _, cfg := range changed {
+			var n int
+			merged, n = merge3(splitLines(stripHeader(last.recorded)), merged, splitLines(stripHeader(cfg.Content)),
+				mergeLabels{Local: agentsPath, Base: "last cirby merge", Remote: cfg.Path})
+			plan.Conflicts += n
+		}
+		plan.Merged = joinLines(merged)
+	}
+	plan.ThreeWay = plan.ThreeWay && len(changed) > 0
+
+	sections := splitSections(stripHeader(agentsMD))
+	plan.Total = len(sections)
+	for _, s := range sections {
+		if s.Heading != "" {
+			plan.Outline = append(plan.Outline, s.Heading)
+		}
+	}
+	affected := map[int]bool{}
+	for _, change := range plan.Changes {
+		for _, h := range change.Hunks {
+			if i := sectionFor(sections, h.Heading); i >= 0 {
+				affected[i] = true
+			}
+		}
+	}
+	for i, s := range sections {
+		if affected[i] {
+			plan.Sections = append(plan.Sections, s)
+		}
+	}
+	return plan
+}
+
+// recordedAgentsMD finds the AGENTS.md cirby last wrote, from the current
+// file if it is unchanged or else from the run history
+func recordedAgentsMD(agentsPath string, last mergeRecord) string {
+	if hashString(last.current) == last.lock.SHA256 {
+		return last.current
+	}
+	for i := len(last.history) - 1; i >= 0; i-- {
+		if last.history[i].AgentsPath != agentsPath {
+			continue
+		}
+		after, err := os.ReadFile(filepath.Join(historyDir(), last.history[i].ID, "after.md"))
+		if err == nil && hashString(string(after)) == last.lock.SHA256 {
+			return string(after)
+		}
+	}
+	return ""
+}
+
+// sourceBaseline returns the content a source had when it was last merged,
+// and whether that differs from the current AGENTS.md. A file cirby linked
+// whose link a tool replaced with an edited copy of AGENTS.md (it still
+// starts with the generated-by header) is compared with the recorded
+// AGENTS.md. Any other file is compared with its own content at the last
+// merge, from the run history: for a replaced link, its content before it
+// was linked, as AGENTS.md also holds the rules of the other sources.
+func sourceBaseline(cfg AgentConfig, last mergeRecord) (baseline string, fromRecorded, ok bool) {
+	path := filepath.ToSlash(cfg.Path)
+	recorded, ok := last.lock.Sources[path]
+	if !ok {
+		return "", false, false
+	}
+
+	linked := recorded == linkedSource || slices.Contains(last.lock.Linked, path)
+	if linked && last.recorded != "" && copiesAgentsMD(cfg.Content) {
+		// Whether the link broke before or after AGENTS.md was edited, the
+		// AGENTS.md cirby wrote is a common ancestor of both. The header
+		// never reaches the prompt.
+		return stripHeader(last.recorded), last.recorded != last.current, true
+	}
+	if recorded == linkedSource {
+		return "", false, false // linked before its content was recorded
+	}
+
+	for i := len(last.history) - 1; i >= 0; i-- {
+		for _, in := range last.history[i].Inputs {
+			if in.Path == cfg.Path && in.SHA256 == recorded && in.Symlink == "" {
+				return in.Content, false, true
+			}
+		}
+	}
+	return "", false, false
+}
+
+// copiesAgentsMD reports whether content is a copy of a generated
+// AGENTS.md, by its header
+func copiesAgentsMD(content string) bool {
+	for _, line := range splitLines(content) {
+		if strings.TrimSpace(line) != "" {
+			return isHeader(line)
+		}
+	}
+	return false
+}
+
+// changeHunks lists the changes from old to new, each with the heading of
+// new it falls under
+func changeHunks(old, new []string) []changeHunk {
+	headings := make([]string, len(new))
+	current := ""
+	inFence := false
+	for i, line := range new {
+		var heading bool
+		heading, inFence = markdownHeading(line, inFence)
+		if heading {
+			current = strings.TrimSpace(line)
+		}
+		headings[i] = current
+	}
+
+	var hunks []changeHunk
+	i, j := 0, 0
+	matches := append(lcsMatches(old, new), [2]int{len(old), len(new)})
+	for _, m := range matches {
+		if i < m[0] || j < m[1] {
+			h := changeHunk{Removed: old[i:m[0]]}
+			if j > 0 {
+				h.Heading = headings[j-1]
+			}
+			// Added lines are split up by the sections they land in
+			for k := j; k < m[1]; k++ {
+				if headings[k] != h.Heading && (len(h.Added) > 0 || len(h.Removed) > 0) {
+					hunks = appendHunk(hunks, h)
+					h = changeHunk{}
+				}
+				h.Heading = headings[k]
+				h.Added = append(h.Added, new[k])
+			}
+			hunks = appendHunk(hunks, h)
+		}
+		i, j = m[0]+1, m[1]+1
+	}
+	return hunks
+}
+
+// appendHunk adds h unless it only changes blank lines
+func appendHunk(hunks []changeHunk, h changeHunk) []changeHunk {
+	for _, lines := range [][]string{h.Removed, h.Added} {
+		for _, line := range lines {
+			if strings.TrimSpace(line) != "" {
+				return append(hunks, h)
+			}
+		}
+	}
+	return hunks
+}
+
+// markdownHeading reports whether line is an ATX heading, tracking fenced
+// code blocks (whose "# comments" are not headings) through inFence
+func markdownHeading(line string, inFence bool) (heading, stillInFence bool) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		return false, !inFence
+	}
+	if inFence {
+		return false, true
+	}
+	level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+	return level >= 1 && level <= 6 && (len(trimmed) == level || trimmed[level] == ' '), false
+}
+
+// splitSections splits markdown at its level-2 headings
+func splitSections(content string) []markdownSection {
+	var sections []markdownSection
+	var cur markdownSection
+	var lines []string
+	inFence := false
+	for _, line := range splitLines(content) {
+		var heading bool
+		heading, inFence = markdownHeading(line, inFence)
+		if heading && strings.HasPrefix(line, "## ") {
+			if len(lines) > 0 {
+				cur.Content = joinLines(lines)
+				sections = append(sections, cur)
+			}
+			cur, lines = markdownSection{Heading: strings.TrimSpace(line)}, nil
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) > 0 {
+		cur.Content = joinLines(lines)
+		sections = append(sections, cur)
+	}
+	return sections
+}
+
+// sectionFor finds the section a source heading belongs to: the one with
+// the same title, or the one containing it as a subheading. It returns -1
+// when there is none.
+func sectionFor(sections []markdownSection, heading string) int {
+	if heading == "" {
+		if len(sections) > 0 && sections[0].Heading == "" {
+			return 0
+		}
+		return -1
+	}
+	title := headingTitle(heading)
+	for i, s := range sections {
+		if s.Heading != "" && headingTitle(s.Heading) == title {
+			return i
+		}
+	}
+	for i, s := range sections {
+		for _, line := range splitLines(s.Content) {
+			if strings.HasPrefix(line, "#") && headingTitle(line) == title {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func headingTitle(heading string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(heading), "#")))
+}
+
+// changedLines counts the added and removed lines of the plan
+func (p *incrementalPlan) changedLines() int {
+	n := 0
+	for _, c := range p.Changes {
+		for _, h := range c.Hunks {
+			n += len(h.Added) + len(h.Removed)
+		}
+	}
+	return n
+}
+
+// describe lists each changed source with its added and removed lines
+func (p *incrementalPlan) describe(opts Options) {
+	for _, c := range p.Changes {
+		added, removed := 0, 0
+		for _, h := range c.Hunks {
+			added += len(h.Added)
+			removed += len(h.Removed)
+		}
+		if c.New {
+			fmt.Fprintf(opts.stdout(), "  [new] %s (+%d)\n", c.Path, added)
+		} else {
+			fmt.Fprintf(opts.stdout(), "  [changed] %s (+%d -%d)\n", c.Path, added, removed)
+		}
+	}
+}
+
+func (p *incrementalPlan) sectionText() string {
+	var parts []string
+	for _, s := range p.Sections {
+		parts = append(parts, strings.TrimRight(s.Content, "\n"))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func buildIncrementalPrompt(existingContent string, plan *incrementalPlan, scope packageScope) string {
+	target := scope.agentsPath()
+
+	var changes strings.Builder
+	for _, c := range plan.Changes {
+		if c.New {
+			fmt.Fprintf(&changes, "%s is new:\n", c.Path)
+		} else {
+			fmt.Fprintf(&changes, "Changes in %s:\n", c.Path)
+		}
+		for _, h := range c.Hunks {
+			if h.Heading != "" {
+				fmt.Fprintf(&changes, "\nUnder %q:\n", h.Heading)
+			} else {
+				changes.WriteString("\nAt the top of the file:\n")
+			}
+			for _, line := range h.Removed {
+				changes.WriteString("- " + line + "\n")
+			}
+			for _, line := range h.Added {
+				changes.WriteString("+ " + line + "\n")
+			}
+		}
+		changes.WriteString("\n")
+	}
+
+	sections := "None of the existing sections match; add the changes where they fit best.\n"
+	if len(plan.Sections) > 0 {
+		sections = fmt.Sprintf("The sections of %s these changes belong to currently read:\n\n---\n%s\n---\n", target, plan.sectionText())
+	}
+
+	preserve := ""
+	if strings.Contains(existingContent, "<!-- cirby:section ") {
+		preserve = "Keep every block between <!-- cirby:section NAME --> and <!-- /cirby:section NAME --> markers\nexactly as it is, including the markers; cirby maintains those blocks.\n\n"
+	}
+
+	return fmt.Sprintf(`Some agent configuration files changed or were added since they were last merged into %s.
+Only these changes (lines starting with "-" were removed, "+" were added) need merging:
+
+%s%s
+%s currently has these headings:
+%s
+
+Please:
+1. Update %s in place, editing only the sections shown above, or adding a
+   new section if a change fits none of the existing ones
+2. Add information that is new, and drop instructions the change removed
+3. Leave every other section of %s exactly as it is
+4. Use agent-agnostic language (don't say "Claude should..." or "Gemini should...")
+5. Keep the content concise
+
+%s%sPlease update the %s file now.`, target, changes.String(), sections, target, strings.Join(plan.Outline, "\n"), target, target, preserve, buildInheritNote(scope), target)
+}
+
+// buildConflictPrompt asks the agent to finish a three-way merge whose
+// conflicts cirby could not resolve line by line. intro says which sides
+// changed.
+func buildConflictPrompt(intro, merged string, scope packageScope) string {
+	target := scope.agentsPath()
+	return fmt.Sprintf(`%s
+
+cirby merged the changes of both sides against their common ancestor.
+Regions both sides changed differently are marked like a git conflict:
+the %s side, then the ancestor after "|||||||", then the other side
+after "=======".
+
+The merged result is:
+
+---
+%s---
+
+Please:
+1. Write this result to %s, resolving every conflict so that the intent of both
+   sides survives; use the ancestor to tell what each side changed
+2. Remove all conflict markers
+3. Do not repeat an instruction that appears on both sides
+4. Use agent-agnostic language (don't say "Claude should..." or "Gemini should...")
+5. Leave everything outside the conflicts exactly as it is
+
+%sPlease update the %s file now.`, intro, target, merged, target, buildInheritNote(scope), target)
+}
+
+// conflictIntro describes a plan's three-way merge for buildConflictPrompt
+func (p *incrementalPlan) conflictIntro(target string) string {
+	var files []string
+	for _, c := range p.Changes {
+		files = append(files, c.Path)
+	}
+	return fmt.Sprintf("Both %s and these agent configuration files were edited since cirby last merged them:\n%s", target, strings.Join(files, "\n"))
+}
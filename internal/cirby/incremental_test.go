@@ -0,0 +1,82 @@
+package cirby
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanIncrementalReplacedLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		content func(agentsMD string) string // of CLAUDE.md once its link is replaced
+		added   []string
+	}{
+		{
+			name:    "by its own content, edited",
+			content: func(string) string { return "# Claude\n\nUse tabs.\nUse gofmt.\n" },
+			added:   []string{"Use gofmt."},
+		},
+		{
+			name:    "by an edited copy of AGENTS.md",
+			content: func(agentsMD string) string { return agentsMD + "Use gofmt.\n" },
+			added:   []string{"Use gofmt."},
+		},
+		{
+			// Copied on another day, so the header changed too
+			name: "by a copy of AGENTS.md with another header",
+			content: func(agentsMD string) string {
+				return renderHeader([]string{"CLAUDE.md"}, time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)) + "\n" + stripHeader(agentsMD) + "Use gofmt.\n"
+			},
+			added: []string{"Use gofmt."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testProject(t, map[string]string{
+				"CLAUDE.md": "# Claude\n\nUse tabs.\n",
+				"GEMINI.md": "Be brief.\n",
+			})
+			var out bytes.Buffer
+			opts := testOptions(mockAgent, &out)
+			if err := Run(opts); err != nil {
+				t.Fatalf("Run: %v\n%s", err, out.String())
+			}
+			data, err := os.ReadFile("AGENTS.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+			agentsMD := string(data)
+			claude := AgentConfig{Path: "CLAUDE.md", Content: tt.content(agentsMD)}
+			if err := os.Remove("CLAUDE.md"); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile("CLAUDE.md", []byte(claude.Content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			scope := packageScope{Dir: ".", Output: "AGENTS.md"}
+			plan := planIncremental(scope, []AgentConfig{claude}, true, agentsMD, opts)
+			if plan == nil || len(plan.Changes) != 1 {
+				t.Fatalf("plan = %+v, want one change", plan)
+			}
+			var added, removed []string
+			for _, h := range plan.Changes[0].Hunks {
+				added = append(added, h.Added...)
+				removed = append(removed, h.Removed...)
+			}
+			if strings.Join(added, "\n") != strings.Join(tt.added, "\n") || len(removed) > 0 {
+				t.Errorf("changes of CLAUDE.md: added %q, removed %q; want added %q", added, removed, tt.added)
+			}
+			prompt := buildIncrementalPrompt(stripHeader(agentsMD), plan, scope)
+			if strings.Contains(prompt, "- Be brief.") {
+				t.Errorf("prompt removes GEMINI.md's rules:\n%s", prompt)
+			}
+			if strings.Contains(prompt, headerPrefix) {
+				t.Errorf("prompt contains the generated-by header:\n%s", prompt)
+			}
+		})
+	}
+}
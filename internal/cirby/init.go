@@ -0,0 +1,58 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Init writes a first AGENTS.md from a built-in template, --template or
+// the one matching the detected project type, with the project's own
+// build and test commands filled in. Unlike cirby generate it runs no agent.
+func Init(opts Options) error {
+	roots := opts.roots()
+	if len(roots) > 1 {
+		return fmt.Errorf("cirby init writes one AGENTS.md at a time; give a single --path")
+	}
+	if err := validatePath(roots[0]); err != nil {
+		return err
+	}
+	scope := packageScope{Dir: roots[0], Output: opts.output()}
+	agentsPath := scope.agentsPath()
+	if fileExists(agentsPath) && !opts.Force {
+		return fmt.Errorf("%s already exists; use --force to replace it with the template", agentsPath)
+	}
+
+	name := opts.Template
+	if name == "" {
+		var err error
+		if name, err = detectTemplate(scope.Dir); err != nil {
+			return err
+		}
+	}
+	content, ok := builtinTemplate(name, scope.Dir)
+	if !ok {
+		return fmt.Errorf("unknown template %s (built in: %s); --template URLs and files work with cirby and cirby generate", name, strings.Join(builtinTemplateNames(), ", "))
+	}
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		fmt.Fprintf(opts.stdout(), "  - Write %s from the %s template\n", agentsPath, name)
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	before, err := os.ReadFile(agentsPath)
+	existed := err == nil
+	if err := writeMergeResult(agentsPath, content); err != nil {
+		return fmt.Errorf("writing %s: %w", agentsPath, err)
+	}
+	entry := historyEntry{Agent: "init", AgentsPath: agentsPath, HadAgentsMD: existed}
+	if err := recordHistory(entry, string(before)); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	if err := stampIntegrity(scope, lockStamp{Backend: "init"}, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Wrote %s from the %s template; fill in the overview, then run cirby to merge other agents' files into it\n", agentsPath, name)
+	return nil
+}
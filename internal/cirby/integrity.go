@@ -0,0 +1,298 @@
+package cirby
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// linkedSource stands for a source linked to the canonical file before
+// its content was recorded, in locks written by earlier versions
+const linkedSource = "symlink"
+
+// lockStamp is what wrote a canonical file, for its integrity record
+type lockStamp struct {
+	Backend string         // agent, or builtin step such as merge3 or adopt; "" keeps the recorded one
+	Model   string         // model the agent ran, as far as it is known
+	Inputs  []historyInput // sources as they were before they were linked
+	Configs []AgentConfig  // sources as scanned by this run; nil scans them again
+}
+
+// agentsLock is the integrity record of one canonical file: its hash, the
+// state of every source file when cirby last wrote it, and what wrote it
+type agentsLock struct {
+	Dir      string            `json:"dir"`
+	SHA256   string            `json:"sha256"`
+	Sources  map[string]string `json:"sources"`            // path -> sha256 of the content merged
+	Linked   []string          `json:"linked,omitempty"`   // sources now linked to the canonical file
+	Includes map[string]string `json:"includes,omitempty"` // path -> sha256 of files pulled in by include directives
+	Backend  string            `json:"backend,omitempty"`  // agent, or builtin step such as merge3 or adopt
+	Model    string            `json:"model,omitempty"`
+	Version  string            `json:"cirby_version,omitempty"`
+}
+
+// scopeConfigs scans the sources of scope
+func scopeConfigs(scope packageScope, opts Options) ([]AgentConfig, error) {
+	opts.Output = scope.Output
+	return scanConfigs(scope.Dir, opts)
+}
+
+// sourceHashes describes the current state of a scope's sources, as
+// scanned into configs. Files are hashed as they are now, since links and
+// copies may have replaced them after the scan; settings and plugin
+// sources keep what the scan found, so plugins do not run again. A source
+// linked to the canonical file has the content it had before it was
+// linked, from recorded; once it is a file again its own content counts,
+// so replacing the link shows up as a change.
+func sourceHashes(scope packageScope, configs []AgentConfig, recorded map[string]string) map[string]string {
+	agentsPath := scope.agentsPath()
+	sources := map[string]string{}
+	for _, cfg := range configs {
+		switch {
+		case cfg.Path == agentsPath:
+		case isSymlinkToAgentsMD(cfg.Path, agentsPath):
+			hash, ok := recorded[filepath.ToSlash(cfg.Path)]
+			if !ok {
+				hash = linkedSource
+			}
+			sources[filepath.ToSlash(cfg.Path)] = hash
+		default:
+			content := cfg.Content
+			if !cfg.quoted() {
+				if data, err := os.ReadFile(cfg.Path); err == nil {
+					content = normalizeText(string(data))
+				}
+			}
+			sources[filepath.ToSlash(cfg.Path)] = hashString(content)
+		}
+	}
+	return sources
+}
+
+// linkedSources lists the sources that are links to agentsPath
+func linkedSources(sources map[string]string, agentsPath string) []string {
+	var linked []string
+	for path := range sources {
+		if isSymlinkToAgentsMD(filepath.FromSlash(path), agentsPath) {
+			linked = append(linked, path)
+		}
+	}
+	sort.Strings(linked)
+	return linked
+}
+
+// stampIntegrity records the scope's canonical file and sources in
+// .cirby.lock after cirby changed them. A stamp without a backend keeps
+// the recorded one, for changes that only relink or refresh.
+func stampIntegrity(scope packageScope, stamp lockStamp, opts Options) error {
+	agentsPath := scope.agentsPath()
+	key := filepath.ToSlash(agentsPath)
+	lock, err := loadLock()
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(agentsPath)
+	switch {
+	case os.IsNotExist(err):
+		// Removed, for example by undoing the run that created it
+		if _, ok := lock.Agents[key]; !ok {
+			return nil
+		}
+		delete(lock.Agents, key)
+	case err != nil:
+		return err
+	default:
+		recorded := map[string]string{}
+		old, hadOld := lock.Agents[key]
+		if hadOld {
+			maps.Copy(recorded, old.Sources)
+		}
+		for _, in := range stamp.Inputs {
+			recorded[filepath.ToSlash(in.Path)] = in.SHA256
+		}
+		configs := stamp.Configs
+		if configs == nil {
+			if configs, err = scopeConfigs(scope, opts); err != nil {
+				return err
+			}
+		}
+		sources := sourceHashes(scope, configs, recorded)
+		if lock.Agents == nil {
+			lock.Agents = map[string]*agentsLock{}
+		}
+		entry := &agentsLock{
+			Dir:      filepath.ToSlash(scope.Dir),
+			SHA256:   hashString(string(content)),
+			Sources:  sources,
+			Linked:   linkedSources(sources, agentsPath),
+			Includes: includedFiles(agentsPath),
+			Backend:  stamp.Backend,
+			Model:    stamp.Model,
+			Version:  Version,
+		}
+		if hadOld && stamp.Backend == "" {
+			entry.Backend, entry.Model = old.Backend, old.Model
+		}
+		lock.Agents[key] = entry
+	}
+	if err := saveLock(lock); err != nil {
+		return fmt.Errorf("writing %s: %w", lockFile, err)
+	}
+	return nil
+}
+
+// restampIntegrity refreshes the record of agentsPath if it has one, for
+// changes that do not know the file's scope (such as undo)
+func restampIntegrity(agentsPath string, opts Options) error {
+	lock, err := loadLock()
+	if err != nil {
+		return err
+	}
+	entry, ok := lock.Agents[filepath.ToSlash(agentsPath)]
+	if !ok {
+		return nil
+	}
+	return stampIntegrity(lockScope(agentsPath, entry), lockStamp{}, opts)
+}
+
+func lockScope(agentsPath string, entry *agentsLock) packageScope {
+	dir := filepath.FromSlash(entry.Dir)
+	output, err := filepath.Rel(dir, filepath.FromSlash(agentsPath))
+	if err != nil {
+		output = filepath.Base(agentsPath)
+	}
+	return packageScope{Dir: dir, Output: output}
+}
+
+// Check verifies the canonical files against .cirby.lock. It fails when a
+// file was edited outside cirby, or when sources changed since the last
+// merge. With `check: {hand_edits: warn}` in .cirby.yaml, hand edits only
+// produce a warning.
+func Check(opts Options) error {
+	if opts.Report != "" {
+		if _, _, err := parseReport(opts.Report, reportFiles); err != nil {
+			return err
+		}
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	lock, err := loadLock()
+	if err != nil {
+		return err
+	}
+	if len(lock.Agents) == 0 {
+		return fmt.Errorf("no integrity record in %s; run cirby to merge first", lockFile)
+	}
+
+	paths := make([]string, 0, len(lock.Agents))
+	for path := range lock.Agents {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	failures := 0
+	var results []checkResult
+	for _, path := range paths {
+		entry := lock.Agents[path]
+		scope := lockScope(path, entry)
+
+		content, err := os.ReadFile(scope.agentsPath())
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s: missing\n", path)
+			results = append(results, checkResult{Path: path, Rule: "missing", Severity: "error", Message: "missing; run cirby to merge it again"})
+			failures++
+			continue
+		}
+		configs, err := scopeConfigs(scope, opts)
+		if err != nil {
+			return err
+		}
+		sources := sourceHashes(scope, configs, entry.Sources)
+		changedSources := diffSources(entry.Sources, sources)
+		includes := changedIncludes(entry, scope.agentsPath())
+		edited := hashString(string(content)) != entry.SHA256
+
+		switch {
+		case len(changedSources) > 0:
+			fmt.Fprintf(opts.stdout(), "[error] %s is stale; sources changed since the last merge:\n", path)
+			for _, s := range changedSources {
+				fmt.Fprintf(opts.stdout(), "  - %s\n", s)
+			}
+			results = append(results, checkResult{Path: path, Rule: "stale", Severity: "error", Message: "stale; sources changed since the last merge: " + strings.Join(changedSources, ", ") + ". Run cirby and commit the result."})
+			failures++
+		case len(includes) > 0:
+			fmt.Fprintf(opts.stdout(), "[error] %s is stale; included files changed since cirby last wrote it:\n", path)
+			for _, s := range includes {
+				fmt.Fprintf(opts.stdout(), "  - %s\n", s)
+			}
+			results = append(results, checkResult{Path: path, Rule: "stale", Severity: "error", Message: "stale; included files changed since cirby last wrote it: " + strings.Join(includes, ", ") + ". Run cirby and commit the result."})
+			failures++
+		case edited && cfg.HandEdits == "warn":
+			fmt.Fprintf(opts.stdout(), "[warn] %s was edited outside cirby\n", path)
+			results = append(results, checkResult{Path: path, Rule: "hand-edit", Severity: "warning", Message: "edited outside cirby"})
+		case edited:
+			fmt.Fprintf(opts.stdout(), "[error] %s was edited outside cirby; move the change into a source file and rerun cirby\n", path)
+			results = append(results, checkResult{Path: path, Rule: "hand-edit", Severity: "error", Message: "edited outside cirby; move the change into a source file and rerun cirby"})
+			failures++
+		default:
+			fmt.Fprintf(opts.stdout(), "[ok] %s matches %s\n", path, lockFile)
+			results = append(results, checkResult{Path: path, Message: "in sync"})
+		}
+		if opts.Verbose && entry.Backend != "" {
+			fmt.Fprintf(opts.stdout(), "  written by %s by cirby v%s\n", lockBackend(entry), entry.Version)
+		}
+	}
+
+	if err := reportResults("cirby check", results, opts); err != nil {
+		return err
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of %d files failed the integrity check", failures, len(paths))
+	}
+	return nil
+}
+
+// lockBackend describes what last wrote a canonical file, such as
+// "claude (opus)"
+func lockBackend(entry *agentsLock) string {
+	if entry.Model == "" {
+		return entry.Backend
+	}
+	return fmt.Sprintf("%s (%s)", entry.Backend, entry.Model)
+}
+
+// changedIncludes lists the files included by agentsPath that were added,
+// changed or removed since entry was recorded. Records from before
+// includes were tracked have none.
+func changedIncludes(entry *agentsLock, agentsPath string) []string {
+	if entry.Includes == nil {
+		return nil
+	}
+	return diffSources(entry.Includes, includedFiles(agentsPath))
+}
+
+// diffSources lists the sources that were added, removed or changed
+func diffSources(recorded, current map[string]string) []string {
+	var changed []string
+	for path, hash := range current {
+		switch old, ok := recorded[path]; {
+		case !ok:
+			changed = append(changed, path+" (new)")
+		case old != hash:
+			changed = append(changed, path+" (modified)")
+		}
+	}
+	for path := range recorded {
+		if _, ok := current[path]; !ok {
+			changed = append(changed, path+" (removed)")
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,55 @@
+package cirby
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckIncludes(t *testing.T) {
+	testProject(t, map[string]string{
+		"CLAUDE.md":       "# Claude\n\nUse tabs.\n",
+		"docs/testing.md": "Run go test.\n",
+	})
+	var out bytes.Buffer
+	opts := testOptions(mockAgent, &out)
+	if err := Run(opts); err != nil {
+		t.Fatalf("Run: %v\n%s", err, out.String())
+	}
+	// As if the merge had kept an include directive
+	data, err := os.ReadFile("AGENTS.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("AGENTS.md", append(data, "\n<!-- cirby:include docs/testing.md -->\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scope := packageScope{Dir: ".", Output: "AGENTS.md"}
+	if err := stampIntegrity(scope, lockStamp{}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(opts); err != nil {
+		t.Fatalf("Check after stamping: %v\n%s", err, out.String())
+	}
+
+	if err := os.WriteFile("docs/testing.md", []byte("Run go test -race.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := Check(opts); err == nil {
+		t.Fatalf("Check passed after an included file changed:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "docs/testing.md (modified)") {
+		t.Errorf("Check does not name the included file:\n%s", out.String())
+	}
+
+	// Running cirby again records the change
+	out.Reset()
+	if err := Run(opts); err != nil {
+		t.Fatalf("Run: %v\n%s", err, out.String())
+	}
+	if err := Check(opts); err != nil {
+		t.Errorf("Check after rerunning cirby: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,75 @@
+package cirby
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONC(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want any
+	}{
+		{
+			name: "plain JSON",
+			in:   `{"a": [1, "two"], "b": null}`,
+			want: map[string]any{"a": []any{1.0, "two"}, "b": nil},
+		},
+		{
+			name: "line and block comments",
+			in:   "{\n  // servers\n  \"a\": 1, /* inline */ \"b\": 2\n  /* multi\n     line */\n}",
+			want: map[string]any{"a": 1.0, "b": 2.0},
+		},
+		{
+			name: "trailing commas",
+			in:   "{\"list\": [1, 2,\n], \"obj\": {\"x\": true,},\n}",
+			want: map[string]any{"list": []any{1.0, 2.0}, "obj": map[string]any{"x": true}},
+		},
+		{
+			name: "comment markers and commas inside strings",
+			in:   `{"url": "https://example.com/*x*/", "s": "a,}", "q": "say \"//\",]"}`,
+			want: map[string]any{"url": "https://example.com/*x*/", "s": "a,}", "q": `say "//",]`},
+		},
+		{
+			name: "trailing comma before a comment",
+			in:   "[1, 2, // last\n]",
+			want: []any{1.0, 2.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got any
+			if err := parseJSONC([]byte(tt.in), &got); err != nil {
+				t.Fatalf("parseJSONC: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONC =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJSONCErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"a": 1`,
+		`{"a": /* unterminated`,
+		`{"a": 'single'}`,
+	} {
+		var v any
+		if err := parseJSONC([]byte(in), &v); err == nil {
+			t.Errorf("parseJSONC(%q) = %#v, want an error", in, v)
+		}
+	}
+}
+
+func TestMarshalJSONFile(t *testing.T) {
+	got, err := marshalJSONFile(map[string]any{"cmd": "a && b <c>", "n": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"cmd\": \"a && b <c>\",\n  \"n\": 1\n}\n"
+	if string(got) != want {
+		t.Errorf("marshalJSONFile =\n%s\nwant\n%s", got, want)
+	}
+}
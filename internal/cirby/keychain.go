@@ -0,0 +1,252 @@
+package cirby
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// keychainService is the service name API keys are filed under
+const keychainService = "cirby"
+
+// errNoKey means the keychain has no key for the backend
+var errNoKey = errors.New("no key stored")
+
+// Auth manages API keys in the OS keychain: `cirby auth login <backend>`,
+// `cirby auth logout <backend>` and `cirby auth status`
+func Auth(action string, args []string, opts Options) error {
+	switch action {
+	case "login", "logout":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: cirby auth %s <backend> (%s)", action, strings.Join(apiBackendNames(), ", "))
+		}
+		agent, err := findAPIBackend(args[0])
+		if err != nil {
+			return err
+		}
+		if action == "logout" {
+			if err := keychainDelete(agent.Name); err != nil {
+				return fmt.Errorf("removing the %s key: %w", agent.Name, err)
+			}
+			fmt.Fprintf(opts.stdout(), "[ok] Removed the %s API key from the %s\n", agent.Name, keychainName())
+			return nil
+		}
+		key, err := readSecret(fmt.Sprintf("%s API key (%s): ", agent.Name, agent.API.KeyEnv), opts)
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return fmt.Errorf("no key entered")
+		}
+		if err := keychainSet(agent.Name, key); err != nil {
+			return fmt.Errorf("storing the %s key: %w", agent.Name, err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Stored the %s API key in the %s\n", agent.Name, keychainName())
+		if os.Getenv(agent.API.KeyEnv) != "" {
+			fmt.Fprintf(opts.stdout(), "[warn] %s is set and takes precedence over the stored key\n", agent.API.KeyEnv)
+		}
+		return nil
+	case "status", "":
+		for _, a := range supportedAgents {
+			if a.API == nil || a.API.KeyEnv == "" {
+				continue
+			}
+			_, source := apiKey(a)
+			if source == "" {
+				source = "not set"
+			}
+			fmt.Fprintf(opts.stdout(), "%-10s %s\n", a.Name, source)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown auth action: %s (login, logout, status)", action)
+}
+
+// apiKey returns the agent's API key and where it came from: the
+// environment variable, which wins, or the OS keychain
+func apiKey(agent SupportedAgent) (key, source string) {
+	if agent.API.KeyEnv == "" {
+		return "", ""
+	}
+	if key := os.Getenv(agent.API.KeyEnv); key != "" {
+		return key, agent.API.KeyEnv
+	}
+	if key, err := keychainGet(agent.Name); err == nil && key != "" {
+		return key, keychainName()
+	}
+	return "", ""
+}
+
+func findAPIBackend(name string) (SupportedAgent, error) {
+	for _, a := range supportedAgents {
+		if a.Name == name && a.API != nil && a.API.KeyEnv != "" {
+			return a, nil
+		}
+	}
+	return SupportedAgent{}, fmt.Errorf("unknown API backend: %s (supported: %s)", name, strings.Join(apiBackendNames(), ", "))
+}
+
+func apiBackendNames() []string {
+	var names []string
+	for _, a := range supportedAgents {
+		if a.API != nil && a.API.KeyEnv != "" {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// readSecret reads a line from stdin without echoing it on a terminal
+func readSecret(prompt string, opts Options) (string, error) {
+	stdin := opts.stdin()
+	hide := runtime.GOOS != "windows" && stdin == os.Stdin && isTerminal(os.Stdin)
+	fmt.Fprint(opts.stdout(), prompt)
+	if hide {
+		stty := exec.Command("stty", "-echo")
+		stty.Stdin = os.Stdin
+		if stty.Run() == nil {
+			defer func() {
+				restore := exec.Command("stty", "echo")
+				restore.Stdin = os.Stdin
+				restore.Run()
+				fmt.Fprintln(opts.stdout())
+			}()
+		}
+	}
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if !hide && !isTerminal(os.Stdin) {
+		fmt.Fprintln(opts.stdout()) // piped input is not echoed
+	}
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading the key: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// keychainName names the store used on this OS, for messages
+func keychainName() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macOS Keychain"
+	case "windows":
+		return "Windows DPAPI store"
+	}
+	return "Secret Service keyring"
+}
+
+// keychainGet looks up the key stored for account. macOS uses the login
+// Keychain, Linux the Secret Service (through secret-tool), and Windows a
+// DPAPI-encrypted file only the current user can decrypt.
+func keychainGet(account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	case "windows":
+		path, err := dpapiKeyFile(account)
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return "", errNoKey
+		}
+		cmd = powershell(`$s = Get-Content -LiteralPath $env:CIRBY_KEY_FILE | ConvertTo-SecureString; `+
+			`[Runtime.InteropServices.Marshal]::PtrToStringBSTR([Runtime.InteropServices.Marshal]::SecureStringToBSTR($s))`, path)
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", keychainService, "account", account)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errNoKey
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// keychainSet stores key for account, replacing any previous one. The key
+// always goes to the tool on stdin, never in its arguments, where other
+// users could read it with ps.
+func keychainSet(account, key string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// with -i security reads the command from stdin, keeping the key out of argv
+		if strings.ContainsAny(key, "\"\\\n\r") {
+			return fmt.Errorf("the key contains quotes, backslashes or line breaks, which the Keychain cannot take on stdin; set it in the environment instead")
+		}
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -l \"cirby %s API key\" -w \"%s\"\n",
+			keychainService, account, account, key))
+	case "windows":
+		path, err := dpapiKeyFile(account)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		cmd = powershell(`[Console]::In.ReadLine() | ConvertTo-SecureString -AsPlainText -Force | `+
+			`ConvertFrom-SecureString | Set-Content -LiteralPath $env:CIRBY_KEY_FILE`, path)
+		cmd.Stdin = strings.NewReader(key + "\n")
+	default:
+		cmd = exec.Command("secret-tool", "store", "--label=cirby "+account+" API key",
+			"service", keychainService, "account", account)
+		cmd.Stdin = strings.NewReader(key)
+	}
+	return runKeychainTool(cmd)
+}
+
+// keychainDelete removes the key stored for account
+func keychainDelete(account string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return runKeychainTool(exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", account))
+	case "windows":
+		path, err := dpapiKeyFile(account)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return runKeychainTool(exec.Command("secret-tool", "clear", "service", keychainService, "account", account))
+}
+
+func runKeychainTool(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("%s is not installed", cmd.Args[0])
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", cmd.Args[0], msg)
+		}
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return nil
+}
+
+// dpapiKeyFile is where the encrypted key for account lives on Windows
+func dpapiKeyFile(account string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cirby", "keys", account+".dpapi"), nil
+}
+
+// powershell runs script with the key file path in $env:CIRBY_KEY_FILE,
+// which avoids quoting it
+func powershell(script, keyFile string) *exec.Cmd {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Env = append(os.Environ(), "CIRBY_KEY_FILE="+keyFile)
+	return cmd
+}
@@ -0,0 +1,101 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sources are read without a byte order mark and with LF line endings, so
+// prompts, diffs and hashes never depend on the editor that saved them.
+// AGENTS.md is written back in the style it had before the merge, or the
+// one line_endings asks for, so a merge does not rewrite every line of it.
+
+const (
+	lineEndingsAuto = "auto" // keep the style of the existing AGENTS.md; LF for a new one
+	lineEndingsLF   = "lf"
+	lineEndingsCRLF = "crlf"
+)
+
+const utf8BOM = "\ufeff"
+
+func validateLineEndings(mode string) error {
+	switch mode {
+	case "", lineEndingsAuto, lineEndingsLF, lineEndingsCRLF:
+		return nil
+	}
+	return fmt.Errorf("unknown line endings: %s (supported: %s, %s, %s)", mode, lineEndingsAuto, lineEndingsLF, lineEndingsCRLF)
+}
+
+// textStyle is how a text file ends its lines and whether it starts with a
+// byte order mark
+type textStyle struct {
+	crlf bool
+	bom  bool
+}
+
+// detectTextStyle finds the style of text; mixed line endings count as
+// CRLF when most lines use it
+func detectTextStyle(text string) textStyle {
+	crlf := strings.Count(text, "\r\n")
+	return textStyle{
+		crlf: crlf > 0 && crlf*2 >= strings.Count(text, "\n"),
+		bom:  strings.HasPrefix(text, utf8BOM),
+	}
+}
+
+func (s textStyle) String() string {
+	var parts []string
+	if s.crlf {
+		parts = append(parts, "CRLF")
+	} else {
+		parts = append(parts, "LF")
+	}
+	if s.bom {
+		parts = append(parts, "BOM")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// apply rewrites text in style s
+func (s textStyle) apply(text string) string {
+	text = normalizeText(text)
+	if s.crlf {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	if s.bom {
+		text = utf8BOM + text
+	}
+	return text
+}
+
+// normalizeText drops a byte order mark and turns CRLF into LF
+func normalizeText(text string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(text, utf8BOM), "\r\n", "\n")
+}
+
+// restoreLineEndings rewrites the merge result at agentsPath in the style
+// of previous, the AGENTS.md before the merge, or in the one line_endings
+// asks for. Agents and cirby's own passes write LF without a BOM.
+func restoreLineEndings(agentsPath, previous string, opts Options) error {
+	var style textStyle
+	switch opts.LineEndings {
+	case lineEndingsLF:
+	case lineEndingsCRLF:
+		style.crlf = true
+	default:
+		style = detectTextStyle(previous)
+	}
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	want := style.apply(string(data))
+	if want == string(data) {
+		return nil
+	}
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  [ok] %s written with %s\n", agentsPath, style)
+	}
+	return writeFile(agentsPath, []byte(want), 0644)
+}
@@ -0,0 +1,121 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Link modes for pointing tool-specific files at AGENTS.md
+const (
+	LinkSymlink = "symlink"
+	LinkCopy    = "copy"
+)
+
+// copyMarker identifies files generated by cirby in copy mode
+const copyMarker = "<!-- cirby:copy"
+
+func linkMode(opts Options) string {
+	if opts.LinkMode == "" {
+		return LinkSymlink
+	}
+	return opts.LinkMode
+}
+
+func validateLinkMode(mode string) error {
+	switch mode {
+	case "", LinkSymlink, LinkCopy:
+		return nil
+	}
+	return fmt.Errorf("unknown link mode: %s (supported: %s, %s)", mode, LinkSymlink, LinkCopy)
+}
+
+// linkConfig points path at agentsPath using the configured link mode
+func linkConfig(path, agentsPath string, opts Options) error {
+	if sameFile(path, agentsPath) {
+		return errSameFile(path, agentsPath)
+	}
+	if linkMode(opts) == LinkCopy {
+		return writeCopy(path, agentsPath)
+	}
+	return createSymlink(path, agentsPath, opts)
+}
+
+func printLinked(path, agentsPath string, opts Options) {
+	if linkMode(opts) == LinkCopy {
+		fmt.Fprintf(opts.stdout(), tr("[ok] Copied %s -> %s\n"), agentsPath, path)
+		return
+	}
+	fmt.Fprintf(opts.stdout(), tr("[ok] Symlinked %s -> %s\n"), path, agentsPath)
+}
+
+// prepareLinks validates AGENTS.md before files get pointed at it. In
+// symlink mode tools read include directives verbatim, so they only need
+// to resolve; copy mode expands them when the copies are written.
+func prepareLinks(agentsPath string) error {
+	if err := validateIncludes(agentsPath); err != nil {
+		return fmt.Errorf("validating includes in %s: %w", agentsPath, err)
+	}
+	return nil
+}
+
+// isCirbyCopy reports whether content was generated by cirby in copy mode
+func isCirbyCopy(content string) bool {
+	for i, line := range strings.SplitN(content, "\n", 6) {
+		if i == 5 {
+			break
+		}
+		if strings.HasPrefix(line, copyMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderCopy builds the content of a copy-mode file for path
+func renderCopy(path, agentsPath string) (string, error) {
+	expanded, err := expandIncludes(agentsPath)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if filepath.Ext(path) == ".mdc" {
+		// Cursor rule files need frontmatter to be applied automatically
+		fmt.Fprintf(&b, "---\ndescription: Project instructions generated from %s\nalwaysApply: true\n---\n", filepath.Base(agentsPath))
+	}
+	fmt.Fprintf(&b, "%s of %s - edit that file instead and rerun cirby -->\n\n", copyMarker, filepath.ToSlash(agentsPath))
+	b.WriteString(normalizeText(expanded))
+	return detectTextStyle(expanded).apply(b.String()), nil
+}
+
+// isStaleCopy reports whether an existing copy no longer matches AGENTS.md,
+// or has to become a symlink because the link mode changed
+func isStaleCopy(cfg AgentConfig, agentsPath string, opts Options) bool {
+	if linkMode(opts) != LinkCopy {
+		return true
+	}
+	want, err := renderCopy(cfg.Path, agentsPath)
+	if err != nil {
+		return true
+	}
+	return normalizeText(want) != cfg.Content
+}
+
+func writeCopy(path, agentsPath string) error {
+	content, err := renderCopy(path, agentsPath)
+	if err != nil {
+		return fmt.Errorf("expanding %s: %w", agentsPath, err)
+	}
+
+	mode := copyMode(path, agentsPath)
+	// Replace symlinks rather than writing through them
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := removeFile(path); err != nil {
+			return fmt.Errorf("removing existing symlink: %w", err)
+		}
+	}
+
+	return writeFile(path, []byte(content), mode)
+}
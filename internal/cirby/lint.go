@@ -0,0 +1,233 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// lintRule is one rule of the lint: section of .cirby.yaml, checked by
+// cirby validate and after every merge:
+//
+//	lint:
+//	  - rule: required_section
+//	    section: Testing
+//	  - rule: banned_phrase
+//	    phrase: ask the user        # or pattern: a regular expression
+//	    severity: warning           # error (default), warning or off
+//	  - rule: max_heading_depth
+//	    depth: 3
+//	  - rule: required_command
+//	    command: make test
+//	    message: CI runs make test; agents should too
+type lintRule struct {
+	Rule     string
+	Value    string         // the section, phrase or command
+	Pattern  *regexp.Regexp // banned_phrase
+	Depth    int            // max_heading_depth
+	Severity string         // "error" or "warning"
+	Message  string         // why the rule exists, added to its findings
+}
+
+// lintKinds maps each rule to the key holding its value
+var lintKinds = map[string]string{
+	"required_section":  "section",
+	"banned_phrase":     "phrase",
+	"max_heading_depth": "depth",
+	"required_command":  "command",
+}
+
+// lintFinding is a place where an AGENTS.md breaks a lint rule
+type lintFinding struct {
+	Rule     string
+	Severity string
+	Line     int // 0 when the rule is about the whole file
+	Message  string
+}
+
+// parseLintRules reads the lint: section of .cirby.yaml. Rules that are
+// off are dropped.
+func parseLintRules(v any, path string) ([]lintRule, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: lint must be a list of rules", path)
+	}
+	var rules []lintRule
+	for i, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: lint rule %d must be a mapping", path, i+1)
+		}
+		r := lintRule{Rule: yamlString(m["rule"]), Severity: yamlString(m["severity"]), Message: yamlString(m["message"])}
+		key, ok := lintKinds[r.Rule]
+		if !ok {
+			return nil, fmt.Errorf("%s: lint rule %d: unknown rule %q (banned_phrase, max_heading_depth, required_command, required_section)", path, i+1, r.Rule)
+		}
+		switch r.Severity {
+		case "":
+			r.Severity = "error"
+		case "error", "warning":
+		case "off":
+			continue
+		default:
+			return nil, fmt.Errorf("%s: lint rule %d: severity must be error, warning or off", path, i+1)
+		}
+		r.Value = yamlString(m[key])
+		switch {
+		case r.Rule == "banned_phrase" && yamlString(m["pattern"]) != "":
+			re, err := regexp.Compile(yamlString(m["pattern"]))
+			if err != nil {
+				return nil, fmt.Errorf("%s: lint rule %d: %w", path, i+1, err)
+			}
+			r.Pattern = re
+		case r.Rule == "banned_phrase" && r.Value != "":
+			r.Pattern = regexp.MustCompile(`(?i)` + regexp.QuoteMeta(r.Value))
+		case r.Rule == "max_heading_depth":
+			n, err := strconv.Atoi(r.Value)
+			if err != nil || n < 1 || n > 6 {
+				return nil, fmt.Errorf("%s: lint rule %d: depth must be a number between 1 and 6", path, i+1)
+			}
+			r.Depth = n
+		case r.Value == "":
+			return nil, fmt.Errorf("%s: lint rule %d: %s needs %s", path, i+1, r.Rule, key)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// lint checks content against rules. Headings and phrases inside code
+// blocks do not count; commands do, since that is where they usually are.
+func lint(content string, rules []lintRule) []lintFinding {
+	var headings []string
+	type heading struct{ line, level int }
+	var levels []heading
+	lines := splitLines(content)
+	inFence := make([]bool, len(lines))
+	fenced := false
+	for i, line := range lines {
+		t := strings.TrimSpace(line)
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fenced = !fenced
+			inFence[i] = true
+			continue
+		}
+		inFence[i] = fenced
+		if level := len(t) - len(strings.TrimLeft(t, "#")); !fenced && level > 0 && strings.HasPrefix(t[level:], " ") {
+			headings = append(headings, t)
+			levels = append(levels, heading{i + 1, level})
+		}
+	}
+
+	var findings []lintFinding
+	add := func(r lintRule, line int, message string) {
+		if r.Message != "" {
+			message += ": " + r.Message
+		}
+		findings = append(findings, lintFinding{r.Rule, r.Severity, line, message})
+	}
+	for _, r := range rules {
+		switch r.Rule {
+		case "required_section":
+			if !matchesTitle(r.Value, headings) {
+				add(r, 0, fmt.Sprintf("missing required section %q", r.Value))
+			}
+		case "banned_phrase":
+			for i, line := range lines {
+				if m := r.Pattern.FindString(line); m != "" && !inFence[i] {
+					add(r, i+1, fmt.Sprintf("banned phrase %q", m))
+				}
+			}
+		case "max_heading_depth":
+			for _, h := range levels {
+				if h.level > r.Depth {
+					add(r, h.line, fmt.Sprintf("heading level %d is deeper than %d", h.level, r.Depth))
+				}
+			}
+		case "required_command":
+			if !strings.Contains(content, r.Value) {
+				add(r, 0, fmt.Sprintf("never mentions the command %q", r.Value))
+			}
+		}
+	}
+	return findings
+}
+
+func (f lintFinding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("line %d: %s", f.Line, f.Message)
+	}
+	return f.Message
+}
+
+// Validate checks canonical files against the structure: requirements,
+// lint: rules and validate plugins of .cirby.yaml without merging
+// anything: files, or the AGENTS.md of each --path. It fails when any rule
+// with severity error is broken.
+func Validate(files []string, opts Options) error {
+	if opts.Report != "" {
+		if _, _, err := parseReport(opts.Report, reportFiles); err != nil {
+			return err
+		}
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	validators := slices.ContainsFunc(cfg.Wasm, func(p wasmPlugin) bool { return p.Role == "validate" })
+	if len(cfg.Lint) == 0 && !cfg.Structure.configured() && !validators {
+		return fmt.Errorf("nothing to validate; add lint: rules, structure: requirements or a validate plugin to .cirby.yaml")
+	}
+	if len(files) == 0 {
+		scopes, err := runScopes(opts)
+		if err != nil {
+			return err
+		}
+		for _, s := range scopes {
+			files = append(files, s.agentsPath())
+		}
+	}
+
+	var results []checkResult
+	failures := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s: missing\n", file)
+			results = append(results, checkResult{Path: file, Rule: "missing", Severity: "error", Message: "missing"})
+			failures++
+			continue
+		}
+		findings := append(lint(string(data), cfg.Lint), wasmFindings(file, string(data), cfg.Wasm)...)
+		for _, v := range structureViolations(string(data), cfg.Structure) {
+			findings = append(findings, lintFinding{Rule: "structure", Severity: "error", Message: v})
+		}
+		broken := 0
+		for _, f := range findings {
+			if f.Severity == "error" {
+				fmt.Fprintf(opts.stdout(), "[error] %s: %s\n", file, f)
+				broken++
+			} else {
+				fmt.Fprintf(opts.stdout(), "[warn] %s: %s\n", file, f)
+			}
+			results = append(results, checkResult{Path: file, Rule: f.Rule, Severity: f.Severity, Message: f.String(), Line: f.Line})
+		}
+		if broken > 0 {
+			failures++
+		} else if len(findings) == 0 {
+			fmt.Fprintf(opts.stdout(), "[ok] %s follows the rules of %s\n", file, cfg.Path)
+			results = append(results, checkResult{Path: file, Message: "valid"})
+		}
+	}
+
+	if err := reportResults("cirby validate", results, opts); err != nil {
+		return err
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d of %d files failed validation", failures, len(files))
+	}
+	return nil
+}
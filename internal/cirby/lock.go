@@ -0,0 +1,62 @@
+package cirby
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockFile records what cirby last synced, so later runs can tell what
+// changed. It is meant to be committed.
+const lockFile = ".cirby.lock"
+
+type cirbyLock struct {
+	Agents map[string]*agentsLock `json:"agents,omitempty"` // by canonical file path
+	Remote *remoteLock            `json:"remote,omitempty"`
+}
+
+// remoteLock is the state of the last `cirby sync-remote`
+type remoteLock struct {
+	URL       string            `json:"url"`
+	Ref       string            `json:"ref,omitempty"`
+	Revision  string            `json:"revision"`
+	SyncedAt  time.Time         `json:"synced_at"`
+	Fragments map[string]string `json:"fragments"` // path -> sha256
+}
+
+func loadLock() (cirbyLock, error) {
+	return readLock(lockFile)
+}
+
+// readLock reads the lock at path, which is empty when there is none
+func readLock(path string) (cirbyLock, error) {
+	var lock cirbyLock
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return lock, nil
+	}
+	if err != nil {
+		return lock, err
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return lock, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return lock, nil
+}
+
+// saveLock writes lock, or removes the lock file once it records nothing,
+// as after undoing the only merge
+func saveLock(lock cirbyLock) error {
+	if len(lock.Agents) == 0 && lock.Remote == nil {
+		if err := removeFile(lockFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := marshalJSONFile(lock)
+	if err != nil {
+		return err
+	}
+	return writeFile(lockFile, data, 0644)
+}
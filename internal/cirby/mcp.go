@@ -0,0 +1,185 @@
+package cirby
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision we implement
+const mcpProtocolVersion = "2025-06-18"
+
+// mcpTool describes a tool in the tools/list response
+type mcpTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// mcpArgs are the arguments shared by all cirby tools
+type mcpArgs struct {
+	Agent     string `json:"agent"`
+	DryRun    bool   `json:"dry_run"`
+	Force     bool   `json:"force"`
+	Recursive bool   `json:"recursive"`
+	LinkMode  string `json:"link_mode"`
+	Output    string `json:"output"`
+}
+
+func (a mcpArgs) options() Options {
+	return Options{
+		Agent:     a.Agent,
+		DryRun:    a.DryRun,
+		Force:     a.Force,
+		Recursive: a.Recursive,
+		LinkMode:  a.LinkMode,
+		Output:    a.Output,
+		// Never let a tool call read from the protocol stream
+		Stdin: strings.NewReader(""),
+	}
+}
+
+var recursiveProperty = map[string]any{
+	"type":        "boolean",
+	"description": "Also cover per-package config files in subdirectories",
+}
+
+var mcpTools = []mcpTool{
+	{
+		Name:        "scan_configs",
+		Description: "List AI agent config files (CLAUDE.md, .cursorrules, ...) in the working directory and how each relates to AGENTS.md.",
+		InputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"recursive": recursiveProperty},
+		},
+	},
+	{
+		Name:        "check_sync",
+		Description: "Check whether every agent config file is already merged into and linked to AGENTS.md.",
+		InputSchema: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"recursive": recursiveProperty},
+		},
+	},
+	{
+		Name:        "merge_to_agents_md",
+		Description: "Merge agent config files into AGENTS.md using an installed coding agent CLI and link the originals to it.",
+		InputSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"agent":     map[string]any{"type": "string", "description": "Merge agent: claude, opencode, gemini, cursor, codex or aider. Defaults to the first installed one."},
+				"dry_run":   map[string]any{"type": "boolean", "description": "Only describe what would be done"},
+				"force":     map[string]any{"type": "boolean", "description": "Skip the git uncommitted changes check"},
+				"recursive": recursiveProperty,
+				"link_mode": map[string]any{"type": "string", "enum": []string{LinkSymlink, LinkCopy}},
+				"output":    map[string]any{"type": "string", "description": "Canonical file to merge into, defaults to AGENTS.md"},
+			},
+		},
+	},
+}
+
+// ServeMCP runs cirby as a Model Context Protocol server over stdio
+func ServeMCP() error {
+	return serveRPC(os.Stdin, os.Stdout, handleMCP)
+}
+
+func handleMCP(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(params, &p)
+		version := p.ProtocolVersion
+		if version == "" {
+			version = mcpProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "cirby", "version": Version},
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		var args mcpArgs
+		if len(p.Arguments) > 0 {
+			if err := json.Unmarshal(p.Arguments, &args); err != nil {
+				return nil, &rpcError{rpcInvalidParams, err.Error()}
+			}
+		}
+		text, err := callMCPTool(p.Name, args)
+		if err != nil {
+			if _, ok := err.(*rpcError); ok {
+				return nil, err
+			}
+			return mcpResult(text+err.Error(), true), nil
+		}
+		return mcpResult(text, false), nil
+	}
+
+	if strings.HasPrefix(method, "notifications/") {
+		return nil, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, "method not found: " + method}
+}
+
+func mcpResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+func callMCPTool(name string, args mcpArgs) (string, error) {
+	opts := args.options()
+
+	switch name {
+	case "scan_configs":
+		statuses, err := inspectConfigs(opts)
+		if err != nil {
+			return "", err
+		}
+		if len(statuses) == 0 {
+			return "No agent configuration files found.", nil
+		}
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		return string(data), err
+	case "check_sync":
+		statuses, err := inspectConfigs(opts)
+		if err != nil {
+			return "", err
+		}
+		var pending []string
+		for _, st := range statuses {
+			if !st.inSync() {
+				pending = append(pending, fmt.Sprintf("%s (%s)", st.Path, st.Status))
+			}
+		}
+		if len(pending) == 0 {
+			return "In sync: every agent config file points at AGENTS.md.", nil
+		}
+		return "Out of sync, run merge_to_agents_md to fix:\n- " + strings.Join(pending, "\n- "), nil
+	case "merge_to_agents_md":
+		if err := validateLinkMode(args.LinkMode); err != nil {
+			return "", &rpcError{rpcInvalidParams, err.Error()}
+		}
+		var out bytes.Buffer
+		opts.Stdout = &out
+		err := Run(opts)
+		return out.String(), err
+	}
+
+	return "", &rpcError{rpcInvalidParams, "unknown tool: " + name}
+}
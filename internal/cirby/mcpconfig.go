@@ -0,0 +1,337 @@
+package cirby
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// canonicalMCPConfig holds the unified MCP server list. It uses the
+// `mcpServers` format shared by Claude Code and Cursor.
+const canonicalMCPConfig = ".mcp.json"
+
+// mcpConfigFile is a tool-specific file that lists MCP servers
+type mcpConfigFile struct {
+	Tool    string
+	Path    string
+	Key     string // JSON key holding the server map
+	ToolDir string // the tool counts as used when this directory exists
+	// Symlink is set when the file has the canonical format and can simply
+	// point at canonicalMCPConfig
+	Symlink bool
+	// toCanonical and fromCanonical convert one server entry; nil means
+	// the entry is already in canonical form
+	toCanonical   func(server map[string]any) map[string]any
+	fromCanonical func(server, existing map[string]any) map[string]any
+}
+
+var mcpConfigFiles = []mcpConfigFile{
+	{Tool: "Cursor", Path: ".cursor/mcp.json", Key: "mcpServers", ToolDir: ".cursor", Symlink: true},
+	{Tool: "Gemini CLI", Path: ".gemini/settings.json", Key: "mcpServers", ToolDir: ".gemini",
+		toCanonical: geminiServerToCanonical, fromCanonical: canonicalServerToGemini},
+	{Tool: "VS Code", Path: ".vscode/mcp.json", Key: "servers", ToolDir: ".vscode",
+		toCanonical: vscodeServerToCanonical, fromCanonical: canonicalServerToVSCode},
+}
+
+// Server fields every tool understands; anything else is tool-specific
+var portableMCPFields = []string{"command", "args", "env", "cwd", "type", "url", "headers"}
+
+// SyncMCP merges the MCP server definitions of all tools into
+// canonicalMCPConfig and regenerates each tool's file from it
+func SyncMCP(opts Options) error {
+	canonicalDoc, err := readJSONObject(canonicalMCPConfig)
+	if err != nil {
+		return err
+	}
+	servers := jsonObject(canonicalDoc["mcpServers"])
+	origin := map[string]string{}
+	for name := range servers {
+		origin[name] = canonicalMCPConfig
+	}
+
+	// Collect servers from every tool file that is not already a link
+	docs := map[string]map[string]any{}
+	found := canonicalDoc != nil
+	for _, f := range mcpConfigFiles {
+		if isSymlinkToAgentsMD(f.Path, canonicalMCPConfig) {
+			found = true
+			continue
+		}
+		doc, err := readJSONObject(f.Path)
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			continue
+		}
+		found = true
+		docs[f.Path] = doc
+
+		toolServers := jsonObject(doc[f.Key])
+		for _, name := range sortedKeys(toolServers) {
+			server := jsonObject(toolServers[name])
+			if f.toCanonical != nil {
+				server = f.toCanonical(server)
+			}
+			server = normalizeMCPServer(server)
+			existing, ok := servers[name]
+			if !ok {
+				servers[name] = server
+				origin[name] = f.Path
+				continue
+			}
+			if !reflect.DeepEqual(normalizeMCPServer(jsonObject(existing)), server) {
+				fmt.Fprintf(opts.stdout(), "[warn] MCP server %q differs between %s and %s; keeping %s\n",
+					name, origin[name], f.Path, origin[name])
+			}
+		}
+	}
+
+	if !found {
+		fmt.Fprintln(opts.stdout(), "No MCP server configurations found.")
+		return nil
+	}
+
+	if !opts.Force {
+		referenced := map[string]bool{canonicalMCPConfig: true}
+		for _, f := range mcpConfigFiles {
+			referenced[f.Path] = true
+		}
+		if err := checkGitStatus(referenced, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.Verbose {
+		for _, name := range sortedKeys(servers) {
+			fmt.Fprintf(opts.stdout(), "  [ok] %s (from %s)\n", name, origin[name])
+		}
+	}
+
+	// Plan the canonical file first, then every tool variant
+	if canonicalDoc == nil {
+		canonicalDoc = map[string]any{}
+	}
+	canonicalDoc["mcpServers"] = servers
+	var writes []plannedWrite
+	if w, err := planJSONWrite(canonicalMCPConfig, canonicalDoc); err != nil {
+		return err
+	} else if w != nil {
+		writes = append(writes, *w)
+	}
+
+	var links []string
+	for _, f := range mcpConfigFiles {
+		_, statErr := os.Lstat(f.Path)
+		if statErr != nil && !dirExists(f.ToolDir) {
+			continue // tool not used in this project
+		}
+
+		if f.Symlink && linkMode(opts) == LinkSymlink {
+			if !isSymlinkToAgentsMD(f.Path, canonicalMCPConfig) {
+				links = append(links, f.Path)
+			}
+			continue
+		}
+
+		doc := docs[f.Path]
+		if doc == nil {
+			doc = map[string]any{}
+		}
+		existing := jsonObject(doc[f.Key])
+		converted := map[string]any{}
+		for name, server := range servers {
+			if f.fromCanonical != nil {
+				converted[name] = f.fromCanonical(jsonObject(server), jsonObject(existing[name]))
+			} else {
+				converted[name] = server
+			}
+		}
+		doc[f.Key] = converted
+
+		w, err := planJSONWrite(f.Path, doc)
+		if err != nil {
+			return err
+		}
+		if w != nil {
+			writes = append(writes, *w)
+		} else if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [skip] %s (up to date)\n", f.Path)
+		}
+	}
+
+	if len(writes) == 0 && len(links) == 0 {
+		fmt.Fprintf(opts.stdout(), "[ok] MCP servers already in sync (%d servers).\n", len(servers))
+		return nil
+	}
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		for _, w := range writes {
+			fmt.Fprintf(opts.stdout(), "  - Write %s\n", w.Path)
+		}
+		for _, path := range links {
+			fmt.Fprintf(opts.stdout(), "  - Create symlink: %s -> %s\n", path, canonicalMCPConfig)
+		}
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	for _, w := range writes {
+		if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(w.Path, w.Content, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", w.Path, err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Wrote %s\n", w.Path)
+	}
+	for _, path := range links {
+		if err := createSymlink(path, canonicalMCPConfig, opts); err != nil {
+			return fmt.Errorf("linking %s: %w", path, err)
+		}
+		fmt.Fprintf(opts.stdout(), tr("[ok] Symlinked %s -> %s\n"), path, canonicalMCPConfig)
+	}
+
+	fmt.Fprintf(opts.stdout(), "\nDone! %d MCP servers in sync.\n", len(servers))
+	return nil
+}
+
+// plannedWrite is a file whose content has to change
+type plannedWrite struct {
+	Path    string
+	Content []byte
+}
+
+// planJSONWrite returns the write needed to make path hold doc, or nil
+// when it already does
+func planJSONWrite(path string, doc map[string]any) (*plannedWrite, error) {
+	content, err := marshalJSONFile(doc)
+	if err != nil {
+		return nil, err
+	}
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, content) {
+		return nil, nil
+	}
+	return &plannedWrite{Path: path, Content: content}, nil
+}
+
+// readJSONObject reads a JSON (or JSONC) object, returning nil if the file
+// does not exist
+func readJSONObject(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := parseJSONC(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	return doc, nil
+}
+
+func jsonObject(v any) map[string]any {
+	if m, ok := v.(map[string]any); ok {
+		return m
+	}
+	return map[string]any{}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// normalizeMCPServer keeps the portable fields of a canonical entry and
+// drops the implicit stdio type, so equal servers compare equal
+func normalizeMCPServer(server map[string]any) map[string]any {
+	out := map[string]any{}
+	for _, field := range portableMCPFields {
+		if v, ok := server[field]; ok {
+			out[field] = v
+		}
+	}
+	if out["type"] == "stdio" {
+		delete(out, "type")
+	}
+	return out
+}
+
+// Gemini uses httpUrl for streamable HTTP servers and url for SSE
+func geminiServerToCanonical(server map[string]any) map[string]any {
+	out := copyJSONObject(server)
+	if u, ok := out["httpUrl"]; ok {
+		out["type"] = "http"
+		out["url"] = u
+		delete(out, "httpUrl")
+	} else if _, ok := out["url"]; ok {
+		out["type"] = "sse"
+	}
+	return out
+}
+
+func canonicalServerToGemini(server, existing map[string]any) map[string]any {
+	out := toolSpecificFields(existing, "httpUrl")
+	for k, v := range normalizeMCPServer(server) {
+		out[k] = v
+	}
+	switch out["type"] {
+	case "http":
+		out["httpUrl"] = out["url"]
+		delete(out, "url")
+	}
+	delete(out, "type")
+	return out
+}
+
+// VS Code requires an explicit type on every server
+func vscodeServerToCanonical(server map[string]any) map[string]any {
+	return copyJSONObject(server)
+}
+
+func canonicalServerToVSCode(server, existing map[string]any) map[string]any {
+	out := toolSpecificFields(existing)
+	for k, v := range normalizeMCPServer(server) {
+		out[k] = v
+	}
+	if _, ok := out["type"]; !ok {
+		out["type"] = "stdio"
+	}
+	return out
+}
+
+// toolSpecificFields returns the non-portable fields of an existing tool
+// entry (such as Gemini's trust or timeout) so regenerating keeps them
+func toolSpecificFields(existing map[string]any, alsoDrop ...string) map[string]any {
+	out := copyJSONObject(existing)
+	for _, field := range append(portableMCPFields, alsoDrop...) {
+		delete(out, field)
+	}
+	return out
+}
+
+func copyJSONObject(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
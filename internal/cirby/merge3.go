@@ -0,0 +1,116 @@
+package cirby
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict markers, in the style of git merge
+const (
+	conflictStart  = "<<<<<<< "
+	conflictBase   = "||||||| "
+	conflictMiddle = "======="
+	conflictEnd    = ">>>>>>> "
+)
+
+// mergeLabels name the three sides in conflict markers
+type mergeLabels struct {
+	Local, Base, Remote string
+}
+
+// merge3 merges the changes base->local and base->remote line by line.
+// Regions changed only on one side take that side; regions changed
+// differently on both sides become conflicts, marked with the labels.
+// It returns the merged lines and the number of conflicts.
+func merge3(base, local, remote []string, labels mergeLabels) ([]string, int) {
+	localMatch := matchIndex(base, local)
+	remoteMatch := matchIndex(base, remote)
+
+	var out []string
+	conflicts := 0
+	i, j, k := 0, 0, 0
+	for {
+		// The next base line both sides kept ends the current region
+		s := i
+		for s < len(base) && (localMatch[s] < 0 || remoteMatch[s] < 0) {
+			s++
+		}
+		je, ke := len(local), len(remote)
+		if s < len(base) {
+			je, ke = localMatch[s], remoteMatch[s]
+		}
+
+		b, l, r := base[i:s], local[j:je], remote[k:ke]
+		switch {
+		case slices.Equal(l, b):
+			out = append(out, r...)
+		case slices.Equal(r, b), slices.Equal(l, r):
+			out = append(out, l...)
+		default:
+			conflicts++
+			out = append(out, conflictStart+labels.Local)
+			out = append(out, l...)
+			out = append(out, conflictBase+labels.Base)
+			out = append(out, b...)
+			out = append(out, conflictMiddle)
+			out = append(out, r...)
+			out = append(out, conflictEnd+labels.Remote)
+		}
+
+		if s >= len(base) {
+			return out, conflicts
+		}
+		out = append(out, base[s])
+		i, j, k = s+1, je+1, ke+1
+	}
+}
+
+// mergeUnion combines two versions without a common ancestor: the local
+// lines stay as they are, followed by every remote paragraph (block of
+// lines between blank lines) that the local version does not contain
+func mergeUnion(local, remote []string) []string {
+	out := append([]string(nil), local...)
+	text := "\n" + strings.Join(local, "\n") + "\n"
+	var block []string
+	flush := func() {
+		if len(block) > 0 && !strings.Contains(text, "\n"+strings.Join(block, "\n")+"\n") {
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+			out = append(out, block...)
+		}
+		block = nil
+	}
+	for _, line := range remote {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		block = append(block, line)
+	}
+	flush()
+	return out
+}
+
+// matchIndex maps every line of base to its matching line in other, or -1
+func matchIndex(base, other []string) []int {
+	index := make([]int, len(base))
+	for i := range index {
+		index[i] = -1
+	}
+	for _, m := range lcsMatches(base, other) {
+		index[m[0]] = m[1]
+	}
+	return index
+}
+
+// hasConflictMarkers reports whether text still contains unresolved
+// conflict markers
+func hasConflictMarkers(text string) bool {
+	for _, line := range splitLines(text) {
+		if strings.HasPrefix(line, conflictStart) || strings.HasPrefix(line, conflictEnd) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package cirby
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	labels := mergeLabels{Local: "AGENTS.md", Base: "last cirby merge", Remote: "CLAUDE.md"}
+	tests := []struct {
+		name                string
+		base, local, remote string
+		want                string
+		conflicts           int
+	}{
+		{
+			name: "unchanged",
+			base: "a\nb\n", local: "a\nb\n", remote: "a\nb\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "only local changed",
+			base: "a\nb\nc\n", local: "a\nB\nc\n", remote: "a\nb\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "only remote changed",
+			base: "a\nb\nc\n", local: "a\nb\nc\n", remote: "a\nb\nc\nd\n",
+			want: "a\nb\nc\nd\n",
+		},
+		{
+			name: "both changed different lines",
+			base: "a\nb\nc\nd\ne\n", local: "A\nb\nc\nd\ne\n", remote: "a\nb\nc\nd\nE\n",
+			want: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name: "both made the same change",
+			base: "a\nb\nc\n", local: "a\nx\nc\n", remote: "a\nx\nc\n",
+			want: "a\nx\nc\n",
+		},
+		{
+			name: "local deleted, remote kept",
+			base: "a\nb\nc\n", local: "a\nc\n", remote: "a\nb\nc\n",
+			want: "a\nc\n",
+		},
+		{
+			name: "conflicting edits",
+			base: "a\nb\nc\n", local: "a\nlocal\nc\n", remote: "a\nremote\nc\n",
+			want:      "a\n<<<<<<< AGENTS.md\nlocal\n||||||| last cirby merge\nb\n=======\nremote\n>>>>>>> CLAUDE.md\nc\n",
+			conflicts: 1,
+		},
+		{
+			name: "two conflicts",
+			base: "a\nb\nc\nd\ne\n", local: "1\nb\nc\nd\n5\n", remote: "one\nb\nc\nd\nfive\n",
+			want: "<<<<<<< AGENTS.md\n1\n||||||| last cirby merge\na\n=======\none\n>>>>>>> CLAUDE.md\nb\nc\nd\n" +
+				"<<<<<<< AGENTS.md\n5\n||||||| last cirby merge\ne\n=======\nfive\n>>>>>>> CLAUDE.md\n",
+			conflicts: 2,
+		},
+		{
+			name: "both appended",
+			base: "a\n", local: "a\nlocal\n", remote: "a\nremote\n",
+			want:      "a\n<<<<<<< AGENTS.md\nlocal\n||||||| last cirby merge\n=======\nremote\n>>>>>>> CLAUDE.md\n",
+			conflicts: 1,
+		},
+		{
+			name: "empty base",
+			base: "", local: "", remote: "new\n",
+			want: "new\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := merge3(splitLines(tt.base), splitLines(tt.local), splitLines(tt.remote), labels)
+			if text := joinLines(got); text != tt.want || conflicts != tt.conflicts {
+				t.Errorf("merge3 = %d conflicts\n%s\nwant %d\n%s", conflicts, text, tt.conflicts, tt.want)
+			}
+			if hasConflictMarkers(joinLines(got)) != (tt.conflicts > 0) {
+				t.Errorf("hasConflictMarkers = %v with %d conflicts", !(tt.conflicts > 0), tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeUnion(t *testing.T) {
+	tests := []struct {
+		name          string
+		local, remote string
+		want          string
+	}{
+		{
+			name:  "remote paragraphs already present",
+			local: "# A\n\n- one\n- two\n", remote: "- one\n- two\n",
+			want: "# A\n\n- one\n- two\n",
+		},
+		{
+			name:  "new remote paragraphs are appended",
+			local: "# A\n\n- one\n", remote: "- one\n\n- three\n\n# B\nbody\n",
+			want: "# A\n\n- one\n\n- three\n\n# B\nbody\n",
+		},
+		{
+			name:  "empty local",
+			local: "", remote: "x\n",
+			want: "x\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := joinLines(mergeUnion(splitLines(tt.local), splitLines(tt.remote)))
+			if got != tt.want {
+				t.Errorf("mergeUnion =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasConflictMarkers(t *testing.T) {
+	for text, want := range map[string]bool{
+		"plain\n":                     false,
+		"a\n<<<<<<< AGENTS.md\nx\n":   true,
+		"a\n>>>>>>> CLAUDE.md\n":      true,
+		"use <<<<<<< inside a line\n": false,
+		strings.Repeat("=", 7) + "\n": false,
+		"```\n<<<<<<< HEAD\n```\n":    true,
+	} {
+		if got := hasConflictMarkers(text); got != want {
+			t.Errorf("hasConflictMarkers(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
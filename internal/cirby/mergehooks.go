@@ -0,0 +1,71 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// hooksConfig holds shell commands run around each merge, for formatters,
+// notifications or checks of a team's own:
+//
+//	hooks:
+//	  pre_merge: ./scripts/check-sources.sh     # non-zero exit: nothing is merged
+//	  post_merge: npx prettier --write "$CIRBY_AGENTS_MD"  # non-zero exit: merge rejected
+//	  post_link: [./scripts/notify.sh, git add -A]
+//
+// Each runs through sh in the project root, with hookEnv describing the run.
+type hooksConfig struct {
+	PreMerge  []string
+	PostMerge []string
+	PostLink  []string
+}
+
+// hookRun describes the merge a hook runs for
+type hookRun struct {
+	Scope   packageScope
+	Agent   string        // "" before an agent was selected
+	Sources []AgentConfig // merged
+	Linked  []AgentConfig // post_link: linked to the canonical file
+}
+
+// hookEnv is the environment of a hook: cirby's own plus CIRBY_* variables
+func (r hookRun) hookEnv(hook string) []string {
+	paths := func(configs []AgentConfig) string {
+		var list []string
+		for _, c := range configs {
+			list = append(list, c.Path)
+		}
+		return strings.Join(list, "\n")
+	}
+	return append(os.Environ(),
+		"CIRBY_HOOK="+hook,
+		"CIRBY_DIR="+r.Scope.Dir,
+		"CIRBY_AGENTS_MD="+r.Scope.agentsPath(),
+		"CIRBY_AGENT="+r.Agent,
+		"CIRBY_SOURCES="+paths(r.Sources), // one per line
+		"CIRBY_LINKED="+paths(r.Linked),
+	)
+}
+
+// runHooks runs the commands of one hook in order and stops at the first
+// that fails. Hooks never run in dry-run mode.
+func runHooks(hook string, commands []string, run hookRun, opts Options) error {
+	if opts.DryRun {
+		return nil
+	}
+	for _, command := range commands {
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  Running %s hook: %s\n", hook, command)
+		}
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = run.hookEnv(hook)
+		cmd.Stdout = opts.stdout()
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q: %w", hook, command, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package cirby
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// started is when cirby started; a run lasts as long as the process
+var started = time.Now()
+
+// metricsConfig makes runs observable fleet-wide:
+//
+//	metrics:
+//	  file: /var/lib/node_exporter/textfile/cirby.prom  # OpenMetrics text
+//	  statsd: 127.0.0.1:8125                             # UDP
+type metricsConfig struct {
+	File   string
+	StatsD string
+}
+
+// metricFamilies are the metrics cirby writes, in file order
+var metricFamilies = []struct{ name, kind, help string }{
+	{"cirby_runs", "counter", "Runs by command."},
+	{"cirby_run_failures", "counter", "Runs that failed, by command."},
+	{"cirby_last_run_duration_seconds", "gauge", "How long the last run took."},
+	{"cirby_last_run_timestamp_seconds", "gauge", "When the last run finished."},
+	{"cirby_targets", "gauge", "Targets of the last run, by outcome."},
+	{"cirby_drifted_targets", "gauge", "Canonical files of the last run that were edited outside cirby."},
+}
+
+// runMetrics is what one run contributes
+type runMetrics struct {
+	Command  string // merge, rollout, check or validate
+	Failed   bool
+	Outcomes map[string]int
+	Drifted  int
+}
+
+// recordTargets records the metrics of a merge or rollout
+func recordTargets(command string, results []targetResult, opts Options) {
+	m := runMetrics{Command: strings.TrimPrefix(command, "cirby "), Outcomes: map[string]int{}}
+	for _, r := range results {
+		m.Outcomes[r.Outcome]++
+		m.Failed = m.Failed || r.Outcome == outcomeFailed
+		if r.Drifted {
+			m.Drifted++
+		}
+	}
+	recordMetrics(m, opts)
+}
+
+// recordChecks records the metrics of cirby check or cirby validate
+func recordChecks(command string, results []checkResult, opts Options) {
+	m := runMetrics{Command: strings.TrimPrefix(command, "cirby "), Outcomes: map[string]int{}}
+	for _, r := range results {
+		switch r.Severity {
+		case "":
+			m.Outcomes["passed"]++
+		case "error":
+			m.Outcomes["failed"]++
+			m.Failed = true
+		default:
+			m.Outcomes[r.Severity]++
+		}
+		if r.Rule == "stale" || r.Rule == "hand-edit" {
+			m.Drifted++
+		}
+	}
+	recordMetrics(m, opts)
+}
+
+// recordMetrics writes m to the configured file and StatsD endpoint.
+// Metrics never fail a run: problems are printed as warnings.
+func recordMetrics(m runMetrics, opts Options) {
+	cfg, err := loadProjectConfig()
+	if err != nil || opts.DryRun {
+		return
+	}
+	elapsed := time.Since(started)
+	if cfg.Metrics.File != "" {
+		if err := updateMetricsFile(cfg.Metrics.File, m, elapsed); err != nil {
+			fmt.Fprintf(opts.stdout(), "[warn] Metrics not written: %v\n", err)
+		}
+	}
+	if cfg.Metrics.StatsD != "" && !opts.Offline {
+		if err := sendStatsD(cfg.Metrics.StatsD, m, elapsed); err != nil {
+			fmt.Fprintf(opts.stdout(), "[warn] Metrics not sent: %v\n", err)
+		}
+	}
+}
+
+// updateMetricsFile adds m to the samples of path. Counters accumulate
+// across runs; the gauges of m's command are replaced.
+func updateMetricsFile(path string, m runMetrics, elapsed time.Duration) error {
+	samples := map[string]float64{}
+	if data, err := os.ReadFile(path); err == nil {
+		for _, line := range splitLines(string(data)) {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			i := strings.LastIndex(line, " ")
+			if v, err := strconv.ParseFloat(line[i+1:], 64); i > 0 && err == nil {
+				samples[line[:i]] = v
+			}
+		}
+	}
+	command := fmt.Sprintf("command=%q", m.Command)
+	for key := range samples {
+		if strings.HasPrefix(key, "cirby_targets{"+command+",") {
+			delete(samples, key)
+		}
+	}
+	samples["cirby_runs_total{"+command+"}"]++
+	failures := samples["cirby_run_failures_total{"+command+"}"]
+	if m.Failed {
+		failures++
+	}
+	samples["cirby_run_failures_total{"+command+"}"] = failures
+	samples["cirby_last_run_duration_seconds{"+command+"}"] = elapsed.Seconds()
+	samples["cirby_last_run_timestamp_seconds{"+command+"}"] = float64(time.Now().Unix())
+	samples["cirby_drifted_targets{"+command+"}"] = float64(m.Drifted)
+	for outcome, n := range m.Outcomes {
+		samples[fmt.Sprintf("cirby_targets{%s,outcome=%q}", command, outcome)] = float64(n)
+	}
+
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, f := range metricFamilies {
+		fmt.Fprintf(&b, "# TYPE %s %s\n# HELP %s %s\n", f.name, f.kind, f.name, f.help)
+		name := f.name
+		if f.kind == "counter" {
+			name += "_total"
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, name+"{") {
+				fmt.Fprintf(&b, "%s %s\n", key, strconv.FormatFloat(samples[key], 'f', -1, 64))
+			}
+		}
+	}
+	b.WriteString("# EOF\n")
+
+	// Collectors may read the file at any time, so it is replaced whole
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// sendStatsD sends m as StatsD lines, such as cirby.merge.runs:1|c
+func sendStatsD(addr string, m runMetrics, elapsed time.Duration) error {
+	conn, err := net.DialTimeout("udp", addr, 2*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	prefix := "cirby." + m.Command + "."
+	lines := []string{prefix + "runs:1|c", fmt.Sprintf("%sduration:%d|ms", prefix, elapsed.Milliseconds()), fmt.Sprintf("%sdrifted:%d|g", prefix, m.Drifted)}
+	if m.Failed {
+		lines = append(lines, prefix+"failures:1|c")
+	}
+	outcomes := make([]string, 0, len(m.Outcomes))
+	for outcome := range m.Outcomes {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+	for _, outcome := range outcomes {
+		name := strings.NewReplacer(" ", "_", "-", "_").Replace(outcome)
+		lines = append(lines, fmt.Sprintf("%stargets.%s:%d|g", prefix, name, m.Outcomes[outcome]))
+	}
+	_, err = conn.Write([]byte(strings.Join(lines, "\n")))
+	return err
+}
@@ -0,0 +1,59 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mockAgent is the name of the mock backend. It is only used when named,
+// never auto-detected, not even with --offline.
+const mockAgent = "mock"
+
+// mockFailEnv makes the mock backend fail, to exercise error handling
+const mockFailEnv = "CIRBY_MOCK_FAIL"
+
+// mockMerge stands in for an agent in tests, CI pipelines and demos: it
+// appends every source verbatim to the target under a "## From <path>"
+// section, replacing the section a source got in an earlier run. It runs
+// no process and makes no network calls, and the result only depends on
+// the inputs.
+func mockMerge(target string, files []AgentConfig, opts Options) error {
+	if msg := os.Getenv(mockFailEnv); msg != "" {
+		return fmt.Errorf("mock failure (%s=%s)", mockFailEnv, msg)
+	}
+	content := "# " + filepath.Base(opts.output()) + "\n"
+	if data, err := os.ReadFile(target); err == nil {
+		content = stripHeader(string(data))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	sorted := append([]AgentConfig(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	sections := splitSections(content)
+	for _, f := range sorted {
+		heading := "## From " + filepath.ToSlash(f.Path)
+		section := markdownSection{Heading: heading, Content: heading + "\n\n" + strings.TrimRight(f.Content, "\n") + "\n"}
+		replaced := false
+		for i, s := range sections {
+			if s.Heading == heading {
+				sections[i], replaced = section, true
+			}
+		}
+		if !replaced {
+			sections = append(sections, section)
+		}
+	}
+
+	parts := make([]string, len(sections))
+	for i, s := range sections {
+		parts[i] = strings.TrimRight(s.Content, "\n")
+	}
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  - Appended %d files with the mock backend\n", len(sorted))
+	}
+	return writeMergeResult(target, strings.Join(parts, "\n\n")+"\n")
+}
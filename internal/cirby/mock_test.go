@@ -0,0 +1,159 @@
+package cirby
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testProject makes a temporary project with files and runs the test in
+// it, with the user's cache and config directories out of the way and the
+// audit and agent logs going to the project
+func testProject(t *testing.T, files map[string]string) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "cache"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("DO_NOT_TRACK", "1")
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+	setProjectRoot(dir)
+	t.Cleanup(func() { setProjectRoot("") })
+}
+
+// testOptions are the options of a merge run without prompts
+func testOptions(agent string, out *bytes.Buffer) Options {
+	return Options{
+		Agent:    agent,
+		Force:    true,
+		LinkMode: LinkSymlink,
+		Output:   "AGENTS.md",
+		Stdout:   out,
+		Stdin:    strings.NewReader(""),
+	}
+}
+
+func readAgentsMD(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile("AGENTS.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stripHeader(string(data))
+}
+
+func TestMockMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		want   string
+		linked []string
+	}{
+		{
+			name:   "one source",
+			files:  map[string]string{"CLAUDE.md": "# Claude\n\nUse tabs.\n"},
+			want:   "# AGENTS.md\n\n## From CLAUDE.md\n\n# Claude\n\nUse tabs.\n",
+			linked: []string{"CLAUDE.md"},
+		},
+		{
+			name: "sources in path order",
+			files: map[string]string{
+				"GEMINI.md": "Be brief.\n",
+				"CLAUDE.md": "Use tabs.\n",
+			},
+			want:   "# AGENTS.md\n\n## From CLAUDE.md\n\nUse tabs.\n\n## From GEMINI.md\n\nBe brief.\n",
+			linked: []string{"CLAUDE.md", "GEMINI.md"},
+		},
+		{
+			name: "into an existing AGENTS.md",
+			files: map[string]string{
+				"AGENTS.md": "# Rules\n\n## Style\n\nGo fmt.\n",
+				"CLAUDE.md": "Use tabs.\n",
+			},
+			want:   "# Rules\n\n## Style\n\nGo fmt.\n\n## From CLAUDE.md\n\nUse tabs.\n",
+			linked: []string{"CLAUDE.md"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testProject(t, tt.files)
+			var out bytes.Buffer
+			if err := Run(testOptions(mockAgent, &out)); err != nil {
+				t.Fatalf("Run: %v\n%s", err, out.String())
+			}
+			if got := readAgentsMD(t); got != tt.want {
+				t.Errorf("AGENTS.md =\n%s\nwant\n%s", got, tt.want)
+			}
+			for _, path := range tt.linked {
+				if !isSymlinkToAgentsMD(path, "AGENTS.md") {
+					t.Errorf("%s is not linked to AGENTS.md", path)
+				}
+			}
+		})
+	}
+}
+
+func TestMockMergeIsRepeatable(t *testing.T) {
+	testProject(t, map[string]string{"CLAUDE.md": "Use tabs.\n"})
+	var out bytes.Buffer
+	if err := Run(testOptions(mockAgent, &out)); err != nil {
+		t.Fatalf("Run: %v\n%s", err, out.String())
+	}
+	first := readAgentsMD(t)
+
+	// A second run finds everything linked
+	out.Reset()
+	if err := Run(testOptions(mockAgent, &out)); err != nil {
+		t.Fatalf("second Run: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "Already in sync") {
+		t.Errorf("second run:\n%s", out.String())
+	}
+	if got := readAgentsMD(t); got != first {
+		t.Errorf("AGENTS.md changed on the second run:\n%s", got)
+	}
+
+	// and undo brings the source back
+	out.Reset()
+	if err := Undo(1, testOptions(mockAgent, &out)); err != nil {
+		t.Fatalf("Undo: %v\n%s", err, out.String())
+	}
+	data, err := os.ReadFile("CLAUDE.md")
+	if err != nil || string(data) != "Use tabs.\n" {
+		t.Errorf("CLAUDE.md after undo = %q, %v", data, err)
+	}
+	if _, err := os.Stat("AGENTS.md"); !os.IsNotExist(err) {
+		t.Errorf("AGENTS.md still exists after undo: %v", err)
+	}
+	if data, err := os.ReadFile(lockFile); !os.IsNotExist(err) {
+		t.Errorf("%s after undoing the only merge = %q, %v; want it removed", lockFile, data, err)
+	}
+}
+
+func TestMockMergeFailure(t *testing.T) {
+	testProject(t, map[string]string{"CLAUDE.md": "Use tabs.\n"})
+	t.Setenv(mockFailEnv, "boom")
+	var out bytes.Buffer
+	err := Run(testOptions(mockAgent, &out))
+	if err == nil || !strings.Contains(err.Error(), "mock failure") {
+		t.Fatalf("Run error = %v, want a mock failure", err)
+	}
+	if data, err := os.ReadFile("CLAUDE.md"); err != nil || string(data) != "Use tabs.\n" {
+		t.Errorf("CLAUDE.md after a failed merge = %q, %v", data, err)
+	}
+	if _, err := os.Stat("AGENTS.md"); !os.IsNotExist(err) {
+		t.Errorf("AGENTS.md written by a failed merge: %v", err)
+	}
+}
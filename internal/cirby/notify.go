@@ -0,0 +1,154 @@
+package cirby
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// notifyTimeout bounds the request to a notification webhook
+const notifyTimeout = 10 * time.Second
+
+// notifyConfig sends the outcome of merges and checks to a webhook:
+//
+//	notify:
+//	  url: ${SLACK_WEBHOOK_URL}   # expanded from the environment
+//	  format: slack               # or json (default): a notification object
+//	  on: changes                 # changes (default), failures or always
+type notifyConfig struct {
+	URL    string
+	Format string
+	On     string
+}
+
+// notification is the JSON payload of the json format
+type notification struct {
+	Command    string         `json:"command"` // cirby merge, cirby rollout or cirby check
+	Repository string         `json:"repository"`
+	Summary    string         `json:"summary"`
+	Failed     bool           `json:"failed"`
+	Targets    []targetResult `json:"targets,omitempty"`
+	Checks     []checkResult  `json:"checks,omitempty"`
+}
+
+// notifyTargets reports the results of a merge or rollout
+func notifyTargets(command string, results []targetResult, opts Options) {
+	n := notification{Command: command, Summary: batchSummary(results), Targets: results}
+	changed := false
+	for _, r := range results {
+		n.Failed = n.Failed || r.Outcome == outcomeFailed
+		changed = changed || r.Outcome != outcomeUpToDate
+	}
+	sendNotification(n, changed, opts)
+}
+
+// notifyChecks reports the results of cirby check or cirby validate
+func notifyChecks(command string, results []checkResult, opts Options) {
+	n := notification{Command: command, Checks: results}
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Severity]++
+	}
+	n.Failed = counts["error"] > 0
+	n.Summary = fmt.Sprintf("%d failed, %d warnings, %d passed", counts["error"], counts["warning"], counts[""])
+	sendNotification(n, n.Failed || counts["warning"] > 0, opts)
+}
+
+// sendNotification posts n to the configured webhook. Notifications never
+// fail a run: problems are printed as warnings.
+func sendNotification(n notification, changed bool, opts Options) {
+	cfg, err := loadProjectConfig()
+	if err != nil || cfg.Notify.URL == "" || opts.DryRun || opts.Offline {
+		return
+	}
+	switch cfg.Notify.On {
+	case "failures":
+		if !n.Failed {
+			return
+		}
+	case "always":
+	default:
+		if !changed {
+			return
+		}
+	}
+	n.Repository = os.Getenv("GITHUB_REPOSITORY")
+	if n.Repository == "" {
+		if wd, err := os.Getwd(); err == nil {
+			n.Repository = filepath.Base(wd)
+		}
+	}
+
+	var payload any = n
+	if cfg.Notify.Format == "slack" {
+		payload = map[string]string{"text": slackText(n)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	target, err := url.Parse(os.ExpandEnv(cfg.Notify.URL))
+	if err != nil || target.Host == "" {
+		fmt.Fprintf(opts.stdout(), "[warn] Notification not sent: notify.url is not a URL once expanded\n")
+		return
+	}
+	if err := postNotification(target, body, cfg.API); err != nil {
+		fmt.Fprintf(opts.stdout(), "[warn] Notification not sent: %v\n", err)
+	} else if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  [ok] Sent notification to %s\n", target.Host)
+	}
+}
+
+// postNotification sends body to target. Webhook URLs are secrets, so
+// errors leave the URL out.
+func postNotification(target *url.URL, body []byte, api apiConfig) error {
+	transport, err := apiTransport(api)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notifyTimeout, Transport: transport}
+	resp, err := client.Post(target.String(), "application/json", bytes.NewReader(body))
+	if urlErr, ok := err.(*url.Error); ok {
+		return fmt.Errorf("%s: %w", target.Host, urlErr.Err)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// slackText renders n as a Slack message: a summary line, then one line
+// per target or file that needs attention
+func slackText(n notification) string {
+	icon := ":white_check_mark:"
+	if n.Failed {
+		icon = ":x:"
+	}
+	lines := []string{fmt.Sprintf("%s *%s* in `%s`: %s", icon, n.Command, n.Repository, n.Summary)}
+	for _, r := range n.Targets {
+		line := fmt.Sprintf("• `%s` %s", r.Target, r.Outcome)
+		switch {
+		case r.Error != "":
+			line += ": " + r.Error
+		case r.Added > 0 || r.Removed > 0 || r.Linked > 0:
+			line += fmt.Sprintf(" (+%d −%d, %d files linked)", r.Added, r.Removed, r.Linked)
+		}
+		lines = append(lines, line)
+	}
+	for _, r := range n.Checks {
+		if r.Severity != "" {
+			lines = append(lines, fmt.Sprintf("• `%s` %s: %s", r.Path, r.Severity, r.Message))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
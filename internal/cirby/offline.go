@@ -0,0 +1,96 @@
+package cirby
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// offlineAgents lists what --offline allows, for messages
+const offlineAgents = "ollama on this machine, or builtin"
+
+// checkOffline fails if --offline is set and the agent would use the network
+func checkOffline(agent SupportedAgent, opts Options) error {
+	if !opts.Offline {
+		return nil
+	}
+	if !agent.Offline {
+		return fmt.Errorf("--offline: %s makes network calls; use %s", agent.Name, offlineAgents)
+	}
+	if agent.API != nil && !isLoopbackURL(agent.API.url()) {
+		return fmt.Errorf("--offline: %s points at %s, which is not this machine", agent.Name, agent.API.url())
+	}
+	return nil
+}
+
+// requireOnline fails if --offline is set, for what needs the network
+func requireOnline(what string, opts Options) error {
+	if opts.Offline {
+		return fmt.Errorf("--offline: %s needs the network", what)
+	}
+	return nil
+}
+
+// isNetworkRef reports whether a template, baseline or remote reference
+// is fetched over the network rather than read from disk
+func isNetworkRef(ref string) bool {
+	if strings.Contains(ref, "://") {
+		return !strings.HasPrefix(ref, "file://")
+	}
+	if strings.HasPrefix(ref, "git@") {
+		return true
+	}
+	if _, err := os.Stat(ref); err == nil {
+		return false
+	}
+	// owner/repo shorthand on GitHub
+	u, err := templateURL(ref)
+	return err == nil && u != ""
+}
+
+// isLoopbackURL reports whether rawURL points at this machine
+func isLoopbackURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// builtinMerge merges without an agent: it keeps the existing target and
+// merges in the sources in path order, section by section, dropping text
+// that is already there (see heuristicMerge). The result only depends on
+// the inputs.
+func builtinMerge(target string, files []AgentConfig, opts Options) error {
+	var doc []docSection
+	if data, err := os.ReadFile(target); err == nil {
+		doc = parseDoc(splitLines(stripHeader(string(data))))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if len(doc) == 0 {
+		doc = []docSection{{Heading: "# " + filepath.Base(opts.output()), Level: 1}}
+	}
+
+	sorted := append([]AgentConfig(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	dropped := 0
+	for _, f := range sorted {
+		var n int
+		doc, n = heuristicMerge(doc, parseDoc(splitLines(f.Content)))
+		dropped += n
+	}
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  - Merged %d files without an agent, dropping %d duplicate paragraphs and list items\n", len(sorted), dropped)
+	}
+	return writeMergeResult(target, renderDoc(doc))
+}
@@ -0,0 +1,134 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// docChunk is the part of a document before its first section, or one
+// ## section with everything below it, including generated sections
+type docChunk struct {
+	Title string // "" for the part before the first section
+	Lines []string
+}
+
+// splitChunks splits content at its ## headings. Generated sections move
+// with their markers, and the table of contents stays at the top.
+func splitChunks(content string) []docChunk {
+	chunks := []docChunk{{}}
+	inFence, inGenerated, pending := false, false, false
+	tocStart, _ := sectionMarkers(tocSection)
+	for _, line := range splitLines(content) {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inFence && strings.HasPrefix(trimmed, "<!-- cirby:section ") && trimmed != tocStart:
+			chunks = append(chunks, docChunk{Lines: []string{line}})
+			inGenerated, pending = true, true
+			continue
+		case !inFence && strings.HasPrefix(trimmed, "<!-- /cirby:section "):
+			inGenerated = false
+		}
+		var heading bool
+		heading, inFence = markdownHeading(line, inFence)
+		if heading && strings.HasPrefix(trimmed, "## ") {
+			switch {
+			case pending:
+				chunks[len(chunks)-1].Title = headingTitle(trimmed)
+				pending = false
+			case !inGenerated:
+				chunks = append(chunks, docChunk{Title: headingTitle(trimmed)})
+			}
+		}
+		cur := &chunks[len(chunks)-1]
+		cur.Lines = append(cur.Lines, line)
+	}
+	return chunks
+}
+
+// orderChunks sorts sections into the order of outline. Sections not in
+// it keep their relative order and go where unknown says: "end" (the
+// default), "start", or after the outline section of that name.
+func orderChunks(chunks []docChunk, outline []string, unknown string) []docChunk {
+	rank := func(c docChunk) int {
+		for i, title := range outline {
+			if matchesTitle(title, []string{"## " + c.Title}) {
+				return i
+			}
+		}
+		return -1
+	}
+	unknownRank := float64(len(outline))
+	switch {
+	case unknown == "start":
+		unknownRank = -0.5
+	case unknown != "" && unknown != "end":
+		for i, title := range outline {
+			if normalizeTitle("## "+title) == normalizeTitle("## "+unknown) {
+				unknownRank = float64(i) + 0.5
+			}
+		}
+	}
+
+	head, sections := chunks[:1], append([]docChunk(nil), chunks[1:]...)
+	sort.SliceStable(sections, func(i, j int) bool {
+		ri, rj := float64(rank(sections[i])), float64(rank(sections[j]))
+		if ri < 0 {
+			ri = unknownRank
+		}
+		if rj < 0 {
+			rj = unknownRank
+		}
+		return ri < rj
+	})
+	return append(append([]docChunk(nil), head...), sections...)
+}
+
+// joinChunks puts chunks back together with one blank line between them
+func joinChunks(chunks []docChunk) string {
+	var parts []string
+	for _, c := range chunks {
+		if text := strings.Trim(joinLines(c.Lines), "\n"); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n") + "\n"
+}
+
+// orderContent reorders the sections of content to follow outline, or
+// returns it unchanged without one
+func orderContent(content string, cfg structureConfig) string {
+	if len(cfg.Outline) == 0 {
+		return content
+	}
+	chunks := splitChunks(content)
+	ordered := joinChunks(orderChunks(chunks, cfg.Outline, cfg.Unknown))
+	if ordered == joinChunks(chunks) {
+		return content
+	}
+	return ordered
+}
+
+// orderSections reorders the sections of agentsPath to follow
+// structure.outline of .cirby.yaml, so merges by different agents do not
+// shuffle the document
+func orderSections(agentsPath string, opts Options) error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	ordered := orderContent(string(data), cfg.Structure)
+	if ordered == string(data) {
+		return nil
+	}
+	if err := writeFile(agentsPath, []byte(ordered), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", agentsPath, err)
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Reordered the sections of %s to follow the outline\n", agentsPath)
+	return nil
+}
@@ -0,0 +1,215 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pipelineDir holds the intermediate output of per-file passes
+const pipelineDir = ".cirby/pipeline"
+
+// pipelinePass is one step of a merge pipeline in .cirby.yaml:
+//
+//	pipeline:
+//	  - name: summarize
+//	    each: true                # once per source file
+//	    agent: ollama
+//	    prompt: Summarize the rules in {{file}} and write them to {{output}}.
+//	  - name: combine
+//	    prompt: Merge {{files}} into {{output}}.
+//	  - name: dedupe
+//	    dedup: true               # embedding dedup, see --dedup
+//
+// Prompts can use {{target}} (AGENTS.md), {{output}} (the file the pass
+// writes), {{files}} (the current inputs, one per line), {{sources}} (their
+// content), {{content}} (AGENTS.md so far) and, in per-file passes,
+// {{file}} and {{file_content}}.
+type pipelinePass struct {
+	Name   string
+	Agent  string // default: the agent of the run
+	Prompt string
+	Each   bool
+	Dedup  bool
+}
+
+// parsePipeline reads the pipeline: list of .cirby.yaml
+func parsePipeline(v any, path string) ([]pipelinePass, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: pipeline must be a list of passes", path)
+	}
+	var passes []pipelinePass
+	for i, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: pipeline pass %d must be a mapping", path, i+1)
+		}
+		p := pipelinePass{Name: yamlString(m["name"]), Agent: yamlString(m["agent"]), Prompt: yamlString(m["prompt"])}
+		p.Each, _ = yamlBool(m["each"])
+		p.Dedup, _ = yamlBool(m["dedup"])
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("pass %d", i+1)
+		}
+		if !p.Dedup && p.Prompt == "" && p.Agent != "builtin" {
+			return nil, fmt.Errorf("%s: pipeline pass %q needs a prompt", path, p.Name)
+		}
+		if p.Each && (p.Dedup || p.Agent == "builtin") {
+			return nil, fmt.Errorf("%s: pipeline pass %q cannot run per file", path, p.Name)
+		}
+		passes = append(passes, p)
+	}
+	return passes, nil
+}
+
+// runPipeline merges toProcess into the scope's AGENTS.md by running the
+// configured passes in order. Per-file passes replace each input with
+// their output; all others update AGENTS.md.
+func runPipeline(scope packageScope, agent SupportedAgent, toProcess, toRelink []AgentConfig, opts Options) (agentMerge, error) {
+	agentsPath := scope.agentsPath()
+	passes := opts.pipeline
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		fmt.Fprintf(opts.stdout(), "  - Merge %d files into %s with a %d-pass pipeline:\n", len(toProcess), agentsPath, len(passes))
+		for i, p := range passes {
+			fmt.Fprintf(opts.stdout(), "    %d. %s (%s)\n", i+1, p.Name, p.describe(agent))
+		}
+		printDryRunLinks(toProcess, toRelink, agentsPath, opts)
+		return agentMerge{linked: len(toProcess) + len(toRelink)}, nil
+	}
+
+	defer os.RemoveAll(pipelineDir)
+	inputs := append([]AgentConfig(nil), toProcess...)
+	var prompts []string
+	for i, p := range passes {
+		fmt.Fprintf(opts.stdout(), "[%d/%d] %s (%s)...\n", i+1, len(passes), p.Name, p.describe(agent))
+		if p.Dedup {
+			dedupOpts := opts
+			dedupOpts.Dedup = true
+			if err := dedupMerge(agentsPath, dedupOpts); err != nil {
+				return agentMerge{}, fmt.Errorf("pipeline pass %q: %w", p.Name, err)
+			}
+			continue
+		}
+
+		passAgent := agent
+		if p.Agent != "" {
+			passOpts := opts
+			passOpts.Agent = p.Agent
+			selected, err := selectAgent(passOpts)
+			if err != nil {
+				return agentMerge{}, fmt.Errorf("pipeline pass %q: %w", p.Name, err)
+			}
+			passAgent = selected
+		}
+
+		current, _ := os.ReadFile(agentsPath)
+		vars := map[string]string{
+			"target":  agentsPath,
+			"files":   joinPaths(inputs),
+			"sources": inlineSources(inputs),
+			"content": stripHeader(string(current)),
+		}
+
+		if !p.Each {
+			vars["output"] = agentsPath
+			prompt := p.expand(vars, scope)
+			if err := executeAgent(passAgent, prompt, agentsPath, inputs, opts); err != nil {
+				return agentMerge{}, fmt.Errorf("pipeline pass %q failed: %w", p.Name, err)
+			}
+			prompts = append(prompts, prompt)
+			continue
+		}
+
+		dir := filepath.Join(pipelineDir, fmt.Sprintf("%d-%s", i+1, slug(p.Name)))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return agentMerge{}, err
+		}
+		var outputs []AgentConfig
+		for n, f := range inputs {
+			output := filepath.Join(dir, fmt.Sprintf("%02d-%s.md", n+1, slug(strings.TrimSuffix(filepath.Base(f.Path), filepath.Ext(f.Path)))))
+			vars["file"], vars["file_content"], vars["output"] = f.Path, f.Content, output
+			prompt := p.expand(vars, scope)
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  - %s -> %s\n", f.Path, output)
+			}
+			if err := executeAgent(passAgent, prompt, output, []AgentConfig{f}, opts); err != nil {
+				return agentMerge{}, fmt.Errorf("pipeline pass %q failed on %s: %w", p.Name, f.Path, err)
+			}
+			data, err := os.ReadFile(output)
+			if err != nil {
+				return agentMerge{}, fmt.Errorf("pipeline pass %q did not write %s", p.Name, output)
+			}
+			outputs = append(outputs, AgentConfig{Path: output, Agent: f.Agent, Content: string(data)})
+			prompts = append(prompts, prompt)
+		}
+		inputs = outputs
+	}
+
+	if _, err := os.Stat(agentsPath); err != nil {
+		return agentMerge{}, fmt.Errorf("the pipeline did not create %s; its last passes must write {{output}}", agentsPath)
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Merged %d files into %s in %d passes\n", len(toProcess), agentsPath, len(passes))
+	return agentMerge{prompt: strings.Join(prompts, "\n")}, nil
+}
+
+// describe names what runs the pass
+func (p pipelinePass) describe(agent SupportedAgent) string {
+	switch {
+	case p.Dedup:
+		return "embedding dedup"
+	case p.Agent != "":
+		return p.Agent
+	}
+	return agent.Name
+}
+
+// expand fills in the placeholders of the pass prompt. A prompt that does
+// not say where to write gets told.
+func (p pipelinePass) expand(vars map[string]string, scope packageScope) string {
+	var pairs []string
+	for k, v := range vars {
+		pairs = append(pairs, "{{"+k+"}}", v)
+	}
+	prompt := strings.NewReplacer(pairs...).Replace(strings.TrimSpace(p.Prompt))
+	if !strings.Contains(p.Prompt, "{{output}}") {
+		prompt += "\n\nWrite the result to " + vars["output"] + "."
+	}
+	if note := buildInheritNote(scope); note != "" && !p.Each {
+		prompt += "\n\n" + note
+	}
+	return prompt
+}
+
+func joinPaths(files []AgentConfig) string {
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	return strings.Join(paths, "\n")
+}
+
+// inlineSources lists the content of files, each under its path
+func inlineSources(files []AgentConfig) string {
+	var b strings.Builder
+	for _, f := range files {
+		fmt.Fprintf(&b, "--- %s ---\n%s\n", f.Path, strings.TrimRight(f.Content, "\n"))
+	}
+	return b.String()
+}
+
+// slug makes a name safe to use in a file name
+func slug(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
@@ -0,0 +1,164 @@
+package cirby
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// pluginTimeout bounds one run of a scanner plugin
+const pluginTimeout = 60 * time.Second
+
+// scannerPlugin is a program that contributes sources no file holds, such
+// as rules kept in an internal wiki:
+//
+//	plugins:
+//	  - name: wiki
+//	    command: ./scripts/wiki-rules --space ENG
+//
+// cirby runs the command through sh in the project root with a
+// pluginRequest on stdin, and reads a pluginResponse from stdout.
+type scannerPlugin struct {
+	Name    string
+	Command string
+}
+
+// pluginRequest tells a plugin which directory is being scanned
+type pluginRequest struct {
+	Version int    `json:"version"` // of this contract, 1
+	Dir     string `json:"dir"`     // relative to the project root
+	Output  string `json:"output"`  // the canonical file the sources merge into
+	Offline bool   `json:"offline"` // --offline: the plugin should not use the network
+}
+
+// pluginResponse lists the sources a plugin found, e.g.
+//
+//	{"configs": [{"id": "security", "agent": "Engineering wiki", "content": "# Security\n..."}]}
+type pluginResponse struct {
+	Configs []struct {
+		ID      string `json:"id"`      // stable name, shown as wiki:security
+		Agent   string `json:"agent"`   // where it came from; default "wiki plugin"
+		Content string `json:"content"` // Markdown instructions
+	} `json:"configs"`
+}
+
+// parsePlugins reads the plugins: section of .cirby.yaml: scanner
+// plugins, which have a command, and WASM plugins, which have a module
+func parsePlugins(v any, path string) ([]scannerPlugin, []wasmPlugin, error) {
+	items, ok := v.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: plugins must be a list of plugins", path)
+	}
+	var plugins []scannerPlugin
+	var modules []wasmPlugin
+	seen := map[string]bool{}
+	for i, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: plugin %d must be a mapping", path, i+1)
+		}
+		p := scannerPlugin{Name: yamlString(m["name"]), Command: yamlString(m["command"])}
+		w := wasmPlugin{Name: p.Name, Module: yamlString(m["wasm"]), Role: yamlString(m["role"])}
+		switch {
+		case p.Name == "" || strings.ContainsAny(p.Name, ":/ "):
+			return nil, nil, fmt.Errorf("%s: plugin %d needs a name without spaces, colons or slashes", path, i+1)
+		case seen[p.Name]:
+			return nil, nil, fmt.Errorf("%s: plugin %s is declared twice", path, p.Name)
+		case p.Command != "" && w.Module != "":
+			return nil, nil, fmt.Errorf("%s: plugin %s needs a command or a wasm module, not both", path, p.Name)
+		case w.Module != "" && !slices.Contains(wasmRoles, w.Role):
+			return nil, nil, fmt.Errorf("%s: plugin %s: role must be %s", path, p.Name, strings.Join(wasmRoles, " or "))
+		case p.Command == "" && w.Module == "":
+			return nil, nil, fmt.Errorf("%s: plugin %s needs a command or a wasm module", path, p.Name)
+		}
+		seen[p.Name] = true
+		if w.Module != "" {
+			modules = append(modules, w)
+		} else {
+			plugins = append(plugins, p)
+		}
+	}
+	return plugins, modules, nil
+}
+
+// scanPlugins runs the configured plugins for dir and returns what they
+// contributed. Like settings, plugin sources have no file to link: they
+// are quoted to the agent and merged again only when they change.
+func scanPlugins(dir string, opts Options) ([]AgentConfig, error) {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	var configs []AgentConfig
+	for _, p := range cfg.Plugins {
+		found, err := p.run(dir, opts)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+		configs = append(configs, found...)
+	}
+	return configs, nil
+}
+
+func (p scannerPlugin) run(dir string, opts Options) ([]AgentConfig, error) {
+	input, err := json.Marshal(pluginRequest{Version: 1, Dir: filepath.ToSlash(dir), Output: opts.output(), Offline: opts.Offline})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", p.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%q did not finish within %s", p.Command, pluginTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", p.Command, err)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, fmt.Errorf("%q: expected a JSON object with configs: %w", p.Command, err)
+	}
+
+	var configs []AgentConfig
+	seen := map[string]bool{}
+	for i, c := range resp.Configs {
+		switch {
+		case c.ID == "":
+			return nil, fmt.Errorf("config %d has no id", i+1)
+		case seen[c.ID]:
+			return nil, fmt.Errorf("config %s is listed twice", c.ID)
+		case len(c.Content) > maxConfigSize:
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [skip] %s:%s (larger than %d KiB)\n", p.Name, c.ID, maxConfigSize/1024)
+			}
+			continue
+		case strings.TrimSpace(c.Content) == "":
+			continue
+		}
+		seen[c.ID] = true
+		agent := c.Agent
+		if agent == "" {
+			agent = p.Name + " plugin"
+		}
+		content := c.Content
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		path := p.Name + ":" + c.ID
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [ok] %s (%s)\n", path, agent)
+		}
+		configs = append(configs, AgentConfig{Path: path, Agent: agent, Content: content, Plugin: p.Name})
+	}
+	return configs, nil
+}
@@ -0,0 +1,44 @@
+package cirby
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxPromptArg is the longest prompt passed as a command-line argument.
+// Linux rejects single arguments over 128 KiB, and everything in argv is
+// visible in ps, so CLIs that can read the prompt elsewhere always do.
+const maxPromptArg = 128 << 10
+
+// agentInput is how the prompt reaches an agent CLI
+type agentInput struct {
+	Args    []string  // the CLI's own arguments, before --model and friends
+	Stdin   io.Reader // nil to pass cirby's stdin through
+	Cleanup func()    // removes the prompt file, if one was written
+	Via     string    // for --verbose: "stdin", a file path, or "" for argv
+}
+
+// promptInput picks the way agent takes prompt: over stdin, from a
+// private temporary file, or as an argument when the CLI knows no other
+func promptInput(agent SupportedAgent, prompt string) (agentInput, error) {
+	switch {
+	case agent.StdinArgs != nil:
+		return agentInput{Args: agent.StdinArgs, Stdin: strings.NewReader(prompt), Cleanup: func() {}, Via: "stdin"}, nil
+	case agent.PromptFile != nil:
+		f, err := os.CreateTemp("", "cirby-prompt-*.md")
+		if err != nil {
+			return agentInput{}, err
+		}
+		defer f.Close()
+		if _, err := f.WriteString(prompt); err != nil {
+			os.Remove(f.Name())
+			return agentInput{}, fmt.Errorf("writing prompt file: %w", err)
+		}
+		return agentInput{Args: agent.PromptFile(f.Name()), Cleanup: func() { os.Remove(f.Name()) }, Via: f.Name()}, nil
+	case len(prompt) > maxPromptArg:
+		return agentInput{}, fmt.Errorf("the prompt is %s, too long for %s, which only takes it as an argument; use claude, gemini, aider or an API backend", formatBytes(len(prompt)), agent.Name)
+	}
+	return agentInput{Args: agent.Args(prompt), Cleanup: func() {}}, nil
+}
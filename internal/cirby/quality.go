@@ -0,0 +1,176 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// defaultMinScore is the quality score --strict requires unless
+// quality.min_score in .cirby.yaml says otherwise
+const defaultMinScore = 70
+
+// agentPhrasing matches text addressed to one agent, which a shared
+// AGENTS.md should not need
+var agentPhrasing = regexp.MustCompile(`(?i)\b(claude(\s+code)?|gemini(\s+cli)?|cursor|windsurf|copilot|codex|aider)\b|\b(claude|gemini|codex)\.md\b|\.cursorrules|\.windsurfrules`)
+
+// qualityScore measures a merge result against its sources
+type qualityScore struct {
+	Lines, Covered       int // source lines, and those found in the result
+	Rules, Duplicates    int // rules in the result, and near-duplicates among them
+	Headings, Kept       int // source section headings, and those the result has
+	Tokens, Budget       int // size of the result, and of the sources
+	Phrasing             int // mentions of a specific agent
+	Score                int // 0-100
+	coverage, duplicates float64
+}
+
+// scoreMerge computes the quality signals of merged, weighted as coverage
+// 35, duplicates 20, sections 20, length 15 and agent phrasing 10
+func scoreMerge(sources []AgentConfig, merged string) qualityScore {
+	var q qualityScore
+
+	haystack := normalizeForCoverage(merged)
+	for _, src := range sources {
+		for _, line := range splitLines(src.Content) {
+			if norm := normalizeForCoverage(line); len(norm) >= 4 {
+				q.Lines++
+				if strings.Contains(haystack, norm) {
+					q.Covered++
+				}
+			}
+		}
+	}
+
+	doc := parseDoc(splitLines(merged))
+	seen := &shingleIndex{exact: map[string]bool{}}
+	for _, s := range doc {
+		for _, b := range s.Blocks {
+			if strings.HasPrefix(strings.TrimSpace(b.Lines[0]), "```") || strings.HasPrefix(strings.TrimSpace(b.Lines[0]), "<!-- cirby:section ") {
+				continue
+			}
+			for _, unit := range blockUnits(b) {
+				q.Rules++
+				if seen.contains(unit) {
+					q.Duplicates++
+				}
+				seen.add(unit)
+			}
+		}
+	}
+
+	for _, src := range sources {
+		for _, s := range parseDoc(splitLines(src.Content)) {
+			if s.Level < 2 || normalizeTitle(s.Heading) == "" {
+				continue
+			}
+			q.Headings++
+			if findSection(doc, s) >= 0 {
+				q.Kept++
+			}
+		}
+		q.Budget += estimateTokens(src.Content)
+	}
+	q.Tokens = estimateTokens(merged)
+
+	inFence, inSection := false, false
+	for _, line := range splitLines(merged) {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			inFence = !inFence
+			continue
+		case strings.HasPrefix(trimmed, "<!-- cirby:section "):
+			inSection = true
+		case strings.HasPrefix(trimmed, "<!-- /cirby:section "):
+			inSection = false
+		}
+		if !inFence && !inSection {
+			q.Phrasing += len(agentPhrasing.FindAllString(line, -1))
+		}
+	}
+
+	q.coverage = ratio(q.Covered, q.Lines)
+	if q.Rules > 0 {
+		q.duplicates = float64(q.Duplicates) / float64(q.Rules)
+	}
+	sections := ratio(q.Kept, q.Headings)
+	length := 1.0
+	if q.Budget > 0 && q.Tokens > q.Budget {
+		length = float64(q.Budget) / float64(q.Tokens)
+	}
+	phrasing := max(0, 1-0.2*float64(q.Phrasing))
+
+	q.Score = int(35*q.coverage + 20*(1-q.duplicates) + 20*sections + 15*length + 10*phrasing + 0.5)
+	return q
+}
+
+// ratio is n of total, or 1 when there is nothing to measure
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 1
+	}
+	return float64(n) / float64(total)
+}
+
+func (q qualityScore) String() string {
+	return fmt.Sprintf("coverage %d%%, duplicates %d%%, sections %d/%d, ~%s of ~%s source tokens, agent-specific phrasing %d",
+		int(q.coverage*100), int(q.duplicates*100), q.Kept, q.Headings, formatCount(q.Tokens), formatCount(q.Budget), q.Phrasing)
+}
+
+// verifyMerge prints the quality score of a merge result and checks it
+// against the structure: requirements and lint: rules of .cirby.yaml. With
+// --strict, a low score, a broken requirement or a lint error restores the
+// previous AGENTS.md, keeping the result in .cirby/rejected, and fails.
+func verifyMerge(agentsPath, before string, existed bool, sources []AgentConfig, opts Options) error {
+	merged, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	minScore := defaultMinScore
+	if cfg.MinScore > 0 {
+		minScore = cfg.MinScore
+	}
+
+	level := "warning"
+	if opts.Strict {
+		level = "error"
+	}
+	var problems []string
+	q := scoreMerge(sources, string(merged))
+	if q.Score >= minScore {
+		fmt.Fprintf(opts.stdout(), "[ok] Quality score %d/100 (%s)\n", q.Score, q)
+	} else {
+		fmt.Fprintf(opts.stdout(), "[warn] Quality score %d/100 is below %d (%s)\n", q.Score, minScore, q)
+		annotate(level, agentsPath, fmt.Sprintf("merge quality score %d/100 is below %d (%s)", q.Score, minScore, q), opts)
+		problems = append(problems, fmt.Sprintf("quality score %d is below %d", q.Score, minScore))
+	}
+	for _, v := range structureViolations(string(merged), cfg.Structure) {
+		fmt.Fprintf(opts.stdout(), "[warn] %s: %s\n", agentsPath, v)
+		annotate(level, agentsPath, v, opts)
+		problems = append(problems, v)
+	}
+	for _, f := range append(lint(string(merged), cfg.Lint), wasmFindings(agentsPath, string(merged), cfg.Wasm)...) {
+		fmt.Fprintf(opts.stdout(), "[warn] %s: %s\n", agentsPath, f)
+		if f.Severity == "warning" {
+			annotate("warning", agentsPath, f.String(), opts)
+			continue
+		}
+		annotate(level, agentsPath, f.String(), opts)
+		problems = append(problems, f.String())
+	}
+	if !opts.Strict || len(problems) == 0 {
+		return nil
+	}
+
+	rejected, err := rejectMerge(agentsPath, before, existed)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("--strict: %s; %s is unchanged and the rejected result is in %s", strings.Join(problems, "; "), agentsPath, rejected)
+}
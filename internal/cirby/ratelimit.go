@@ -0,0 +1,122 @@
+package cirby
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBackoff caps the wait between retries without a server-given delay
+const maxBackoff = time.Minute
+
+// retryableStatus reports whether a response means "try again later":
+// rate limits and temporary overloads
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, 529: // 529: Anthropic "overloaded"
+		return true
+	}
+	return false
+}
+
+// sendWithRetry sends the request built by newRequest, waiting out rate
+// limits until deadline instead of failing the run. It returns the body of
+// the successful response.
+func sendWithRetry(client *http.Client, name string, newRequest func() (*http.Request, error), deadline time.Time, opts Options) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%s request failed: %w", name, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s response: %w", name, err)
+		}
+
+		if opts.Verbose {
+			if quota := describeQuota(resp.Header); quota != "" {
+				fmt.Fprintf(opts.stdout(), "  - %s quota left: %s\n", name, quota)
+			}
+		}
+		if resp.StatusCode/100 == 2 {
+			return data, nil
+		}
+		if !retryableStatus(resp.StatusCode) {
+			return nil, fmt.Errorf("%s API error (%s): %s", name, resp.Status, apiError(data))
+		}
+
+		wait := retryDelay(resp.Header, attempt, time.Now())
+		if time.Now().Add(wait).After(deadline) {
+			return nil, fmt.Errorf("%s is rate limited (%s) and would need %s more than --timeout allows: %s",
+				name, resp.Status, wait.Round(time.Second), apiError(data))
+		}
+		fmt.Fprintf(opts.stdout(), "  [warn] %s returned %s; retrying in %s (attempt %d)\n",
+			name, resp.Status, wait.Round(time.Second), attempt+1)
+		time.Sleep(wait)
+	}
+}
+
+// retryDelay is how long to wait before the next attempt: what the server
+// asked for in Retry-After or its rate limit reset headers, or else an
+// exponential backoff
+func retryDelay(h http.Header, attempt int, now time.Time) time.Duration {
+	var wait time.Duration
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			wait = time.Duration(secs) * time.Second
+		} else if t, err := http.ParseTime(v); err == nil {
+			wait = t.Sub(now)
+		}
+	}
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if len(values) == 0 || !strings.Contains(lower, "ratelimit") || !strings.Contains(lower, "reset") {
+			continue
+		}
+		// Anthropic sends RFC 3339 times, OpenAI durations such as "6m0s"
+		if t, err := time.Parse(time.RFC3339, values[0]); err == nil {
+			wait = max(wait, t.Sub(now))
+		} else if d, err := time.ParseDuration(values[0]); err == nil {
+			wait = max(wait, d)
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	return min(time.Duration(1<<min(attempt, 6))*time.Second, maxBackoff)
+}
+
+// describeQuota summarizes the remaining rate limit quota of a response,
+// for example "49/50 requests, 39,000/40,000 tokens"
+func describeQuota(h http.Header) string {
+	var parts []string
+	for _, kind := range []string{"requests", "tokens", "input-tokens", "output-tokens"} {
+		remaining := firstHeader(h, "anthropic-ratelimit-"+kind+"-remaining", "x-ratelimit-remaining-"+kind)
+		limit := firstHeader(h, "anthropic-ratelimit-"+kind+"-limit", "x-ratelimit-limit-"+kind)
+		r, err1 := strconv.Atoi(remaining)
+		l, err2 := strconv.Atoi(limit)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s/%s %s", formatCount(r), formatCount(l), strings.ReplaceAll(kind, "-", " ")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func firstHeader(h http.Header, names ...string) string {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,204 @@
+package cirby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteBlock names the marked block of AGENTS.md holding synced fragments
+const remoteBlock = "remote"
+
+// remoteFragment is one shared file pulled from the remote source
+type remoteFragment struct {
+	Path    string
+	Content string
+}
+
+// SyncRemote pulls the shared fragments configured in .cirby.yaml, places
+// them beneath the project-specific content of AGENTS.md and records the
+// synced revision in .cirby.lock
+func SyncRemote(opts Options) error {
+	if err := validateOutput(opts.output()); err != nil {
+		return err
+	}
+	agentsPath := opts.output()
+
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Remote == nil {
+		return fmt.Errorf(`no remote configured; add one to .cirby.yaml:
+
+  remote:
+    url: https://github.com/my-org/agent-guidelines.git
+    ref: main
+    paths: [AGENTS.md]`)
+	}
+	remote := *cfg.Remote
+	if isNetworkRef(remote.URL) {
+		if err := requireOnline("syncing "+remote.URL, opts); err != nil {
+			return err
+		}
+	}
+	if len(remote.Paths) == 0 {
+		remote.Paths = []string{"AGENTS.md"}
+	}
+
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "Fetching %s...\n", remote.URL)
+	}
+	fragments, revision, err := fetchRemote(remote)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", remote.URL, err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- Synced from %s at %s by `cirby sync-remote`; change it upstream, not here. -->\n", remote.URL, shortRevision(revision))
+	hashes := map[string]string{}
+	for _, f := range fragments {
+		b.WriteString("\n" + strings.TrimSpace(f.Content) + "\n")
+		hashes[f.Path] = hashString(f.Content)
+	}
+	block := strings.TrimRight(b.String(), "\n")
+
+	current, err := os.ReadFile(agentsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	existed := err == nil
+	updated := replaceBlock(string(current), remoteBlock, block)
+
+	lock, err := loadLock()
+	if err != nil {
+		return err
+	}
+	if updated == string(current) && lock.Remote != nil && lock.Remote.Revision == revision {
+		fmt.Fprintf(opts.stdout(), "[ok] %s is up to date with %s (%s)\n", agentsPath, remote.URL, shortRevision(revision))
+		return nil
+	}
+
+	if !opts.Force {
+		referenced := map[string]bool{filepath.ToSlash(agentsPath): true, lockFile: true}
+		if err := checkGitStatus(referenced, opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		if updated != string(current) {
+			fmt.Fprintf(opts.stdout(), "  - Update %d shared fragments in %s\n", len(fragments), agentsPath)
+		}
+		fmt.Fprintf(opts.stdout(), "  - Record revision %s in %s\n", shortRevision(revision), lockFile)
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	if updated != string(current) {
+		if err := writeFile(agentsPath, []byte(updated), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", agentsPath, err)
+		}
+		entry := historyEntry{Agent: "sync-remote", AgentsPath: agentsPath, HadAgentsMD: existed}
+		if err := recordHistory(entry, string(current)); err != nil {
+			return fmt.Errorf("recording history: %w", err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Updated %d shared fragments in %s\n", len(fragments), agentsPath)
+	}
+
+	lock.Remote = &remoteLock{
+		URL:       remote.URL,
+		Ref:       remote.Ref,
+		Revision:  revision,
+		SyncedAt:  time.Now().UTC(),
+		Fragments: hashes,
+	}
+	if err := saveLock(lock); err != nil {
+		return fmt.Errorf("writing %s: %w", lockFile, err)
+	}
+	if updated != string(current) {
+		if err := stampIntegrity(packageScope{Dir: ".", Output: agentsPath}, lockStamp{Backend: "sync-remote"}, opts); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Synced %s at %s\n", remote.URL, shortRevision(revision))
+	return nil
+}
+
+// isGitRemote reports whether url names a git repository rather than a
+// plain HTTPS location
+func isGitRemote(r remoteConfig) bool {
+	return r.Git || strings.HasSuffix(r.URL, ".git") || strings.HasPrefix(r.URL, "git@") ||
+		strings.HasPrefix(r.URL, "ssh://") || strings.HasPrefix(r.URL, "file://")
+}
+
+// fetchRemote returns the configured fragments and the revision they were
+// taken from: the commit for git remotes, a content hash otherwise
+func fetchRemote(r remoteConfig) ([]remoteFragment, string, error) {
+	if isGitRemote(r) {
+		return fetchGitRemote(r)
+	}
+
+	var fragments []remoteFragment
+	h := sha256.New()
+	for _, p := range r.Paths {
+		url := strings.TrimSuffix(r.URL, "/") + "/" + strings.TrimPrefix(p, "/")
+		data, err := fetchRemoteFile(url)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", url, err)
+		}
+		fragments = append(fragments, remoteFragment{Path: p, Content: string(data)})
+		fmt.Fprintf(h, "%s\x00%s\x00", p, data)
+	}
+	return fragments, "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fetchGitRemote(r remoteConfig) ([]remoteFragment, string, error) {
+	dir, err := os.MkdirTemp("", "cirby-remote-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if r.Ref != "" {
+		args = append(args, "--branch", r.Ref)
+	}
+	args = append(args, r.URL, dir)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		return nil, "", fmt.Errorf("git clone: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("reading revision: %w", err)
+	}
+
+	var fragments []remoteFragment
+	for _, p := range r.Paths {
+		clean := path.Clean("/" + p)[1:] // stay inside the checkout
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(clean)))
+		if err != nil {
+			return nil, "", fmt.Errorf("reading %s: %w", p, err)
+		}
+		if len(data) > maxConfigSize {
+			return nil, "", fmt.Errorf("%s is larger than %d bytes", p, maxConfigSize)
+		}
+		fragments = append(fragments, remoteFragment{Path: p, Content: string(data)})
+	}
+	return fragments, strings.TrimSpace(string(out)), nil
+}
+
+func shortRevision(revision string) string {
+	revision = strings.TrimPrefix(revision, "sha256:")
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
@@ -0,0 +1,502 @@
+package cirby
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Preview prints a Markdown file formatted for the terminal: the
+// canonical file by default, path if given, or standard input for "-".
+// With Raw the file is printed as is.
+func Preview(path string, opts Options) error {
+	if path == "" {
+		path = opts.output()
+	}
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(io.LimitReader(opts.stdin(), maxConfigSize))
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Raw {
+		_, err := opts.stdout().Write(data)
+		return err
+	}
+	fmt.Fprint(opts.stdout(), renderMarkdown(string(data), terminalWidth(), styleFor(opts.stdout(), opts)))
+	return nil
+}
+
+// markdownRenderer turns Markdown into wrapped, styled terminal text
+type markdownRenderer struct {
+	width int
+	color bool
+	style termStyle
+	out   []string
+}
+
+var (
+	orderedItem = regexp.MustCompile(`^(\d+)[.)]\s+(.*)$`)
+	tableRule   = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+	horizRule   = regexp.MustCompile(`^(\*\s*){3,}$|^(-\s*){3,}$|^(_\s*){3,}$`)
+)
+
+// renderMarkdown renders the common subset of Markdown used in agent
+// instructions: headings, paragraphs, lists, quotes, code and tables
+func renderMarkdown(src string, width int, style termStyle) string {
+	color := style.color
+	r := &markdownRenderer{width: width, color: color, style: style}
+	lines := splitLines(src)
+
+	// Frontmatter is shown as is
+	if len(lines) > 0 && lines[0] == "---" {
+		for i := 1; i < len(lines); i++ {
+			if lines[i] == "---" {
+				for _, l := range lines[:i+1] {
+					r.emit(paint(l, ansiDim, color))
+				}
+				r.blank()
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+
+		case strings.HasPrefix(trimmed, "<!--"):
+			// Comments, such as cirby's section markers, are not shown
+			for !strings.Contains(lines[i], "-->") && i+1 < len(lines) {
+				i++
+			}
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			if lang := strings.TrimSpace(strings.Trim(trimmed, "`~")); lang != "" {
+				r.emit("  " + paint(lang, ansiDim, color))
+			}
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				r.emit("    " + paint(lines[i], ansiCyan, color))
+			}
+			r.blank()
+
+		case strings.HasPrefix(trimmed, "#"):
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level > 6 || (len(trimmed) > level && trimmed[level] != ' ') {
+				i = r.paragraph(lines, i)
+				break
+			}
+			text := strings.TrimSpace(strings.TrimRight(trimmed[level:], "# "))
+			r.heading(level, text)
+
+		case horizRule.MatchString(trimmed):
+			r.emit(paint(strings.Repeat(style.glyph("─", "-"), min(r.width, 80)), ansiDim, color))
+			r.blank()
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			bar := paint(style.glyph("│ ", "> "), ansiDim, color)
+			for _, l := range r.wrap(strings.Join(quote, " "), r.width-2) {
+				r.emit(bar + l)
+			}
+			r.blank()
+
+		case isListItem(trimmed):
+			i = r.list(lines, i)
+
+		case strings.HasPrefix(trimmed, "|") && i+1 < len(lines) && tableRule.MatchString(strings.TrimSpace(lines[i+1])):
+			i = r.table(lines, i)
+
+		default:
+			i = r.paragraph(lines, i)
+		}
+	}
+
+	for len(r.out) > 0 && r.out[len(r.out)-1] == "" {
+		r.out = r.out[:len(r.out)-1]
+	}
+	return joinLines(r.out)
+}
+
+func (r *markdownRenderer) emit(line string) {
+	r.out = append(r.out, line)
+}
+
+// blank separates blocks with exactly one empty line
+func (r *markdownRenderer) blank() {
+	if len(r.out) > 0 && r.out[len(r.out)-1] != "" {
+		r.out = append(r.out, "")
+	}
+}
+
+func (r *markdownRenderer) heading(level int, text string) {
+	r.blank()
+	styled := r.inline(text)
+	if r.style.plain {
+		// As written, which screen readers announce as a heading level
+		r.emit(strings.Repeat("#", level) + " " + styled)
+		r.blank()
+		return
+	}
+	switch level {
+	case 1:
+		r.emit(paint(strings.ToUpper(stripANSI(styled)), ansiBold+ansiMagenta+ansiUnderline, r.color))
+	case 2:
+		r.emit(paint(stripANSI(styled), ansiBold+ansiMagenta, r.color))
+	default:
+		r.emit(paint(strings.Repeat("#", level)+" ", ansiDim, r.color) + paint(stripANSI(styled), ansiBold, r.color))
+	}
+	if !r.color && level <= 2 {
+		char := "="
+		if level == 2 {
+			char = "-"
+		}
+		r.emit(strings.Repeat(char, visibleWidth(styled)))
+	}
+	r.blank()
+}
+
+// paragraph renders the lines starting at i up to the next block, and
+// returns the index of its last line
+func (r *markdownRenderer) paragraph(lines []string, i int) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || (len(text) > 0 && startsBlock(trimmed)) {
+			break
+		}
+		text = append(text, trimmed)
+	}
+	for _, l := range r.wrap(strings.Join(text, " "), r.width) {
+		r.emit(l)
+	}
+	r.blank()
+	return i - 1
+}
+
+// list renders consecutive list items with their continuation lines
+func (r *markdownRenderer) list(lines []string, i int) int {
+	for i < len(lines) {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if !isListItem(trimmed) {
+			break
+		}
+		indent := (len(line) - len(strings.TrimLeft(line, " \t"))) / 2 * 2
+
+		bullet, text := r.style.glyph("•", "-"), ""
+		if m := orderedItem.FindStringSubmatch(trimmed); m != nil {
+			bullet, text = m[1]+".", m[2]
+		} else {
+			text = strings.TrimSpace(trimmed[1:])
+		}
+		switch {
+		case strings.HasPrefix(text, "[ ] "):
+			bullet, text = r.style.glyph("☐", "- [ ]"), text[4:]
+		case strings.HasPrefix(text, "[x] "), strings.HasPrefix(text, "[X] "):
+			bullet, text = r.style.glyph("☑", "- [x]"), text[4:]
+		}
+
+		// Lazy continuation lines belong to the item
+		for i+1 < len(lines) {
+			next := strings.TrimSpace(lines[i+1])
+			if next == "" || startsBlock(next) {
+				break
+			}
+			text += " " + next
+			i++
+		}
+
+		prefix := strings.Repeat(" ", indent) + paint(bullet, ansiYellow, r.color) + " "
+		hang := strings.Repeat(" ", indent+utf8.RuneCountInString(bullet)+1)
+		for n, l := range r.wrap(text, r.width-len(hang)) {
+			if n == 0 {
+				r.emit(prefix + l)
+			} else {
+				r.emit(hang + l)
+			}
+		}
+		i++
+		// A blank line between items keeps the list going
+		if i+1 < len(lines) && strings.TrimSpace(lines[i]) == "" && isListItem(strings.TrimSpace(lines[i+1])) {
+			i++
+		}
+	}
+	r.blank()
+	return i - 1
+}
+
+// table renders a pipe table with aligned columns
+func (r *markdownRenderer) table(lines []string, i int) int {
+	var rows [][]string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "|") {
+			break
+		}
+		if len(rows) == 1 && tableRule.MatchString(trimmed) {
+			continue
+		}
+		var cells []string
+		for _, cell := range splitTableRow(trimmed) {
+			cells = append(cells, r.inline(strings.TrimSpace(cell)))
+		}
+		rows = append(rows, cells)
+	}
+
+	var widths []int
+	for _, row := range rows {
+		for c, cell := range row {
+			if c >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[c] = max(widths[c], visibleWidth(cell))
+		}
+	}
+	sep := paint(r.style.glyph(" │ ", " | "), ansiDim, r.color)
+	for n, row := range rows {
+		var cells []string
+		for c := range widths {
+			cell := ""
+			if c < len(row) {
+				cell = row[c]
+			}
+			if n == 0 {
+				cell = paint(stripANSI(cell), ansiBold, r.color)
+			}
+			cells = append(cells, cell+strings.Repeat(" ", widths[c]-visibleWidth(cell)))
+		}
+		r.emit(strings.TrimRight(strings.Join(cells, sep), " "))
+		if n == 0 {
+			var rule []string
+			for _, w := range widths {
+				rule = append(rule, strings.Repeat(r.style.glyph("─", "-"), w))
+			}
+			r.emit(paint(strings.Join(rule, r.style.glyph("─┼─", "-+-")), ansiDim, r.color))
+		}
+	}
+	r.blank()
+	return i - 1
+}
+
+// splitTableRow splits a table row at unescaped pipes outside code spans
+func splitTableRow(row string) []string {
+	row = strings.TrimSuffix(strings.TrimPrefix(row, "|"), "|")
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case row[i] == '`':
+			inCode = !inCode
+			cell.WriteByte('`')
+		case row[i] == '|' && !inCode:
+			cells = append(cells, cell.String())
+			cell.Reset()
+		default:
+			cell.WriteByte(row[i])
+		}
+	}
+	return append(cells, cell.String())
+}
+
+func isListItem(trimmed string) bool {
+	if len(trimmed) >= 2 && strings.ContainsRune("-*+", rune(trimmed[0])) && trimmed[1] == ' ' {
+		return !horizRule.MatchString(trimmed)
+	}
+	return orderedItem.MatchString(trimmed)
+}
+
+// startsBlock reports whether a line ends the paragraph before it
+func startsBlock(trimmed string) bool {
+	return strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ">") ||
+		strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") ||
+		strings.HasPrefix(trimmed, "<!--") || strings.HasPrefix(trimmed, "|") ||
+		isListItem(trimmed) || horizRule.MatchString(trimmed)
+}
+
+// wrap styles text and breaks it into lines at most width wide
+func (r *markdownRenderer) wrap(text string, width int) []string {
+	width = max(width, 20)
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	for _, word := range strings.Fields(r.inlineWords(text)) {
+		w := visibleWidth(word)
+		if lineWidth > 0 && lineWidth+1+w > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			lineWidth = 0
+		}
+		if lineWidth > 0 {
+			line.WriteByte(' ')
+			lineWidth++
+		}
+		line.WriteString(word)
+		lineWidth += w
+	}
+	if lineWidth > 0 {
+		lines = append(lines, line.String())
+	}
+	return lines
+}
+
+// inlineWords styles text so that every word carries its own styles and
+// lines can be broken between any two words
+func (r *markdownRenderer) inlineWords(text string) string {
+	if !r.color {
+		return r.inline(text)
+	}
+	var b strings.Builder
+	for _, seg := range parseInline(text, "") {
+		words := strings.Fields(seg.text)
+		if len(words) == 0 {
+			b.WriteString(seg.text)
+			continue
+		}
+		if strings.HasPrefix(seg.text, " ") {
+			b.WriteByte(' ')
+		}
+		for n, w := range words {
+			if n > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(paint(w, seg.style, true))
+		}
+		if strings.HasSuffix(seg.text, " ") {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// inline styles text with its emphasis, code spans and links
+func (r *markdownRenderer) inline(text string) string {
+	var b strings.Builder
+	for _, seg := range parseInline(text, "") {
+		if !r.color && seg.style == ansiCyan {
+			b.WriteString("`" + seg.text + "`")
+			continue
+		}
+		b.WriteString(paint(seg.text, seg.style, r.color))
+	}
+	return b.String()
+}
+
+// inlineSegment is a run of text with a single style
+type inlineSegment struct {
+	text  string
+	style string
+}
+
+// parseInline splits text into styled segments, inheriting style
+func parseInline(text, style string) []inlineSegment {
+	var segs []inlineSegment
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			segs = append(segs, inlineSegment{plain.String(), style})
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		rest := text[i:]
+		switch {
+		case c == '\\' && i+1 < len(text) && strings.ContainsRune("\\`*_[]()#+-.!|<>", rune(text[i+1])):
+			plain.WriteByte(text[i+1])
+			i++
+			continue
+
+		case c == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[ticks:], rest[:ticks]); end >= 0 {
+				flush()
+				segs = append(segs, inlineSegment{strings.TrimSpace(rest[ticks : ticks+end]), ansiCyan})
+				i += 2*ticks + end - 1
+				continue
+			}
+
+		case strings.HasPrefix(rest, "<!--"):
+			if end := strings.Index(rest, "-->"); end >= 0 {
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if end := strings.Index(rest[2:], rest[:2]); end > 0 {
+				flush()
+				segs = append(segs, parseInline(rest[2:2+end], style+ansiBold)...)
+				i += end + 3
+				continue
+			}
+
+		case c == '*' || c == '_':
+			// Underscores inside words (snake_case) are not emphasis
+			if c == '_' && i > 0 && isWordByte(text[i-1]) {
+				break
+			}
+			end := strings.IndexByte(rest[1:], c)
+			if end > 0 && rest[1] != ' ' && (c == '*' || 2+end >= len(rest) || !isWordByte(rest[2+end])) {
+				flush()
+				segs = append(segs, parseInline(rest[1:1+end], style+ansiItalic)...)
+				i += end + 1
+				continue
+			}
+
+		case c == '[':
+			if close := strings.Index(rest, "]("); close > 0 {
+				if end := strings.IndexByte(rest[close:], ')'); end > 0 {
+					flush()
+					label, url := rest[1:close], rest[close+2:close+end]
+					segs = append(segs, parseInline(label, style+ansiBlue+ansiUnderline)...)
+					if url != label {
+						segs = append(segs, inlineSegment{" (" + url + ")", style + ansiDim})
+					}
+					i += close + end
+					continue
+				}
+			}
+		}
+		plain.WriteByte(c)
+	}
+	flush()
+	return segs
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+func stripANSI(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// visibleWidth is the number of terminal columns s takes up
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(stripANSI(s))
+}
@@ -0,0 +1,118 @@
+package cirby
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		width int
+		style termStyle
+		want  string
+	}{
+		{
+			name:  "headings",
+			in:    "# Project\n## Build ##\n### Tests\n",
+			width: 40,
+			want:  "PROJECT\n=======\n\nBuild\n-----\n\n### Tests\n",
+		},
+		{
+			name:  "paragraph wrapped to the width",
+			in:    "one two three four five six seven\neight nine ten\n",
+			width: 20,
+			want:  "one two three four\nfive six seven eight\nnine ten\n",
+		},
+		{
+			name:  "lists with continuation lines and tasks",
+			in:    "- first\n  continued\n\n- second\n  - nested\n1. ordered\n- [ ] todo\n- [x] done\n",
+			width: 40,
+			want:  "• first continued\n• second\n  • nested\n1. ordered\n☐ todo\n☑ done\n",
+		},
+		{
+			name:  "plain lists and headings",
+			in:    "# Title\n- [x] done\n* item\n",
+			width: 40,
+			style: termStyle{plain: true},
+			want:  "# Title\n\n- [x] done\n- item\n",
+		},
+		{
+			name:  "code block keeps its lines",
+			in:    "```go\nfunc main() {\n\tfmt.Println(\"**not bold**\")\n}\n```\nafter\n",
+			width: 20,
+			want:  "  go\n    func main() {\n    \tfmt.Println(\"**not bold**\")\n    }\n\nafter\n",
+		},
+		{
+			name:  "table with aligned columns",
+			in:    "| Command | Use |\n|---|:--|\n| `go test` | tests |\n| make a\\|b | pipes |\n",
+			width: 40,
+			want:  "Command   │ Use\n──────────┼──────\n`go test` │ tests\nmake a|b  │ pipes\n",
+		},
+		{
+			name:  "quote, rule and comments",
+			in:    "<!-- cirby:begin -->\n> quoted\n> text\n\n---\n\nend <!-- hidden -->\n",
+			width: 40,
+			style: termStyle{plain: true},
+			want:  "> quoted text\n\n" + strings.Repeat("-", 40) + "\n\nend\n",
+		},
+		{
+			name:  "inline markup without color",
+			in:    "Run **`make`** in *this* dir, see [docs](https://x.dev) and \\*stars\\*; keep snake_case_names.\n",
+			width: 200,
+			want:  "Run `make` in this dir, see docs (https://x.dev) and *stars*; keep snake_case_names.\n",
+		},
+		{
+			name:  "frontmatter is shown as is",
+			in:    "---\ndescription: Go rules\n---\n# Go\n",
+			width: 40,
+			want:  "---\ndescription: Go rules\n---\n\nGO\n==\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderMarkdown(tt.in, tt.width, tt.style)
+			if got != tt.want {
+				t.Errorf("renderMarkdown =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownColor(t *testing.T) {
+	got := renderMarkdown("## Build\nUse **go build** and `make`.\n", 40, termStyle{color: true})
+	for _, want := range []string{
+		paint("Build", ansiBold+ansiMagenta, true),
+		paint("go", ansiBold, true) + " " + paint("build", ansiBold, true),
+		paint("make", ansiCyan, true),
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderMarkdown =\n%q\nwant it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "-----") {
+		t.Errorf("renderMarkdown underlined a heading with color on:\n%s", got)
+	}
+	if lines := strings.Split(stripANSI(got), "\n"); lines[0] != "Build" || lines[2] != "Use go build and make." {
+		t.Errorf("renderMarkdown without escapes =\n%s", stripANSI(got))
+	}
+}
+
+func TestSplitTableRow(t *testing.T) {
+	tests := []struct {
+		row  string
+		want []string
+	}{
+		{"| a | b |", []string{" a ", " b "}},
+		{"a|b", []string{"a", "b"}},
+		{"| `x | y` | z |", []string{" `x | y` ", " z "}},
+		{`| a \| b | c |`, []string{" a | b ", " c "}},
+	}
+	for _, tt := range tests {
+		got := splitTableRow(tt.row)
+		if strings.Join(got, "¦") != strings.Join(tt.want, "¦") {
+			t.Errorf("splitTableRow(%q) = %q, want %q", tt.row, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// replayDir holds the results of cirby replay, one directory per run and
+// agent
+const replayDir = ".cirby/replay"
+
+// Replay sends the prompt of a recorded run again, with the agent that
+// made it or another one. The agent works on a copy of the sources and
+// AGENTS.md as they were before that run, in .cirby/replay/<run>-<agent>,
+// so the project is left alone; the result is shown next to the recorded
+// one.
+func Replay(id, agentName string, opts Options) error {
+	if id == "" {
+		return fmt.Errorf("usage: cirby replay <run> [agent]; see `cirby history` for runs")
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	var entry *historyEntry
+	for i := range entries {
+		if entries[i].ID == id {
+			entry = &entries[i]
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("no recorded run %s; see `cirby history`", id)
+	}
+	runDir := filepath.Join(historyDir(), entry.ID)
+	prompt, err := os.ReadFile(filepath.Join(runDir, "prompt.md"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("run %s has no saved prompt; only merges by an agent keep one", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if agentName == "" {
+		if _, ok := findAgent(entry.Agent); !ok {
+			return fmt.Errorf("run %s was not merged by an agent; name one: cirby replay %s <agent>", id, id)
+		}
+		agentName = entry.Agent
+	}
+	opts.Agent = agentName
+	agent, err := selectAgent(opts)
+	if err != nil {
+		return err
+	}
+
+	sandbox := filepath.Join(replayDir, entry.ID+"-"+agent.Name)
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		fmt.Fprintf(opts.stdout(), "  - Restore the %d sources and %s of run %s in %s\n", len(entry.Inputs), entry.AgentsPath, id, sandbox)
+		fmt.Fprintf(opts.stdout(), "  - Send its saved prompt (~%s tokens) to %s\n", formatCount(estimateTokens(string(prompt))), agent.Name)
+		return nil
+	}
+
+	files, err := restoreRun(*entry, sandbox)
+	if err != nil {
+		return fmt.Errorf("preparing %s: %w", sandbox, err)
+	}
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(sandbox); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.stdout(), "Replaying run %s with %s...\n", id, agent.Name)
+	err = executeAgent(agent, string(prompt), entry.AgentsPath, files, opts)
+	if cdErr := os.Chdir(root); cdErr != nil {
+		return fmt.Errorf("returning to %s: %w", root, cdErr)
+	}
+	if err != nil {
+		return fmt.Errorf("replaying run %s with %s: %w", id, agent.Name, err)
+	}
+
+	resultPath := filepath.Join(sandbox, entry.AgentsPath)
+	result, err := os.ReadFile(resultPath)
+	if err != nil {
+		return fmt.Errorf("%s did not write %s", agent.Name, entry.AgentsPath)
+	}
+	recorded, err := os.ReadFile(filepath.Join(runDir, "after.md"))
+	if err != nil {
+		return err
+	}
+	recordedLabel := fmt.Sprintf("run %s (%s)", id, entry.Agent)
+	fmt.Fprintln(opts.stdout())
+	fmt.Fprint(opts.stdout(), sideBySide(recordedLabel, resultPath, splitLines(string(recorded)), splitLines(string(result)), terminalWidth(), styleFor(opts.stdout(), opts)))
+	fmt.Fprintln(opts.stdout(), "\nQuality:")
+	for _, r := range []struct{ label, content string }{{"recorded", string(recorded)}, {agent.Name, string(result)}} {
+		score := scoreMerge(files, r.content)
+		fmt.Fprintf(opts.stdout(), "  %-10s %3d/100  %s\n", r.label, score.Score, score)
+	}
+	fmt.Fprintf(opts.stdout(), "\n[ok] Replayed run %s with %s into %s; %s is unchanged\n", id, agent.Name, resultPath, entry.AgentsPath)
+	return nil
+}
+
+// restoreRun recreates the sources and AGENTS.md a run started from in
+// dir, along with .cirby.yaml, and returns the sources
+func restoreRun(entry historyEntry, dir string) ([]AgentConfig, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(replayDir, 0755); err != nil {
+		return nil, err
+	}
+	// Scratch copies, keep them out of commits
+	if err := os.WriteFile(filepath.Join(replayDir, ".gitignore"), []byte("*\n"), 0644); err != nil {
+		return nil, err
+	}
+	write := func(path string, data []byte) error {
+		target := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	}
+
+	var files []AgentConfig
+	for _, in := range entry.Inputs {
+		if in.Symlink != "" {
+			target := filepath.Join(dir, in.Path)
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return nil, err
+			}
+			if err := os.Symlink(in.Symlink, target); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := write(in.Path, []byte(in.Content)); err != nil {
+			return nil, err
+		}
+		files = append(files, AgentConfig{Path: in.Path, Content: in.Content})
+	}
+	if entry.HadAgentsMD {
+		before, err := os.ReadFile(filepath.Join(historyDir(), entry.ID, "before.md"))
+		if err != nil {
+			return nil, err
+		}
+		if err := write(entry.AgentsPath, before); err != nil {
+			return nil, err
+		}
+	}
+	// Scrubbing, agent overrides and logging settings apply in the copy too
+	for _, name := range projectConfigFiles {
+		if data, err := os.ReadFile(name); err == nil {
+			if err := write(name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,179 @@
+package cirby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Report formats of --report, with the file each writes by default
+var reportFiles = map[string]string{
+	"junit":       "cirby-junit.xml",
+	"codequality": "gl-code-quality-report.json",
+}
+
+// checkResult is the outcome of one check on one file
+type checkResult struct {
+	Path     string `json:"path"`
+	Rule     string `json:"rule,omitempty"`     // what failed, e.g. "stale"; "" when the file passed
+	Severity string `json:"severity,omitempty"` // "error" or "warning"; "" when the file passed
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"` // 0 when the result is about the whole file
+}
+
+// reportResults publishes the results of a check: as GitHub Actions
+// annotations and job summary, and as the --report file
+func reportResults(name string, results []checkResult, opts Options) error {
+	summary := fmt.Sprintf("### %s\n\n| File | Result |\n|------|--------|\n", name)
+	for _, r := range results {
+		switch r.Severity {
+		case "":
+			summary += fmt.Sprintf("| `%s` | %s |\n", r.Path, r.Message)
+		case "warning":
+			annotate("warning", r.Path, r.Message, opts)
+			summary += fmt.Sprintf("| `%s` | %s (warning) |\n", r.Path, r.Message)
+		default:
+			annotate("error", r.Path, r.Message, opts)
+			summary += fmt.Sprintf("| `%s` | **%s** |\n", r.Path, r.Message)
+		}
+	}
+	if err := writeJobSummary(summary); err != nil {
+		return err
+	}
+	notifyChecks(name, results, opts)
+	recordChecks(name, results, opts)
+	return writeReport(name, results, opts)
+}
+
+// parseReport splits --report FORMAT[=FILE] into format and file, for
+// the formats of files
+func parseReport(spec string, files map[string]string) (format, file string, err error) {
+	format, file, _ = strings.Cut(spec, "=")
+	def, ok := files[format]
+	if !ok {
+		formats := make([]string, 0, len(files))
+		for f := range files {
+			formats = append(formats, f)
+		}
+		sort.Strings(formats)
+		return "", "", fmt.Errorf("invalid --report %q: use %s, optionally =FILE", spec, strings.Join(formats, " or "))
+	}
+	if file == "" {
+		file = def
+	}
+	return format, file, nil
+}
+
+// writeReport writes results in the format of --report, if set
+func writeReport(name string, results []checkResult, opts Options) error {
+	if opts.Report == "" {
+		return nil
+	}
+	format, file, err := parseReport(opts.Report, reportFiles)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if format == "junit" {
+		data, err = junitReport(name, results)
+	} else {
+		data, err = codeQualityReport(name, results)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  - Wrote %s report to %s\n", format, file)
+	}
+	return nil
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitReport has one test case per file; warnings pass, with the warning
+// as output
+func junitReport(name string, results []checkResult) ([]byte, error) {
+	suite := junitSuite{Name: name, Tests: len(results)}
+	for _, r := range results {
+		c := junitCase{Name: r.Path, ClassName: strings.ReplaceAll(name, " ", ".")}
+		if r.Line > 0 {
+			c.Name = fmt.Sprintf("%s:%d", r.Path, r.Line)
+		}
+		switch r.Severity {
+		case "error":
+			c.Failure = &junitFailure{Type: r.Rule, Message: r.Message, Text: r.Path + ": " + r.Message}
+			suite.Failures++
+		case "warning":
+			c.SystemOut = "warning: " + r.Message
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// codeQualityIssue is an entry of a GitLab Code Quality report
+type codeQualityIssue struct {
+	Description string `json:"description"`
+	CheckName   string `json:"check_name"`
+	Fingerprint string `json:"fingerprint"`
+	Severity    string `json:"severity"`
+	Location    struct {
+		Path  string `json:"path"`
+		Lines struct {
+			Begin int `json:"begin"`
+		} `json:"lines"`
+	} `json:"location"`
+}
+
+// codeQualityReport lists the failures and warnings; files that passed
+// are left out
+func codeQualityReport(name string, results []checkResult) ([]byte, error) {
+	issues := []codeQualityIssue{}
+	for _, r := range results {
+		if r.Severity == "" {
+			continue
+		}
+		issue := codeQualityIssue{Description: r.Message, CheckName: "cirby-" + r.Rule, Severity: "major"}
+		if r.Severity == "warning" {
+			issue.Severity = "minor"
+		}
+		sum := sha256.Sum256([]byte(name + "\x00" + r.Path + "\x00" + r.Rule + "\x00" + r.Message))
+		issue.Fingerprint = hex.EncodeToString(sum[:16])
+		issue.Location.Path = r.Path
+		issue.Location.Lines.Begin = max(r.Line, 1)
+		issues = append(issues, issue)
+	}
+	data, err := json.MarshalIndent(issues, "", "  ")
+	return append(data, '\n'), err
+}
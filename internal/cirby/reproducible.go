@@ -0,0 +1,72 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// warnReproducible says when --reproducible cannot make agent deterministic.
+// API backends get fixed sampling parameters and builtin merges are
+// deterministic anyway, but none of the agent CLIs take a temperature or
+// seed.
+func warnReproducible(agent SupportedAgent, opts Options) {
+	if !opts.Reproducible || agent.API != nil || agent.Merge != nil {
+		return
+	}
+	fmt.Fprintf(opts.stdout(), "[warn] %s has no option for deterministic output; only formatting is normalized (use an API backend or builtin for identical results)\n", agent.Name)
+}
+
+// normalizeMerge rewrites a merge result in one canonical form with
+// --reproducible, so results that only differ in whitespace are identical
+func normalizeMerge(agentsPath string, opts Options) error {
+	if !opts.Reproducible {
+		return nil
+	}
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	normalized := normalizeMarkdown(string(data))
+	if normalized == string(data) {
+		return nil
+	}
+	return writeFile(agentsPath, []byte(normalized), 0644)
+}
+
+// normalizeMarkdown uses LF line endings, drops trailing whitespace and
+// repeated blank lines outside code blocks, puts a blank line around
+// headings and ends the file with a single newline
+func normalizeMarkdown(content string) string {
+	var out []string
+	inFence, afterHeading := false, false
+	for _, line := range splitLines(content) {
+		trimmed := strings.TrimSpace(line)
+		fence := strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")
+		if inFence && !fence {
+			out = append(out, line)
+			continue
+		}
+		line = strings.TrimRight(line, " \t")
+		heading, _ := markdownHeading(line, false)
+		blank := line == ""
+		last := len(out) - 1
+		switch {
+		case blank && (last < 0 || out[last] == ""):
+			continue
+		case heading && last >= 0 && out[last] != "":
+			out = append(out, "")
+		case !blank && afterHeading:
+			out = append(out, "")
+		}
+		out = append(out, line)
+		afterHeading = heading
+		if fence {
+			inFence = !inFence
+		}
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return joinLines(out)
+}
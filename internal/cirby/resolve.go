@@ -0,0 +1,290 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// optionSetting is a run option that may be set, from highest precedence
+// to lowest, by a flag, a CIRBY_<KEY> environment variable, the defaults:
+// section of .cirby.yaml, the same section of the global config, or its
+// default:
+//
+//	defaults:
+//	  agent: claude
+//	  model: claude-sonnet-4-5
+//	  link_mode: copy
+//	  timeout: 5m
+type optionSetting struct {
+	Key     string // in defaults:; the flag is the same with dashes
+	Default string
+	set     func(o *Options, value string) error
+	get     func(o Options) string
+}
+
+// settingOrigin is where the value of a setting came from
+type settingOrigin struct {
+	Key    string
+	Value  string
+	Origin string // "flag", "env CIRBY_MODEL", a config file, or "default"
+}
+
+func stringOption(key, def string, field func(o *Options) *string) optionSetting {
+	return optionSetting{
+		Key:     key,
+		Default: def,
+		set:     func(o *Options, v string) error { *field(o) = v; return nil },
+		get:     func(o Options) string { return *field(&o) },
+	}
+}
+
+func boolOption(key string, field func(o *Options) *bool) optionSetting {
+	return optionSetting{
+		Key:     key,
+		Default: "false",
+		set: func(o *Options, v string) error {
+			// yes and on as in the rest of .cirby.yaml, and 1 for CIRBY_*
+			// variables
+			b, ok := yamlBool(v)
+			if !ok {
+				var err error
+				if b, err = strconv.ParseBool(v); err != nil {
+					return fmt.Errorf("%s must be true or false", key)
+				}
+			}
+			*field(o) = b
+			return nil
+		},
+		get: func(o Options) string { return strconv.FormatBool(*field(&o)) },
+	}
+}
+
+// optionSettings are the options resolveOptions fills in
+var optionSettings = []optionSetting{
+	stringOption("agent", "", func(o *Options) *string { return &o.Agent }),
+	stringOption("model", "", func(o *Options) *string { return &o.Model }),
+	{
+		Key:     "link_mode",
+		Default: LinkSymlink,
+		set: func(o *Options, v string) error {
+			o.LinkMode = v
+			return validateLinkMode(v)
+		},
+		get: func(o Options) string { return o.LinkMode },
+	},
+	{
+		Key:     "line_endings",
+		Default: lineEndingsAuto,
+		set: func(o *Options, v string) error {
+			o.LineEndings = v
+			return validateLineEndings(v)
+		},
+		get: func(o Options) string { return o.LineEndings },
+	},
+	stringOption("output", "AGENTS.md", func(o *Options) *string { return &o.Output }),
+	stringOption("template", "", func(o *Options) *string { return &o.Template }),
+	stringOption("max_length", "", func(o *Options) *string { return &o.MaxLength }),
+	{
+		Key:     "timeout",
+		Default: defaultAPITimeout.String(),
+		set: func(o *Options, v string) error {
+			timeout, err := time.ParseDuration(v)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("timeout must be a duration such as 90s or 10m")
+			}
+			o.Timeout = timeout
+			return nil
+		},
+		get: func(o Options) string {
+			if o.Timeout <= 0 {
+				return defaultAPITimeout.String()
+			}
+			return o.Timeout.String()
+		},
+	},
+	{
+		Key:     "max_cost",
+		Default: "0",
+		set: func(o *Options, v string) error {
+			cost, err := strconv.ParseFloat(strings.TrimPrefix(v, "$"), 64)
+			if err != nil || cost < 0 {
+				return fmt.Errorf("max_cost must be an amount in USD such as 0.50")
+			}
+			o.MaxCost = cost
+			return nil
+		},
+		get: func(o Options) string { return strconv.FormatFloat(o.MaxCost, 'f', -1, 64) },
+	},
+	boolOption("offline", func(o *Options) *bool { return &o.Offline }),
+	boolOption("strict", func(o *Options) *bool { return &o.Strict }),
+	boolOption("fail_on_secrets", func(o *Options) *bool { return &o.FailOnSecrets }),
+	boolOption("reproducible", func(o *Options) *bool { return &o.Reproducible }),
+	boolOption("no_header", func(o *Options) *bool { return &o.NoHeader }),
+	boolOption("no_cache", func(o *Options) *bool { return &o.NoCache }),
+	boolOption("plain", func(o *Options) *bool { return &o.Plain }),
+}
+
+// globalConfigPath is the config shared by every project of the user
+func globalConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cirby", "config.yaml"), nil
+}
+
+// configLayer is the defaults: section of one config file
+type configLayer struct {
+	Path   string
+	Values map[string]string
+}
+
+// loadDefaults reads the defaults: section of the first of paths that
+// exists. Only that section is parsed, so a mistake elsewhere in the file
+// is reported by the command that uses it.
+func loadDefaults(paths ...string) (configLayer, error) {
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return configLayer{}, err
+		}
+		parsed, err := parseYAML(data)
+		if err != nil {
+			return configLayer{}, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		doc, _ := parsed.(map[string]any)
+		layer := configLayer{Path: path, Values: map[string]string{}}
+		defaults, _ := doc["defaults"].(map[string]any)
+		for key, value := range defaults {
+			if !slices.ContainsFunc(optionSettings, func(s optionSetting) bool { return s.Key == key }) {
+				return configLayer{}, fmt.Errorf("%s: unknown setting defaults.%s", path, key)
+			}
+			if s, ok := value.(string); ok {
+				layer.Values[key] = s
+			}
+		}
+		return layer, nil
+	}
+	return configLayer{}, nil
+}
+
+// configLayers are the project and global config, highest precedence
+// first
+func configLayers() ([]configLayer, error) {
+	project, err := loadDefaults(projectConfigFiles...)
+	if err != nil {
+		return nil, err
+	}
+	layers := []configLayer{project}
+	if path, err := globalConfigPath(); err == nil {
+		global, err := loadDefaults(path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, global)
+	}
+	return layers, nil
+}
+
+// ResolveOptions fills in every option not given as a flag (those named
+// in opts.Flags) from the environment, .cirby.yaml, the global config or
+// its default, and makes opts.Root (the current directory unless set) the
+// project the run's changes are audited and logged against
+func ResolveOptions(opts Options) (Options, error) {
+	opts, _, err := resolveOptions(opts)
+	if err != nil {
+		return opts, err
+	}
+	if opts.Root == "" {
+		if opts.Root, err = os.Getwd(); err != nil {
+			return opts, err
+		}
+	}
+	setProjectRoot(opts.Root)
+	return opts, nil
+}
+
+// resolveOptions is ResolveOptions, also reporting where each value came
+// from
+func resolveOptions(opts Options) (Options, []settingOrigin, error) {
+	layers, err := configLayers()
+	if err != nil {
+		return opts, nil, err
+	}
+	var origins []settingOrigin
+	for _, s := range optionSettings {
+		origin := "default"
+		if slices.Contains(opts.Flags, strings.ReplaceAll(s.Key, "_", "-")) {
+			origin = "flag"
+		} else {
+			value, found := s.Default, false
+			env := "CIRBY_" + strings.ToUpper(s.Key)
+			if v, ok := os.LookupEnv(env); ok {
+				value, origin, found = v, "env "+env, true
+			}
+			for _, layer := range layers {
+				if v, ok := layer.Values[s.Key]; ok && !found {
+					value, origin, found = v, layer.Path, true
+				}
+			}
+			if err := s.set(&opts, value); err != nil {
+				return opts, nil, fmt.Errorf("%s: %w", origin, err)
+			}
+		}
+		origins = append(origins, settingOrigin{Key: s.Key, Value: s.get(opts), Origin: origin})
+	}
+	return opts, origins, nil
+}
+
+// Config shows the config files cirby reads, or with `show --resolved`
+// the value of every option and where it came from
+func Config(action string, opts Options) error {
+	if action != "show" {
+		return fmt.Errorf("usage: cirby config show [--resolved]")
+	}
+	if opts.Resolved {
+		_, origins, err := resolveOptions(opts)
+		if err != nil {
+			return err
+		}
+		for _, o := range origins {
+			value := o.Value
+			if value == "" {
+				value = "(none)"
+			}
+			fmt.Fprintf(opts.stdout(), "%-16s %-24s %s\n", o.Key, value, o.Origin)
+		}
+		return nil
+	}
+	layers, err := configLayers()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(opts.stdout(), "Precedence: flags > CIRBY_* environment > .cirby.yaml > global config > defaults")
+	for i, layer := range layers {
+		name := [...]string{"Project", "Global"}[i]
+		if layer.Path == "" {
+			where := strings.Join(projectConfigFiles, " or ")
+			if i > 0 {
+				where, _ = globalConfigPath()
+			}
+			fmt.Fprintf(opts.stdout(), "%s: none (%s)\n", name, where)
+			continue
+		}
+		fmt.Fprintf(opts.stdout(), "%s: %s\n", name, layer.Path)
+		for _, s := range optionSettings {
+			if v, ok := layer.Values[s.Key]; ok {
+				fmt.Fprintf(opts.stdout(), "  %s: %s\n", s.Key, v)
+			}
+		}
+	}
+	return nil
+}
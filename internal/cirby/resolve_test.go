@@ -0,0 +1,33 @@
+package cirby
+
+import "testing"
+
+func TestResolveBoolOption(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+		err  bool
+	}{
+		{in: "true", want: true},
+		{in: "yes", want: true},
+		{in: "On", want: true},
+		{in: "1", want: true},
+		{in: "off", want: false},
+		{in: "no", want: false},
+		{in: "0", want: false},
+		{in: "maybe", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			testProject(t, nil)
+			t.Setenv("CIRBY_STRICT", tt.in)
+			opts, _, err := resolveOptions(Options{})
+			if (err != nil) != tt.err {
+				t.Fatalf("CIRBY_STRICT=%s: err = %v", tt.in, err)
+			}
+			if err == nil && opts.Strict != tt.want {
+				t.Errorf("CIRBY_STRICT=%s: strict = %v, want %v", tt.in, opts.Strict, tt.want)
+			}
+		})
+	}
+}
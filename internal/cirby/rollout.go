@@ -0,0 +1,368 @@
+package cirby
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rolloutBranch is the branch cirby rollout commits the merge to
+const rolloutBranch = "cirby/agents-md"
+
+// rolloutRepo is one line of the --repos list
+type rolloutRepo struct {
+	Owner, Name string
+	URL         string // cloned from
+}
+
+func (r rolloutRepo) String() string { return r.Owner + "/" + r.Name }
+
+// parseRolloutRepos reads --repos: one repository per line, as owner/name,
+// as a name in --org, or as a clone URL. # starts a comment.
+func parseRolloutRepos(data []byte, org string) ([]rolloutRepo, error) {
+	server := strings.TrimSuffix(envOr("GITHUB_SERVER_URL", "https://github.com"), "/")
+	var repos []rolloutRepo
+	for i, line := range splitLines(string(data)) {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		var r rolloutRepo
+		if strings.Contains(line, "://") || strings.HasPrefix(line, "git@") {
+			r.URL = line
+			dir, name := path.Split(strings.TrimSuffix(strings.ReplaceAll(line, ":", "/"), ".git"))
+			r.Owner, r.Name = path.Base(dir), name
+		} else {
+			r.Owner, r.Name, _ = strings.Cut(line, "/")
+			if r.Name == "" {
+				r.Owner, r.Name = org, line
+			}
+			r.URL = fmt.Sprintf("%s/%s/%s.git", server, r.Owner, r.Name)
+		}
+		if r.Owner == "" || r.Name == "" || strings.Contains(r.Name, "/") {
+			return nil, fmt.Errorf("--repos line %d: %q is not owner/name, a name in --org, or a clone URL", i+1, line)
+		}
+		repos = append(repos, r)
+	}
+	if len(repos) == 0 {
+		return nil, fmt.Errorf("--repos lists no repositories")
+	}
+	return repos, nil
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Rollout merges the agent configs of many repositories: each is cloned to
+// a temporary directory and merged without prompts, and the result is
+// committed on rolloutBranch, pushed, and proposed as a pull request.
+func Rollout(opts Options) error {
+	if opts.Repos == "" {
+		return fmt.Errorf("usage: cirby rollout --repos list.txt [--org org] [agent]")
+	}
+	if err := requireOnline("cirby rollout", opts); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(opts.Repos)
+	if err != nil {
+		return fmt.Errorf("reading --repos: %w", err)
+	}
+	repos, err := parseRolloutRepos(data, opts.Org)
+	if err != nil {
+		return err
+	}
+	token := envOr("GITHUB_TOKEN", os.Getenv("GH_TOKEN"))
+	if token == "" && !opts.DryRun {
+		return fmt.Errorf("cirby rollout opens pull requests with GITHUB_TOKEN or GH_TOKEN; set one")
+	}
+
+	// One agent for every repository, and nothing that waits for an answer
+	agent, err := selectAgent(opts)
+	if err != nil {
+		return err
+	}
+	opts.Agent = agent.Name
+	opts.Interactive, opts.Review, opts.Edit = false, false, false
+
+	var results []targetResult
+	for i, repo := range repos {
+		fmt.Fprintf(opts.stdout(), "\n== [%d/%d] %s ==\n", i+1, len(repos), repo)
+		repoResults, err := rolloutOne(repo, token, opts)
+		for _, r := range repoResults {
+			r.Target = repo.String() + "/" + r.Target
+			results = append(results, r)
+		}
+		if err != nil {
+			fmt.Fprintf(opts.stdout(), "[error] %s: %v\n", repo, err)
+			if len(repoResults) == 0 {
+				results = append(results, targetResult{Target: repo.String(), Outcome: outcomeFailed, Error: err.Error()})
+			}
+		}
+	}
+	return finishBatch("cirby rollout", results, opts)
+}
+
+// rolloutOne clones, merges, commits and proposes one repository
+func rolloutOne(repo rolloutRepo, token string, opts Options) ([]targetResult, error) {
+	dir, err := os.MkdirTemp("", "cirby-rollout-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	auth := gitTokenEnv(token)
+	if err := rolloutGit("", auth, "clone", "--quiet", "--depth", "1", repo.URL, dir); err != nil {
+		return nil, err
+	}
+	base, err := exec.Command("git", "-C", dir, "symbolic-ref", "--short", "HEAD").Output()
+	if err != nil {
+		return nil, fmt.Errorf("reading the default branch: %w", err)
+	}
+	if err := rolloutGit(dir, auth, "checkout", "--quiet", "-b", rolloutBranch); err != nil {
+		return nil, err
+	}
+
+	results, err := rolloutMerge(dir, opts)
+	if err != nil {
+		return results, err
+	}
+	for _, r := range results {
+		if r.Outcome == outcomeFailed {
+			return results, fmt.Errorf("%s: %s", r.Target, r.Error)
+		}
+	}
+
+	if opts.DryRun {
+		for _, r := range results {
+			if r.Outcome == outcomeWould {
+				fmt.Fprintf(opts.stdout(), "  - Would commit on %s, push, and open a pull request against %s\n", rolloutBranch, strings.TrimSpace(string(base)))
+				break
+			}
+		}
+		return results, nil
+	}
+	changed, err := rolloutChanges(dir)
+	if err != nil {
+		return results, err
+	}
+	if len(changed) == 0 {
+		fmt.Fprintf(opts.stdout(), "[skip] %s: nothing to change\n", repo)
+		return results, nil
+	}
+
+	title := "Adopt AGENTS.md as the shared agent instructions"
+	if err := rolloutGit(dir, auth, append([]string{"add", "-A", "--"}, changed...)...); err != nil {
+		return results, err
+	}
+	if err := rolloutGit(dir, auth, "commit", "--quiet", "-m", title, "-m", "Merged with `cirby "+opts.Agent+"` by cirby rollout."); err != nil {
+		return results, err
+	}
+	if err := rolloutGit(dir, auth, "push", "--quiet", "--set-upstream", "origin", rolloutBranch); err != nil {
+		return results, err
+	}
+	body := fmt.Sprintf("Merges this repository's agent config files into `AGENTS.md` and links each tool's file to it, using `cirby %s`.\n\n%s\nOpened by `cirby rollout`.\n", opts.Agent, batchTable(results, termStyle{}))
+	url, err := openPullRequest(repo, token, title, body, strings.TrimSpace(string(base)))
+	if err != nil {
+		return results, err
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Opened %s\n", url)
+	return results, nil
+}
+
+// rolloutMerge runs `cirby merge` in dir as a child process, so the clone
+// is merged in its own working directory with its own .cirby.yaml, and
+// returns the outcome of each target from the child's JSON report
+func rolloutMerge(dir string, opts Options) ([]targetResult, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	report, err := os.CreateTemp("", "cirby-rollout-*.json")
+	if err != nil {
+		return nil, err
+	}
+	report.Close()
+	defer os.Remove(report.Name())
+
+	cmd := exec.Command(exe, rolloutArgs(report.Name(), opts)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), rolloutEnv(opts)...)
+	cmd.Stdin = strings.NewReader("")
+	cmd.Stdout = opts.stdout()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	var results []targetResult
+	if data, err := os.ReadFile(report.Name()); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &results); err != nil {
+			return nil, fmt.Errorf("reading the merge report: %w", err)
+		}
+	}
+	if runErr != nil && len(results) == 0 {
+		if msg := strings.TrimPrefix(strings.TrimSpace(stderr.String()), "Error: "); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, runErr
+	}
+	return results, nil
+}
+
+// rolloutArgs are the arguments of the merge in each clone: the agent and
+// the merge flags given to cirby rollout. Interactive ones are left out,
+// as nobody is there to answer.
+func rolloutArgs(report string, opts Options) []string {
+	args := []string{"merge", "--agent", opts.Agent, "--report", "json=" + report}
+	for _, f := range []struct {
+		name string
+		on   bool
+	}{
+		{"dry-run", opts.DryRun},
+		{"verbose", opts.Verbose},
+		{"force", opts.Force},
+		{"recursive", opts.Recursive},
+		{"full", opts.FullMerge},
+		{"no-sections", opts.NoSections},
+		{"dedup", opts.Dedup},
+	} {
+		if f.on {
+			args = append(args, "--"+f.name)
+		}
+	}
+	if opts.Temperature != nil {
+		args = append(args, "--temperature", strconv.FormatFloat(*opts.Temperature, 'f', -1, 64))
+	}
+	if opts.MaxTokens > 0 {
+		args = append(args, "--max-tokens", strconv.Itoa(opts.MaxTokens))
+	}
+	if opts.ReasoningEffort != "" {
+		args = append(args, "--reasoning-effort", opts.ReasoningEffort)
+	}
+	if len(opts.AgentArgs) > 0 {
+		args = append(append(args, "--"), opts.AgentArgs...)
+	}
+	return args
+}
+
+// rolloutEnv passes the options given as flags to cirby rollout on to
+// each merge as CIRBY_* variables. Defaults from the .cirby.yaml where
+// rollout ran are not passed: each repository's own apply.
+func rolloutEnv(opts Options) []string {
+	var env []string
+	for _, s := range optionSettings {
+		if s.Key != "agent" && slices.Contains(opts.Flags, strings.ReplaceAll(s.Key, "_", "-")) {
+			env = append(env, "CIRBY_"+strings.ToUpper(s.Key)+"="+s.get(opts))
+		}
+	}
+	return env
+}
+
+// rolloutChanges returns the files the merge changed in dir, among those
+// cirby writes: each canonical file, its sources and .cirby.lock. Nothing
+// else in the clone, such as a metrics file, is committed.
+func rolloutChanges(dir string) ([]string, error) {
+	lock, err := readLock(filepath.Join(dir, lockFile))
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]bool{lockFile: true}
+	for target, entry := range lock.Agents {
+		owned[target] = true
+		for source := range entry.Sources {
+			owned[source] = true
+		}
+	}
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain", "-z", "--untracked-files=all").Output()
+	if err != nil {
+		return nil, fmt.Errorf("checking git status: %w", err)
+	}
+	var changed []string
+	for _, entry := range strings.Split(string(status), "\x00") {
+		if len(entry) > 3 && owned[entry[3:]] {
+			changed = append(changed, entry[3:])
+		}
+	}
+	return changed, nil
+}
+
+// gitTokenEnv has git send token to the GitHub server over HTTPS, so the
+// same token that opens pull requests clones and pushes. It is passed as
+// environment configuration rather than arguments, which other users can
+// see, and only for GITHUB_SERVER_URL: SSH and other hosts use their own
+// credentials.
+func gitTokenEnv(token string) []string {
+	if token == "" {
+		return nil
+	}
+	server := strings.TrimSuffix(envOr("GITHUB_SERVER_URL", "https://github.com"), "/")
+	basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http." + server + "/.extraheader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + basic,
+	}
+}
+
+// rolloutGit runs git in dir with env added to cirby's, with its output in
+// the error
+func rolloutGit(dir string, env []string, args ...string) error {
+	command := args[0]
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), env...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v: %s", command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// openPullRequest proposes rolloutBranch for merging into base and returns
+// the pull request's URL
+func openPullRequest(repo rolloutRepo, token, title, body, base string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"title": title, "body": body, "head": rolloutBranch, "base": base})
+	if err != nil {
+		return "", err
+	}
+	api := strings.TrimSuffix(envOr("GITHUB_API_URL", "https://api.github.com"), "/")
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/repos/%s/%s/pulls", api, repo.Owner, repo.Name), bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("opening pull request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("opening pull request: GitHub returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	var pr struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(data, &pr); err != nil {
+		return "", fmt.Errorf("reading pull request: %w", err)
+	}
+	return pr.HTMLURL, nil
+}
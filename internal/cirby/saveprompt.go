@@ -0,0 +1,100 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// savedPromptDir holds the last prompt sent with --save-prompt, for
+// debugging bad merges and reporting them against an agent
+const savedPromptDir = ".cirby/last-prompt"
+
+// savedInvocation is everything needed to send a prompt again by hand
+type savedInvocation struct {
+	Prompt  string            // exactly as sent, after scrubbing
+	Command []string          // agent CLI and its arguments, or the API method and URL
+	Env     map[string]string // variables cirby set on top of its own environment, unexpanded
+	Stdin   bool              // the prompt went to the CLI's stdin
+	File    string            // temporary file the prompt was read from
+	Body    []byte            // API request body
+}
+
+// savePrompt replaces the contents of savedPromptDir with inv
+func savePrompt(inv savedInvocation, opts Options) error {
+	if !opts.SavePrompt {
+		return nil
+	}
+	if err := os.RemoveAll(savedPromptDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(savedPromptDir, 0755); err != nil {
+		return err
+	}
+	files := map[string]string{
+		// Local state, keep it out of commits
+		".gitignore": "*\n",
+		"prompt.md":  inv.Prompt,
+		"command.sh": savedCommand(inv),
+	}
+	if len(inv.Body) > 0 {
+		files["request.json"] = string(inv.Body) + "\n"
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(savedPromptDir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("saving prompt: %w", err)
+		}
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Saved the prompt and command to %s\n", savedPromptDir)
+	return nil
+}
+
+// savedCommand is a shell script that repeats the invocation from the
+// project root
+func savedCommand(inv savedInvocation) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	keys := make([]string, 0, len(inv.Env))
+	for key := range inv.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// Double quotes, so ${VAR} is expanded again when the script runs
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`").Replace(inv.Env[key])
+		fmt.Fprintf(&b, "export %s=\"%s\"\n", key, value)
+	}
+	saved := savedPromptDir + "/prompt.md"
+	quoted := make([]string, len(inv.Command))
+	for i, arg := range inv.Command {
+		switch {
+		case arg == inv.Prompt:
+			quoted[i] = `"$(cat ` + saved + `)"`
+		case inv.File != "" && arg == inv.File:
+			quoted[i] = saved
+		default:
+			quoted[i] = shellQuote(arg)
+		}
+	}
+	switch {
+	case inv.Stdin:
+		fmt.Fprintf(&b, "%s < %s\n", strings.Join(quoted, " "), saved)
+	case len(inv.Body) > 0:
+		fmt.Fprintf(&b, "# API key headers left out\ncurl -X %s -H 'Content-Type: application/json' -d @%s/request.json\n", strings.Join(quoted, " "), savedPromptDir)
+	default:
+		b.WriteString(strings.Join(quoted, " ") + "\n")
+	}
+	return b.String()
+}
+
+// shellQuote quotes s for sh unless it is plainly safe
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,@%+", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,132 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// maskedToken matches the placeholders a scrubber puts in place of
+// masked text
+var maskedToken = regexp.MustCompile(`\[\[masked:(\d+)\]\]`)
+
+// maskNote tells the agent to leave placeholders alone
+const maskNote = "\n\nText like [[masked:N]] stands for content that was hidden from you. Keep every such placeholder\nexactly as written, wherever the text around it ends up.\n"
+
+// scrubber masks what the scrub rules in .cirby.yaml match (internal host
+// names, project codenames) with [[masked:N]] placeholders, and restores
+// the original text afterwards. Equal text gets the same placeholder.
+type scrubber struct {
+	rules    []*regexp.Regexp
+	values   []string       // placeholder N-1 stands for values[N-1]
+	indexOf  map[string]int // value -> N
+	warnings map[string]bool
+}
+
+// loadScrubber returns the scrubber for the project's scrub rules, or nil
+// when there are none
+func loadScrubber() (*scrubber, error) {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Scrub) == 0 {
+		return nil, nil
+	}
+	return &scrubber{rules: cfg.Scrub, indexOf: map[string]int{}, warnings: map[string]bool{}}, nil
+}
+
+// mask replaces every match of the rules in text with its placeholder
+func (s *scrubber) mask(text string) string {
+	for _, re := range s.rules {
+		text = re.ReplaceAllStringFunc(text, func(match string) string {
+			if maskedToken.MatchString(match) {
+				return match
+			}
+			n, ok := s.indexOf[match]
+			if !ok {
+				s.values = append(s.values, match)
+				n = len(s.values)
+				s.indexOf[match] = n
+			}
+			return "[[masked:" + strconv.Itoa(n) + "]]"
+		})
+	}
+	return text
+}
+
+// unmask puts the original text back in place of placeholders
+func (s *scrubber) unmask(text string) string {
+	return maskedToken.ReplaceAllStringFunc(text, func(token string) string {
+		n, _ := strconv.Atoi(maskedToken.FindStringSubmatch(token)[1])
+		if n < 1 || n > len(s.values) {
+			return token
+		}
+		return s.values[n-1]
+	})
+}
+
+// maskPrompt masks prompt, adding a note about placeholders if any
+func (s *scrubber) maskPrompt(prompt string, opts Options) string {
+	masked := s.mask(prompt)
+	if masked == prompt {
+		return prompt
+	}
+	if opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  - Masked %d scrubbed terms in the prompt\n", len(s.values))
+	}
+	return masked + maskNote
+}
+
+// maskFile replaces the file at path with its masked content for an agent
+// CLI to read and edit, and returns a function that unmasks whatever the
+// agent left there
+func (s *scrubber) maskFile(path string) (restore func() error, err error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s.unmaskFile(path), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if masked := s.mask(string(data)); masked != string(data) {
+		if err := writeFile(path, []byte(masked), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return s.unmaskFile(path), nil
+}
+
+func (s *scrubber) unmaskFile(path string) func() error {
+	return func() error {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if restored := s.unmask(string(data)); restored != string(data) {
+			return writeFile(path, []byte(restored), 0644)
+		}
+		return nil
+	}
+}
+
+// warnUnmaskable warns about files an agent CLI reads itself that contain
+// scrubbed terms, which cirby cannot mask without rewriting them
+func (s *scrubber) warnUnmaskable(files []AgentConfig, agent string, opts Options) {
+	for _, f := range files {
+		if s.warnings[f.Path] {
+			continue
+		}
+		for _, re := range s.rules {
+			if re.MatchString(f.Content) {
+				s.warnings[f.Path] = true
+				fmt.Fprintf(opts.stdout(), "  [warn] %s contains scrubbed terms that %s reads unmasked; use an API backend to mask them\n", f.Path, agent)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// secretPattern recognizes one kind of credential. When Group is set,
+// only that submatch is the secret (the value of a `key = value` pair).
+type secretPattern struct {
+	Kind  string
+	Re    *regexp.Regexp
+	Group int
+}
+
+var secretPatterns = []secretPattern{
+	{Kind: "Anthropic API key", Re: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{Kind: "OpenAI API key", Re: regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_-]{32,}`)},
+	{Kind: "AWS access key", Re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Kind: "GitHub token", Re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{40,})`)},
+	{Kind: "GitLab token", Re: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{Kind: "Slack token", Re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{Kind: "Stripe key", Re: regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}`)},
+	{Kind: "Google API key", Re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{Kind: "JSON web token", Re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{Kind: "URL password", Re: regexp.MustCompile(`[a-z][a-z0-9+.-]*://[^\s/:@]+:([^\s/@]{6,})@`), Group: 1},
+	{Kind: "credential", Group: 2, Re: regexp.MustCompile(
+		`(?i)\b([a-z0-9_.-]*(?:api[_-]?key|secret|token|passw(?:or)?d|credential)s?)["']?\s*[:=]\s*["']?([A-Za-z0-9_\-./+=]{16,})`)},
+	// Last, as it joins lines, which would shift the line numbers of later findings
+	{Kind: "private key", Re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z ]*PRIVATE KEY-----|$)`)},
+}
+
+// secretNote tells the agent to leave redaction placeholders alone
+const secretNote = "\n\nText like [REDACTED:kind] stands for a credential that was hidden from you. Keep every such\nplaceholder exactly as written, wherever the text around it ends up.\n"
+
+// secretFinding is a credential found in text
+type secretFinding struct {
+	Kind string
+	Line int
+}
+
+// secretRedactor replaces credentials with [REDACTED:kind] placeholders
+// in the texts of one agent run, the prompt and the file the agent edits,
+// and puts them back in what the agent returns. Equal credentials get the
+// same placeholder; different ones of a kind are numbered from the second
+// on ([REDACTED:kind-2]), and a placeholder the text already holds is
+// never used, so restoring only touches what cirby put there.
+type secretRedactor struct {
+	placeholders map[string]string // secret -> placeholder
+	used         map[string]bool   // placeholders handed out
+}
+
+// redactSecrets replaces credentials in text with [REDACTED:kind]
+// placeholders
+func redactSecrets(text string) (string, []secretFinding) {
+	var r secretRedactor
+	return r.redact(text)
+}
+
+// redact replaces the credentials in text with their placeholders
+func (r *secretRedactor) redact(text string) (string, []secretFinding) {
+	if r.placeholders == nil {
+		r.placeholders, r.used = map[string]string{}, map[string]bool{}
+	}
+	var findings []secretFinding
+	original := text
+	for _, p := range secretPatterns {
+		text = r.replace(text, original, p, &findings)
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return text, findings
+}
+
+// restore puts the credentials back in place of the placeholders left in
+// text
+func (r *secretRedactor) restore(text string) string {
+	var pairs []string
+	for secret, placeholder := range r.placeholders {
+		pairs = append(pairs, placeholder, secret)
+	}
+	if len(pairs) == 0 {
+		return text
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// redactFile replaces the credentials in the file at path for an agent
+// CLI to read and edit, and returns a function that restores them in
+// whatever the agent left there. With --fail-on-secrets it refuses to let
+// the agent see the file at all.
+func (r *secretRedactor) redactFile(path, agent string, opts Options) (restore func() error, err error) {
+	restore = func() error {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if restored := r.restore(string(data)); restored != string(data) {
+			return writeFile(path, []byte(restored), 0644)
+		}
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return restore, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	redacted, findings := r.redact(string(data))
+	if len(findings) == 0 {
+		return restore, nil
+	}
+	if opts.FailOnSecrets {
+		return nil, fmt.Errorf("%s contains secrets, and %s would read it (--fail-on-secrets): %s", path, agent, describeFindings(findings))
+	}
+	fmt.Fprintf(opts.stdout(), "  [warn] Redacted secrets from %s while %s edits it: %s\n", path, agent, describeFindings(findings))
+	if err := writeFile(path, []byte(redacted), 0644); err != nil {
+		return nil, err
+	}
+	return restore, nil
+}
+
+func (r *secretRedactor) replace(text, original string, p secretPattern, findings *[]secretFinding) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range p.Re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := m[0], m[1]
+		if p.Group > 0 {
+			start, end = m[2*p.Group], m[2*p.Group+1]
+		}
+		secret := text[start:end]
+		if p.Group > 0 && !looksRandom(secret) {
+			continue // a placeholder or identifier, not a credential
+		}
+		placeholder, ok := r.placeholders[secret]
+		if !ok {
+			placeholder = r.newPlaceholder(p.Kind, original)
+			r.placeholders[secret], r.used[placeholder] = placeholder, true
+		}
+		*findings = append(*findings, secretFinding{Kind: p.Kind, Line: strings.Count(text[:start], "\n") + 1})
+		b.WriteString(text[last:start])
+		b.WriteString(placeholder)
+		last = end
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// newPlaceholder is the first placeholder for kind that is neither handed
+// out yet nor already in original
+func (r *secretRedactor) newPlaceholder(kind, original string) string {
+	base := "[REDACTED:" + strings.ReplaceAll(kind, " ", "-")
+	for n := 1; ; n++ {
+		placeholder := base + "]"
+		if n > 1 {
+			placeholder = base + "-" + strconv.Itoa(n) + "]"
+		}
+		if !r.used[placeholder] && !strings.Contains(original, placeholder) {
+			return placeholder
+		}
+	}
+}
+
+// looksRandom tells generated credentials from words and placeholders:
+// it needs letters and digits, and no "xxxx" or "your" in it
+func looksRandom(s string) bool {
+	var letters, digits bool
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = true
+		case r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			letters = true
+		}
+	}
+	lower := strings.ToLower(s)
+	for _, placeholder := range []string{"xxxx", "0000", "example", "your", "changeme"} {
+		if strings.Contains(lower, placeholder) {
+			return false
+		}
+	}
+	return letters && digits
+}
+
+// scrubPrompt redacts credentials from a prompt before it is sent to
+// where, warning about each one; secrets restores them in the reply. With
+// --fail-on-secrets it refuses to send the prompt at all.
+func scrubPrompt(prompt, where string, secrets *secretRedactor, opts Options) (string, error) {
+	redacted, findings := secrets.redact(prompt)
+	if len(findings) == 0 {
+		return prompt, nil
+	}
+	if opts.FailOnSecrets {
+		return "", fmt.Errorf("not sending the prompt to %s, it contains: %s (--fail-on-secrets)", where, describeFindings(findings))
+	}
+	fmt.Fprintf(opts.stdout(), "  [warn] Redacted secrets from the prompt sent to %s: %s\n", where, describeFindings(findings))
+	return redacted + secretNote, nil
+}
+
+// checkSourceSecrets warns about credentials in files an agent CLI reads
+// itself, which cirby cannot redact
+func checkSourceSecrets(files []AgentConfig, agent string, opts Options) error {
+	for _, f := range files {
+		_, findings := redactSecrets(f.Content)
+		if len(findings) == 0 {
+			continue
+		}
+		if opts.FailOnSecrets {
+			return fmt.Errorf("%s contains secrets, and %s would read it (--fail-on-secrets): %s", f.Path, agent, describeFindings(findings))
+		}
+		fmt.Fprintf(opts.stdout(), "  [warn] %s contains secrets that %s reads unredacted: %s\n", f.Path, agent, describeFindings(findings))
+	}
+	return nil
+}
+
+// describeFindings summarizes findings, e.g. "GitHub token (line 3)"
+func describeFindings(findings []secretFinding) string {
+	var parts []string
+	for _, f := range findings {
+		parts = append(parts, fmt.Sprintf("%s (line %d)", f.Kind, f.Line))
+	}
+	if len(parts) > 3 {
+		parts = append(parts[:3], fmt.Sprintf("%d more", len(parts)-3))
+	}
+	return strings.Join(parts, ", ")
+}
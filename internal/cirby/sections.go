@@ -0,0 +1,139 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// generatedSection is a part of AGENTS.md that cirby writes itself from
+// project files, between `<!-- cirby:section NAME -->` and
+// `<!-- /cirby:section NAME -->` markers. render returns the section body
+// (without heading), or "" when the section should not exist.
+type generatedSection struct {
+	Name   string
+	Title  string
+	render func(scope packageScope) (string, error)
+}
+
+var generatedSections = []generatedSection{
+	{Name: "subagents", Title: "Available subagents", render: renderSubagentsSection},
+	{Name: "hooks", Title: "Automation & hooks", render: renderHooksSection},
+}
+
+// refreshSections regenerates the generated sections of the scope's
+// AGENTS.md, adding, updating or removing them as the files they describe
+// change. It returns the content from before the update and whether
+// anything changed (or, in dry-run mode, would change).
+func refreshSections(scope packageScope, opts Options) (before string, changed bool, err error) {
+	if opts.NoSections {
+		return "", false, nil
+	}
+	agentsPath := scope.agentsPath()
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return "", false, nil // nothing to update before the first merge
+	}
+	before = string(data)
+
+	content := before
+	var updated []string
+	for _, section := range generatedSections {
+		body, err := section.render(scope)
+		if err != nil {
+			return "", false, fmt.Errorf("generating %q section: %w", section.Title, err)
+		}
+		next := replaceSection(content, section, body)
+		if next != content {
+			updated = append(updated, section.Title)
+			content = next
+		}
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return "", false, err
+	}
+	// New sections are appended; move them where the outline wants them
+	if len(updated) > 0 {
+		content = orderContent(content, cfg.Structure)
+	}
+	// Last, so it lists the generated sections too
+	if next := refreshTOC(content, cfg.TOC); next != content {
+		updated = append(updated, "Contents")
+		content = next
+	}
+	if len(updated) == 0 {
+		return before, false, nil
+	}
+
+	for _, title := range updated {
+		if opts.DryRun {
+			fmt.Fprintf(opts.stdout(), "[Dry Run] Would update %q section in %s\n", title, agentsPath)
+		} else {
+			fmt.Fprintf(opts.stdout(), "[ok] Updated %q section in %s\n", title, agentsPath)
+		}
+	}
+	if opts.DryRun {
+		return before, true, nil
+	}
+	if err := writeFile(agentsPath, []byte(content), 0644); err != nil {
+		return "", false, fmt.Errorf("writing %s: %w", agentsPath, err)
+	}
+	return before, true, nil
+}
+
+func sectionMarkers(name string) (start, end string) {
+	return "<!-- cirby:section " + name + " -->", "<!-- /cirby:section " + name + " -->"
+}
+
+// replaceSection puts body into content's section, appending the section
+// if it is missing and removing it when body is empty
+func replaceSection(content string, section generatedSection, body string) string {
+	var block string
+	if body != "" {
+		block = "## " + section.Title + "\n\n" + strings.TrimRight(body, "\n")
+	}
+	return replaceBlock(content, section.Name, block)
+}
+
+// replaceBlock replaces the marked block called name with block (without
+// markers), appending it if missing and removing it when block is empty
+func replaceBlock(content, name, block string) string {
+	start, end := sectionMarkers(name)
+	if block != "" {
+		block = start + "\n" + block + "\n" + end
+	}
+
+	i := strings.Index(content, start)
+	j := strings.Index(content, end)
+	if i >= 0 && j > i {
+		if block != "" {
+			return content[:i] + block + content[j+len(end):]
+		}
+		// Drop the section and the blank line that separated it
+		rest := strings.TrimLeft(content[j+len(end):], "\n")
+		head := strings.TrimRight(content[:i], "\n")
+		if rest == "" {
+			return head + "\n"
+		}
+		return head + "\n\n" + rest
+	}
+	if block == "" {
+		return content
+	}
+	if strings.TrimSpace(content) == "" {
+		return block + "\n"
+	}
+	return strings.TrimRight(content, "\n") + "\n\n" + block + "\n"
+}
+
+// markedBlock returns the text between the markers of block name
+func markedBlock(content, name string) (string, bool) {
+	start, end := sectionMarkers(name)
+	i := strings.Index(content, start)
+	j := strings.Index(content, end)
+	if i < 0 || j < i {
+		return "", false
+	}
+	return strings.Trim(content[i+len(start):j], "\n"), true
+}
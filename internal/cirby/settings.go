@@ -0,0 +1,480 @@
+package cirby
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// canonicalSettingsFile is written by `cirby settings export`
+const canonicalSettingsFile = ".cirby/settings.json"
+
+// agentSettings is the part of an agent's settings that affects what it
+// may do unattended, in a tool-neutral form
+type agentSettings struct {
+	Tool     string            `json:"tool"`
+	Path     string            `json:"path"`
+	Approval string            `json:"approval,omitempty"` // ask, auto-edit or auto
+	Sandbox  string            `json:"sandbox,omitempty"`  // on or off, with the tool's mode in parentheses
+	Network  string            `json:"network,omitempty"`  // on or off, inside the sandbox
+	Allow    []string          `json:"allow,omitempty"`
+	Ask      []string          `json:"ask,omitempty"`
+	Deny     []string          `json:"deny,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+// settingsSource is a settings file and the reader for its format
+type settingsSource struct {
+	Tool string
+	Path string
+	read func(path string, s *agentSettings) error
+}
+
+var settingsSources = []settingsSource{
+	{"Claude Code", ".claude/settings.json", readClaudeSettings},
+	{"Claude Code (local)", ".claude/settings.local.json", readClaudeSettings},
+	{"Gemini CLI", ".gemini/settings.json", readGeminiSettings},
+	{"Codex", ".codex/config.toml", readCodexSettings},
+	{"Cursor", ".cursor/cli.json", readCursorSettings},
+}
+
+// Settings shows the agents' permission and sandbox settings side by side
+// and flags conflicts. The export action also writes canonicalSettingsFile.
+func Settings(action string, opts Options) error {
+	if action != "" && action != "show" && action != "export" {
+		return fmt.Errorf("unknown settings action: %s (use show or export)", action)
+	}
+
+	all, err := loadAgentSettings()
+	if err != nil {
+		return err
+	}
+	if len(all) == 0 {
+		fmt.Fprintln(opts.stdout(), "No agent settings files found.")
+		return nil
+	}
+
+	out := opts.stdout()
+	fmt.Fprint(out, "Agent settings:\n\n")
+	for _, s := range all {
+		fmt.Fprintf(out, "%s (%s)\n", s.Tool, s.Path)
+		printSetting(out, "approval", s.Approval)
+		printSetting(out, "sandbox", s.Sandbox)
+		printSetting(out, "network", s.Network)
+		printSetting(out, "allow", strings.Join(s.Allow, ", "))
+		printSetting(out, "ask", strings.Join(s.Ask, ", "))
+		printSetting(out, "deny", strings.Join(s.Deny, ", "))
+		printSetting(out, "env", strings.Join(formatEnv(s.Env), ", "))
+		fmt.Fprintln(out)
+	}
+
+	conflicts := settingsConflicts(all)
+	if len(conflicts) == 0 {
+		fmt.Fprintln(out, "[ok] No conflicts between agents.")
+	} else {
+		fmt.Fprintln(out, "Conflicts:")
+		for _, c := range conflicts {
+			fmt.Fprintf(out, "  [warn] %s\n", c)
+		}
+	}
+
+	if action != "export" {
+		return nil
+	}
+
+	content, err := marshalJSONFile(unifySettings(all, conflicts))
+	if err != nil {
+		return err
+	}
+	if opts.DryRun {
+		fmt.Fprintf(out, "\n[Dry Run] Would write %s\n", canonicalSettingsFile)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(canonicalSettingsFile), 0755); err != nil {
+		return err
+	}
+	if err := writeFile(canonicalSettingsFile, content, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", canonicalSettingsFile, err)
+	}
+	fmt.Fprintf(out, "\n[ok] Wrote %s\n", canonicalSettingsFile)
+	return nil
+}
+
+func printSetting(w io.Writer, name, value string) {
+	if value != "" {
+		fmt.Fprintf(w, "  %-9s %s\n", name+":", value)
+	}
+}
+
+func formatEnv(env map[string]string) []string {
+	var pairs []string
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+func loadAgentSettings() ([]agentSettings, error) {
+	var all []agentSettings
+	for _, src := range settingsSources {
+		if _, err := os.Stat(src.Path); err != nil {
+			continue
+		}
+		s := agentSettings{Tool: src.Tool, Path: src.Path}
+		if err := src.read(src.Path, &s); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", src.Path, err)
+		}
+		all = append(all, s)
+	}
+	return all, nil
+}
+
+// settingsConflicts lists rules allowed by one agent but denied by another,
+// and sandbox, network or env settings that differ between agents
+func settingsConflicts(all []agentSettings) []string {
+	var conflicts []string
+	for _, a := range all {
+		for _, b := range all {
+			if settingsAgent(a) == settingsAgent(b) {
+				continue
+			}
+			for _, allow := range a.Allow {
+				for _, deny := range b.Deny {
+					switch {
+					case allow == deny:
+						conflicts = append(conflicts, fmt.Sprintf("%s allowed by %s but denied by %s", allow, a.Tool, b.Tool))
+					case rulesOverlap(allow, deny):
+						conflicts = append(conflicts, fmt.Sprintf("%s allowed by %s but %s denied by %s", allow, a.Tool, deny, b.Tool))
+					}
+				}
+			}
+		}
+	}
+
+	for _, field := range []struct {
+		name string
+		get  func(agentSettings) string
+	}{
+		{"sandbox", func(s agentSettings) string { return onOff(s.Sandbox) }},
+		{"network", func(s agentSettings) string { return onOff(s.Network) }},
+		{"approval", func(s agentSettings) string { return s.Approval }},
+	} {
+		if c := differingSetting(all, field.name, field.get); c != "" {
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	keys := map[string]bool{}
+	for _, s := range all {
+		for k := range s.Env {
+			keys[k] = true
+		}
+	}
+	var names []string
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if c := differingSetting(all, "env "+k, func(s agentSettings) string { return s.Env[k] }); c != "" {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts
+}
+
+// differingSetting reports a setting that agents set to different values;
+// agents that leave it unset are ignored
+func differingSetting(all []agentSettings, name string, get func(agentSettings) string) string {
+	var agents []string
+	byAgent := map[string]string{}
+	for _, s := range all {
+		v := get(s)
+		if v == "" {
+			continue
+		}
+		agent := settingsAgent(s)
+		if _, seen := byAgent[agent]; !seen {
+			agents = append(agents, agent)
+		}
+		byAgent[agent] = v // local settings override the project's
+	}
+	values := map[string]bool{}
+	var parts []string
+	for _, agent := range agents {
+		values[byAgent[agent]] = true
+		parts = append(parts, fmt.Sprintf("%s in %s", byAgent[agent], agent))
+	}
+	if len(values) < 2 {
+		return ""
+	}
+	return fmt.Sprintf("%s differs: %s", name, strings.Join(parts, ", "))
+}
+
+// settingsAgent names the agent a settings file belongs to, so an agent's
+// local overrides are not reported as conflicting with its project settings
+func settingsAgent(s agentSettings) string {
+	return strings.TrimSuffix(s.Tool, " (local)")
+}
+
+func onOff(value string) string {
+	on, _, _ := strings.Cut(value, " ")
+	return on
+}
+
+// rulesOverlap reports whether two rules such as Shell(git push) and
+// Shell(git) can match the same action
+func rulesOverlap(a, b string) bool {
+	kindA, patternA := splitRule(a)
+	kindB, patternB := splitRule(b)
+	if kindA != kindB {
+		return false
+	}
+	if patternA == "*" || patternB == "*" {
+		return true
+	}
+	return strings.HasPrefix(patternA, patternB) || strings.HasPrefix(patternB, patternA)
+}
+
+func splitRule(rule string) (kind, pattern string) {
+	kind, pattern, ok := strings.Cut(rule, "(")
+	if !ok {
+		return rule, "*"
+	}
+	return kind, strings.TrimSuffix(pattern, ")")
+}
+
+// unifySettings combines all agents' settings with the most restrictive
+// choice winning: denied rules stay denied, and the sandbox and approval
+// prompts stay on if any agent uses them
+func unifySettings(all []agentSettings, conflicts []string) map[string]any {
+	allow, ask, deny := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	env := map[string]string{}
+	approval, sandbox, network := "", "", ""
+	approvalRank := map[string]int{"ask": 3, "auto-edit": 2, "auto": 1}
+	var sources []string
+	for _, s := range all {
+		sources = append(sources, s.Path)
+		for _, r := range s.Allow {
+			allow[r] = true
+		}
+		for _, r := range s.Ask {
+			ask[r] = true
+		}
+		for _, r := range s.Deny {
+			deny[r] = true
+		}
+		for k, v := range s.Env {
+			if _, ok := env[k]; !ok {
+				env[k] = v
+			}
+		}
+		if approvalRank[s.Approval] > approvalRank[approval] {
+			approval = s.Approval
+		}
+		if on := onOff(s.Sandbox); on == "on" || sandbox == "" {
+			sandbox = on
+		}
+		if on := onOff(s.Network); on == "off" || network == "" {
+			network = on
+		}
+	}
+	for r := range deny {
+		delete(allow, r)
+		delete(ask, r)
+	}
+
+	unified := map[string]any{
+		"permissions": map[string]any{
+			"allow": sortedSet(allow),
+			"ask":   sortedSet(ask),
+			"deny":  sortedSet(deny),
+		},
+		"env":     env,
+		"sources": sources,
+	}
+	if approval != "" {
+		unified["approval"] = approval
+	}
+	if sandbox != "" {
+		unified["sandbox"] = sandbox
+	}
+	if network != "" {
+		unified["network"] = network
+	}
+	if len(conflicts) > 0 {
+		unified["conflicts"] = conflicts
+	}
+	return unified
+}
+
+func sortedSet(set map[string]bool) []string {
+	items := []string{}
+	for k := range set {
+		items = append(items, k)
+	}
+	sort.Strings(items)
+	return items
+}
+
+func readClaudeSettings(path string, s *agentSettings) error {
+	doc, err := readJSONObject(path)
+	if err != nil {
+		return err
+	}
+	perms := jsonObject(doc["permissions"])
+	s.Allow = normalizeRules(yamlStrings(perms["allow"]), claudeRule)
+	s.Ask = normalizeRules(yamlStrings(perms["ask"]), claudeRule)
+	s.Deny = normalizeRules(yamlStrings(perms["deny"]), claudeRule)
+	switch yamlString(perms["defaultMode"]) {
+	case "default", "plan":
+		s.Approval = "ask"
+	case "acceptEdits":
+		s.Approval = "auto-edit"
+	case "bypassPermissions":
+		s.Approval = "auto"
+	}
+	if enabled, ok := jsonObject(doc["sandbox"])["enabled"].(bool); ok {
+		s.Sandbox = boolSetting(enabled)
+	}
+	s.Env = stringMap(doc["env"])
+	return nil
+}
+
+func readGeminiSettings(path string, s *agentSettings) error {
+	doc, err := readJSONObject(path)
+	if err != nil {
+		return err
+	}
+	// Settings moved under "tools" in newer Gemini CLI versions
+	tools := jsonObject(doc["tools"])
+	lookup := func(nested, legacy string) any {
+		if v, ok := tools[nested]; ok {
+			return v
+		}
+		return doc[legacy]
+	}
+	s.Allow = normalizeRules(yamlStrings(lookup("allowed", "allowedTools")), geminiRule)
+	s.Deny = normalizeRules(yamlStrings(lookup("exclude", "excludeTools")), geminiRule)
+	if auto, ok := lookup("autoAccept", "autoAccept").(bool); ok {
+		s.Approval = map[bool]string{true: "auto-edit", false: "ask"}[auto]
+	}
+	switch v := lookup("sandbox", "sandbox").(type) {
+	case bool:
+		s.Sandbox = boolSetting(v)
+	case string:
+		s.Sandbox = "on (" + v + ")"
+	}
+	return nil
+}
+
+func readCodexSettings(path string, s *agentSettings) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc, err := parseTOML(data)
+	if err != nil {
+		return err
+	}
+	switch yamlString(doc["approval_policy"]) {
+	case "untrusted", "on-request", "on-failure":
+		s.Approval = "ask"
+	case "never":
+		s.Approval = "auto"
+	}
+	switch mode := yamlString(doc["sandbox_mode"]); mode {
+	case "read-only", "workspace-write":
+		s.Sandbox = "on (" + mode + ")"
+	case "danger-full-access":
+		s.Sandbox = "off (" + mode + ")"
+	}
+	if network, ok := jsonObject(doc["sandbox_workspace_write"])["network_access"].(bool); ok {
+		s.Network = boolSetting(network)
+	}
+	s.Env = stringMap(jsonObject(doc["shell_environment_policy"])["set"])
+	return nil
+}
+
+func readCursorSettings(path string, s *agentSettings) error {
+	doc, err := readJSONObject(path)
+	if err != nil {
+		return err
+	}
+	perms := jsonObject(doc["permissions"])
+	s.Allow = normalizeRules(yamlStrings(perms["allow"]), cursorRule)
+	s.Deny = normalizeRules(yamlStrings(perms["deny"]), cursorRule)
+	return nil
+}
+
+func boolSetting(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func stringMap(v any) map[string]string {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	out := map[string]string{}
+	for k, v := range m {
+		out[k] = fmt.Sprint(v)
+	}
+	return out
+}
+
+func normalizeRules(rules []string, normalize func(kind, pattern string) (string, string)) []string {
+	var out []string
+	for _, rule := range rules {
+		kind, pattern := splitRule(strings.TrimSpace(rule))
+		kind, pattern = normalize(kind, pattern)
+		out = append(out, kind+"("+pattern+")")
+	}
+	return out
+}
+
+// Rules are normalized to Shell, Read, Edit, WebFetch and Mcp kinds, with
+// Claude's "cmd:*" prefix syntax reduced to the prefix
+func claudeRule(kind, pattern string) (string, string) {
+	pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, ":*"), " *")
+	switch kind {
+	case "Bash":
+		return "Shell", pattern
+	case "Write", "MultiEdit", "NotebookEdit":
+		return "Edit", pattern
+	case "WebFetch":
+		return "WebFetch", strings.TrimPrefix(pattern, "domain:")
+	}
+	if server, tool, ok := strings.Cut(strings.TrimPrefix(kind, "mcp__"), "__"); ok && strings.HasPrefix(kind, "mcp__") {
+		return "Mcp", server + "/" + tool
+	}
+	return kind, pattern
+}
+
+func geminiRule(kind, pattern string) (string, string) {
+	switch kind {
+	case "run_shell_command", "ShellTool":
+		return "Shell", pattern
+	case "read_file", "read_many_files", "ReadFileTool", "ReadManyFilesTool":
+		return "Read", pattern
+	case "write_file", "replace", "WriteFileTool", "EditTool":
+		return "Edit", pattern
+	case "web_fetch", "WebFetchTool":
+		return "WebFetch", pattern
+	}
+	return kind, pattern
+}
+
+func cursorRule(kind, pattern string) (string, string) {
+	if kind == "Write" {
+		return "Edit", pattern
+	}
+	return kind, pattern
+}
@@ -0,0 +1,86 @@
+package cirby
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// sourceMapFile maps the sections of every canonical file to the sources
+// they came from, for other tools to read. It is rewritten after each merge.
+const sourceMapFile = ".cirby/sources.json"
+
+type sourceMap struct {
+	Version int                        `json:"version"`
+	Files   map[string]*sourceMapEntry `json:"files"` // by canonical file path
+}
+
+// sourceMapEntry describes one canonical file as of its last merge
+type sourceMapEntry struct {
+	SHA256    string              `json:"sha256"`
+	MergedAt  time.Time           `json:"merged_at"`
+	Sources   []sourceMapSource   `json:"sources"`
+	Sections  []sectionProvenance `json:"sections"`
+	Unmatched int                 `json:"unmatched"` // rules found in no source
+}
+
+type sourceMapSource struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"` // content as merged
+}
+
+func loadSourceMap() (sourceMap, error) {
+	sm := sourceMap{Version: 1, Files: map[string]*sourceMapEntry{}}
+	data, err := os.ReadFile(sourceMapFile)
+	if os.IsNotExist(err) {
+		return sm, nil
+	}
+	if err != nil {
+		return sm, err
+	}
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return sm, fmt.Errorf("parsing %s: %w", sourceMapFile, err)
+	}
+	if sm.Files == nil {
+		sm.Files = map[string]*sourceMapEntry{}
+	}
+	return sm, nil
+}
+
+// writeSourceMap records where the sections of agentsPath came from, using
+// the same attribution as cirby explain
+func writeSourceMap(agentsPath string) error {
+	content, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	sources, err := provenanceSources(filepath.Clean(agentsPath))
+	if err != nil {
+		return err
+	}
+	sm, err := loadSourceMap()
+	if err != nil {
+		return err
+	}
+
+	entry := &sourceMapEntry{SHA256: hashString(string(content)), MergedAt: time.Now().UTC()}
+	for _, src := range sources {
+		entry.Sources = append(entry.Sources, sourceMapSource{Path: src.Path, SHA256: src.SHA256})
+	}
+	entry.Sections = explainSections(string(content), sources)
+	for _, s := range entry.Sections {
+		entry.Unmatched += s.New
+	}
+	sm.Files[filepath.ToSlash(filepath.Clean(agentsPath))] = entry
+
+	data, err := marshalJSONFile(sm)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(sourceMapFile), 0755); err != nil {
+		return err
+	}
+	return writeFile(sourceMapFile, data, 0644)
+}
@@ -0,0 +1,221 @@
+package cirby
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSplitThreshold is the size in tokens beyond which cirby offers to
+// split AGENTS.md
+const defaultSplitThreshold = 4000
+
+// splitConfig controls how `cirby split` moves sections out of AGENTS.md:
+//
+//	split:
+//	  threshold: 3000        # tokens; split until AGENTS.md is this small
+//	  dir: docs/agents       # topic files, next to AGENTS.md
+//	  keep: [Build, Testing] # sections that always stay in AGENTS.md
+type splitConfig struct {
+	Threshold int
+	Dir       string
+	Keep      []string
+}
+
+func (c splitConfig) threshold() int {
+	if c.Threshold > 0 {
+		return c.Threshold
+	}
+	return defaultSplitThreshold
+}
+
+func (c splitConfig) dir() string {
+	if c.Dir != "" {
+		return filepath.FromSlash(c.Dir)
+	}
+	return filepath.Join("docs", "agents")
+}
+
+// topicFile is a section moved out of AGENTS.md
+type topicFile struct {
+	Title string
+	Path  string // relative to AGENTS.md
+	Body  string
+}
+
+// splitContent moves the largest sections of content into topic files
+// until it is within the threshold, leaving a summary and a link behind.
+// Generated sections and those in keep stay.
+func splitContent(content string, cfg splitConfig) (string, []topicFile) {
+	chunks := splitChunks(content)
+	var topics []topicFile
+	taken := map[string]bool{}
+	for estimateTokens(joinChunks(chunks)) > cfg.threshold() {
+		best, bestSize := -1, 0
+		for i, c := range chunks[1:] {
+			if c.Title == "" || taken[c.Title] || isSectionMarker(c.Lines[0]) || matchesTitle(c.Title, headingsOf(cfg.Keep)) {
+				continue
+			}
+			if size := estimateTokens(joinLines(c.Lines)); size > bestSize {
+				best, bestSize = i+1, size
+			}
+		}
+		if best < 0 {
+			break
+		}
+		c := chunks[best]
+		taken[c.Title] = true
+		heading := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(c.Lines[0]), "#"))
+		body := strings.Trim(joinLines(c.Lines[1:]), "\n")
+		topic := topicFile{
+			Title: heading,
+			Path:  filepath.ToSlash(filepath.Join(cfg.dir(), slug(heading)+".md")),
+			Body:  "# " + heading + "\n\n" + body + "\n",
+		}
+		// The summary must not be longer than what it replaces
+		lines := []string{c.Lines[0], ""}
+		if summary := summarize(body); summary != "" && estimateTokens(summary) < bestSize/2 {
+			lines = append(lines, summary, "")
+		}
+		lines = append(lines, fmt.Sprintf("Details: [%s](%s)", topic.Path, topic.Path))
+		chunks[best].Lines = lines
+		topics = append(topics, topic)
+	}
+	if len(topics) == 0 {
+		return content, nil
+	}
+	return joinChunks(chunks), topics
+}
+
+// summarize returns the first sentence of the first paragraph of body, or
+// its first list item
+func summarize(body string) string {
+	for _, s := range parseDoc(splitLines(body)) {
+		for _, b := range s.Blocks {
+			first := strings.TrimSpace(b.Lines[0])
+			if strings.HasPrefix(first, "```") || strings.HasPrefix(first, "~~~") || isSectionMarker(first) {
+				continue
+			}
+			if b.List {
+				return listItems(b.Lines)[0][0]
+			}
+			text := strings.Join(strings.Fields(strings.Join(b.Lines, " ")), " ")
+			if i := strings.Index(text, ". "); i >= 0 {
+				text = text[:i+1]
+			}
+			return text
+		}
+	}
+	return ""
+}
+
+func isSectionMarker(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "<!-- cirby:section ")
+}
+
+// Split moves detailed sections of AGENTS.md (or path) into topic files
+// under split.dir, keeping a short summary and a link in their place
+func Split(path string, opts Options) error {
+	if path == "" {
+		path = opts.output()
+	}
+	path = filepath.Clean(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	content := string(data)
+	if tokens := estimateTokens(content); tokens <= cfg.Split.threshold() {
+		fmt.Fprintf(opts.stdout(), "[ok] %s is ~%s tokens, within the ~%s to split at\n", path, formatCount(tokens), formatCount(cfg.Split.threshold()))
+		return nil
+	}
+	split, topics := splitContent(content, cfg.Split)
+	if len(topics) == 0 {
+		fmt.Fprintf(opts.stdout(), "[skip] %s has no sections that can be moved out\n", path)
+		return nil
+	}
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		for _, t := range topics {
+			fmt.Fprintf(opts.stdout(), "  - Move %q to %s\n", t.Title, filepath.Join(filepath.Dir(path), filepath.FromSlash(t.Path)))
+		}
+		fmt.Fprintf(opts.stdout(), "  - Shrink %s from ~%s to ~%s tokens\n", path, formatCount(estimateTokens(content)), formatCount(estimateTokens(split)))
+		fmt.Fprintln(opts.stdout(), tr("\nRun without --dry-run to apply changes."))
+		return nil
+	}
+
+	if err := writeSplit(path, split, topics, opts); err != nil {
+		return err
+	}
+	entry := historyEntry{Agent: "split", AgentsPath: path, HadAgentsMD: true}
+	if err := recordHistory(entry, content); err != nil {
+		return fmt.Errorf("recording history: %w", err)
+	}
+	if err := restampIntegrity(path, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Shrank %s from ~%s to ~%s tokens\n", path, formatCount(estimateTokens(content)), formatCount(estimateTokens(split)))
+	return nil
+}
+
+// writeSplit writes the topic files next to path, then path itself
+func writeSplit(path, content string, topics []topicFile, opts Options) error {
+	for _, t := range topics {
+		target := filepath.Join(filepath.Dir(path), filepath.FromSlash(t.Path))
+		if existing, err := os.ReadFile(target); err == nil && string(existing) != t.Body && !opts.Force {
+			return fmt.Errorf("%s already exists; use --force to overwrite it", target)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(target, []byte(t.Body), copyMode(target, path)); err != nil {
+			return fmt.Errorf("writing %s: %w", target, err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Moved %q to %s\n", t.Title, target)
+	}
+	if err := writeFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// offerSplit points out a merge result beyond split.threshold, and with
+// --interactive asks to split it as part of the merge
+func offerSplit(agentsPath string, opts Options) error {
+	data, err := os.ReadFile(agentsPath)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	tokens := estimateTokens(string(data))
+	if tokens <= cfg.Split.threshold() {
+		return nil
+	}
+	split, topics := splitContent(string(data), cfg.Split)
+	if len(topics) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(opts.stdout(), "[warn] %s is ~%s tokens, more than the ~%s some tools read\n", agentsPath, formatCount(tokens), formatCount(cfg.Split.threshold()))
+	if !opts.Interactive {
+		fmt.Fprintf(opts.stdout(), "  - Run `cirby split %s` to move detailed sections into %s\n", agentsPath, cfg.Split.dir())
+		return nil
+	}
+	fmt.Fprintf(opts.stdout(), "Move %d detailed sections into %s? [y/N]: ", len(topics), cfg.Split.dir())
+	input, _ := bufio.NewReader(opts.stdin()).ReadString('\n')
+	if answer := strings.ToLower(strings.TrimSpace(input)); answer != "y" && answer != "yes" {
+		return nil
+	}
+	return writeSplit(agentsPath, split, topics, opts)
+}
@@ -0,0 +1,135 @@
+package cirby
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// stateRoot is where cirby keeps what it writes but nobody commits or
+// edits: the merge cache and, per project, run history and agent logs. It
+// is in the user cache directory ($XDG_CACHE_HOME/cirby on Linux,
+// ~/Library/Caches/cirby on macOS, %LocalAppData%\cirby on Windows).
+// Settings, the lock, the audit log and other per-repo state stay in
+// .cirby/ of the project.
+func stateRoot() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cirby"), nil
+}
+
+// projectStateDir is the directory of kind ("history", "logs") for the
+// project in dir, named after it and a hash of its absolute path. Without
+// a user cache directory it is .cirby/<kind> in the project, where cirby
+// kept it before; that is also moved over on first use.
+func projectStateDir(dir, kind string) string {
+	legacy := filepath.Join(dir, ".cirby", kind)
+	root, err := stateRoot()
+	if err != nil {
+		return legacy
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return legacy
+	}
+	sum := sha256.Sum256([]byte(abs))
+	state := filepath.Join(root, "projects", filepath.Base(abs)+"-"+hex.EncodeToString(sum[:])[:12], kind)
+	if _, err := os.Stat(legacy); err == nil {
+		if _, err := os.Stat(state); os.IsNotExist(err) {
+			if err := os.MkdirAll(filepath.Dir(state), 0755); err != nil || os.Rename(legacy, state) != nil {
+				// Another file system, say: keep using it where it is
+				return legacy
+			}
+		}
+	}
+	return state
+}
+
+// historyDir holds one subdirectory per recorded run of the project in
+// the current directory
+func historyDir() string {
+	return projectStateDir(".", "history")
+}
+
+// Cache shows where cirby keeps its cache and state, or with "clean"
+// removes them
+func Cache(action string, opts Options) error {
+	root, err := stateRoot()
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "":
+		fmt.Fprintf(opts.stdout(), "Merge cache: %s (%s)\n", filepath.Join(root, "merges"), formatBytes(dirSize(filepath.Join(root, "merges"))))
+		fmt.Fprintf(opts.stdout(), "WASM cache:  %s (%s)\n", filepath.Join(root, "wasm"), formatBytes(dirSize(filepath.Join(root, "wasm"))))
+		fmt.Fprintf(opts.stdout(), "History:     %s (%s)\n", historyDir(), formatBytes(dirSize(historyDir())))
+		fmt.Fprintf(opts.stdout(), "Agent logs:  %s (%s)\n", projectStateDir(".", "logs"), formatBytes(dirSize(projectStateDir(".", "logs"))))
+		return nil
+	case "clean":
+		return cleanCache(root, opts)
+	}
+	return fmt.Errorf("unknown cache action: %s (use clean, or nothing to show where the cache is)", action)
+}
+
+// cleanCache removes the merge cache, compiled WASM plugins and the
+// history and agent logs of every project
+func cleanCache(root string, opts Options) error {
+	var found []string
+	for _, pattern := range []string{"merges", "wasm", "projects/*/history", "projects/*/logs"} {
+		matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+		found = append(found, matches...)
+	}
+	// Kept in the project by older versions
+	for _, kind := range []string{"history", "logs"} {
+		if legacy := filepath.Join(".cirby", kind); fileExists(legacy) {
+			found = append(found, legacy)
+		}
+	}
+	sort.Strings(found)
+	if len(found) == 0 {
+		fmt.Fprintf(opts.stdout(), "[ok] Nothing cached in %s\n", root)
+		return nil
+	}
+
+	if opts.DryRun {
+		fmt.Fprint(opts.stdout(), tr("\n[Dry Run] Would perform these actions:\n\n"))
+		for _, path := range found {
+			fmt.Fprintf(opts.stdout(), "  - Remove %s (%s)\n", path, formatBytes(dirSize(path)))
+		}
+		return nil
+	}
+	total := 0
+	for _, path := range found {
+		total += dirSize(path)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  - Removed %s\n", path)
+		}
+	}
+	// Project directories left empty
+	projects, _ := filepath.Glob(filepath.Join(root, "projects", "*"))
+	for _, dir := range projects {
+		os.Remove(dir)
+	}
+	fmt.Fprintf(opts.stdout(), "[ok] Removed %s of cached merges, history and logs; `cirby undo` and `cirby replay` start over\n", formatBytes(total))
+	return nil
+}
+
+// dirSize is the total size of the files under path
+func dirSize(path string) int {
+	size := 0
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += int(info.Size())
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,117 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// fileStats is the size of one instruction file
+type fileStats struct {
+	Path     string
+	Agent    string
+	Bytes    int
+	Tokens   int
+	Headings int
+	Modified string
+	LinkedTo string // set for files that are symlinks to AGENTS.md
+}
+
+// Stats shows how much each source file and AGENTS.md weigh, largest
+// sources first, so it is clear what takes up the instruction budget
+func Stats(opts Options) error {
+	scopes, err := runScopes(opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(opts.stdout(), 0, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tAGENT\tSIZE\tTOKENS\tHEADINGS\tMODIFIED")
+	found := false
+	for _, scope := range scopes {
+		agentsPath := scope.agentsPath()
+		configs, err := scanConfigs(scope.Dir, opts)
+		if err != nil {
+			return err
+		}
+
+		var sources []fileStats
+		var canonical *fileStats
+		total := 0
+		for _, cfg := range configs {
+			st := statFile(cfg)
+			switch {
+			case cfg.Path == agentsPath:
+				// The scan does not read the canonical file's content
+				if data, err := os.ReadFile(agentsPath); err == nil {
+					cfg.Content = string(data)
+					st = statFile(cfg)
+				}
+				canonical = &st
+			case isSymlinkToAgentsMD(cfg.Path, agentsPath):
+				st.LinkedTo = agentsPath
+				sources = append(sources, st)
+			default:
+				total += st.Tokens
+				sources = append(sources, st)
+			}
+		}
+		sort.SliceStable(sources, func(i, j int) bool { return sources[i].Tokens > sources[j].Tokens })
+
+		var linked []fileStats
+		for _, st := range sources {
+			found = true
+			if st.LinkedTo != "" {
+				linked = append(linked, st)
+				continue
+			}
+			share := ""
+			if total > 0 && len(sources) > 1 {
+				share = fmt.Sprintf(" (%d%%)", st.Tokens*100/total)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t~%s%s\t%d\t%s\n", st.Path, st.Agent, formatBytes(st.Bytes), formatCount(st.Tokens), share, st.Headings, st.Modified)
+		}
+		if canonical != nil {
+			found = true
+			fmt.Fprintf(w, "%s\t(canonical)\t%s\t~%s\t%d\t%s\n", canonical.Path, formatBytes(canonical.Bytes), formatCount(canonical.Tokens), canonical.Headings, canonical.Modified)
+		}
+		// Last, as rows with fewer cells end the tabwriter's column block
+		for _, st := range linked {
+			fmt.Fprintf(w, "%s\t%s\t-> %s\n", st.Path, st.Agent, st.LinkedTo)
+		}
+	}
+	if !found {
+		fmt.Fprintln(opts.stdout(), tr("No agent configuration files found."))
+		return nil
+	}
+	return w.Flush()
+}
+
+func statFile(cfg AgentConfig) fileStats {
+	st := fileStats{Path: cfg.Path, Agent: cfg.Agent, Bytes: len(cfg.Content), Tokens: estimateTokens(cfg.Content)}
+	inFence := false
+	for _, line := range splitLines(cfg.Content) {
+		var heading bool
+		heading, inFence = markdownHeading(line, inFence)
+		if heading {
+			st.Headings++
+		}
+	}
+	if info, err := os.Stat(cfg.Path); err == nil {
+		st.Modified = info.ModTime().Format("2006-01-02 15:04")
+	}
+	return st
+}
+
+// formatBytes shows a size as B, KB or MB
+func formatBytes(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1024), ".0") + " KB"
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/(1024*1024)), ".0") + " MB"
+}
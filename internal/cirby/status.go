@@ -0,0 +1,58 @@
+package cirby
+
+// Config file states reported by inspectConfigs
+const (
+	statusCanonical = "canonical"
+	statusSymlinked = "symlinked"
+	statusCopy      = "copy"
+	statusStale     = "stale copy"
+	statusUnmerged  = "unmerged"
+)
+
+// configStatus describes how a discovered config file relates to AGENTS.md
+type configStatus struct {
+	Path       string `json:"path"`
+	Agent      string `json:"agent"`
+	Status     string `json:"status"`
+	AgentsPath string `json:"agents_md"`
+}
+
+// inSync reports whether the file needs no further action
+func (c configStatus) inSync() bool {
+	return c.Status == statusCanonical || c.Status == statusSymlinked || c.Status == statusCopy
+}
+
+// inspectConfigs scans every scope of a run without changing anything
+func inspectConfigs(opts Options) ([]configStatus, error) {
+	scopes, err := runScopes(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []configStatus
+	for _, scope := range scopes {
+		agentsPath := scope.agentsPath()
+		configs, err := scanConfigs(scope.Dir, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, cfg := range configs {
+			st := configStatus{Path: cfg.Path, Agent: cfg.Agent, AgentsPath: agentsPath}
+			switch {
+			case cfg.Path == agentsPath:
+				st.Status = statusCanonical
+			case isSymlinkToAgentsMD(cfg.Path, agentsPath):
+				st.Status = statusSymlinked
+			case isCirbyCopy(cfg.Content):
+				st.Status = statusCopy
+				if isStaleCopy(cfg, agentsPath, Options{LinkMode: LinkCopy}) {
+					st.Status = statusStale
+				}
+			default:
+				st.Status = statusUnmerged
+			}
+			statuses = append(statuses, st)
+		}
+	}
+	return statuses, nil
+}
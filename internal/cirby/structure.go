@@ -0,0 +1,110 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rejectedDir keeps merge results --strict refused, so they can be
+// inspected or restored by hand
+const rejectedDir = ".cirby/rejected"
+
+// structureConfig holds hard requirements on merge results:
+//
+//	structure:
+//	  required: [Build, Testing]        # sections that must exist
+//	  outline: [Overview, Build, Testing, Code Style]  # the only sections allowed, in order
+//	  unknown: end                      # where sections outside it go: start, end or after a section
+//	  max_tokens: 4000
+//	  no_tool_names: true               # no "Claude", ".cursorrules", ...
+type structureConfig struct {
+	Required    []string
+	Outline     []string
+	Unknown     string
+	MaxTokens   int
+	NoToolNames bool
+}
+
+// configured reports whether cfg requires anything
+func (cfg structureConfig) configured() bool {
+	return len(cfg.Required) > 0 || len(cfg.Outline) > 0 || cfg.MaxTokens > 0 || cfg.NoToolNames
+}
+
+// structureViolations lists how content breaks the requirements of cfg
+func structureViolations(content string, cfg structureConfig) []string {
+	var violations []string
+	doc := parseDoc(splitLines(content))
+	var headings []string
+	for _, s := range doc {
+		if s.Level == 2 {
+			headings = append(headings, s.Heading)
+		}
+	}
+
+	for _, want := range cfg.Required {
+		if !matchesTitle(want, headings) {
+			violations = append(violations, fmt.Sprintf("missing required section %q", want))
+		}
+	}
+	if len(cfg.Outline) > 0 {
+		for _, h := range headings {
+			if title := strings.TrimSpace(strings.TrimLeft(h, "#")); !matchesTitle(title, headingsOf(cfg.Outline)) {
+				violations = append(violations, fmt.Sprintf("section %q is not in the outline", title))
+			}
+		}
+	}
+	if tokens := estimateTokens(content); cfg.MaxTokens > 0 && tokens > cfg.MaxTokens {
+		violations = append(violations, fmt.Sprintf("~%s tokens, more than the %s allowed", formatCount(tokens), formatCount(cfg.MaxTokens)))
+	}
+	if cfg.NoToolNames {
+		inFence := false
+		for i, line := range splitLines(content) {
+			if t := strings.TrimSpace(line); strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+				inFence = !inFence
+				continue
+			}
+			if name := agentPhrasing.FindString(line); name != "" && !inFence {
+				violations = append(violations, fmt.Sprintf("line %d names a specific tool: %q", i+1, name))
+			}
+		}
+	}
+	return violations
+}
+
+// matchesTitle reports whether one of headings is the section title, the
+// way heuristic merges match sections
+func matchesTitle(title string, headings []string) bool {
+	want := normalizeTitle("## " + title)
+	for _, h := range headings {
+		got := normalizeTitle(h)
+		if got == want || (want != "" && got != "" && (wordSubset(want, got) || wordSubset(got, want))) {
+			return true
+		}
+	}
+	return false
+}
+
+func headingsOf(titles []string) []string {
+	headings := make([]string, len(titles))
+	for i, t := range titles {
+		headings[i] = "## " + t
+	}
+	return headings
+}
+
+// rejectMerge restores the AGENTS.md from before the merge, keeping the
+// refused result in rejectedDir
+func rejectMerge(agentsPath, before string, existed bool) (string, error) {
+	rejected := filepath.Join(rejectedDir, filepath.ToSlash(filepath.Clean(agentsPath)))
+	if data, err := os.ReadFile(agentsPath); err == nil {
+		if err := os.MkdirAll(filepath.Dir(rejected), 0755); err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(rejected, data, 0644); err != nil {
+			return "", err
+		}
+	}
+	return rejected, restoreAgentsMD(agentsPath, before, existed)
+}
@@ -0,0 +1,211 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// instructionSource is a JSON or YAML settings file that some tool keeps
+// instructions in. Its instructions are merged like any other source, but
+// the file itself is never linked or replaced.
+type instructionSource struct {
+	Agent   string
+	Path    string // relative to the scanned directory
+	YAML    bool
+	extract func(doc map[string]any) []extractedSetting
+}
+
+// extractedSetting is the instruction text of one setting
+type extractedSetting struct {
+	Key   string
+	Title string
+	Texts []string
+}
+
+var instructionSources = []instructionSource{
+	{Agent: "GitHub Copilot (VS Code settings)", Path: ".vscode/settings.json", extract: copilotInstructions},
+	{Agent: "Continue", Path: ".continue/config.json", extract: continueInstructions},
+	{Agent: "Continue", Path: ".continue/config.yaml", YAML: true, extract: continueInstructions},
+}
+
+// copilotInstructions reads the github.copilot.chat.*.instructions
+// settings: lists of {"text": ...} or {"file": ...}. Files are not read,
+// they are Markdown files cirby finds, or should find, on its own.
+func copilotInstructions(doc map[string]any) []extractedSetting {
+	var settings []extractedSetting
+	for key, v := range doc {
+		name, ok := strings.CutPrefix(key, "github.copilot.chat.")
+		if !ok || !strings.HasSuffix(name, ".instructions") {
+			continue
+		}
+		s := extractedSetting{Key: key, Title: settingTitle(strings.TrimSuffix(name, ".instructions"))}
+		items, _ := v.([]any)
+		for _, item := range items {
+			if m, ok := item.(map[string]any); ok {
+				if text := strings.TrimSpace(yamlString(m["text"])); text != "" {
+					s.Texts = append(s.Texts, text)
+				}
+			}
+		}
+		if len(s.Texts) > 0 {
+			settings = append(settings, s)
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+// continueInstructions reads Continue's systemMessage and its rules, plain
+// strings or {name, rule} entries
+func continueInstructions(doc map[string]any) []extractedSetting {
+	var settings []extractedSetting
+	if text := strings.TrimSpace(yamlString(doc["systemMessage"])); text != "" {
+		settings = append(settings, extractedSetting{Key: "systemMessage", Title: "Instructions", Texts: []string{text}})
+	}
+	rules := extractedSetting{Key: "rules", Title: "Rules"}
+	items, _ := doc["rules"].([]any)
+	for _, item := range items {
+		text := yamlString(item)
+		if m, ok := item.(map[string]any); ok {
+			text = yamlString(m["rule"])
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			rules.Texts = append(rules.Texts, text)
+		}
+	}
+	if len(rules.Texts) > 0 {
+		settings = append(settings, rules)
+	}
+	return settings
+}
+
+// settingTitle turns a setting name such as codeGeneration into a heading
+func settingTitle(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case i == 0:
+			b.WriteRune(unicode.ToUpper(r))
+		case unicode.IsUpper(r):
+			b.WriteRune(' ')
+			b.WriteRune(unicode.ToLower(r))
+		case r == '.' || r == '_' || r == '-':
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// renderSettings writes extracted settings as Markdown: one section per
+// setting, one-line instructions as a list
+func renderSettings(settings []extractedSetting) string {
+	var b strings.Builder
+	for _, s := range settings {
+		fmt.Fprintf(&b, "## %s\n\n", s.Title)
+		for i, text := range s.Texts {
+			switch {
+			case !strings.Contains(text, "\n"):
+				fmt.Fprintf(&b, "- %s\n", text)
+			case i > 0:
+				fmt.Fprintf(&b, "\n%s\n\n", text)
+			default:
+				fmt.Fprintf(&b, "%s\n\n", text)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n"
+}
+
+// scanSettings returns the instructions kept in dir's settings files
+func scanSettings(dir string, opts Options) []AgentConfig {
+	var configs []AgentConfig
+	for _, src := range instructionSources {
+		path := filepath.Join(dir, filepath.FromSlash(src.Path))
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > maxConfigSize {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [error] %s (error reading: %v)\n", path, err)
+			}
+			continue
+		}
+		var doc map[string]any
+		if src.YAML {
+			var v any
+			v, err = parseYAML(data)
+			doc, _ = v.(map[string]any)
+		} else {
+			err = parseJSONC(data, &doc)
+		}
+		if err != nil {
+			if opts.Verbose {
+				fmt.Fprintf(opts.stdout(), "  [error] %s (error parsing: %v)\n", path, err)
+			}
+			continue
+		}
+
+		settings := src.extract(doc)
+		if len(settings) == 0 {
+			continue
+		}
+		var keys []string
+		for _, s := range settings {
+			keys = append(keys, s.Key)
+		}
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [ok] %s (%s: %s)\n", path, src.Agent, strings.Join(keys, ", "))
+		}
+		configs = append(configs, AgentConfig{
+			Path:     path,
+			Agent:    src.Agent,
+			Content:  renderSettings(settings),
+			Settings: strings.Join(keys, ", "),
+		})
+	}
+	return configs
+}
+
+// settingsMerged reports whether cfg's instructions are unchanged since
+// they were last merged into agentsPath, as settings files stay in place
+// and would otherwise be merged again on every run
+func settingsMerged(cfg AgentConfig, agentsPath string) bool {
+	lock, err := loadLock()
+	if err != nil {
+		return false
+	}
+	entry, ok := lock.Agents[filepath.ToSlash(agentsPath)]
+	return ok && entry.Sources[filepath.ToSlash(cfg.Path)] == hashString(cfg.Content)
+}
+
+// promptFiles lists configs for a merge prompt. Instructions from settings
+// files and plugins are quoted, so the agent does not read or edit the
+// settings, or look for a file that does not exist.
+func promptFiles(configs []AgentConfig) string {
+	var files, quoted []string
+	for _, cfg := range configs {
+		switch {
+		case cfg.Plugin != "":
+			files = append(files, fmt.Sprintf("%s (from %s, quoted below; this is not a file)", cfg.Path, cfg.Agent))
+		case cfg.Settings != "":
+			files = append(files, fmt.Sprintf("%s (only its %s settings, quoted below; do not edit this file)", cfg.Path, cfg.Settings))
+		default:
+			files = append(files, cfg.Path)
+			continue
+		}
+		quoted = append(quoted, fmt.Sprintf("Instructions from %s:\n\n---\n%s---", cfg.Path, cfg.Content))
+	}
+	if len(quoted) == 0 {
+		return strings.Join(files, "\n")
+	}
+	return strings.Join(files, "\n") + "\n\n" + strings.Join(quoted, "\n\n")
+}
@@ -0,0 +1,89 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// subagentsDir holds Claude Code project subagents, one Markdown file each
+// with name and description in the frontmatter
+const subagentsDir = ".claude/agents"
+
+// maxSubagentDescription keeps the generated list readable; the full
+// description stays in the subagent file
+const maxSubagentDescription = 160
+
+type subagent struct {
+	Name        string
+	Description string
+	Path        string
+}
+
+func findSubagents(dir string) ([]subagent, error) {
+	files, err := filepath.Glob(filepath.Join(dir, subagentsDir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	var agents []subagent
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		a := subagent{Name: strings.TrimSuffix(filepath.Base(path), ".md"), Path: path}
+		if front, _ := splitFrontmatter(string(data)); front != "" {
+			if parsed, err := parseYAML([]byte(front)); err == nil {
+				m, _ := parsed.(map[string]any)
+				if name := yamlString(m["name"]); name != "" {
+					a.Name = name
+				}
+				a.Description = yamlString(m["description"])
+			}
+		}
+		agents = append(agents, a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents, nil
+}
+
+// renderSubagentsSection lists the project's subagents so agents other
+// than Claude Code know which roles exist
+func renderSubagentsSection(scope packageScope) (string, error) {
+	agents, err := findSubagents(scope.Dir)
+	if err != nil || len(agents) == 0 {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Subagents defined in `%s/` for Claude Code. Other agents can take on the\nsame roles when asked.\n\n", subagentsDir)
+	for _, a := range agents {
+		rel, err := filepath.Rel(filepath.Dir(scope.agentsPath()), a.Path)
+		if err != nil {
+			rel = a.Path
+		}
+		fmt.Fprintf(&b, "- **%s** ([%s](%s))", a.Name, filepath.Base(a.Path), filepath.ToSlash(rel))
+		if desc := summarizeDescription(a.Description); desc != "" {
+			fmt.Fprintf(&b, ": %s", desc)
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// summarizeDescription shortens a description to its first line, cut at a
+// word boundary if it is still too long
+func summarizeDescription(desc string) string {
+	desc, _, _ = strings.Cut(strings.TrimSpace(strings.ReplaceAll(desc, `\n`, "\n")), "\n")
+	desc = strings.TrimSpace(desc)
+	if len(desc) <= maxSubagentDescription {
+		return desc
+	}
+	cut := strings.LastIndex(desc[:maxSubagentDescription], " ")
+	if cut <= 0 {
+		cut = maxSubagentDescription
+	}
+	return strings.TrimRight(desc[:cut], " ,;:.") + "..."
+}
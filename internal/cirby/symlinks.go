@@ -0,0 +1,142 @@
+package cirby
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// errPrivilegeNotHeld is ERROR_PRIVILEGE_NOT_HELD, what Windows returns
+// for symlinks without Developer Mode or administrator rights
+const errPrivilegeNotHeld = syscall.Errno(1314)
+
+// developerModeHelp explains how to allow symlinks on Windows
+const developerModeHelp = `Windows only lets administrators create symlinks unless Developer Mode is on:
+  Settings > System > For developers > Developer Mode (Windows 10: Update & Security > For developers)
+Or write copies instead, which cirby keeps in sync: --link-mode copy, or link_mode: copy under defaults: in .cirby.yaml`
+
+// symlinksAllowed reports whether this process may create symlinks. Only
+// Windows restricts it; there a throwaway link is tried once.
+var symlinksAllowed = sync.OnceValue(func() bool {
+	if runtime.GOOS != "windows" {
+		return true
+	}
+	dir, err := os.MkdirTemp("", "cirby-symlink-")
+	if err != nil {
+		return true // let the real link report what is wrong
+	}
+	defer os.RemoveAll(dir)
+	err = os.Symlink("target", filepath.Join(dir, "link"))
+	return !errors.Is(err, errPrivilegeNotHeld)
+})
+
+// checkSymlinks switches to copies when symlinks cannot be created or
+// would not work from both sides of a WSL/Windows mount, after explaining
+// why and, where Windows refuses them, asking at a terminal. With
+// --link-mode symlink given explicitly it keeps symlinks on such mounts,
+// and fails where they cannot be created, before any file is touched.
+func checkSymlinks(opts *Options) error {
+	if linkMode(*opts) != LinkSymlink {
+		return nil
+	}
+	explicit := slices.Contains(opts.Flags, "link-mode")
+	if mount := foreignMount("."); mount != "" {
+		if explicit {
+			fmt.Fprintf(opts.stdout(), "[warn] %s; symlinks made here may not resolve from the other side\n", mount)
+		} else {
+			fmt.Fprintf(opts.stdout(), "[warn] %s, where symlinks do not work from both sides; writing copies instead (--link-mode symlink to keep symlinks)\n", mount)
+			opts.LinkMode = LinkCopy
+			return nil
+		}
+	}
+	if symlinksAllowed() {
+		return nil
+	}
+	if explicit {
+		return fmt.Errorf("cannot create symlinks (--link-mode symlink)\n%s", developerModeHelp)
+	}
+	fmt.Fprintf(opts.stdout(), "[warn] Cannot create symlinks here.\n%s\n", developerModeHelp)
+	if interactive(opts.stdin()) && !opts.DryRun {
+		fmt.Fprint(opts.stdout(), "Write copies for this run instead? [Y/n]: ")
+		answer, _ := bufio.NewReader(opts.stdin()).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer == "n" || answer == "no" {
+			return fmt.Errorf("cannot create symlinks; turn on Developer Mode or use --link-mode copy")
+		}
+	} else {
+		fmt.Fprintln(opts.stdout(), "Writing copies for this run.")
+	}
+	opts.LinkMode = LinkCopy
+	return nil
+}
+
+// foreignMount describes dir when it is shared between WSL and Windows:
+// a Windows drive mounted in WSL (drvfs, or 9p on WSL 2), or a WSL file
+// system opened from Windows through \\wsl$. Symlinks created on one side
+// are not followed, or not even seen as links, on the other. It returns ""
+// for anything else.
+func foreignMount(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	switch runtime.GOOS {
+	case "windows":
+		lower := strings.ToLower(abs)
+		if strings.HasPrefix(lower, `\\wsl$\`) || strings.HasPrefix(lower, `\\wsl.localhost\`) {
+			return abs + " is in a WSL file system"
+		}
+	case "linux":
+		if !isWSL() {
+			return ""
+		}
+		if mountpoint, fstype := mountOf(abs); fstype == "9p" || fstype == "drvfs" {
+			return fmt.Sprintf("%s is on a Windows drive (%s, %s)", abs, mountpoint, fstype)
+		}
+	}
+	return ""
+}
+
+// isWSL reports whether this is Linux running under WSL
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft")
+}
+
+// mountOf finds the mount path is on and its file system type
+func mountOf(path string) (mountpoint, fstype string) {
+	data, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return "", ""
+	}
+	// Spaces and the like are octal escapes
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		mp := unescape.Replace(fields[1])
+		if (path == mp || strings.HasPrefix(path, strings.TrimSuffix(mp, "/")+"/")) && len(mp) >= len(mountpoint) {
+			mountpoint, fstype = mp, fields[2]
+		}
+	}
+	return mountpoint, fstype
+}
+
+// symlinkError explains a failed symlink that needs Developer Mode
+func symlinkError(err error) error {
+	if errors.Is(err, errPrivilegeNotHeld) {
+		return fmt.Errorf("%w\n%s", err, developerModeHelp)
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package cirby
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Version is the cirby version reported in telemetry and generated files.
+// main sets it at startup.
+var Version = "dev"
+
+// telemetrySettings is the opt-in state stored in the user config directory
+type telemetrySettings struct {
+	Enabled   bool            `json:"enabled"`
+	Endpoint  string          `json:"endpoint,omitempty"`
+	LastEvent *telemetryEvent `json:"last_event,omitempty"`
+}
+
+// telemetryEvent is everything that is ever reported: no paths, file
+// names or content, only aggregate facts about a run
+type telemetryEvent struct {
+	Version    string `json:"version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	Agent      string `json:"agent,omitempty"`
+	Success    bool   `json:"success"`
+	DurationMS int64  `json:"duration_ms"`
+	Files      int    `json:"files"`
+}
+
+func telemetryPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cirby", "telemetry.json"), nil
+}
+
+func loadTelemetry() (telemetrySettings, error) {
+	var settings telemetrySettings
+	path, err := telemetryPath()
+	if err != nil {
+		return settings, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+func saveTelemetry(settings telemetrySettings) error {
+	path, err := telemetryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// telemetryTimeout caps how long the end of a run waits for the endpoint
+const telemetryTimeout = 500 * time.Millisecond
+
+// telemetryEndpoint returns where events are sent, empty if nowhere
+func telemetryEndpoint(settings telemetrySettings) string {
+	if env := os.Getenv("CIRBY_TELEMETRY_ENDPOINT"); env != "" {
+		return env
+	}
+	return settings.Endpoint
+}
+
+// Telemetry implements `cirby telemetry on|off|status`
+func Telemetry(action string, args []string, opts Options) error {
+	settings, err := loadTelemetry()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "on":
+		settings.Enabled = true
+		if len(args) > 0 {
+			settings.Endpoint = args[0]
+		}
+		if err := saveTelemetry(settings); err != nil {
+			return err
+		}
+		fmt.Fprintln(opts.stdout(), "[ok] Anonymous usage metrics enabled. Thank you!")
+		if telemetryEndpoint(settings) == "" {
+			fmt.Fprintln(opts.stdout(), "No endpoint configured yet: pass one to `cirby telemetry on <url>` or set CIRBY_TELEMETRY_ENDPOINT.")
+		}
+		return nil
+	case "off":
+		settings.Enabled = false
+		if err := saveTelemetry(settings); err != nil {
+			return err
+		}
+		fmt.Fprintln(opts.stdout(), "[ok] Anonymous usage metrics disabled.")
+		return nil
+	case "status", "":
+		state := "disabled"
+		if settings.Enabled {
+			state = "enabled"
+		}
+		if os.Getenv("DO_NOT_TRACK") != "" {
+			state += " (suppressed by DO_NOT_TRACK)"
+		}
+		fmt.Fprintf(opts.stdout(), "Telemetry: %s\n", state)
+		if endpoint := telemetryEndpoint(settings); endpoint != "" {
+			fmt.Fprintf(opts.stdout(), "Endpoint:  %s\n", endpoint)
+		}
+		if settings.LastEvent != nil {
+			data, _ := json.MarshalIndent(settings.LastEvent, "", "  ")
+			fmt.Fprintf(opts.stdout(), "Last event:\n%s\n", data)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown telemetry action: %s (use on, off or status)", action)
+}
+
+// reportUsage sends one event if the user opted in and configured an
+// endpoint, waiting at most telemetryTimeout. It never fails the run:
+// telemetry errors are only shown in verbose mode.
+func reportUsage(event telemetryEvent, opts Options) {
+	if os.Getenv("DO_NOT_TRACK") != "" || opts.Offline {
+		return
+	}
+	settings, err := loadTelemetry()
+	if err != nil || !settings.Enabled {
+		return
+	}
+
+	event.Version = Version
+	event.OS = runtime.GOOS
+	event.Arch = runtime.GOARCH
+
+	if endpoint := telemetryEndpoint(settings); endpoint != "" {
+		if err := sendTelemetry(endpoint, event); err != nil && opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [skip] telemetry: %v\n", err)
+		}
+	}
+
+	settings.LastEvent = &event
+	if err := saveTelemetry(settings); err != nil && opts.Verbose {
+		fmt.Fprintf(opts.stdout(), "  [skip] telemetry: %v\n", err)
+	}
+}
+
+func sendTelemetry(endpoint string, event telemetryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: telemetryTimeout}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
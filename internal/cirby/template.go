@@ -0,0 +1,147 @@
+package cirby
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// templateFetchTimeout bounds downloads of --template and other remote files
+const templateFetchTimeout = 30 * time.Second
+
+// templateURL resolves a --template reference: an http(s) URL, a local
+// file, or owner/repo[/path][@ref] on GitHub (path defaults to AGENTS.md,
+// ref to the default branch)
+func templateURL(ref string) (string, error) {
+	if strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://") {
+		return ref, nil
+	}
+	if fileExists(ref) {
+		return "", nil
+	}
+
+	spec, gitRef, _ := strings.Cut(ref, "@")
+	parts := strings.SplitN(spec, "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid template %q (use a URL, a file or owner/repo[/path][@ref])", ref)
+	}
+	path := "AGENTS.md"
+	if len(parts) == 3 && parts[2] != "" {
+		path = parts[2]
+	}
+	if gitRef == "" {
+		gitRef = "HEAD"
+	}
+	return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s", parts[0], parts[1], gitRef, path), nil
+}
+
+// builtinTemplates are the AGENTS.md templates shipped with cirby, by
+// project type. {{name}} and {{commands}} are filled from the project.
+//
+//go:embed templates/*.md
+var builtinTemplates embed.FS
+
+// builtinTemplateNames lists the templates of builtinTemplates
+func builtinTemplateNames() []string {
+	entries, _ := builtinTemplates.ReadDir("templates")
+	var names []string
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".md"))
+	}
+	return names
+}
+
+// builtinTemplate returns the template called name, filled in with the
+// facts of the project in dir
+func builtinTemplate(name, dir string) (string, bool) {
+	data, err := builtinTemplates.ReadFile("templates/" + name + ".md")
+	if err != nil {
+		return "", false
+	}
+	facts := inspectProject(dir)
+	commands := facts.commandList()
+	if commands == "" {
+		commands = "- Add the commands to build, test and lint the project\n"
+	}
+	content := strings.ReplaceAll(string(data), "{{name}}", facts.Name)
+	return strings.ReplaceAll(content, "{{commands}}\n", commands), true
+}
+
+// detectTemplate picks the built-in template for the project in dir
+func detectTemplate(dir string) (string, error) {
+	exists := func(name string) bool { return fileExists(filepath.Join(dir, name)) }
+	switch {
+	case exists("go.work"), exists("pnpm-workspace.yaml"), exists("lerna.json"), exists("nx.json"), exists("turbo.json"):
+		return "monorepo", nil
+	case exists("go.mod"):
+		return "go", nil
+	case exists("package.json"):
+		return "node", nil
+	case exists("pyproject.toml"), exists("setup.py"), exists("requirements.txt"):
+		return "python", nil
+	}
+	return "", fmt.Errorf("cannot tell the project type; choose a template with --template %s", strings.Join(builtinTemplateNames(), ", "))
+}
+
+// loadTemplate returns the content of the --template reference
+func loadTemplate(ref string) (string, error) {
+	if content, ok := builtinTemplate(ref, "."); ok && !fileExists(ref) {
+		return content, nil
+	}
+	url, err := templateURL(ref)
+	if err != nil {
+		return "", err
+	}
+	if url == "" {
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return "", fmt.Errorf("reading template: %w", err)
+		}
+		return string(data), nil
+	}
+	data, err := fetchRemoteFile(url)
+	if err != nil {
+		return "", fmt.Errorf("fetching template %s: %w", url, err)
+	}
+	return string(data), nil
+}
+
+// fetchRemoteFile downloads a text file of at most maxConfigSize bytes
+func fetchRemoteFile(url string) ([]byte, error) {
+	client := &http.Client{Timeout: templateFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxConfigSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxConfigSize)
+	}
+	return data, nil
+}
+
+// buildTemplateNote asks the merge agent to follow the team template's
+// layout instead of cirby's default structure
+func buildTemplateNote(template string) string {
+	return fmt.Sprintf(`The file must follow this team template. Use the same headings in the same
+order, keep any text the template prescribes, and fill each section with the
+project-specific instructions. Put instructions that fit no template section
+under a final "Project-specific notes" heading:
+
+---
+%s
+---
+`, strings.TrimSpace(template))
+}
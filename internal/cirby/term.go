@@ -0,0 +1,97 @@
+package cirby
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// ANSI styles used for terminal output
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiItalic    = "\x1b[3m"
+	ansiUnderline = "\x1b[4m"
+	ansiRed       = "\x1b[31m"
+	ansiGreen     = "\x1b[32m"
+	ansiYellow    = "\x1b[33m"
+	ansiBlue      = "\x1b[34m"
+	ansiMagenta   = "\x1b[35m"
+	ansiCyan      = "\x1b[36m"
+)
+
+// isTerminal reports whether w is an interactive terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// interactive reports whether r can answer prompts: a terminal, or
+// answers handed in through Options.Stdin. Pipes, files and /dev/null
+// redirected to stdin, as in CI, are neither.
+func interactive(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return true
+	}
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// useColor reports whether output to w may contain ANSI colors; NO_COLOR
+// (https://no-color.org) and TERM=dumb turn them off
+func useColor(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(w)
+}
+
+// termStyle is how output for the terminal is drawn
+type termStyle struct {
+	color bool // ANSI colors
+	plain bool // ASCII only, one item per line: no columns, box drawing or bullets
+}
+
+// styleFor picks the style of output to w. Plain output is for screen
+// readers and dumb terminals: --plain asks for it, and TERM=dumb and
+// output that is not a terminal get it anyway.
+func styleFor(w io.Writer, opts Options) termStyle {
+	if opts.Plain || os.Getenv("TERM") == "dumb" || !isTerminal(w) {
+		return termStyle{plain: true}
+	}
+	return termStyle{color: useColor(w)}
+}
+
+// glyph is fancy, or its ASCII spelling in plain output
+func (s termStyle) glyph(fancy, ascii string) string {
+	if s.plain {
+		return ascii
+	}
+	return fancy
+}
+
+// terminalWidth is the width output is wrapped to: $COLUMNS, or 80
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n >= 20 {
+		return n
+	}
+	return 80
+}
+
+// paint wraps s in an ANSI style when color is on
+func paint(s, style string, color bool) string {
+	if !color || style == "" || s == "" {
+		return s
+	}
+	return style + s + ansiReset
+}
@@ -0,0 +1,38 @@
+// Command wasmplugin is the WASM plugin of the tests. Built for wasip1 it
+// flags lines with TODO when validating, and turns them into notes when
+// transforming.
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+func main() {
+	var req struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Exit(1)
+	}
+	resp := map[string]any{}
+	switch req.Role {
+	case "validate":
+		type finding struct {
+			Line    int    `json:"line"`
+			Message string `json:"message"`
+		}
+		findings := []finding{}
+		for i, line := range strings.Split(req.Content, "\n") {
+			if strings.Contains(line, "TODO") {
+				findings = append(findings, finding{Line: i + 1, Message: "leftover TODO"})
+			}
+		}
+		resp["findings"] = findings
+	case "transform":
+		resp["content"] = strings.ReplaceAll(req.Content, "TODO", "Note")
+	}
+	json.NewEncoder(os.Stdout).Encode(resp)
+}
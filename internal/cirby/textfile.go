@@ -0,0 +1,118 @@
+package cirby
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// scanConfig limits the files scanning reads:
+//
+//	scan:
+//	  max_file_size: 256KiB   # default 1MiB
+type scanConfig struct {
+	MaxFileSize int64
+}
+
+// maxFileSize is the largest source read, maxConfigSize unless set
+func (c scanConfig) maxFileSize() int64 {
+	if c.MaxFileSize > 0 {
+		return c.MaxFileSize
+	}
+	return maxConfigSize
+}
+
+// parseSize reads a size in bytes such as 4096, 64KiB, 64k or 1MiB
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	number := strings.TrimRight(s, "KMGiBbkmg")
+	unit := strings.ToLower(strings.TrimSpace(s[len(number):]))
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i") {
+	case "":
+		return n, nil
+	case "k":
+		return n << 10, nil
+	case "m":
+		return n << 20, nil
+	}
+	return 0, fmt.Errorf("invalid size %q", s)
+}
+
+// readSource reads a source config as normalized text. Files that are too
+// big, binary or not UTF-8 would only fill the prompt with noise, so they
+// are skipped with a warning and ok is false.
+func readSource(path string, limit int64, opts Options) (content string, ok bool) {
+	skip := func(reason string) (string, bool) {
+		fmt.Fprintf(opts.stdout(), "[warn] Skipping %s: %s\n", path, reason)
+		return "", false
+	}
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+	}
+	var info os.FileInfo
+	if err == nil {
+		info, err = f.Stat()
+	}
+	if err != nil {
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [error] %s (error reading: %v)\n", path, err)
+		}
+		return "", false
+	}
+	if !info.Mode().IsRegular() {
+		return skip("not a regular file")
+	}
+	if info.Size() > limit {
+		return skip(fmt.Sprintf("larger than %s (scan.max_file_size)", formatSize(limit)))
+	}
+	// The size may change between Stat and reading
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		if opts.Verbose {
+			fmt.Fprintf(opts.stdout(), "  [error] %s (error reading: %v)\n", path, err)
+		}
+		return "", false
+	}
+	if int64(len(data)) > limit {
+		return skip(fmt.Sprintf("larger than %s (scan.max_file_size)", formatSize(limit)))
+	}
+	if reason := notText(data); reason != "" {
+		return skip(reason)
+	}
+	return normalizeText(string(data)), true
+}
+
+// notText says why data is not UTF-8 text, or returns ""
+func notText(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xff, 0xfe}) || bytes.HasPrefix(data, []byte{0xfe, 0xff}) {
+		return "UTF-16 text; save it as UTF-8"
+	}
+	// Text files have no NUL bytes; looking at the start is enough
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return "binary file"
+	}
+	if !utf8.Valid(data) {
+		return "not UTF-8 text"
+	}
+	return ""
+}
+
+// formatSize prints a size the way parseSize reads it
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
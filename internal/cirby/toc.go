@@ -0,0 +1,110 @@
+package cirby
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tocSection names the table of contents block, kept at the top of
+// AGENTS.md between cirby:section markers
+const tocSection = "toc"
+
+// tocConfig turns on the table of contents:
+//
+//	toc:
+//	  enabled: true
+//	  depth: 3          # deepest heading level listed (default 2)
+//	  min_sections: 4   # only for files with at least this many sections
+type tocConfig struct {
+	Enabled     bool
+	Depth       int
+	MinSections int
+}
+
+// refreshTOC returns content with its table of contents block added,
+// updated or, when cfg says there should be none, removed. New blocks go
+// below the title.
+func refreshTOC(content string, cfg tocConfig) string {
+	toc := renderTOC(content, cfg)
+	start, _ := sectionMarkers(tocSection)
+	if toc == "" || strings.Contains(content, start) {
+		return replaceBlock(content, tocSection, toc)
+	}
+
+	block := replaceBlock("", tocSection, toc)
+	lines := splitLines(content)
+	if len(lines) > 0 && strings.HasPrefix(lines[0], "# ") {
+		rest := strings.TrimLeft(joinLines(lines[1:]), "\n")
+		return lines[0] + "\n\n" + block + "\n" + rest
+	}
+	return block + "\n" + content
+}
+
+// renderTOC lists the headings of content as links, or returns "" when
+// there are too few to need a table of contents
+func renderTOC(content string, cfg tocConfig) string {
+	if !cfg.Enabled {
+		return ""
+	}
+	depth := cfg.Depth
+	if depth < 2 {
+		depth = 2
+	}
+
+	start, end := sectionMarkers(tocSection)
+	var b strings.Builder
+	seen := map[string]int{}
+	sections := 0
+	inFence, inTOC := false, false
+	for _, line := range splitLines(content) {
+		switch strings.TrimSpace(line) {
+		case start:
+			inTOC = true
+		case end:
+			inTOC = false
+			continue
+		}
+		var heading bool
+		if heading, inFence = markdownHeading(line, inFence); !heading || inTOC {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		title := strings.TrimSpace(strings.TrimRight(trimmed[level:], "#"))
+		anchor := headingAnchor(title)
+		// GitHub numbers repeated anchors
+		if n := seen[anchor]; n > 0 {
+			seen[anchor]++
+			anchor = fmt.Sprintf("%s-%d", anchor, n)
+		} else {
+			seen[anchor] = 1
+		}
+		if level < 2 || level > depth {
+			continue
+		}
+		if level == 2 {
+			sections++
+		}
+		fmt.Fprintf(&b, "%s- [%s](#%s)\n", strings.Repeat("  ", level-2), title, anchor)
+	}
+	if sections == 0 || sections < cfg.MinSections {
+		return ""
+	}
+	return "**Contents**\n\n" + strings.TrimRight(b.String(), "\n")
+}
+
+// headingAnchor is the link target GitHub gives a heading: lower case,
+// punctuation dropped, spaces as hyphens
+func headingAnchor(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,447 @@
+package cirby
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the TOML used by tool config files: tables, arrays of
+// tables, dotted keys, basic and literal strings (single and multi-line),
+// integers, floats, booleans, arrays and inline tables. Tables decode to
+// map[string]any, arrays to []any, integers to int64 and floats to
+// float64; dates and times are kept as strings.
+func parseTOML(data []byte) (map[string]any, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	p := &tomlParser{data: strings.TrimPrefix(text, "\ufeff"), line: 1}
+	root := map[string]any{}
+	current := root
+
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.data) {
+			return root, nil
+		}
+		var err error
+		switch {
+		case strings.HasPrefix(p.data[p.pos:], "[["):
+			p.pos += 2
+			var keys []string
+			if keys, err = p.parseKey(); err == nil {
+				err = p.expect("]]")
+			}
+			if err == nil {
+				current, err = tomlArrayTable(root, keys)
+			}
+		case p.data[p.pos] == '[':
+			p.pos++
+			var keys []string
+			if keys, err = p.parseKey(); err == nil {
+				err = p.expect("]")
+			}
+			if err == nil {
+				current, err = tomlTable(root, keys)
+			}
+		default:
+			err = p.parseKeyValue(current)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("toml line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips spaces and comments, and newlines when multiline is set
+func (p *tomlParser) skipBlank(multiline bool) {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '\n' && multiline:
+			p.pos++
+			p.line++
+		case c == '#':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) expect(s string) error {
+	p.skipBlank(false)
+	if !strings.HasPrefix(p.data[p.pos:], s) {
+		return p.errorf("expected %q", s)
+	}
+	p.pos += len(s)
+	return nil
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.pos < len(p.data) && p.data[p.pos] != '\n' {
+		return p.errorf("unexpected %q after value", p.rest())
+	}
+	return nil
+}
+
+// rest returns the remainder of the current line, for error messages
+func (p *tomlParser) rest() string {
+	line, _, _ := strings.Cut(p.data[p.pos:], "\n")
+	return line
+}
+
+// parseKey reads a possibly dotted key such as a."b.c".d
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("expected key")
+		}
+		var key string
+		switch p.data[p.pos] {
+		case '"', '\'':
+			value, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			key = value
+		default:
+			start := p.pos
+			for p.pos < len(p.data) && isTOMLBareKeyChar(p.data[p.pos]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("invalid key %q", p.rest())
+			}
+			key = p.data[start:p.pos]
+		}
+		keys = append(keys, key)
+		p.skipBlank(false)
+		if p.pos >= len(p.data) || p.data[p.pos] != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isTOMLBareKeyChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *tomlParser) parseKeyValue(table map[string]any) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := table[key].(map[string]any)
+		if !ok {
+			if _, exists := table[key]; exists {
+				return p.errorf("key %q is not a table", key)
+			}
+			next = map[string]any{}
+			table[key] = next
+		}
+		table = next
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table[last]; exists {
+		return p.errorf("duplicate key %q", strings.Join(keys, "."))
+	}
+	table[last] = value
+	return nil
+}
+
+func (p *tomlParser) parseValue() (any, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("expected value")
+	}
+	switch p.data[p.pos] {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	for p.pos < len(p.data) && !strings.ContainsRune(",]}# \t\n", rune(p.data[p.pos])) {
+		p.pos++
+	}
+	// A date and time may be separated by a space
+	if p.pos-start == 10 && p.data[start+4] == '-' && p.pos+1 < len(p.data) &&
+		p.data[p.pos] == ' ' && p.data[p.pos+1] >= '0' && p.data[p.pos+1] <= '9' {
+		p.pos++
+		for p.pos < len(p.data) && !strings.ContainsRune(",]}# \t\n", rune(p.data[p.pos])) {
+			p.pos++
+		}
+	}
+	token := p.data[start:p.pos]
+	switch token {
+	case "":
+		return nil, p.errorf("expected value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	number := strings.ReplaceAll(token, "_", "")
+	if i, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(strings.NewReplacer("inf", "Inf", "nan", "NaN").Replace(number), 64); err == nil {
+		return f, nil
+	}
+	if token[0] >= '0' && token[0] <= '9' {
+		return token, nil // date or time
+	}
+	return nil, p.errorf("invalid value %q", token)
+}
+
+func (p *tomlParser) parseArray() ([]any, error) {
+	p.pos++ // [
+	items := []any{}
+	for {
+		p.skipBlank(true)
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.data[p.pos] == ']' {
+			p.pos++
+			return items, nil
+		}
+		item, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		p.skipBlank(true)
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.data) && p.data[p.pos] != ']' {
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (map[string]any, error) {
+	p.pos++ // {
+	table := map[string]any{}
+	for {
+		p.skipBlank(false)
+		if p.pos >= len(p.data) || p.data[p.pos] == '\n' {
+			return nil, p.errorf("unterminated inline table")
+		}
+		if p.data[p.pos] == '}' {
+			p.pos++
+			return table, nil
+		}
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+		} else if p.pos < len(p.data) && p.data[p.pos] != '}' {
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+func (p *tomlParser) parseString() (string, error) {
+	rest := p.data[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return p.parseMultilineString(`"""`, true)
+	case strings.HasPrefix(rest, "'''"):
+		return p.parseMultilineString("'''", false)
+	case rest[0] == '\'':
+		end := strings.IndexAny(rest[1:], "'\n")
+		if end < 0 || rest[1+end] != '\'' {
+			return "", p.errorf("unterminated string")
+		}
+		p.pos += end + 2
+		return rest[1 : 1+end], nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(rest); i++ {
+		switch c := rest[i]; c {
+		case '"':
+			p.pos += i + 1
+			return b.String(), nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '\\':
+			n, err := p.unescape(rest[i:], &b)
+			if err != nil {
+				return "", err
+			}
+			i += n - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *tomlParser) parseMultilineString(delim string, escapes bool) (string, error) {
+	p.pos += len(delim)
+	// A newline right after the opening delimiter is trimmed
+	if strings.HasPrefix(p.data[p.pos:], "\n") {
+		p.pos++
+		p.line++
+	}
+	end := strings.Index(p.data[p.pos:], delim)
+	if end < 0 {
+		return "", p.errorf("unterminated multi-line string")
+	}
+	// Up to two quotes may directly precede the closing delimiter
+	for extra := 0; extra < 2 && p.pos+end+len(delim) < len(p.data) && p.data[p.pos+end+len(delim)] == delim[0]; extra++ {
+		end++
+	}
+	raw := p.data[p.pos : p.pos+end]
+	p.line += strings.Count(raw, "\n")
+	p.pos += end + len(delim)
+	if !escapes {
+		return raw, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			b.WriteByte(raw[i])
+			continue
+		}
+		// A backslash at the end of a line trims the following whitespace
+		if trimmed := strings.TrimLeft(raw[i+1:], " \t"); strings.HasPrefix(trimmed, "\n") {
+			i = len(raw) - len(strings.TrimLeft(trimmed, " \t\n")) - 1
+			continue
+		}
+		n, err := p.unescape(raw[i:], &b)
+		if err != nil {
+			return "", err
+		}
+		i += n - 1
+	}
+	return b.String(), nil
+}
+
+// unescape decodes the escape sequence at the start of s into b and
+// returns its length
+func (p *tomlParser) unescape(s string, b *strings.Builder) (int, error) {
+	if len(s) < 2 {
+		return 0, p.errorf("invalid escape")
+	}
+	simple := map[byte]byte{'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r', 'e': 0x1b, '"': '"', '\\': '\\'}
+	if c, ok := simple[s[1]]; ok {
+		b.WriteByte(c)
+		return 2, nil
+	}
+	size := map[byte]int{'u': 4, 'U': 8}[s[1]]
+	if size == 0 || len(s) < 2+size {
+		return 0, p.errorf("invalid escape %q", s[:2])
+	}
+	code, err := strconv.ParseUint(s[2:2+size], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, p.errorf("invalid escape %q", s[:2+size])
+	}
+	b.WriteRune(rune(code))
+	return 2 + size, nil
+}
+
+// tomlTable returns the table at keys, creating it if needed
+func tomlTable(root map[string]any, keys []string) (map[string]any, error) {
+	table := root
+	for _, key := range keys {
+		switch next := table[key].(type) {
+		case nil:
+			created := map[string]any{}
+			table[key] = created
+			table = created
+		case map[string]any:
+			table = next
+		case []any:
+			// The last element of an array of tables
+			last, ok := next[len(next)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("toml: key %q is not a table", key)
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("toml: key %q is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// tomlArrayTable appends a new table to the array of tables at keys
+func tomlArrayTable(root map[string]any, keys []string) (map[string]any, error) {
+	parent, err := tomlTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	table := map[string]any{}
+	switch existing := parent[last].(type) {
+	case nil:
+		parent[last] = []any{table}
+	case []any:
+		parent[last] = append(existing, table)
+	default:
+		return nil, fmt.Errorf("toml: key %q is not an array of tables", last)
+	}
+	return table, nil
+}
+
+// formatTOMLString quotes s as a TOML basic string, using the multi-line
+// form when s contains newlines
+func formatTOMLString(s string) string {
+	multiline := strings.Contains(s, "\n")
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\n' && multiline, r == '\t':
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if multiline {
+		return `"""` + "\n" + b.String() + `"""`
+	}
+	return `"` + b.String() + `"`
+}
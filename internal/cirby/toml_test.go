@@ -0,0 +1,130 @@
+package cirby
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]any
+	}{
+		{
+			name: "scalars",
+			in:   "name = \"codex\" # comment\ncount = 1_000\nhex = 0x1F\nratio = 0.5\nbig = 1e3\non = true\noff = false\nwhen = 1979-05-27T07:32:00Z\n",
+			want: map[string]any{
+				"name": "codex", "count": int64(1000), "hex": int64(31), "ratio": 0.5, "big": 1000.0,
+				"on": true, "off": false, "when": "1979-05-27T07:32:00Z",
+			},
+		},
+		{
+			name: "date and time separated by a space",
+			in:   "when = 1979-05-27 07:32:00\n",
+			want: map[string]any{"when": "1979-05-27 07:32:00"},
+		},
+		{
+			name: "strings and escapes",
+			in:   `basic = "tab\there \"q\" \u00e9"` + "\n" + `literal = 'C:\path\n'` + "\n",
+			want: map[string]any{"basic": "tab\there \"q\" é", "literal": `C:\path\n`},
+		},
+		{
+			name: "multi-line strings",
+			in:   "a = \"\"\"\nline one\nline two\"\"\"\nb = '''\nraw \\n\n'''\nc = \"\"\"joined \\\n    here\"\"\"\n",
+			want: map[string]any{"a": "line one\nline two", "b": "raw \\n\n", "c": "joined here"},
+		},
+		{
+			name: "quotes before the closing delimiter",
+			in:   `a = """say "hi"""""` + "\n",
+			want: map[string]any{"a": `say "hi""`},
+		},
+		{
+			name: "tables and dotted keys",
+			in:   "[mcp_servers.github]\ncommand = \"gh\"\nenv.TOKEN = \"x\"\n\n[\"quoted.table\"]\nk = 1\n",
+			want: map[string]any{
+				"mcp_servers":  map[string]any{"github": map[string]any{"command": "gh", "env": map[string]any{"TOKEN": "x"}}},
+				"quoted.table": map[string]any{"k": int64(1)},
+			},
+		},
+		{
+			name: "arrays of tables",
+			in:   "[[rules]]\nname = \"a\"\n[[rules]]\nname = \"b\"\n[rules.opts]\nx = 1\n",
+			want: map[string]any{"rules": []any{
+				map[string]any{"name": "a"},
+				map[string]any{"name": "b", "opts": map[string]any{"x": int64(1)}},
+			}},
+		},
+		{
+			name: "arrays and inline tables",
+			in:   "args = [\n  \"--stdio\", # first\n  \"-v\",\n]\nnested = [[1, 2], []]\nenv = { A = \"1\", b.c = 2 }\n",
+			want: map[string]any{
+				"args":   []any{"--stdio", "-v"},
+				"nested": []any{[]any{int64(1), int64(2)}, []any{}},
+				"env":    map[string]any{"A": "1", "b": map[string]any{"c": int64(2)}},
+			},
+		},
+		{
+			name: "BOM and CRLF",
+			in:   "\ufeffa = 1\r\nb = 'x'\r\n",
+			want: map[string]any{"a": int64(1), "b": "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"duplicate key", "a = 1\na = 2\n", `toml line 2: duplicate key "a"`},
+		{"key is not a table", "a = 1\na.b = 2\n", `toml line 2: key "a" is not a table`},
+		{"unterminated string", "a = \"open\nb = 1\n", "toml line 1: unterminated string"},
+		{"unterminated array", "a = [1, 2\n", "toml line 2: unterminated array"},
+		{"missing comma", "a = [1 2]\n", "toml line 1: expected ',' or ']' in array"},
+		{"inline table across lines", "a = { b = 1,\n}\n", "toml line 1: unterminated inline table"},
+		{"text after value", "a = 1 b\n", `toml line 1: unexpected "b" after value`},
+		{"invalid value", "a = yes\n", `toml line 1: invalid value "yes"`},
+		{"invalid escape", `a = "\q"` + "\n", `toml line 1: invalid escape "\\q"`},
+		{"missing equals", "a 1\n", `toml line 1: expected "="`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseTOML error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTOMLString(t *testing.T) {
+	for _, s := range []string{
+		"plain",
+		`quote " and backslash \`,
+		"tab\tand control \x01",
+		"two\nlines\n",
+		"ends with a quote\"",
+	} {
+		doc, err := parseTOML([]byte("v = " + formatTOMLString(s) + "\n"))
+		if err != nil {
+			t.Fatalf("parsing formatTOMLString(%q): %v", s, err)
+		}
+		if doc["v"] != s {
+			t.Errorf("formatTOMLString(%q) read back as %q", s, doc["v"])
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package cirby
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// apiRequestTimeout bounds a single API request; a merge may take minutes
+const apiRequestTimeout = 5 * time.Minute
+
+// apiHTTPClient returns the client for API requests. It honors
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY, and the proxy, CA bundle and
+// client certificate configured under api: in .cirby.yaml.
+func apiHTTPClient(opts Options) (*http.Client, error) {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := apiTransport(cfg.API)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Path, err)
+	}
+	if opts.Verbose {
+		if cfg.API.Proxy != "" {
+			fmt.Fprintf(opts.stdout(), "  - API proxy: %s\n", redactURL(cfg.API.Proxy))
+		}
+		if cfg.API.CABundle != "" {
+			fmt.Fprintf(opts.stdout(), "  - Trusting CA bundle %s\n", cfg.API.CABundle)
+		}
+	}
+	return &http.Client{Timeout: apiRequestTimeout, Transport: transport}, nil
+}
+
+// apiTransport builds an HTTP transport from the api: settings
+func apiTransport(cfg apiConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("api.proxy is not a URL: %s", cfg.Proxy)
+		}
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if bypassProxy(req.URL.Hostname()) {
+				return nil, nil
+			}
+			return proxy, nil
+		}
+	}
+
+	if cfg.CABundle == "" && cfg.ClientCert == "" {
+		return transport, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CABundle != "" {
+		pem, err := os.ReadFile(expandHome(cfg.CABundle))
+		if err != nil {
+			return nil, fmt.Errorf("reading api.ca_bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("api.ca_bundle %s contains no PEM certificates", cfg.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(expandHome(cfg.ClientCert), expandHome(cfg.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("loading api.client_cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// bypassProxy reports whether NO_PROXY lists host, as a name, a domain
+// suffix (".example.com" or "example.com") or "*"
+func bypassProxy(host string) bool {
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	host = strings.ToLower(host)
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if h, _, ok := strings.Cut(entry, ":"); ok {
+			entry = h
+		}
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+// redactURL hides the password of a proxy URL
+func redactURL(raw string) string {
+	if u, err := url.Parse(raw); err == nil {
+		return u.Redacted()
+	}
+	return raw
+}
@@ -0,0 +1,303 @@
+package cirby
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const latestReleaseURL = "https://api.github.com/repos/poshboytl/cirby/releases/latest"
+
+// releasePublicKey is the base64 Ed25519 public key the checksums of every
+// release are signed with. Release builds pin it with
+//
+//	-ldflags "-X github.com/poshboytl/cirby/internal/cirby.releasePublicKey=..."
+//
+// Without it a binary cannot tell a real release from one published by
+// whoever took over the repository or its downloads, so it does not upgrade.
+var releasePublicKey = ""
+
+// maxChecksumsSize bounds the checksums file and its signature
+const maxChecksumsSize = 1 << 20
+
+// githubRelease is the subset of the GitHub releases API we rely on
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r githubRelease) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// Upgrade replaces the running binary with the latest release. With
+// opts.CheckOnly it only reports whether the binary is outdated, returning
+// an error when it is so CI can fail on stale images.
+func Upgrade(opts Options) error {
+	if Version == "dev" {
+		return fmt.Errorf("development builds cannot be upgraded; use go install or a release binary")
+	}
+
+	if err := requireOnline("upgrade", opts); err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 60 * time.Second}
+	release, err := fetchLatestRelease(client)
+	if err != nil {
+		return fmt.Errorf("checking for updates: %w", err)
+	}
+
+	latest := strings.TrimPrefix(release.TagName, "v")
+	if compareVersions(latest, Version) <= 0 {
+		fmt.Fprintf(opts.stdout(), "[ok] cirby v%s is up to date.\n", Version)
+		return nil
+	}
+
+	if opts.CheckOnly {
+		return fmt.Errorf("cirby v%s is available (current: v%s); run `cirby upgrade`", latest, Version)
+	}
+
+	asset := fmt.Sprintf("cirby-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		asset += ".exe"
+	}
+	binaryURL := release.assetURL(asset)
+	if binaryURL == "" {
+		return fmt.Errorf("release v%s has no binary for %s/%s", latest, runtime.GOOS, runtime.GOARCH)
+	}
+	want, err := fetchChecksum(client, release, asset)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("locating current binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("locating current binary: %w", err)
+	}
+
+	if opts.DryRun {
+		fmt.Fprintf(opts.stdout(), "[Dry Run] Would replace %s with v%s (%s)\n", exe, latest, asset)
+		return nil
+	}
+
+	fmt.Fprintf(opts.stdout(), "Downloading cirby v%s...\n", latest)
+	// Download next to the binary so the final rename stays on one filesystem
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".cirby-upgrade-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	got, err := download(client, binaryURL, tmp)
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", asset, err)
+	}
+	if got != want {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset, want, got)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	if err := replaceBinary(tmp.Name(), exe); err != nil {
+		return fmt.Errorf("installing new binary: %w", err)
+	}
+
+	fmt.Fprintf(opts.stdout(), "[ok] Upgraded cirby v%s -> v%s\n", Version, latest)
+	return nil
+}
+
+func fetchLatestRelease(client *http.Client) (githubRelease, error) {
+	var release githubRelease
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return release, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return release, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return release, fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return release, fmt.Errorf("parsing release: %w", err)
+	}
+	return release, nil
+}
+
+// fetchChecksum finds the expected SHA-256 of asset, either from a
+// checksums.txt file (sha256sum format) or a per-asset .sha256 file. The
+// file must carry a valid signature, in <file>.sig, by releasePublicKey.
+func fetchChecksum(client *http.Client, release githubRelease, asset string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("this build pins no release signing key, so it cannot verify releases; install the new version with go install or from the releases page")
+	}
+
+	name := "checksums.txt"
+	if release.assetURL(name) == "" {
+		name = asset + ".sha256"
+	}
+	url, sigURL := release.assetURL(name), release.assetURL(name+".sig")
+	if url == "" {
+		return "", fmt.Errorf("release %s publishes no checksums; refusing to install an unverified binary", release.TagName)
+	}
+	if sigURL == "" {
+		return "", fmt.Errorf("release %s publishes no signature for %s; refusing to install an unverified binary", release.TagName, name)
+	}
+	sums, err := fetchSmall(client, url)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", name, err)
+	}
+	sig, err := fetchSmall(client, sigURL)
+	if err != nil {
+		return "", fmt.Errorf("downloading %s.sig: %w", name, err)
+	}
+	if !verifyReleaseSignature(ed25519.PublicKey(key), sums, sig) {
+		return "", fmt.Errorf("the signature of %s in release %s does not match the pinned release key; refusing to install", name, release.TagName)
+	}
+
+	// Only a line naming exactly this asset counts
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != asset {
+			continue
+		}
+		if sum, err := hex.DecodeString(fields[0]); err != nil || len(sum) != sha256.Size {
+			return "", fmt.Errorf("%s lists an invalid checksum for %s", name, asset)
+		}
+		return strings.ToLower(fields[0]), nil
+	}
+	return "", fmt.Errorf("no checksum listed for %s", asset)
+}
+
+// verifyReleaseSignature checks sig over data, given raw or in base64 as
+// written by `openssl pkeyutl -sign -rawin | base64`
+func verifyReleaseSignature(key ed25519.PublicKey, data, sig []byte) bool {
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(sig)), ""))
+		if err != nil {
+			return false
+		}
+		sig = decoded
+	}
+	return len(sig) == ed25519.SignatureSize && ed25519.Verify(key, data, sig)
+}
+
+// fetchSmall downloads url, which must be under maxChecksumsSize
+func fetchSmall(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxChecksumsSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxChecksumsSize {
+		return nil, fmt.Errorf("larger than %s", formatSize(maxChecksumsSize))
+	}
+	return data, nil
+}
+
+// download writes url to w and returns the hex SHA-256 of the body
+func download(client *http.Client, url string, w io.Writer) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), resp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replaceBinary atomically swaps newPath into place. Windows cannot
+// overwrite a running executable, so the old one is moved aside first.
+func replaceBinary(newPath, exe string) error {
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(newPath, exe); err != nil {
+			os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(newPath, exe)
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+// Pre-release suffixes ("1.2.0-rc1") are ignored.
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v, _, _ = strings.Cut(strings.TrimPrefix(v, "v"), "-")
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
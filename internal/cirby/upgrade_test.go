@@ -0,0 +1,169 @@
+package cirby
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchChecksum(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	const asset = "cirby-linux-amd64"
+	sum := strings.Repeat("ab", 32)
+	sign := func(key ed25519.PrivateKey, data string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(data)))
+	}
+
+	tests := []struct {
+		name    string
+		pinned  string
+		files   map[string]string // release assets by name
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "signed checksums.txt",
+			pinned: base64.StdEncoding.EncodeToString(public),
+			files: map[string]string{
+				"checksums.txt":     strings.Repeat("cd", 32) + "  cirby-darwin-arm64\n" + sum + "  " + asset + "\n",
+				"checksums.txt.sig": sign(private, strings.Repeat("cd", 32)+"  cirby-darwin-arm64\n"+sum+"  "+asset+"\n"),
+			},
+			want: sum,
+		},
+		{
+			name:   "binary mode marker",
+			pinned: base64.StdEncoding.EncodeToString(public),
+			files: map[string]string{
+				asset + ".sha256":     sum + " *" + asset + "\n",
+				asset + ".sha256.sig": sign(private, sum+" *"+asset+"\n"),
+			},
+			want: sum,
+		},
+		{
+			name:   "a line without a name matches nothing",
+			pinned: base64.StdEncoding.EncodeToString(public),
+			files: map[string]string{
+				"checksums.txt":     sum + "\n",
+				"checksums.txt.sig": sign(private, sum+"\n"),
+			},
+			wantErr: "no checksum listed for " + asset,
+		},
+		{
+			name:   "another asset's line matches nothing",
+			pinned: base64.StdEncoding.EncodeToString(public),
+			files: map[string]string{
+				"checksums.txt":     sum + "  " + asset + ".exe\n",
+				"checksums.txt.sig": sign(private, sum+"  "+asset+".exe\n"),
+			},
+			wantErr: "no checksum listed for " + asset,
+		},
+		{
+			name:   "signed by another key",
+			pinned: base64.StdEncoding.EncodeToString(public),
+			files: map[string]string{
+				"checksums.txt":     sum + "  " + asset + "\n",
+				"checksums.txt.sig": sign(otherKey, sum+"  "+asset+"\n"),
+			},
+			wantErr: "does not match the pinned release key",
+		},
+		{
+			name:   "checksums changed after signing",
+			pinned: base64.StdEncoding.EncodeToString(public),
+			files: map[string]string{
+				"checksums.txt":     strings.Repeat("ef", 32) + "  " + asset + "\n",
+				"checksums.txt.sig": sign(private, sum+"  "+asset+"\n"),
+			},
+			wantErr: "does not match the pinned release key",
+		},
+		{
+			name:    "unsigned",
+			pinned:  base64.StdEncoding.EncodeToString(public),
+			files:   map[string]string{"checksums.txt": sum + "  " + asset + "\n"},
+			wantErr: "publishes no signature for checksums.txt",
+		},
+		{
+			name:    "no checksums",
+			pinned:  base64.StdEncoding.EncodeToString(public),
+			files:   map[string]string{},
+			wantErr: "publishes no checksums",
+		},
+		{
+			name:   "no pinned key",
+			pinned: "",
+			files: map[string]string{
+				"checksums.txt":     sum + "  " + asset + "\n",
+				"checksums.txt.sig": sign(private, sum+"  "+asset+"\n"),
+			},
+			wantErr: "pins no release signing key",
+		},
+		{
+			name:   "invalid checksum",
+			pinned: base64.StdEncoding.EncodeToString(public),
+			files: map[string]string{
+				"checksums.txt":     "not-hex  " + asset + "\n",
+				"checksums.txt.sig": sign(private, "not-hex  "+asset+"\n"),
+			},
+			wantErr: "invalid checksum",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				content, ok := tt.files[strings.TrimPrefix(r.URL.Path, "/")]
+				if !ok {
+					http.NotFound(w, r)
+					return
+				}
+				w.Write([]byte(content))
+			}))
+			defer server.Close()
+
+			release := githubRelease{TagName: "v9.9.9"}
+			for name := range tt.files {
+				release.Assets = append(release.Assets, struct {
+					Name string `json:"name"`
+					URL  string `json:"browser_download_url"`
+				}{name, server.URL + "/" + name})
+			}
+			pinned := releasePublicKey
+			releasePublicKey = tt.pinned
+			defer func() { releasePublicKey = pinned }()
+
+			got, err := fetchChecksum(server.Client(), release, asset)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("fetchChecksum = %q, %v; want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("fetchChecksum = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"0.2.0", "0.2.0", 0},
+		{"v0.2.1", "0.2.0", 1},
+		{"0.10.0", "0.9.9", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.2.0-rc1", "1.2.0", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
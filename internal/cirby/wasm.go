@@ -0,0 +1,175 @@
+package cirby
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// wasmPlugin is a WebAssembly module that checks or rewrites every merged
+// file, run inside cirby rather than as a program of its own:
+//
+//	plugins:
+//	  - name: house-rules
+//	    wasm: plugins/house-rules.wasm
+//	    role: validate        # or transform
+//
+// The module is a WASI command. It gets a wasmRequest on stdin and
+// answers with a wasmResponse on stdout. It sees no files, network or
+// environment, and its clock and random numbers are fixed, so the same
+// input always gives the same result.
+type wasmPlugin struct {
+	Name   string
+	Module string // path of the .wasm file, relative to the project root
+	Role   string // "validate" or "transform"
+}
+
+// wasmRoles are what a WASM plugin can do
+var wasmRoles = []string{"validate", "transform"}
+
+// wasmRequest is what a WASM plugin reads on stdin
+type wasmRequest struct {
+	Version int    `json:"version"` // of this contract, 1
+	Role    string `json:"role"`
+	Path    string `json:"path"` // the canonical file
+	Content string `json:"content"`
+}
+
+// wasmResponse is what a WASM plugin prints, e.g.
+//
+//	{"findings": [{"line": 12, "message": "mentions an internal host"}]}
+//	{"content": "# Project\n..."}
+type wasmResponse struct {
+	Findings []struct {
+		Line     int    `json:"line"`     // 0 for the whole file
+		Severity string `json:"severity"` // error (default) or warning
+		Message  string `json:"message"`
+	} `json:"findings"` // validate
+	Content *string `json:"content"` // transform: the new file
+}
+
+// wasmCacheDir is where compiled modules are kept, so a plugin is only
+// compiled again when it changes
+func wasmCacheDir() (string, error) {
+	root, err := stateRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "wasm"), nil
+}
+
+// run gives content to the module and returns its answer
+func (p wasmPlugin) run(path, content string) (wasmResponse, error) {
+	module, err := os.ReadFile(p.Module)
+	if err != nil {
+		return wasmResponse{}, err
+	}
+	input, err := json.Marshal(wasmRequest{Version: 1, Role: p.Role, Path: filepath.ToSlash(path), Content: content})
+	if err != nil {
+		return wasmResponse{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+	defer cancel()
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if dir, err := wasmCacheDir(); err == nil {
+		if cache, err := wazero.NewCompilationCacheWithDir(dir); err == nil {
+			defer cache.Close(ctx)
+			config = config.WithCompilationCache(cache)
+		}
+	}
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	defer runtime.Close(ctx)
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	compiled, err := runtime.CompileModule(ctx, module)
+	if err != nil {
+		return wasmResponse{}, fmt.Errorf("%s: %w", p.Module, err)
+	}
+	var out bytes.Buffer
+	_, err = runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName(p.Name).
+		WithArgs(p.Name).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(&out).
+		WithStderr(os.Stderr))
+	var exit *sys.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return wasmResponse{}, fmt.Errorf("%s did not finish within %s", p.Module, pluginTimeout)
+	case errors.As(err, &exit) && exit.ExitCode() == 0:
+	case err != nil:
+		return wasmResponse{}, fmt.Errorf("%s: %w", p.Module, err)
+	}
+
+	var resp wasmResponse
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		return wasmResponse{}, fmt.Errorf("%s: expected a JSON object: %w", p.Module, err)
+	}
+	return resp, nil
+}
+
+// wasmFindings runs the validate plugins on the content of path. A plugin
+// that fails is a finding too, so a broken module does not pass silently.
+func wasmFindings(path, content string, plugins []wasmPlugin) []lintFinding {
+	var findings []lintFinding
+	for _, p := range plugins {
+		if p.Role != "validate" {
+			continue
+		}
+		resp, err := p.run(path, content)
+		if err != nil {
+			findings = append(findings, lintFinding{Rule: p.Name, Severity: "error", Message: fmt.Sprintf("plugin %s failed: %v", p.Name, err)})
+			continue
+		}
+		for _, f := range resp.Findings {
+			severity := f.Severity
+			if severity != "warning" {
+				severity = "error"
+			}
+			findings = append(findings, lintFinding{Rule: p.Name, Severity: severity, Line: f.Line, Message: f.Message})
+		}
+	}
+	return findings
+}
+
+// transformMerge runs the transform plugins over agentsPath, each on what
+// the one before it returned
+func transformMerge(agentsPath string, opts Options) error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	for _, p := range cfg.Wasm {
+		if p.Role != "transform" {
+			continue
+		}
+		data, err := os.ReadFile(agentsPath)
+		if err != nil {
+			return err
+		}
+		resp, err := p.run(agentsPath, string(data))
+		if err != nil {
+			return fmt.Errorf("plugin %s: %w", p.Name, err)
+		}
+		if resp.Content == nil || strings.TrimSpace(*resp.Content) == "" {
+			return fmt.Errorf("plugin %s: returned no content for %s", p.Name, agentsPath)
+		}
+		if *resp.Content == string(data) {
+			continue
+		}
+		if err := writeFile(agentsPath, []byte(*resp.Content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", agentsPath, err)
+		}
+		fmt.Fprintf(opts.stdout(), "[ok] Transformed %s with the %s plugin\n", agentsPath, p.Name)
+	}
+	return nil
+}
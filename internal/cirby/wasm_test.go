@@ -0,0 +1,77 @@
+package cirby
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildWasmPlugin compiles testdata/wasmplugin for wasip1
+func buildWasmPlugin(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds a WASM module")
+	}
+	module := filepath.Join(t.TempDir(), "plugin.wasm")
+	cmd := exec.Command("go", "build", "-o", module, "./testdata/wasmplugin")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("building the WASM plugin: %v\n%s", err, out)
+	}
+	return module
+}
+
+func TestWasmPlugins(t *testing.T) {
+	module := buildWasmPlugin(t)
+	testProject(t, map[string]string{
+		"CLAUDE.md": "# Claude\n\n- TODO: describe the tests\n",
+		".cirby.yaml": "plugins:\n" +
+			"  - name: todos\n    wasm: " + module + "\n    role: validate\n" +
+			"  - name: notes\n    wasm: " + module + "\n    role: transform\n",
+	})
+
+	var out bytes.Buffer
+	opts := testOptions(mockAgent, &out)
+	if err := Run(opts); err != nil {
+		t.Fatalf("Run: %v\n%s", err, out.String())
+	}
+	if got := readAgentsMD(t); strings.Contains(got, "TODO") || !strings.Contains(got, "Note: describe the tests") {
+		t.Errorf("AGENTS.md was not transformed:\n%s", got)
+	}
+	if !strings.Contains(out.String(), "Transformed AGENTS.md with the notes plugin") {
+		t.Errorf("output does not mention the transform:\n%s", out.String())
+	}
+
+	if err := os.WriteFile("NOTES.md", []byte("# Notes\n\nTODO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := Validate([]string{"NOTES.md"}, opts); err == nil {
+		t.Errorf("Validate passed a file with a TODO:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "[error] NOTES.md: line 3: leftover TODO") {
+		t.Errorf("Validate output:\n%s", out.String())
+	}
+}
+
+func TestParseWasmPlugins(t *testing.T) {
+	tests := []struct {
+		name string
+		in   map[string]any
+		err  string
+	}{
+		{name: "no role", in: map[string]any{"name": "x", "wasm": "x.wasm"}, err: "role must be validate or transform"},
+		{name: "command and module", in: map[string]any{"name": "x", "wasm": "x.wasm", "role": "validate", "command": "./x"}, err: "not both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parsePlugins([]any{tt.in}, ".cirby.yaml")
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package cirby
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// workspaceFile lists the members of a workspace, like go.work:
+//
+//	// Members are merged in order, each as if cirby ran in it
+//	use (
+//		./frontend
+//		./backend agent=gemini model=gemini-2.5-flash
+//		../shared-docs output=docs/AGENTS.md   // or another repository
+//	)
+//	use ./infra recursive=true
+const workspaceFile = "cirby.work"
+
+// workspaceMember is a directory of cirby.work with its overrides
+type workspaceMember struct {
+	Dir       string
+	Agent     string
+	Model     string
+	Output    string
+	Recursive bool
+}
+
+// parseWorkspace reads the use directives of a cirby.work file
+func parseWorkspace(data []byte, path string) ([]workspaceMember, error) {
+	var members []workspaceMember
+	inBlock := false
+	for i, line := range splitLines(string(data)) {
+		line, _, _ = strings.Cut(line, "//")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			continue
+		case inBlock:
+		case fields[0] == "use" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+			continue
+		case fields[0] == "use" && len(fields) > 1:
+			fields = fields[1:]
+		default:
+			return nil, fmt.Errorf("%s:%d: expected use DIR or use ( ... )", path, i+1)
+		}
+
+		m := workspaceMember{Dir: filepath.Clean(fields[0])}
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("%s:%d: %s: overrides are KEY=VALUE", path, i+1, field)
+			case key == "agent":
+				m.Agent = value
+			case key == "model":
+				m.Model = value
+			case key == "output":
+				if err := validateOutput(value); err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+				}
+				m.Output = value
+			case key == "recursive":
+				m.Recursive = value == "true"
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown override %s (agent, model, output, recursive)", path, i+1, key)
+			}
+		}
+		members = append(members, m)
+	}
+	if inBlock {
+		return nil, fmt.Errorf("%s: use ( is missing its )", path)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("%s: no members; add use DIR lines", path)
+	}
+	return members, nil
+}
+
+// runWorkspace merges every member of cirby.work in its own directory.
+// Members without an agent= override share one agent, chosen once.
+func runWorkspace(opts Options) error {
+	data, err := os.ReadFile(workspaceFile)
+	if err != nil {
+		return err
+	}
+	members, err := parseWorkspace(data, workspaceFile)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := validateMember(m.Dir); err != nil {
+			return err
+		}
+	}
+
+	shared := opts.Agent
+	if shared == "" && slices.ContainsFunc(members, func(m workspaceMember) bool { return m.Agent == "" }) {
+		agent, err := selectAgent(opts)
+		if err != nil {
+			return err
+		}
+		shared = agent.Name
+	}
+
+	root, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	var results []targetResult
+	for _, m := range members {
+		fmt.Fprintf(opts.stdout(), "\n== %s ==\n", m.Dir)
+		memberOpts := opts
+		memberOpts.member = true
+		var memberResults []targetResult
+		memberOpts.results = &memberResults
+		memberOpts.Agent = shared
+		if m.Agent != "" {
+			memberOpts.Agent = m.Agent
+		}
+		if m.Model != "" {
+			memberOpts.Model = m.Model
+		}
+		if m.Output != "" {
+			memberOpts.Output = m.Output
+		}
+		memberOpts.Recursive = opts.Recursive || m.Recursive
+
+		if err := os.Chdir(m.Dir); err != nil {
+			return fmt.Errorf("entering %s: %w", m.Dir, err)
+		}
+		err := Run(memberOpts)
+		if cdErr := os.Chdir(root); cdErr != nil {
+			return fmt.Errorf("returning to %s: %w", root, cdErr)
+		}
+		for _, r := range memberResults {
+			r.Target = filepath.Join(m.Dir, r.Target)
+			results = append(results, r)
+		}
+		if err != nil && len(memberResults) == 0 {
+			// Failed before reaching any of its directories
+			fmt.Fprintf(opts.stdout(), "[error] %s: %v\n", m.Dir, err)
+			results = append(results, targetResult{Target: m.Dir, Outcome: outcomeFailed, Error: err.Error()})
+		}
+	}
+	return finishBatch("cirby merge", results, opts)
+}
+
+// validateMember checks that a cirby.work member is a directory. Unlike
+// --path, members may live outside the workspace root.
+func validateMember(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%s: member %w", workspaceFile, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: member %s is not a directory", workspaceFile, dir)
+	}
+	return nil
+}
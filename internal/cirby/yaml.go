@@ -0,0 +1,421 @@
+package cirby
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML used by tool config files: block
+// mappings and sequences, flow sequences and mappings, quoted and plain
+// scalars, literal (|) and folded (>) block scalars, and comments.
+// Mappings decode to map[string]any, sequences to []any and scalars to
+// string; an empty value is nil. Anchors, tags and multi-document
+// streams are not supported.
+func parseYAML(data []byte) (any, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+	p := &yamlParser{lines: strings.Split(text, "\n")}
+
+	p.skipEmpty()
+	if p.pos < len(p.lines) && strings.TrimSpace(p.lines[p.pos]) == "---" {
+		p.pos++
+	}
+	value, err := p.parseNode(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipEmpty()
+	if p.pos < len(p.lines) && strings.TrimSpace(p.lines[p.pos]) != "..." {
+		return nil, p.errorf("unexpected content %q", strings.TrimSpace(p.lines[p.pos]))
+	}
+	return value, nil
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("yaml line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// skipEmpty advances past blank and comment-only lines
+func (p *yamlParser) skipEmpty() {
+	for p.pos < len(p.lines) {
+		trimmed := strings.TrimSpace(stripYAMLComment(p.lines[p.pos]))
+		if trimmed != "" {
+			return
+		}
+		p.pos++
+	}
+}
+
+// current returns the indentation and comment-free content of the next
+// meaningful line, or ok=false at the end of input
+func (p *yamlParser) current() (indent int, content string, ok bool) {
+	p.skipEmpty()
+	if p.pos >= len(p.lines) {
+		return 0, "", false
+	}
+	line := strings.TrimRight(stripYAMLComment(p.lines[p.pos]), " \t")
+	if line == "..." {
+		return 0, "", false // end of the document
+	}
+	if strings.Contains(line[:len(line)-len(strings.TrimLeft(line, " \t"))], "\t") {
+		return 0, "", false
+	}
+	content = strings.TrimLeft(line, " ")
+	return len(line) - len(content), content, true
+}
+
+func isSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// parseNode parses the block starting at the next line, which must be
+// indented at least minIndent
+func (p *yamlParser) parseNode(minIndent int) (any, error) {
+	indent, content, ok := p.current()
+	if !ok || indent < minIndent {
+		return nil, nil
+	}
+	if isSequenceItem(content) {
+		return p.parseSequence(indent)
+	}
+	if _, _, isPair := splitYAMLPair(content); isPair {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return parseYAMLScalar(content)
+}
+
+func (p *yamlParser) parseSequence(indent int) ([]any, error) {
+	items := []any{}
+	for {
+		ind, content, ok := p.current()
+		if !ok || ind != indent || !isSequenceItem(content) {
+			return items, nil
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(content, "-"))
+
+		if rest == "" {
+			p.pos++
+			item, err := p.parseNode(indent + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		// "- key: value" starts a mapping indented to the item content;
+		// rewrite the line so it parses like any other nested block
+		offset := indent + len(content) - len(strings.TrimLeft(strings.TrimPrefix(content, "-"), " "))
+		if _, _, isPair := splitYAMLPair(rest); isPair || isSequenceItem(rest) {
+			p.lines[p.pos] = strings.Repeat(" ", offset) + rest
+			item, err := p.parseNode(offset)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		item, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		p.pos++
+		items = append(items, item)
+	}
+}
+
+func (p *yamlParser) parseMapping(indent int) (map[string]any, error) {
+	m := map[string]any{}
+	for {
+		ind, content, ok := p.current()
+		if !ok || ind < indent {
+			return m, nil
+		}
+		if ind > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+		if isSequenceItem(content) {
+			return m, nil
+		}
+
+		key, value, isPair := splitYAMLPair(content)
+		if !isPair {
+			return nil, p.errorf("expected \"key: value\", got %q", content)
+		}
+
+		switch {
+		case value == "":
+			// Nested block, or a sequence at the same indentation as the key
+			p.pos++
+			next, nextContent, ok := p.current()
+			var child any
+			var err error
+			if ok && next == indent && isSequenceItem(nextContent) {
+				child, err = p.parseSequence(indent)
+			} else {
+				child, err = p.parseNode(indent + 1)
+			}
+			if err != nil {
+				return nil, err
+			}
+			m[key] = child
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			p.pos++
+			m[key] = p.parseBlockScalar(indent, value)
+		default:
+			scalar, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			p.pos++
+			m[key] = scalar
+		}
+	}
+}
+
+// parseBlockScalar reads a literal (|) or folded (>) scalar whose lines
+// are indented deeper than parentIndent
+func (p *yamlParser) parseBlockScalar(parentIndent int, header string) string {
+	folded := header[0] == '>'
+	chomp := strings.TrimLeft(header[1:], "0123456789")
+
+	var lines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		raw := strings.TrimRight(p.lines[p.pos], " \t")
+		if raw == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		ind := len(raw) - len(strings.TrimLeft(raw, " "))
+		if ind <= parentIndent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = ind
+		}
+		if ind < blockIndent {
+			break
+		}
+		lines = append(lines, raw[blockIndent:])
+		p.pos++
+	}
+
+	// Trailing blank lines belong to the chomping indicator, not the text
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+
+	var text string
+	if folded {
+		var b strings.Builder
+		for i, line := range lines {
+			switch {
+			case i == 0, lines[i-1] == "":
+			case line == "":
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+
+	switch chomp {
+	case "-":
+		return text
+	case "+":
+		return text + "\n" + strings.Repeat("\n", trailing)
+	}
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
+
+// splitYAMLPair splits "key: value" outside of quotes and brackets
+func splitYAMLPair(content string) (key, value string, ok bool) {
+	if strings.HasPrefix(content, "[") || strings.HasPrefix(content, "{") {
+		return "", "", false
+	}
+	var quote byte
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 {
+				quote = c
+			}
+		case c == ':' && (i+1 == len(content) || content[i+1] == ' ' || content[i+1] == '\t'):
+			key = strings.TrimSpace(content[:i])
+			if unquoted, err := parseYAMLScalar(key); err == nil {
+				if s, isString := unquoted.(string); isString {
+					key = s
+				}
+			}
+			return key, strings.TrimSpace(content[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing "# comment" outside of quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' || strings.ContainsRune("[{,:-", rune(line[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func parseYAMLScalar(s string) (any, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "" || s == "~" || s == "null":
+		return nil, nil
+	case strings.HasPrefix(s, `"`):
+		if !strings.HasSuffix(s, `"`) || len(s) < 2 {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			// YAML allows escapes Go does not know; keep the raw text
+			return s[1 : len(s)-1], nil
+		}
+		return unquoted, nil
+	case strings.HasPrefix(s, "'"):
+		if !strings.HasSuffix(s, "'") || len(s) < 2 {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated sequence %s", s)
+		}
+		items := []any{}
+		for _, part := range splitYAMLFlow(s[1 : len(s)-1]) {
+			item, err := parseYAMLScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case strings.HasPrefix(s, "{"):
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("unterminated mapping %s", s)
+		}
+		m := map[string]any{}
+		for _, part := range splitYAMLFlow(s[1 : len(s)-1]) {
+			key, value, ok := splitYAMLPair(part)
+			if !ok {
+				return nil, fmt.Errorf("expected \"key: value\" in %s", s)
+			}
+			item, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = item
+		}
+		return m, nil
+	}
+	return s, nil
+}
+
+// splitYAMLFlow splits the inside of a flow collection on top-level commas
+func splitYAMLFlow(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// yamlStrings reads a value that may be a single string or a list of strings
+func yamlStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// yamlString returns v as a string, or "" when it is not a scalar
+func yamlString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// yamlBool interprets the usual YAML spellings of booleans
+func yamlBool(v any) (value, ok bool) {
+	switch strings.ToLower(yamlString(v)) {
+	case "true", "yes", "on":
+		return true, true
+	case "false", "no", "off":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,143 @@
+package cirby
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want any
+	}{
+		{
+			name: "mapping of scalars",
+			in:   "name: cirby\nversion: 2\nempty:\n",
+			want: map[string]any{"name": "cirby", "version": "2", "empty": nil},
+		},
+		{
+			name: "quoted scalars and comments",
+			in:   "# settings\na: \"x # not a comment\"  # comment\nb: 'it''s'\nc: \"tab\\tstop\"\n",
+			want: map[string]any{"a": "x # not a comment", "b": "it's", "c": "tab\tstop"},
+		},
+		{
+			name: "nested mappings",
+			in:   "backups:\n  keep: 50\n  max_age: 720h\n",
+			want: map[string]any{"backups": map[string]any{"keep": "50", "max_age": "720h"}},
+		},
+		{
+			name: "sequence at the key's indentation",
+			in:   "globs:\n- '*.go'\n- docs/**\n",
+			want: map[string]any{"globs": []any{"*.go", "docs/**"}},
+		},
+		{
+			name: "sequence of mappings",
+			in:   "plugins:\n  - name: wiki\n    command: ./wiki --space ENG\n  - name: db\n    command: ./db\n",
+			want: map[string]any{"plugins": []any{
+				map[string]any{"name": "wiki", "command": "./wiki --space ENG"},
+				map[string]any{"name": "db", "command": "./db"},
+			}},
+		},
+		{
+			name: "flow collections",
+			in:   "tools: [Bash, \"Read, Write\", []]\nenv: {A: 1, B: 'two'}\n",
+			want: map[string]any{
+				"tools": []any{"Bash", "Read, Write", []any{}},
+				"env":   map[string]any{"A": "1", "B": "two"},
+			},
+		},
+		{
+			name: "literal block scalar",
+			in:   "prompt: |\n  line one\n    indented\n\n  line three\nnext: x\n",
+			want: map[string]any{"prompt": "line one\n  indented\n\nline three\n", "next": "x"},
+		},
+		{
+			name: "folded block scalar, stripped",
+			in:   "text: >-\n  one\n  two\n\n  three\n",
+			want: map[string]any{"text": "one two\nthree"},
+		},
+		{
+			name: "kept trailing newlines",
+			in:   "text: |+\n  one\n\n\nnext: x\n",
+			want: map[string]any{"text": "one\n\n\n", "next": "x"},
+		},
+		{
+			name: "frontmatter markers and CRLF",
+			in:   "\ufeff---\r\ndescription: Review code\r\nalwaysApply: true\r\n...\r\n",
+			want: map[string]any{"description": "Review code", "alwaysApply": "true"},
+		},
+		{
+			name: "top-level sequence",
+			in:   "- a\n- - b\n  - c\n",
+			want: []any{"a", []any{"b", "c"}},
+		},
+		{
+			name: "null spellings",
+			in:   "a: ~\nb: null\n",
+			want: map[string]any{"a": nil, "b": nil},
+		},
+		{
+			name: "empty document",
+			in:   "# nothing\n\n",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"unterminated string", "a: \"open\n", "yaml line 1: unterminated string"},
+		{"unterminated sequence", "a: [1, 2\n", "yaml line 1: unterminated sequence"},
+		{"bad indentation", "a: 1\n  b: 2\n", "yaml line 2: unexpected indentation"},
+		{"not a pair", "a: 1\njust text\n", "yaml line 2: expected \"key: value\""},
+		{"trailing content", "- a\nb: 1\n", "yaml line 2: unexpected content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.in))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseYAML error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLBool(t *testing.T) {
+	tests := []struct {
+		in        any
+		value, ok bool
+	}{
+		{"true", true, true},
+		{"Yes", true, true},
+		{"on", true, true},
+		{"false", false, true},
+		{"NO", false, true},
+		{"off", false, true},
+		{"maybe", false, false},
+		{nil, false, false},
+		{[]any{"true"}, false, false},
+	}
+	for _, tt := range tests {
+		value, ok := yamlBool(tt.in)
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("yamlBool(%#v) = %v, %v; want %v, %v", tt.in, value, ok, tt.value, tt.ok)
+		}
+	}
+}
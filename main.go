@@ -1,70 +1,582 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/poshboytl/cirby/internal/cirby"
 )
 
 const version = "0.2.0"
 
+// commands are cirby's subcommands, run with the positional arguments that
+// follow their name. Anything else is a merge: bare `cirby`, `cirby claude`
+// and `cirby ./frontend` work as they always did.
+var commands = map[string]func(args []string, opts cirby.Options) error{
+	"merge": runMerge,
+	"link": func(args []string, opts cirby.Options) error {
+		for _, dir := range args {
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+		}
+		opts.Paths = append(opts.Paths, args...)
+		opts.LinkOnly = true
+		return cirby.Run(opts)
+	},
+	"status": func(args []string, opts cirby.Options) error {
+		opts.Verbose = true
+		return cirby.Check(opts)
+	},
+	"check":   func(args []string, opts cirby.Options) error { return cirby.Check(opts) },
+	"history": func(args []string, opts cirby.Options) error { return cirby.History(opts) },
+	"undo": func(args []string, opts cirby.Options) error {
+		steps := 1
+		if len(args) > 0 {
+			var err error
+			if steps, err = strconv.Atoi(args[0]); err != nil {
+				return fmt.Errorf("invalid number of steps: %s", args[0])
+			}
+		}
+		return cirby.Undo(steps, opts)
+	},
+	"adopt":       func(args []string, opts cirby.Options) error { return cirby.Adopt(arg(args, 0), opts) },
+	"sync-remote": func(args []string, opts cirby.Options) error { return cirby.SyncRemote(opts) },
+	"validate":    func(args []string, opts cirby.Options) error { return cirby.Validate(args, opts) },
+	"stats":       func(args []string, opts cirby.Options) error { return cirby.Stats(opts) },
+	"compare":     func(args []string, opts cirby.Options) error { return cirby.Compare(args, opts) },
+	"bench":       func(args []string, opts cirby.Options) error { return cirby.Bench(args, opts) },
+	"rollout": func(args []string, opts cirby.Options) error {
+		opts.Agent = agentArg(args, 0, opts)
+		return cirby.Rollout(opts)
+	},
+	"explain": func(args []string, opts cirby.Options) error { return cirby.Explain(arg(args, 0), opts) },
+	"generate": func(args []string, opts cirby.Options) error {
+		opts.Agent = agentArg(args, 0, opts)
+		return cirby.Generate(opts)
+	},
+	"init":  func(args []string, opts cirby.Options) error { return cirby.Init(opts) },
+	"split": func(args []string, opts cirby.Options) error { return cirby.Split(arg(args, 0), opts) },
+	"replay": func(args []string, opts cirby.Options) error {
+		return cirby.Replay(arg(args, 0), agentArg(args, 1, opts), opts)
+	},
+	"diff":    func(args []string, opts cirby.Options) error { return cirby.Diff(arg(args, 0), opts) },
+	"preview": func(args []string, opts cirby.Options) error { return cirby.Preview(arg(args, 0), opts) },
+	"auth": func(args []string, opts cirby.Options) error {
+		return cirby.Auth(arg(args, 0), args[min(len(args), 1):], opts)
+	},
+	"mcp":      func(args []string, opts cirby.Options) error { return cirby.ServeMCP() },
+	"daemon":   func(args []string, opts cirby.Options) error { return cirby.Daemon(opts) },
+	"rpc":      func(args []string, opts cirby.Options) error { return cirby.ServeRPC(opts) },
+	"upgrade":  func(args []string, opts cirby.Options) error { return cirby.Upgrade(opts) },
+	"sync-mcp": func(args []string, opts cirby.Options) error { return cirby.SyncMCP(opts) },
+	"sync-commands": func(args []string, opts cirby.Options) error {
+		return cirby.SyncCommands(opts)
+	},
+	"sync-ignore": func(args []string, opts cirby.Options) error { return cirby.SyncIgnore(opts) },
+	"settings":    func(args []string, opts cirby.Options) error { return cirby.Settings(arg(args, 0), opts) },
+	"cache":       func(args []string, opts cirby.Options) error { return cirby.Cache(arg(args, 0), opts) },
+	"config":      func(args []string, opts cirby.Options) error { return cirby.Config(arg(args, 0), opts) },
+	"telemetry": func(args []string, opts cirby.Options) error {
+		return cirby.Telemetry(arg(args, 0), args[min(len(args), 1):], opts)
+	},
+	"backups": func(args []string, opts cirby.Options) error {
+		return cirby.Backups(arg(args, 0), args[min(len(args), 1):], opts)
+	},
+}
+
+// maxArgs is how many positional arguments the commands that take a fixed
+// number accept; the others take a list
+var maxArgs = map[string]int{
+	"status": 0, "check": 0, "history": 0, "undo": 1, "adopt": 1, "sync-remote": 0,
+	"stats": 0, "rollout": 1, "explain": 1, "generate": 1, "init": 0, "split": 1,
+	"replay": 2, "diff": 1, "preview": 1, "auth": 2, "mcp": 0, "daemon": 0,
+	"rpc": 0, "upgrade": 0, "sync-mcp": 0, "sync-commands": 0, "sync-ignore": 0,
+	"settings": 1, "cache": 1, "config": 1, "telemetry": 2,
+}
+
 func main() {
-	args := os.Args[1:]
+	cirby.Version = version
+	opts, positional := parseArgs(os.Args[1:])
+	opts, err := cirby.ResolveOptions(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, cirby.Translate("Error: %v\n"), err)
+		os.Exit(1)
+	}
+
+	run, args := runMerge, positional
+	if len(positional) > 0 {
+		if cmd, ok := commands[positional[0]]; ok {
+			run, args = cmd, positional[1:]
+			if n, ok := maxArgs[positional[0]]; ok && len(args) > n {
+				fmt.Fprintf(os.Stderr, "%s\n", argsError(positional[0], n, args[n]))
+				printHelp()
+				os.Exit(1)
+			}
+		}
+	}
+	if err := run(args, opts); err != nil {
+		fmt.Fprintf(os.Stderr, cirby.Translate("Error: %v\n"), err)
+		os.Exit(1)
+	}
+}
+
+// runMerge merges with the agent named first, if any, into each directory
+// that follows (default: the current one)
+func runMerge(args []string, opts cirby.Options) error {
+	for i, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			opts.Paths = append(opts.Paths, arg)
+		} else if i == 0 {
+			opts.Agent = agentArg(args, 0, opts)
+		} else {
+			return fmt.Errorf("%s is not a directory", arg)
+		}
+	}
+	return cirby.Run(opts)
+}
+
+// arg returns the i-th positional argument, or "" when there are fewer
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
+
+// agentArg returns the agent named by the i-th positional argument or by
+// --agent, and exits if they disagree
+func agentArg(args []string, i int, opts cirby.Options) string {
+	name := arg(args, i)
+	if name != "" && slices.Contains(opts.Flags, "agent") && name != opts.Agent {
+		fmt.Fprintf(os.Stderr, "Error: two agents given: %s and --agent %s\n", name, opts.Agent)
+		os.Exit(1)
+	}
+	if name == "" {
+		return opts.Agent
+	}
+	return name
+}
 
-	// Parse flags and agent
+// parseArgs parses flags and returns the remaining positional arguments.
+// Flags may come before, after or between them, as --flag value or
+// --flag=value; everything after -- goes to the agent CLI as it is.
+func parseArgs(args []string) (cirby.Options, []string) {
 	opts := cirby.Options{
-		DryRun:  false,
-		Force:   false,
-		Verbose: false,
-		Agent:   "",
-	}
-
-	for _, arg := range args {
-		switch arg {
-		case "--dry-run", "-n":
-			opts.DryRun = true
-		case "--force", "-f":
-			opts.Force = true
-		case "--verbose", "-v":
-			opts.Verbose = true
-		case "--version":
-			fmt.Printf("cirby v%s\n", version)
+		LinkMode: "symlink",
+		Output:   "AGENTS.md",
+	}
+	if i := slices.Index(args, "--"); i >= 0 {
+		opts.AgentArgs = args[i+1:]
+		args = args[:i]
+	}
+
+	fs := flag.NewFlagSet("cirby", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	// Short and alternative names, by the long name they stand for
+	longName := map[string]string{"dir": "path"}
+	boolFlag := func(p *bool, names ...string) {
+		for _, name := range names {
+			fs.BoolVar(p, name, false, "")
+			longName[name] = names[0]
+		}
+	}
+	stringFlag := func(p *string, names ...string) {
+		for _, name := range names {
+			fs.StringVar(p, name, *p, "")
+			longName[name] = names[0]
+		}
+	}
+	boolFlag(&opts.DryRun, "dry-run", "n")
+	boolFlag(&opts.Force, "force", "f")
+	boolFlag(&opts.Verbose, "verbose", "v")
+	boolFlag(&opts.Recursive, "recursive", "r")
+	boolFlag(&opts.NoCache, "no-cache")
+	boolFlag(&opts.FullMerge, "full")
+	boolFlag(&opts.NoSections, "no-sections")
+	boolFlag(&opts.NoHeader, "no-header")
+	boolFlag(&opts.Reproducible, "reproducible")
+	boolFlag(&opts.SavePrompt, "save-prompt")
+	boolFlag(&opts.Interactive, "interactive", "i")
+	boolFlag(&opts.Review, "review")
+	boolFlag(&opts.Edit, "edit")
+	boolFlag(&opts.CheckOnly, "check-only")
+	boolFlag(&opts.Raw, "raw")
+	boolFlag(&opts.Plain, "plain")
+	boolFlag(&opts.FailOnSecrets, "fail-on-secrets")
+	boolFlag(&opts.Offline, "offline")
+	boolFlag(&opts.Dedup, "dedup")
+	boolFlag(&opts.Strict, "strict")
+	boolFlag(&opts.Choose, "choose")
+	boolFlag(&opts.Resolved, "resolved")
+	stringFlag(&opts.LinkMode, "link-mode")
+	stringFlag(&opts.Output, "output", "o")
+	stringFlag(&opts.Agent, "agent")
+	stringFlag(&opts.Template, "template")
+	stringFlag(&opts.Report, "report")
+	stringFlag(&opts.MaxLength, "max-length")
+	stringFlag(&opts.Model, "model")
+	stringFlag(&opts.Org, "org")
+	stringFlag(&opts.Repos, "repos")
+	stringFlag(&opts.Cassette, "cassette")
+	for _, name := range []string{"path", "dir"} {
+		fs.Func(name, "", func(value string) error {
+			opts.Paths = append(opts.Paths, value)
+			return nil
+		})
+	}
+	fs.Func("temperature", "", func(value string) error {
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil || temperature < 0 || temperature > 2 {
+			return errors.New("0 to 2")
+		}
+		opts.Temperature = &temperature
+		return nil
+	})
+	fs.Func("max-tokens", "", func(value string) error {
+		tokens, err := strconv.Atoi(value)
+		if err != nil || tokens <= 0 {
+			return errors.New("a positive number")
+		}
+		opts.MaxTokens = tokens
+		return nil
+	})
+	fs.Func("reasoning-effort", "", func(value string) error {
+		if value != "low" && value != "medium" && value != "high" {
+			return errors.New("low, medium or high")
+		}
+		opts.ReasoningEffort = value
+		return nil
+	})
+	fs.Func("cassette-mode", "", func(value string) error {
+		if value != "auto" && value != "record" && value != "replay" {
+			return errors.New("auto, record or replay")
+		}
+		opts.CassetteMode = value
+		return nil
+	})
+	fs.Func("line-endings", "", func(value string) error {
+		if value != "auto" && value != "lf" && value != "crlf" {
+			return errors.New("auto, lf or crlf")
+		}
+		opts.LineEndings = value
+		return nil
+	})
+	fs.Func("timeout", "", func(value string) error {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return errors.New("a duration such as 90s or 10m")
+		}
+		opts.Timeout = timeout
+		return nil
+	})
+	fs.Func("max-cost", "", func(value string) error {
+		cost, err := strconv.ParseFloat(strings.TrimPrefix(value, "$"), 64)
+		if err != nil || cost < 0 {
+			return errors.New("an amount in USD such as 0.50")
+		}
+		opts.MaxCost = cost
+		return nil
+	})
+	showVersion := false
+	boolFlag(&showVersion, "version")
+
+	args = splitShortFlags(fs, args)
+
+	// The flag package stops at the first positional argument; carry on
+	// after it so flags can follow the agent name or a command
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			printHelp()
 			os.Exit(0)
-		case "--help", "-h":
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", flagError(err, args))
 			printHelp()
+			os.Exit(1)
+		}
+		if showVersion {
+			fmt.Printf("cirby v%s\n", version)
 			os.Exit(0)
-		default:
-			if arg[0] == '-' {
-				fmt.Fprintf(os.Stderr, "Unknown option: %s\n", arg)
-				printHelp()
-				os.Exit(1)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	fs.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if long, ok := longName[name]; ok {
+			name = long
+		}
+		opts.Flags = append(opts.Flags, name)
+	})
+	return opts, positional
+}
+
+// splitShortFlags spells out combined single-letter options: -nv is -n
+// -v, and -vo FILE or -voFILE is -v -o FILE. Anything that is not made of
+// single-letter options, such as -force, is left as it is.
+func splitShortFlags(fs *flag.FlagSet, args []string) []string {
+	var out []string
+	for _, a := range args {
+		if len(a) <= 2 || a[0] != '-' || a[1] == '-' || strings.Contains(a, "=") {
+			out = append(out, a)
+			continue
+		}
+		var expanded []string
+		for i := 1; i < len(a); i++ {
+			f := fs.Lookup(a[i : i+1])
+			if f == nil {
+				expanded = nil
+				break
+			}
+			expanded = append(expanded, "-"+a[i:i+1])
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				// Takes a value: the rest, or the next argument
+				if i+1 < len(a) {
+					expanded = append(expanded, a[i+1:])
+				}
+				break
 			}
-			// Positional argument = agent name
-			opts.Agent = arg
+		}
+		if expanded == nil || fs.Lookup(a[1:]) != nil {
+			out = append(out, a)
+		} else {
+			out = append(out, expanded...)
 		}
 	}
+	return out
+}
 
-	if err := cirby.Run(opts); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+// flagError rewords the flag package's errors in cirby's own terms, with
+// options spelled --name
+func flagError(err error, args []string) string {
+	msg := err.Error()
+	if name, ok := strings.CutPrefix(msg, "flag provided but not defined: -"); ok {
+		// As typed, which may be -name as well as --name
+		for _, a := range args {
+			if option, _, _ := strings.Cut(a, "="); strings.TrimLeft(option, "-") == name {
+				return "Unknown option: " + option
+			}
+		}
+		return "Unknown option: " + dashes(name)
+	}
+	if name, ok := strings.CutPrefix(msg, "flag needs an argument: -"); ok {
+		return fmt.Sprintf("Option %s requires a value", dashes(name))
+	}
+	// invalid value "3" for flag -temperature: 0 to 2
+	if rest, ok := strings.CutPrefix(msg, "invalid value "); ok {
+		if value, rest, ok := strings.Cut(rest, " for flag -"); ok {
+			name, reason, _ := strings.Cut(rest, ": ")
+			if strings.HasPrefix(reason, "parse error") {
+				reason = "true or false"
+			}
+			return fmt.Sprintf("Invalid %s: %s (%s)", dashes(name), strings.Trim(value, `"`), reason)
+		}
+	}
+	return msg
+}
+
+// argsError reports an argument beyond the n that command takes, in the
+// words of flagError
+func argsError(command string, n int, extra string) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("Unexpected argument: %s (cirby %s takes none)", extra, command)
+	case 1:
+		return fmt.Sprintf("Unexpected argument: %s (cirby %s takes one)", extra, command)
 	}
+	return fmt.Sprintf("Unexpected argument: %s (cirby %s takes at most %d)", extra, command, n)
+}
+
+// dashes spells an option the way the help does: -o, --output
+func dashes(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
 }
 
 func printHelp() {
 	fmt.Println(`cirby - Merge AI coding agent configs into AGENTS.md
 
-Usage: cirby [agent] [options]
+Usage: cirby [merge] [agent] [dir...] [options]
+       cirby <command> [args...] [options]
+
+Options go before, after or between arguments, as --option value or
+--option=value; single-letter ones combine: -nv is -n -v.
 
 Arguments:
   agent              Agent to use for smart merge:
                      claude, opencode, gemini, cursor, codex, aider
+                     anthropic, openai (HTTP APIs, need ANTHROPIC_API_KEY,
+                     OPENAI_API_KEY or cirby auth login; never auto-detected)
+                     ollama (local server at OLLAMA_HOST, model OLLAMA_MODEL)
+                     builtin (deterministic merge without AI)
+                     mock (appends sources verbatim; for tests and demos)
                      If not specified, auto-detects available agents
+  dir...             Directories to merge, each into its own AGENTS.md, with
+                     the same agent (default: the current directory, or every
+                     member listed in cirby.work)
+
+Commands:
+  merge [agent] [dir...]
+                     Merge the configs into AGENTS.md (the default command)
+  link [dir...]      Link the configs already merged into AGENTS.md, without
+                     invoking an agent; files with unmerged changes are left
+  status             Show whether each AGENTS.md is in sync with its sources
+                     and what wrote it; check -v
+  init               Write a first AGENTS.md from a built-in template (--template
+                     go, node, python or monorepo; default: detected), with the
+                     project's build and test commands filled in
+  generate [agent]   Draft a first AGENTS.md from the build files, CI, layout
+                     and README, for projects without agent configs
+  history            List recorded runs (with -v: inputs and snapshots)
+  undo [steps]       Revert the last run, or the last N runs
+  backups [list]     List the files each recorded run can restore
+  backups prune      Remove runs beyond backups.keep or backups.max_age
+  backups restore ID [PATH...]
+                     Write back files as they were before run ID
+  cache [clean]      Show where cached merges, history and agent logs are
+                     kept (the user cache directory), or remove them all
+  config show        Show the defaults: of .cirby.yaml and the global config;
+                     with --resolved, every option's value and where it came
+                     from (flag, CIRBY_* variable, config file or default)
+  telemetry on [url] Opt in to anonymous usage metrics (off, status)
+  adopt [ref]        Three-way merge an upstream AGENTS.md (URL, file or
+                     owner/repo) into the local one; reuses the last ref
+  sync-remote        Pull the shared fragments configured in .cirby.yaml into
+                     AGENTS.md and record the revision in .cirby.lock
+  check              Fail if AGENTS.md was edited outside cirby or its sources
+                     changed since the last merge (recorded in .cirby.lock)
+  validate [file...] Check AGENTS.md (or each file) against the lint: rules
+                     and structure: requirements of .cirby.yaml
+  diff [run]         Show a recorded run (default: the latest) side by side,
+                     with how much of each source the result covers
+  replay <run> [agent]
+                     Send a run's saved prompt again, with its agent or another,
+                     in a copy of its sources under .cirby/replay; shows the
+                     result next to the recorded one
+  stats              Show each source file's and AGENTS.md's size, estimated
+                     tokens, headings and last change, largest first
+  compare <a> <b>    Merge with each agent into .cirby/compare/<agent>.md and
+                     show a diff and quality scores; AGENTS.md is untouched
+  bench [agent...]   Time the same synthetic merge with each agent (default:
+                     all available) and show tokens, cost and quality
+  rollout [agent]    Clone each repository of --repos FILE (owner/name, or a
+                     name in --org ORG), merge it, and open a pull request
+                     from the cirby/agents-md branch (needs GITHUB_TOKEN)
+  explain [file]     Show which source file each AGENTS.md section's rules
+                     came from (--verbose: rule by rule)
+  split [file]       Move the largest AGENTS.md sections into docs/agents/*.md,
+                     leaving a summary and a link (split: in .cirby.yaml)
+  preview [file]     Show AGENTS.md (or file, - for stdin) formatted for the
+                     terminal (--raw: print it unformatted)
+  auth login <api>   Store an API backend key (anthropic, openai) in the OS
+                     keychain; also auth logout <api>, auth status
+  mcp                Serve cirby's tools over the Model Context Protocol (stdio)
+  daemon             Watch the repo and answer status, check and merge
+                     requests (JSON-RPC) on the .cirby/daemon.sock socket
+  rpc                Serve scan, check, merge and preview as JSON-RPC over
+                     stdio, for editor plugins
+  sync-mcp           Merge MCP server lists into .mcp.json and regenerate
+                     .cursor/mcp.json, .gemini/settings.json, .vscode/mcp.json
+  sync-commands      Merge custom slash commands into .cirby/commands and
+                     regenerate .claude, .gemini and .cursor command files
+  sync-ignore        Merge .aiderignore, .cursorignore, .codeiumignore and
+                     .geminiignore into .cirby/ignore and regenerate them
+  settings [export]  Compare agent permission and sandbox settings; export
+                     writes the unified view to .cirby/settings.json
+  upgrade            Update cirby to the latest release
+                     (--check-only: exit non-zero if outdated)
 
 Options:
   --dry-run, -n      Preview changes without modifying files
   --force, -f        Skip git uncommitted changes check
   --verbose, -v      Show detailed output
+  --recursive, -r    Also merge per-package configs in subdirectories
+  --link-mode MODE   How tool files point at AGENTS.md: symlink (default)
+                     or copy (writes expanded copies, resolving includes)
+  --line-endings EOL Line endings of AGENTS.md: auto (default, keep the
+                     existing file's, LF for a new one), lf or crlf
+  --output, -o FILE  Canonical file to merge into (default: AGENTS.md),
+                     e.g. docs/AGENTS.md or CONTRIBUTING-AI.md
+  --path, --dir DIR  Scan, merge and link only in DIR, as if run there
+                     (writes DIR/AGENTS.md); with -r, DIR and its packages.
+                     Repeat it, or list directories after the agent, to
+                     merge several in one run
+  --agent NAME       Agent to merge with, instead of naming it first
+  --choose           Ask which agent to use even if one was remembered for
+                     the project (in .cirby/agent)
+  --model NAME       Model for the agent (claude --model, gemini -m, codex -m,
+                     ...) or API backend to use instead of its default
+  --temperature T    Sampling temperature for API backends (0 to 2)
+  --max-tokens N     Longest reply of API backends, in tokens
+  --reasoning-effort low|medium|high
+                     How much the model thinks first (API backends, codex,
+                     aider); also settable under generation: in .cirby.yaml
+  --max-cost USD     Abort if the estimated merge cost exceeds this amount
+  --max-length N     Condense AGENTS.md when longer than N tokens (4000, 4k)
+                     or characters (16000c): with the agent, then by cutting
+  --template REF     Make the merge follow a team AGENTS.md template: a URL,
+                     a file, owner/repo[/path][@ref] on GitHub, or a built-in
+                     one (go, node, python, monorepo)
+  --report FORMAT    check, validate: also write a junit (cirby-junit.xml) or codequality
+                     (gl-code-quality-report.json) report; merges: a json
+                     (cirby-report.json) or markdown (cirby-report.md) table of
+                     each target's outcome; FORMAT=FILE to rename
+  --no-cache         Always run the agent, even for inputs merged before
+  --timeout DURATION API backends: give up after this long, including waits
+                     for rate limits (default: 10m)
+  --full             Re-merge changed sources in full instead of only the
+                     lines that changed since the last run
+  --dedup            After the merge, drop rules that repeat an earlier one in
+                     other words (embeddings from Ollama or dedup.command)
+  --strict           Fail, keeping the old AGENTS.md, when the merge result
+                     scores under quality.min_score (default: 70 of 100) or
+                     breaks the structure: or lint: rules of .cirby.yaml
+  --offline          Never use the network: only ollama on this machine or
+                     builtin merges; fail on templates, remotes and upgrades
+                     that need fetching, and send no telemetry
+  --fail-on-secrets  Abort instead of redacting when a prompt or a file the
+                     agent reads contains API keys, tokens or private keys
+  --no-sections      Do not add or refresh generated AGENTS.md sections
+  --no-header        Do not keep a "generated with cirby" comment at the top
+                     of AGENTS.md
+  --save-prompt      Write the prompt, the agent command and its environment to
+                     .cirby/last-prompt for debugging or bug reports
+  --cassette DIR     Replay agent results recorded in DIR for the same prompt
+                     and inputs, recording those not there yet
+  --cassette-mode M  auto (default), record (always run the agent and record
+                     over) or replay (never run it; fail if not recorded)
+  --reproducible     Use temperature 0 (and a fixed seed where supported) with
+                     API backends and normalize the formatting of the result,
+                     so identical inputs give an identical AGENTS.md
+  --review           Show the merge result side by side with the old AGENTS.md,
+                     plus source coverage, and ask before applying it
+  --edit             Open the merge result in $EDITOR; it is only applied and
+                     linked once saved and confirmed
+  --interactive, -i  Resolve merge conflicts (three-way merges, adopt) one by
+                     one: keep a side, both, edit, or leave it to the agent
+                     (such as the list of subagents)
+  -- ARGS...         Pass ARGS on to the agent CLI, after cirby's own
+                     arguments, e.g. cirby claude -- --max-turns 3
+  --plain            ASCII, line-oriented output without color, columns or
+                     box drawing, for screen readers and dumb terminals
+                     (automatic with TERM=dumb or when output is not a
+                     terminal)
   --version          Show version
   --help, -h         Show this help
 
@@ -73,9 +585,14 @@ Examples:
   cirby claude       # Use Claude Code for merge
   cirby gemini       # Use Gemini CLI for merge
   cirby --dry-run    # Preview what would be done
+  cirby -r           # Root AGENTS.md plus one per package (monorepos)
+  cirby --path services/api  # Merge only services/api into its AGENTS.md
+  cirby ./frontend ./backend # One AGENTS.md per directory, same agent
+  cirby undo 2       # Go back two runs
+  cirby claude -- --max-turns 3  # Forward flags to the agent CLI
 
 How it works:
-  1. Scans for agent config files (CLAUDE.md, GEMINI.md, .cursorrules, etc.)
+  1. Scans for agent config files (CLAUDE.md, GEMINI.md, CONVENTIONS.md, etc.)
   2. Uses an AI agent to intelligently merge content into AGENTS.md
   3. Creates symlinks so each tool finds its expected file
 